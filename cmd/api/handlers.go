@@ -8,7 +8,9 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/antsrp/balance_service/internal/adjustment"
 	"github.com/antsrp/balance_service/internal/service"
+	"github.com/antsrp/balance_service/internal/withdrawal"
 	"github.com/go-chi/chi"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
@@ -21,15 +23,19 @@ type URLPath struct {
 }
 
 type Handler struct {
-	logger  *zap.SugaredLogger
-	service *service.Service
+	logger             *zap.SugaredLogger
+	service            *service.Service
+	mockPayments       bool // route completing mock payments is registered
+	internalAddBalance bool // route crediting balance without approval is registered
 }
 
-func createNewHandler(logger *zap.Logger, s *service.Service) (*Handler, error) {
+func createNewHandler(logger *zap.Logger, s *service.Service, mockPayments, internalAddBalance bool) (*Handler, error) {
 
 	return &Handler{
-		logger:  logger.Sugar(),
-		service: s,
+		logger:             logger.Sugar(),
+		service:            s,
+		mockPayments:       mockPayments,
+		internalAddBalance: internalAddBalance,
 	}, nil
 }
 
@@ -41,11 +47,59 @@ func (h Handler) Routes() chi.Router {
 
 	r.Route("/", func(r chi.Router) {
 		r.Get("/api/v1/get-balance", h.getBalance)
-		r.Post("/api/v1/add-balance", h.addBalance)
+		if h.internalAddBalance { // credits balance without the second admin, so it is for internal services only
+			r.Post("/api/v1/add-balance", h.addBalance)
+		}
 		r.Post("/api/v1/reserve", h.reserveCash)
 		r.Put("/api/v1/get-revenue", h.getRevenue)
+		r.Post("/api/v1/reserve/order", h.reserveOrder)
+		r.Put("/api/v1/get-revenue/order", h.getOrderRevenue)
 		r.Get("/api/v1/operations", h.getOperations)
 		r.Get("/api/v1/summary", h.getSummary)
+		r.Get("/api/v1/summary/users", h.getUsersSummary)
+		r.Get("/api/v1/admin/reconciliation", h.reconcile)
+		r.Post("/api/v1/admin/reconciliation/repair", h.repairBalances)
+		r.Post("/api/v1/admin/reverse", h.reverseTransaction)
+		r.Post("/api/v1/refund", h.refundOrder)
+		r.Post("/api/v1/transfer", h.transfer)
+		r.Get("/api/v1/admin/exchange-rates", h.getExchangeRates)
+		r.Post("/api/v1/admin/exchange-rates", h.createExchangeRate)
+		r.Post("/api/v1/admin/credit-limit", h.setCreditLimit)
+		r.Post("/api/v1/admin/account-state", h.setAccountState)
+		r.Get("/api/v1/admin/spending-limits", h.getSpendingLimits)
+		r.Post("/api/v1/admin/spending-limits", h.setSpendingLimit)
+		r.Delete("/api/v1/admin/spending-limits", h.deleteSpendingLimit)
+		r.Get("/api/v1/admin/bonuses", h.getBonuses)
+		r.Post("/api/v1/admin/bonuses", h.grantBonus)
+		r.Post("/api/v1/admin/bonuses/expire", h.expireBonuses)
+		r.Get("/api/v1/admin/cashback-rules", h.getCashbackRules)
+		r.Post("/api/v1/admin/cashback-rules", h.createCashbackRule)
+		r.Delete("/api/v1/admin/cashback-rules", h.deleteCashbackRule)
+		r.Get("/api/v1/admin/fee-schedules", h.getFeeSchedules)
+		r.Post("/api/v1/admin/fee-schedules", h.setFeeSchedule)
+		r.Delete("/api/v1/admin/fee-schedules", h.deleteFeeSchedule)
+		r.Get("/api/v1/admin/prices", h.getPrices)
+		r.Post("/api/v1/admin/prices", h.createPrice)
+		r.Get("/api/v1/admin/coupons", h.getCoupons)
+		r.Post("/api/v1/admin/coupons", h.createCoupon)
+		r.Get("/api/v1/admin/vouchers", h.getVouchers)
+		r.Post("/api/v1/admin/vouchers", h.createVoucherBatch)
+		r.Post("/api/v1/vouchers/redeem", h.redeemVoucher)
+		r.Get("/api/v1/top-ups", h.getTopUps)
+		r.Post("/api/v1/top-ups", h.createTopUp)
+		r.Post("/api/v1/payments/callback", h.paymentCallback)
+		if h.mockPayments { // anybody could credit balance through it, so it is for development only
+			r.Post("/api/v1/payments/mock/complete", h.completeMockPayment)
+		}
+		r.Post("/api/v1/withdrawals", h.requestWithdrawal)
+		r.Get("/api/v1/admin/withdrawals", h.getWithdrawals)
+		r.Post("/api/v1/admin/withdrawals/approve", h.approveWithdrawal)
+		r.Post("/api/v1/admin/withdrawals/reject", h.rejectWithdrawal)
+		r.Get("/api/v1/admin/adjustments", h.getAdjustments)
+		r.Post("/api/v1/admin/adjustments", h.requestAdjustment)
+		r.Post("/api/v1/admin/adjustments/approve", h.approveAdjustment)
+		r.Post("/api/v1/admin/adjustments/reject", h.rejectAdjustment)
+		r.Post("/api/v1/admin/adjustments/expire", h.expireAdjustments)
 		r.Handle("/reports/*", http.StripPrefix("/reports/", fileServer))
 		r.Get("/swagger/*", httpSwagger.Handler(
 			httpSwagger.URL("/swagger/doc.json"),
@@ -69,9 +123,34 @@ func (h Handler) httpCodeByMessage(msg string, defaultCode int) int {
 	switch msg {
 	case service.OperationUnsuccessfulInternalError:
 		code = http.StatusInternalServerError
-	case service.DifferentCosts, service.InsufficientFunds:
+	case service.InvalidSignature:
+		code = http.StatusUnauthorized
+	case service.SameActor:
+		code = http.StatusForbidden
+	case service.DifferentCosts, service.DifferentCurrency, service.InsufficientFunds, service.AlreadyRefundedOrder, service.RefundExceedsCost,
+		service.RateNotFound, service.ConversionOverflow, service.SpendingLimitExceeded,
+		service.AccountFrozen, service.AccountClosed, service.AccountInUse, service.StateNotChanged,
+		service.PriceNotFound, service.PriceMismatch,
+		service.CouponExpired, service.CouponExhausted, service.CouponUserLimit, service.CouponNotApplicable,
+		service.VoucherRedeemed, service.VoucherExpired, service.TopUpStateConflict, service.WithdrawalDecided,
+		service.AdjustmentDecided, service.AdjustmentExpired:
 		code = http.StatusUnprocessableEntity
-	case service.OrderNotFound, service.UserNotFound, service.InvalidData, service.InvalidDate, service.OperationOfDifferentUser, service.AlreadyClosedTransaction:
+	case service.RateExists, service.PriceExists, service.CouponExists:
+		code = http.StatusConflict
+	case service.OrderNotFound, service.UserNotFound, service.InvalidData, service.InvalidCurrency, service.InvalidDate, service.OperationOfDifferentUser, service.AlreadyClosedTransaction,
+		service.ReasonRequired, service.TransactionNotFound, service.NotCompletedTransaction, service.AlreadyReversedTransaction, service.ReversalOfReversal,
+		service.OrderHasRefunds, service.NotRecognizedOrder, service.ReversedOrder, service.EmptyOrder, service.DuplicateOrderLine,
+		service.PayeeNotFound, service.PayeeIsPayer, service.OrderHasPayout, service.InvalidQuantity,
+		service.CouponCodeRequired, service.InvalidCouponKind, service.InvalidFixedDiscount, service.InvalidUsageLimit, service.CouponExpiry, service.CouponNotFound,
+		service.InvalidVoucherCount, service.VoucherExpiry, service.VoucherNotFound,
+		service.InvalidTopUpStatus, service.InvalidPaymentStatus, service.TopUpNotFound, service.MockProviderDisabled, service.PaymentsDisabled,
+		service.ActorRequired, service.InvalidWithdrawalStatus, service.WithdrawalNotFound,
+		service.InvalidAdjustmentDirection, service.InvalidReasonCode, service.InvalidAdjustmentStatus, service.AdjustmentNotFound,
+		service.SameCurrencies, service.InvalidRate, service.SameWallet, service.InvalidAmount, service.AmountPrecision, service.AmountOverflow, service.TransferReversal,
+		service.InvalidPeriod, service.LimitNotFound, service.InvalidState,
+		service.SourceRequired, service.InvalidExpiry, service.BonusReversal, service.AdjustmentReversal, service.WithdrawalReversal,
+		service.InvalidPercent, service.InvalidWindow, service.ServiceNotFound, service.RuleNotFound, service.OrderHasCashback,
+		service.InvalidFeeKind, service.InvalidFeePercent, service.InvalidFixedFee, service.InvalidTiers, service.ScheduleNotFound:
 		code = http.StatusBadRequest
 	default:
 		code = defaultCode
@@ -101,23 +180,25 @@ func (h Handler) writeResponse(w http.ResponseWriter, resp *service.Response, de
 }
 
 // @Summary Get user balance
-// @Description Get user balance by id
+// @Description Get user balance by id in the currency, balances in all currencies of user are returned if it is omitted
 // @Tags Routes
 // @Produce json
 // @Param user_id query string true "id of user"
+// @Param currency query string false "ISO 4217 code of currency"
 // @Success 200 {object} service.Response
 // @Failure 400,500 {object} service.Response
 // @Router /get-balance [get]
 func (h Handler) getBalance(w http.ResponseWriter, r *http.Request) {
 	user_id := r.URL.Query().Get("user_id")
+	currency := r.URL.Query().Get("currency")
 
-	resp := h.service.GetUserBalanceLogic(user_id)
+	resp := h.service.GetUserBalanceLogic(user_id, currency)
 
 	h.writeResponse(w, resp, http.StatusOK)
 }
 
 // @Summary Add user balance
-// @Description Add balance of user by the amount of "balance" parameter
+// @Description Add balance of user by the amount of "balance" parameter. For internal services only, available only with internal.add_balance set in configuration, manual credits by admins are made by adjustments, which are approved by the second admin
 // @Tags Routes
 // @Accept json
 // @Produce json
@@ -153,12 +234,13 @@ func (h Handler) getRevenue(w http.ResponseWriter, r *http.Request) {
 }
 
 // @Summary Reserve cash for operation
-// @Description Reserve cash for the subsequent operation
+// @Description Reserve cash for the subsequent operation. Cost of the quantity of service is calculated by its price in effect now, in server side pricing mode always.
+// @Description Discount of the coupon is taken off the cost
 // @Tags Routes
 // @Accept json
 // @Produce json
 // @Param input body models.ReserveRequest true "information of operation reserve"
-// @Success 202 {object} service.Response
+// @Success 202 {object} service.Response{data=service.ReservedLine}
 // @Failure 400,422,500 {object} service.Response
 // @Router /reserve [post]
 func (h Handler) reserveCash(w http.ResponseWriter, r *http.Request) {
@@ -170,8 +252,44 @@ func (h Handler) reserveCash(w http.ResponseWriter, r *http.Request) {
 	h.writeResponse(w, resp, http.StatusAccepted)
 }
 
+// @Summary Reserve cash for order of several services
+// @Description Reserve cash for every service of the order, all of them are reserved or none. Available funds are checked against the total cost
+// @Tags Routes
+// @Accept json
+// @Produce json
+// @Param input body models.OrderRequest true "order and its lines"
+// @Success 202 {object} service.Response{data=[]service.ReservedLine}
+// @Failure 400,422,500 {object} service.Response
+// @Router /reserve/order [post]
+func (h Handler) reserveOrder(w http.ResponseWriter, r *http.Request) {
+	body := h.readBody(r)
+	defer r.Body.Close()
+
+	resp := h.service.ReserveOrderLogic(body)
+
+	h.writeResponse(w, resp, http.StatusAccepted)
+}
+
+// @Summary Get revenue of order of several services
+// @Description Get revenue of every service of the order reserved before, all of them are recognized or none
+// @Tags Routes
+// @Accept json
+// @Produce json
+// @Param input body models.OrderRevenueRequest true "order and its lines to get revenue of"
+// @Success 202 {object} service.Response
+// @Failure 400,500 {object} service.Response
+// @Router /get-revenue/order [put]
+func (h Handler) getOrderRevenue(w http.ResponseWriter, r *http.Request) {
+	body := h.readBody(r)
+	defer r.Body.Close()
+
+	resp := h.service.RevenueOrderLogic(body)
+
+	h.writeResponse(w, resp, http.StatusOK)
+}
+
 // @Summary Get summary
-// @Description Get summary of revenue grouped by services
+// @Description Get summary of revenue grouped by currencies and services
 // @Tags Routes
 // @Produce json
 // @Param year query int true "year to collect the report"
@@ -204,6 +322,43 @@ func (h Handler) getSummary(w http.ResponseWriter, r *http.Request) {
 	h.writeResponse(w, resp, http.StatusOK)
 }
 
+// @Summary Get summary of users
+// @Description Get summary of revenue grouped by users
+// @Tags Routes
+// @Produce json
+// @Param year query int true "year to collect the report"
+// @Param month query int true "month to collect the report"
+// @Param sort query string false "user, spent, top_ups, orders"
+// @Param direction query string false "ASC, DESC"
+// @Success 200 {object} service.Response
+// @Failure 400,500 {object} service.Response
+// @Router /summary/users [get]
+func (h Handler) getUsersSummary(w http.ResponseWriter, r *http.Request) {
+
+	month, err := strconv.Atoi(r.URL.Query().Get("month"))
+	if err != nil {
+		h.writeResponse(w, &service.Response{Error: err, Message: service.InvalidData}, http.StatusBadRequest)
+		return
+	}
+	year, err := strconv.Atoi(r.URL.Query().Get("year"))
+	if err != nil {
+		h.writeResponse(w, &service.Response{Error: err, Message: service.InvalidData}, http.StatusBadRequest)
+		return
+	}
+	sort, direction := strings.Trim(r.URL.Query().Get("sort"), `\"`), strings.Trim(r.URL.Query().Get("direction"), `\"`)
+
+	resp := h.service.GetUsersSummaryLogic(year, month, sort, direction)
+	if resp.Error == nil {
+		url := URLPath{}
+		url.URL = fmt.Sprintf(`%s/reports/%s`, r.Host, resp.Data)
+		resp.Data = url
+	} else {
+		resp.Data = nil
+	}
+
+	h.writeResponse(w, resp, http.StatusOK)
+}
+
 // @Summary Get operations of user
 // @Description Show operations of interest to him
 // @Tags Routes
@@ -235,3 +390,703 @@ func (h Handler) getOperations(w http.ResponseWriter, r *http.Request) {
 	resp := h.service.GetOperations(id, page, sort, direction)
 	h.writeResponse(w, resp, http.StatusOK)
 }
+
+// @Summary Reconcile balances
+// @Description Recompute balances of users from transactions history and report mismatches
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} service.Response{data=reconciliation.Report}
+// @Failure 500 {object} service.Response
+// @Router /admin/reconciliation [get]
+func (h Handler) reconcile(w http.ResponseWriter, r *http.Request) {
+	resp := h.service.ReconcileLogic(false)
+
+	h.writeResponse(w, resp, http.StatusOK)
+}
+
+// @Summary Repair balances
+// @Description Reconcile balances and write adjusting entries for every mismatch
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} service.Response{data=reconciliation.Report}
+// @Failure 500 {object} service.Response
+// @Router /admin/reconciliation/repair [post]
+func (h Handler) repairBalances(w http.ResponseWriter, r *http.Request) {
+	resp := h.service.ReconcileLogic(true)
+
+	h.writeResponse(w, resp, http.StatusOK)
+}
+
+// @Summary Reverse transaction
+// @Description Reverse completed transaction by the linked opposite one, balance of user is adjusted atomically
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param input body models.ReversalRequest true "id of transaction to reverse and reason of reversal"
+// @Success 202 {object} service.Response{data=service.Reversal}
+// @Failure 400,422,500 {object} service.Response
+// @Router /admin/reverse [post]
+func (h Handler) reverseTransaction(w http.ResponseWriter, r *http.Request) {
+	body := h.readBody(r)
+	defer r.Body.Close()
+
+	resp := h.service.ReverseLogic(body)
+
+	h.writeResponse(w, resp, http.StatusAccepted)
+}
+
+// @Summary Refund order
+// @Description Return money of the order with recognized revenue to the user, the whole rest of cost is refunded if amount is zero or omitted
+// @Tags Routes
+// @Accept json
+// @Produce json
+// @Param input body models.RefundRequest true "user, service and order ids, amount of refund"
+// @Success 202 {object} service.Response{data=service.Refund}
+// @Failure 400,422,500 {object} service.Response
+// @Router /refund [post]
+func (h Handler) refundOrder(w http.ResponseWriter, r *http.Request) {
+	body := h.readBody(r)
+	defer r.Body.Close()
+
+	resp := h.service.RefundLogic(body)
+
+	h.writeResponse(w, resp, http.StatusAccepted)
+}
+
+// @Summary Transfer money
+// @Description Transfer money from the wallet of one user to the wallet of another one, amount is converted at the rate in effect at the time of transfer if to_currency differs from currency
+// @Tags Routes
+// @Accept json
+// @Produce json
+// @Param input body models.TransferRequest true "sender, recipient, amount and currencies of transfer"
+// @Success 202 {object} service.Response{data=transfer.Result}
+// @Failure 400,422,500 {object} service.Response
+// @Router /transfer [post]
+func (h Handler) transfer(w http.ResponseWriter, r *http.Request) {
+	body := h.readBody(r)
+	defer r.Body.Close()
+
+	resp := h.service.TransferLogic(body)
+
+	h.writeResponse(w, resp, http.StatusAccepted)
+}
+
+// @Summary Get exchange rates
+// @Description Get history of exchange rates of the currency pair, all pairs are returned if it is omitted
+// @Tags Admin
+// @Produce json
+// @Param base query string false "ISO 4217 code of base currency"
+// @Param quote query string false "ISO 4217 code of quote currency"
+// @Success 200 {object} service.Response{data=[]exchange.Rate}
+// @Failure 400,500 {object} service.Response
+// @Router /admin/exchange-rates [get]
+func (h Handler) getExchangeRates(w http.ResponseWriter, r *http.Request) {
+	base := r.URL.Query().Get("base")
+	quote := r.URL.Query().Get("quote")
+
+	resp := h.service.GetExchangeRatesLogic(base, quote)
+
+	h.writeResponse(w, resp, http.StatusOK)
+}
+
+// @Summary Create exchange rate
+// @Description Add rate of the currency pair in effect since effective_from (since now if omitted)
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param input body models.ExchangeRateRequest true "currency pair, rate and its effective date"
+// @Success 201 {object} service.Response{data=exchange.Rate}
+// @Failure 400,409,500 {object} service.Response
+// @Router /admin/exchange-rates [post]
+func (h Handler) createExchangeRate(w http.ResponseWriter, r *http.Request) {
+	body := h.readBody(r)
+	defer r.Body.Close()
+
+	resp := h.service.CreateExchangeRateLogic(body)
+
+	h.writeResponse(w, resp, http.StatusCreated)
+}
+
+// @Summary Set credit limit
+// @Description Set the amount the wallet of user may go negative by, zero limit disables credit. User and wallet are created if they don't exist
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param input body models.CreditLimitRequest true "user, currency and credit limit"
+// @Success 200 {object} service.Response{data=service.Balance}
+// @Failure 400,500 {object} service.Response
+// @Router /admin/credit-limit [post]
+func (h Handler) setCreditLimit(w http.ResponseWriter, r *http.Request) {
+	body := h.readBody(r)
+	defer r.Body.Close()
+
+	resp := h.service.SetCreditLimitLogic(body)
+
+	h.writeResponse(w, resp, http.StatusOK)
+}
+
+// @Summary Get spending limits
+// @Description Get spending limits of user along with amounts used in their current periods
+// @Tags Admin
+// @Produce json
+// @Param user_id query string true "id of user"
+// @Success 200 {object} service.Response{data=[]spending.Limit}
+// @Failure 400,500 {object} service.Response
+// @Router /admin/spending-limits [get]
+func (h Handler) getSpendingLimits(w http.ResponseWriter, r *http.Request) {
+	user_id := r.URL.Query().Get("user_id")
+
+	resp := h.service.GetSpendingLimitsLogic(user_id)
+
+	h.writeResponse(w, resp, http.StatusOK)
+}
+
+// @Summary Set spending limit
+// @Description Create daily or monthly spending limit of user on all services or on the single one, amount of the existing limit is changed
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param input body models.SpendingLimitRequest true "user, optional service, period, currency and amount of limit"
+// @Success 200 {object} service.Response{data=spending.Limit}
+// @Failure 400,500 {object} service.Response
+// @Router /admin/spending-limits [post]
+func (h Handler) setSpendingLimit(w http.ResponseWriter, r *http.Request) {
+	body := h.readBody(r)
+	defer r.Body.Close()
+
+	resp := h.service.SetSpendingLimitLogic(body)
+
+	h.writeResponse(w, resp, http.StatusOK)
+}
+
+// @Summary Delete spending limit
+// @Description Delete spending limit by id
+// @Tags Admin
+// @Produce json
+// @Param id query string true "id of limit"
+// @Success 200 {object} service.Response
+// @Failure 400,500 {object} service.Response
+// @Router /admin/spending-limits [delete]
+func (h Handler) deleteSpendingLimit(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+
+	resp := h.service.DeleteSpendingLimitLogic(id)
+
+	h.writeResponse(w, resp, http.StatusOK)
+}
+
+// @Summary Change state of account
+// @Description Freeze, unfreeze or close the account of user. Frozen account rejects reservations and transfers from it, closed account rejects any operation and must be empty to be closed
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param input body models.AccountStateRequest true "user, new state and reason of change"
+// @Success 200 {object} service.Response
+// @Failure 400,422,500 {object} service.Response
+// @Router /admin/account-state [post]
+func (h Handler) setAccountState(w http.ResponseWriter, r *http.Request) {
+	body := h.readBody(r)
+	defer r.Body.Close()
+
+	resp := h.service.SetAccountStateLogic(body)
+
+	h.writeResponse(w, resp, http.StatusOK)
+}
+
+// @Summary Get bonuses
+// @Description Get bonus buckets of user with remaining amounts and reservations they were spent on
+// @Tags Admin
+// @Produce json
+// @Param user_id query string true "id of user"
+// @Success 200 {object} service.Response{data=[]bonus.Bucket}
+// @Failure 400,500 {object} service.Response
+// @Router /admin/bonuses [get]
+func (h Handler) getBonuses(w http.ResponseWriter, r *http.Request) {
+	user_id := r.URL.Query().Get("user_id")
+
+	resp := h.service.GetBonusesLogic(user_id)
+
+	h.writeResponse(w, resp, http.StatusOK)
+}
+
+// @Summary Grant bonus
+// @Description Add bonus to the balance of user. Bonuses are spent on reservations before the rest of balance, can't be transferred and are written off at expiry
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param input body models.BonusRequest true "user, currency, amount, source and expiry of bonus"
+// @Success 200 {object} service.Response{data=bonus.Bucket}
+// @Failure 400,422,500 {object} service.Response
+// @Router /admin/bonuses [post]
+func (h Handler) grantBonus(w http.ResponseWriter, r *http.Request) {
+	body := h.readBody(r)
+	defer r.Body.Close()
+
+	resp := h.service.GrantBonusLogic(body)
+
+	h.writeResponse(w, resp, http.StatusOK)
+}
+
+// @Summary Expire bonuses
+// @Description Write off amounts left in expired bonus buckets, each by its own operation
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} service.Response{data=bonus.Expiry}
+// @Failure 500 {object} service.Response
+// @Router /admin/bonuses/expire [post]
+func (h Handler) expireBonuses(w http.ResponseWriter, r *http.Request) {
+	resp := h.service.ExpireBonusesLogic()
+
+	h.writeResponse(w, resp, http.StatusOK)
+}
+
+// @Summary Get cashback rules
+// @Description Get cashback rules of the service, rules of all services are returned if it is omitted
+// @Tags Admin
+// @Produce json
+// @Param service_id query string false "id of service"
+// @Success 200 {object} service.Response{data=[]cashback.Rule}
+// @Failure 400,500 {object} service.Response
+// @Router /admin/cashback-rules [get]
+func (h Handler) getCashbackRules(w http.ResponseWriter, r *http.Request) {
+	service_id := r.URL.Query().Get("service_id")
+
+	resp := h.service.GetCashbackRulesLogic(service_id)
+
+	h.writeResponse(w, resp, http.StatusOK)
+}
+
+// @Summary Create cashback rule
+// @Description Add cashback rule of the service. Cashback is credited to the user when revenue of his order is recognized within the window of rule
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param input body models.CashbackRuleRequest true "service, currency, percent, optional cap and window of rule"
+// @Success 200 {object} service.Response{data=cashback.Rule}
+// @Failure 400,500 {object} service.Response
+// @Router /admin/cashback-rules [post]
+func (h Handler) createCashbackRule(w http.ResponseWriter, r *http.Request) {
+	body := h.readBody(r)
+	defer r.Body.Close()
+
+	resp := h.service.CreateCashbackRuleLogic(body)
+
+	h.writeResponse(w, resp, http.StatusOK)
+}
+
+// @Summary Delete cashback rule
+// @Description Delete cashback rule by id, cashback paid already is kept
+// @Tags Admin
+// @Produce json
+// @Param id query string true "id of rule"
+// @Success 200 {object} service.Response
+// @Failure 400,500 {object} service.Response
+// @Router /admin/cashback-rules [delete]
+func (h Handler) deleteCashbackRule(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+
+	resp := h.service.DeleteCashbackRuleLogic(id)
+
+	h.writeResponse(w, resp, http.StatusOK)
+}
+
+// @Summary Get fee schedules
+// @Description Get platform fee schedules of the service, schedules of all services are returned if it is omitted
+// @Tags Admin
+// @Produce json
+// @Param service_id query string false "id of service"
+// @Success 200 {object} service.Response{data=[]fee.Schedule}
+// @Failure 400,500 {object} service.Response
+// @Router /admin/fee-schedules [get]
+func (h Handler) getFeeSchedules(w http.ResponseWriter, r *http.Request) {
+	service_id := r.URL.Query().Get("service_id")
+
+	resp := h.service.GetFeeSchedulesLogic(service_id)
+
+	h.writeResponse(w, resp, http.StatusOK)
+}
+
+// @Summary Set fee schedule
+// @Description Set platform fee schedule of the service in the currency, replacing the previous one. Fee is taken from revenue of the order when it is recognized
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param input body models.FeeScheduleRequest true "service, currency, kind and fields of the kind"
+// @Success 200 {object} service.Response{data=fee.Schedule}
+// @Failure 400,500 {object} service.Response
+// @Router /admin/fee-schedules [post]
+func (h Handler) setFeeSchedule(w http.ResponseWriter, r *http.Request) {
+	body := h.readBody(r)
+	defer r.Body.Close()
+
+	resp := h.service.SetFeeScheduleLogic(body)
+
+	h.writeResponse(w, resp, http.StatusOK)
+}
+
+// @Summary Delete fee schedule
+// @Description Delete platform fee schedule of the service in the currency, fees taken already are kept
+// @Tags Admin
+// @Produce json
+// @Param service_id query string true "id of service"
+// @Param currency query string true "currency of schedule"
+// @Success 200 {object} service.Response
+// @Failure 400,500 {object} service.Response
+// @Router /admin/fee-schedules [delete]
+func (h Handler) deleteFeeSchedule(w http.ResponseWriter, r *http.Request) {
+	service_id := r.URL.Query().Get("service_id")
+	code := r.URL.Query().Get("currency")
+
+	resp := h.service.DeleteFeeScheduleLogic(service_id, code)
+
+	h.writeResponse(w, resp, http.StatusOK)
+}
+
+// @Summary Get prices
+// @Description Get history of prices of the service in the currency, prices of all services or currencies are returned if they are omitted
+// @Tags Admin
+// @Produce json
+// @Param service_id query string false "id of service"
+// @Param currency query string false "ISO 4217 code of currency"
+// @Success 200 {object} service.Response{data=[]pricing.Price}
+// @Failure 400,500 {object} service.Response
+// @Router /admin/prices [get]
+func (h Handler) getPrices(w http.ResponseWriter, r *http.Request) {
+	service_id := r.URL.Query().Get("service_id")
+	code := r.URL.Query().Get("currency")
+
+	resp := h.service.GetPricesLogic(service_id, code)
+
+	h.writeResponse(w, resp, http.StatusOK)
+}
+
+// @Summary Create price
+// @Description Add price of unit of the service in the currency in effect since effective_from (since now if omitted)
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param input body models.PriceRequest true "service, currency, price and its effective date"
+// @Success 201 {object} service.Response{data=pricing.Price}
+// @Failure 400,409,500 {object} service.Response
+// @Router /admin/prices [post]
+func (h Handler) createPrice(w http.ResponseWriter, r *http.Request) {
+	body := h.readBody(r)
+	defer r.Body.Close()
+
+	resp := h.service.CreatePriceLogic(body)
+
+	h.writeResponse(w, resp, http.StatusCreated)
+}
+
+// @Summary Get coupons
+// @Description Get discount coupons along with numbers of their redemptions
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} service.Response{data=[]coupon.Coupon}
+// @Failure 500 {object} service.Response
+// @Router /admin/coupons [get]
+func (h Handler) getCoupons(w http.ResponseWriter, r *http.Request) {
+	resp := h.service.GetCouponsLogic()
+
+	h.writeResponse(w, resp, http.StatusOK)
+}
+
+// @Summary Create coupon
+// @Description Add discount coupon of percent or fixed kind, it may be limited to the service, the currency, number of redemptions and time
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param input body models.CouponRequest true "code, kind, fields of the kind and limits of coupon"
+// @Success 201 {object} service.Response{data=coupon.Coupon}
+// @Failure 400,409,500 {object} service.Response
+// @Router /admin/coupons [post]
+func (h Handler) createCoupon(w http.ResponseWriter, r *http.Request) {
+	body := h.readBody(r)
+	defer r.Body.Close()
+
+	resp := h.service.CreateCouponLogic(body)
+
+	h.writeResponse(w, resp, http.StatusCreated)
+}
+
+// @Summary Get vouchers
+// @Description Get vouchers of the batch along with their redemptions, vouchers of all batches are returned if it is omitted
+// @Tags Admin
+// @Produce json
+// @Param batch_id query string false "id of batch"
+// @Success 200 {object} service.Response{data=[]voucher.Voucher}
+// @Failure 400,500 {object} service.Response
+// @Router /admin/vouchers [get]
+func (h Handler) getVouchers(w http.ResponseWriter, r *http.Request) {
+	batch_id := r.URL.Query().Get("batch_id")
+
+	resp := h.service.GetVouchersLogic(batch_id)
+
+	h.writeResponse(w, resp, http.StatusOK)
+}
+
+// @Summary Create batch of vouchers
+// @Description Generate the batch of one-time voucher codes of the same value and expiry
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param input body models.VoucherBatchRequest true "number of vouchers, their value, currency and expiry"
+// @Success 201 {object} service.Response{data=voucher.Batch}
+// @Failure 400,500 {object} service.Response
+// @Router /admin/vouchers [post]
+func (h Handler) createVoucherBatch(w http.ResponseWriter, r *http.Request) {
+	body := h.readBody(r)
+	defer r.Body.Close()
+
+	resp := h.service.CreateVoucherBatchLogic(body)
+
+	h.writeResponse(w, resp, http.StatusCreated)
+}
+
+// @Summary Redeem voucher
+// @Description Top up balance of user by the value of voucher, every voucher is redeemed once and before it expires
+// @Tags Routes
+// @Accept json
+// @Produce json
+// @Param input body models.RedeemVoucherRequest true "user and code of voucher"
+// @Success 202 {object} service.Response{data=voucher.Voucher}
+// @Failure 400,422,500 {object} service.Response
+// @Router /vouchers/redeem [post]
+func (h Handler) redeemVoucher(w http.ResponseWriter, r *http.Request) {
+	body := h.readBody(r)
+	defer r.Body.Close()
+
+	resp := h.service.RedeemVoucherLogic(body)
+
+	h.writeResponse(w, resp, http.StatusAccepted)
+}
+
+// @Summary Get top-ups
+// @Description Get top-ups paid through the payment provider, top-ups of all users or in any status are returned if they are omitted
+// @Tags Routes
+// @Produce json
+// @Param user_id query string false "id of user"
+// @Param status query string false "status of top-up" Enums(pending, succeeded, failed)
+// @Success 200 {object} service.Response{data=[]payment.TopUp}
+// @Failure 400,500 {object} service.Response
+// @Router /top-ups [get]
+func (h Handler) getTopUps(w http.ResponseWriter, r *http.Request) {
+	user_id := r.URL.Query().Get("user_id")
+	status := r.URL.Query().Get("status")
+
+	resp := h.service.GetTopUpsLogic(user_id, status)
+
+	h.writeResponse(w, resp, http.StatusOK)
+}
+
+// @Summary Create top-up
+// @Description Create pending top-up of balance paid through the payment provider, balance is credited when the provider reports the payment succeeded
+// @Tags Routes
+// @Accept json
+// @Produce json
+// @Param input body models.TopUpRequest true "user, amount and currency of top-up"
+// @Success 201 {object} service.Response{data=payment.TopUp}
+// @Failure 400,500 {object} service.Response
+// @Router /top-ups [post]
+func (h Handler) createTopUp(w http.ResponseWriter, r *http.Request) {
+	body := h.readBody(r)
+	defer r.Body.Close()
+
+	resp := h.service.CreateTopUpLogic(body)
+
+	h.writeResponse(w, resp, http.StatusCreated)
+}
+
+// @Summary Payment callback
+// @Description Webhook of the payment provider about the final status of payment, repeated callbacks with the same status change nothing
+// @Tags Payments
+// @Accept json
+// @Produce json
+// @Param X-Signature header string true "signature of body by the payment provider"
+// @Param input body models.PaymentCallbackRequest true "id of payment and its final status"
+// @Success 200 {object} service.Response{data=payment.TopUp}
+// @Failure 400,401,422,500 {object} service.Response
+// @Router /payments/callback [post]
+func (h Handler) paymentCallback(w http.ResponseWriter, r *http.Request) {
+	body := h.readBody(r)
+	defer r.Body.Close()
+
+	resp := h.service.PaymentCallbackLogic(body, r.Header.Get("X-Signature"))
+
+	h.writeResponse(w, resp, http.StatusOK)
+}
+
+// @Summary Complete mock payment
+// @Description Make the mock payment provider send the signed callback about the payment, available only with the mock provider and payments.mock_complete set in configuration
+// @Tags Payments
+// @Accept json
+// @Produce json
+// @Param input body models.PaymentCallbackRequest true "id of payment and its final status"
+// @Success 200 {object} service.Response{data=payment.TopUp}
+// @Failure 400,422,500 {object} service.Response
+// @Router /payments/mock/complete [post]
+func (h Handler) completeMockPayment(w http.ResponseWriter, r *http.Request) {
+	body := h.readBody(r)
+	defer r.Body.Close()
+
+	resp := h.service.SimulatePaymentLogic(body)
+
+	h.writeResponse(w, resp, http.StatusOK)
+}
+
+// @Summary Request withdrawal
+// @Description Hold the amount of withdrawal on the wallet of user until another admin approves or rejects the request
+// @Tags Routes
+// @Accept json
+// @Produce json
+// @Param input body models.WithdrawalRequest true "user, amount, currency of withdrawal and the admin requesting it"
+// @Success 201 {object} service.Response{data=withdrawal.Withdrawal}
+// @Failure 400,422,500 {object} service.Response
+// @Router /withdrawals [post]
+func (h Handler) requestWithdrawal(w http.ResponseWriter, r *http.Request) {
+	body := h.readBody(r)
+	defer r.Body.Close()
+
+	resp := h.service.RequestWithdrawalLogic(body)
+
+	h.writeResponse(w, resp, http.StatusCreated)
+}
+
+// @Summary Get withdrawals
+// @Description Get withdrawals along with changes of their status, withdrawals of all users or in any status are returned if they are omitted
+// @Tags Admin
+// @Produce json
+// @Param user_id query string false "id of user"
+// @Param status query string false "status of withdrawal" Enums(pending, approved, rejected)
+// @Success 200 {object} service.Response{data=[]withdrawal.Withdrawal}
+// @Failure 400,500 {object} service.Response
+// @Router /admin/withdrawals [get]
+func (h Handler) getWithdrawals(w http.ResponseWriter, r *http.Request) {
+	user_id := r.URL.Query().Get("user_id")
+	status := r.URL.Query().Get("status")
+
+	resp := h.service.GetWithdrawalsLogic(user_id, status)
+
+	h.writeResponse(w, resp, http.StatusOK)
+}
+
+// @Summary Approve withdrawal
+// @Description Debit the held amount of pending withdrawal, the admin requested it can't approve it
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param input body models.WithdrawalDecisionRequest true "withdrawal and the admin approving it"
+// @Success 200 {object} service.Response{data=withdrawal.Withdrawal}
+// @Failure 400,403,422,500 {object} service.Response
+// @Router /admin/withdrawals/approve [post]
+func (h Handler) approveWithdrawal(w http.ResponseWriter, r *http.Request) {
+	body := h.readBody(r)
+	defer r.Body.Close()
+
+	resp := h.service.DecideWithdrawalLogic(body, withdrawal.StatusApproved)
+
+	h.writeResponse(w, resp, http.StatusOK)
+}
+
+// @Summary Reject withdrawal
+// @Description Release the held amount of pending withdrawal, the admin requested it can't reject it
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param input body models.WithdrawalDecisionRequest true "withdrawal, the admin rejecting it and the reason"
+// @Success 200 {object} service.Response{data=withdrawal.Withdrawal}
+// @Failure 400,403,422,500 {object} service.Response
+// @Router /admin/withdrawals/reject [post]
+func (h Handler) rejectWithdrawal(w http.ResponseWriter, r *http.Request) {
+	body := h.readBody(r)
+	defer r.Body.Close()
+
+	resp := h.service.DecideWithdrawalLogic(body, withdrawal.StatusRejected)
+
+	h.writeResponse(w, resp, http.StatusOK)
+}
+
+// @Summary Get adjustments
+// @Description Get manual adjustments of balances, adjustments of all users or in any status are returned if they are omitted. Pending adjustments nobody approved in time are expired first, they are also expired by the scheduled task or /admin/adjustments/expire
+// @Tags Admin
+// @Produce json
+// @Param user_id query string false "id of user"
+// @Param status query string false "status of adjustment" Enums(pending, applied, rejected, expired)
+// @Success 200 {object} service.Response{data=[]adjustment.Adjustment}
+// @Failure 400,500 {object} service.Response
+// @Router /admin/adjustments [get]
+func (h Handler) getAdjustments(w http.ResponseWriter, r *http.Request) {
+	user_id := r.URL.Query().Get("user_id")
+	status := r.URL.Query().Get("status")
+
+	resp := h.service.GetAdjustmentsLogic(user_id, status)
+
+	h.writeResponse(w, resp, http.StatusOK)
+}
+
+// @Summary Request adjustment
+// @Description Credit or debit balance of user manually with the reason code, adjustment above the approval threshold of its currency, or in currency without threshold, waits for another admin to approve it until it expires
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param input body models.AdjustmentRequest true "user, direction, amount, currency, reason code of adjustment and the admin requesting it"
+// @Success 201 {object} service.Response{data=adjustment.Adjustment}
+// @Failure 400,422,500 {object} service.Response
+// @Router /admin/adjustments [post]
+func (h Handler) requestAdjustment(w http.ResponseWriter, r *http.Request) {
+	body := h.readBody(r)
+	defer r.Body.Close()
+
+	resp := h.service.RequestAdjustmentLogic(body)
+
+	h.writeResponse(w, resp, http.StatusCreated)
+}
+
+// @Summary Approve adjustment
+// @Description Apply the pending adjustment, the admin requested it can't approve it
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param input body models.AdjustmentDecisionRequest true "adjustment and the admin approving it"
+// @Success 200 {object} service.Response{data=adjustment.Adjustment}
+// @Failure 400,403,422,500 {object} service.Response
+// @Router /admin/adjustments/approve [post]
+func (h Handler) approveAdjustment(w http.ResponseWriter, r *http.Request) {
+	body := h.readBody(r)
+	defer r.Body.Close()
+
+	resp := h.service.DecideAdjustmentLogic(body, adjustment.StatusApplied)
+
+	h.writeResponse(w, resp, http.StatusOK)
+}
+
+// @Summary Reject adjustment
+// @Description Reject the pending adjustment leaving balance as it was, the admin requested it can't reject it
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param input body models.AdjustmentDecisionRequest true "adjustment and the admin rejecting it"
+// @Success 200 {object} service.Response{data=adjustment.Adjustment}
+// @Failure 400,403,422,500 {object} service.Response
+// @Router /admin/adjustments/reject [post]
+func (h Handler) rejectAdjustment(w http.ResponseWriter, r *http.Request) {
+	body := h.readBody(r)
+	defer r.Body.Close()
+
+	resp := h.service.DecideAdjustmentLogic(body, adjustment.StatusRejected)
+
+	h.writeResponse(w, resp, http.StatusOK)
+}
+
+// @Summary Expire adjustments
+// @Description Mark expired pending adjustments nobody approved in time, meant to be called by scheduler
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} service.Response{data=adjustment.Expiry}
+// @Failure 500 {object} service.Response
+// @Router /admin/adjustments/expire [post]
+func (h Handler) expireAdjustments(w http.ResponseWriter, r *http.Request) {
+	resp := h.service.ExpireAdjustmentsLogic()
+
+	h.writeResponse(w, resp, http.StatusOK)
+}
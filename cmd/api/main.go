@@ -4,7 +4,10 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
+	"github.com/antsrp/balance_service/internal/adjustment"
+	"github.com/antsrp/balance_service/internal/payment"
 	"github.com/antsrp/balance_service/internal/postgres"
 	"github.com/antsrp/balance_service/internal/service"
 	"go.uber.org/zap"
@@ -38,21 +41,135 @@ func main() {
 		logger.Sugar().Fatal("Can't create db: ", err)
 	}
 
-	userStorage, err := postgres.CreateUserStorage(db)
+	ledgerStorage, err := postgres.CreateLedgerStorage(db)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create a ledger storage", err)
+	}
+	defer handleCloser(logger, "ledger storage", ledgerStorage)
+
+	exchangeStorage, err := postgres.CreateExchangeStorage(db)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create an exchange storage", err)
+	}
+	defer handleCloser(logger, "exchange storage", exchangeStorage)
+
+	spendingStorage, err := postgres.CreateSpendingStorage(db)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create a spending storage", err)
+	}
+	defer handleCloser(logger, "spending storage", spendingStorage)
+
+	accountStorage, err := postgres.CreateAccountStorage(db, cfg.Accounts.FrozenTopUps)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create an account storage", err)
+	}
+	defer handleCloser(logger, "account storage", accountStorage)
+
+	bonusStorage, err := postgres.CreateBonusStorage(db, ledgerStorage, accountStorage)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create a bonus storage", err)
+	}
+	defer handleCloser(logger, "bonus storage", bonusStorage)
+
+	cashbackStorage, err := postgres.CreateCashbackStorage(db)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create a cashback storage", err)
+	}
+	defer handleCloser(logger, "cashback storage", cashbackStorage)
+
+	feeStorage, err := postgres.CreateFeeStorage(db)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create a fee storage", err)
+	}
+	defer handleCloser(logger, "fee storage", feeStorage)
+
+	priceStorage, err := postgres.CreatePriceStorage(db, cfg.Pricing.ServerSide)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create a price storage", err)
+	}
+	defer handleCloser(logger, "price storage", priceStorage)
+
+	couponStorage, err := postgres.CreateCouponStorage(db)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create a coupon storage", err)
+	}
+	defer handleCloser(logger, "coupon storage", couponStorage)
+
+	userStorage, err := postgres.CreateUserStorage(db, ledgerStorage, exchangeStorage, accountStorage)
 	if err != nil {
 		logger.Sugar().Fatal("Can't create a user storage", err)
 	}
 	defer handleCloser(logger, "user storage", userStorage)
 
-	transactionStorage, err := postgres.CreateTransactionStorage(db, cfg.Limitations.PageLimit)
+	voucherStorage, err := postgres.CreateVoucherStorage(db, userStorage)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create a voucher storage", err)
+	}
+	defer handleCloser(logger, "voucher storage", voucherStorage)
+
+	topUpStorage, err := postgres.CreateTopUpStorage(db, userStorage)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create a top-up storage", err)
+	}
+	defer handleCloser(logger, "top-up storage", topUpStorage)
+
+	var provider payment.Provider
+	if cfg.Payments.Provider != "" {
+		if provider, err = payment.NewProvider(cfg.Payments.Provider, cfg.Payments.Secret, cfg.Payments.AllowMock); err != nil {
+			logger.Sugar().Fatal("Can't create a payment provider", err)
+		}
+	} else {
+		logger.Info("Payment provider isn't configured, top-ups are disabled")
+	}
+
+	transactionStorage, err := postgres.CreateTransactionStorage(db, ledgerStorage, exchangeStorage, spendingStorage, accountStorage, bonusStorage, cashbackStorage, feeStorage, priceStorage, couponStorage, cfg.Limitations.PageLimit)
 	if err != nil {
 		logger.Sugar().Fatal("Can't create a user storage", err)
 	}
 	defer handleCloser(logger, "reservation storage", transactionStorage)
 
-	serv := service.CreateNewService(userStorage, transactionStorage)
+	withdrawalStorage, err := postgres.CreateWithdrawalStorage(db, transactionStorage)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create a withdrawal storage", err)
+	}
+	defer handleCloser(logger, "withdrawal storage", withdrawalStorage)
+
+	thresholds, err := adjustment.ParseThresholds(cfg.Adjustments.ApprovalThresholds)
+	if err != nil {
+		logger.Sugar().Fatal("Can't parse approval thresholds of adjustments", err)
+	}
+	adjustmentStorage, err := postgres.CreateAdjustmentStorage(db, userStorage, transactionStorage, thresholds, time.Duration(cfg.Adjustments.PendingHours)*time.Hour)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create an adjustment storage", err)
+	}
+	defer handleCloser(logger, "adjustment storage", adjustmentStorage)
+
+	reconStorage, err := postgres.CreateReconciliationStorage(db, ledgerStorage, accountStorage)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create a reconciliation storage", err)
+	}
+	defer handleCloser(logger, "reconciliation storage", reconStorage)
+
+	serv := service.CreateNewService(service.Deps{
+		Users:          userStorage,
+		Transactions:   transactionStorage,
+		Reconciliation: reconStorage,
+		Exchange:       exchangeStorage,
+		Spending:       spendingStorage,
+		Accounts:       accountStorage,
+		Bonuses:        bonusStorage,
+		Cashback:       cashbackStorage,
+		Fees:           feeStorage,
+		Prices:         priceStorage,
+		Coupons:        couponStorage,
+		Vouchers:       voucherStorage,
+		TopUps:         topUpStorage,
+		Provider:       provider,
+		Withdrawals:    withdrawalStorage,
+		Adjustments:    adjustmentStorage,
+	})
 
-	h, err := createNewHandler(logger, serv)
+	h, err := createNewHandler(logger, serv, cfg.Payments.MockComplete, cfg.Internal.AddBalance)
 	if err != nil {
 		logger.Sugar().Fatal("Can't create a new handler", err)
 	}
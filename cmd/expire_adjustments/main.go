@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/antsrp/balance_service/internal/postgres"
+	"github.com/antsrp/balance_service/internal/service"
+	"go.uber.org/zap"
+)
+
+// expire_adjustments marks expired pending adjustments nobody approved in time, it is meant to be run by scheduler
+func main() {
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		log.Fatal("Can't create zap logger: ", err)
+	}
+
+	cfg := service.ParseDBConfig(logger)
+
+	db, err := postgres.SQLConnect(cfg, logger)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create db: ", err)
+	}
+	defer db.SQLClose()
+
+	// adjustments are only expired, neither applied nor requested
+	adjustmentStorage, err := postgres.CreateAdjustmentStorage(db, nil, nil, nil, 0)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create an adjustment storage: ", err)
+	}
+	defer adjustmentStorage.Close()
+
+	serv := service.CreateNewService(service.Deps{Adjustments: adjustmentStorage})
+
+	resp := serv.ExpireAdjustmentsLogic()
+	if resp.Error != nil {
+		logger.Sugar().Fatal("Can't expire adjustments: ", resp.Error)
+	}
+
+	data, err := json.MarshalIndent(resp.Data, "", "\t")
+	if err != nil {
+		logger.Sugar().Fatal("Can't marshal result: ", err)
+	}
+	fmt.Println(string(data))
+}
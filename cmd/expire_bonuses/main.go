@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/antsrp/balance_service/internal/postgres"
+	"github.com/antsrp/balance_service/internal/service"
+	"go.uber.org/zap"
+)
+
+// expire_bonuses writes off bonuses left in expired buckets, it is meant to be run by scheduler
+func main() {
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		log.Fatal("Can't create zap logger: ", err)
+	}
+
+	cfg := service.ParseDBConfig(logger)
+
+	db, err := postgres.SQLConnect(cfg, logger)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create db: ", err)
+	}
+	defer db.SQLClose()
+
+	ledgerStorage, err := postgres.CreateLedgerStorage(db)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create a ledger storage: ", err)
+	}
+	defer ledgerStorage.Close()
+
+	accountStorage, err := postgres.CreateAccountStorage(db, cfg.Accounts.FrozenTopUps)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create an account storage: ", err)
+	}
+	defer accountStorage.Close()
+
+	bonusStorage, err := postgres.CreateBonusStorage(db, ledgerStorage, accountStorage)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create a bonus storage: ", err)
+	}
+	defer bonusStorage.Close()
+
+	serv := service.CreateNewService(service.Deps{Bonuses: bonusStorage})
+
+	resp := serv.ExpireBonusesLogic()
+	if resp.Error != nil {
+		logger.Sugar().Fatal("Can't expire bonuses: ", resp.Error)
+	}
+
+	data, err := json.MarshalIndent(resp.Data, "", "\t")
+	if err != nil {
+		logger.Sugar().Fatal("Can't marshal result: ", err)
+	}
+	fmt.Println(string(data))
+}
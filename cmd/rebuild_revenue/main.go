@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/antsrp/balance_service/internal/postgres"
+	"github.com/antsrp/balance_service/internal/service"
+	"go.uber.org/zap"
+)
+
+// rebuild_revenue recomputes the revenue_daily aggregate table from raw transactions
+func main() {
+
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		log.Fatal("Can't create zap logger: ", err)
+	}
+
+	cfg := service.ParseDBConfig(logger)
+
+	db, err := postgres.SQLConnect(cfg, logger)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create db: ", err)
+	}
+	defer db.SQLClose()
+
+	ledgerStorage, err := postgres.CreateLedgerStorage(db)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create a ledger storage: ", err)
+	}
+	defer ledgerStorage.Close()
+
+	exchangeStorage, err := postgres.CreateExchangeStorage(db)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create an exchange storage: ", err)
+	}
+	defer exchangeStorage.Close()
+
+	spendingStorage, err := postgres.CreateSpendingStorage(db)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create a spending storage: ", err)
+	}
+	defer spendingStorage.Close()
+
+	accountStorage, err := postgres.CreateAccountStorage(db, cfg.Accounts.FrozenTopUps)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create an account storage: ", err)
+	}
+	defer accountStorage.Close()
+
+	bonusStorage, err := postgres.CreateBonusStorage(db, ledgerStorage, accountStorage)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create a bonus storage: ", err)
+	}
+	defer bonusStorage.Close()
+
+	cashbackStorage, err := postgres.CreateCashbackStorage(db)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create a cashback storage: ", err)
+	}
+	defer cashbackStorage.Close()
+
+	feeStorage, err := postgres.CreateFeeStorage(db)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create a fee storage: ", err)
+	}
+	defer feeStorage.Close()
+
+	priceStorage, err := postgres.CreatePriceStorage(db, cfg.Pricing.ServerSide)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create a price storage: ", err)
+	}
+	defer priceStorage.Close()
+
+	couponStorage, err := postgres.CreateCouponStorage(db)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create a coupon storage: ", err)
+	}
+	defer couponStorage.Close()
+
+	transactionStorage, err := postgres.CreateTransactionStorage(db, ledgerStorage, exchangeStorage, spendingStorage, accountStorage, bonusStorage, cashbackStorage, feeStorage, priceStorage, couponStorage, cfg.Limitations.PageLimit)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create a transaction storage: ", err)
+	}
+	defer transactionStorage.Close()
+
+	if err := transactionStorage.RebuildRevenueDaily(); err != nil {
+		logger.Sugar().Fatal("Can't rebuild daily revenue: ", err)
+	}
+
+	fmt.Println("daily revenue is rebuilt")
+}
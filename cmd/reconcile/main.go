@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/antsrp/balance_service/internal/postgres"
+	"github.com/antsrp/balance_service/internal/service"
+	"go.uber.org/zap"
+)
+
+// reconcile recomputes balances of users from transactions history and prints mismatches
+func main() {
+	repair := flag.Bool("repair", false, "write adjusting entries for mismatched balances")
+	flag.Parse()
+
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		log.Fatal("Can't create zap logger: ", err)
+	}
+
+	cfg := service.ParseDBConfig(logger)
+
+	db, err := postgres.SQLConnect(cfg, logger)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create db: ", err)
+	}
+	defer db.SQLClose()
+
+	ledgerStorage, err := postgres.CreateLedgerStorage(db)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create a ledger storage: ", err)
+	}
+	defer ledgerStorage.Close()
+
+	accountStorage, err := postgres.CreateAccountStorage(db, cfg.Accounts.FrozenTopUps)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create an account storage: ", err)
+	}
+	defer accountStorage.Close()
+
+	reconStorage, err := postgres.CreateReconciliationStorage(db, ledgerStorage, accountStorage)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create a reconciliation storage: ", err)
+	}
+	defer reconStorage.Close()
+
+	serv := service.CreateNewService(service.Deps{Reconciliation: reconStorage})
+
+	resp := serv.ReconcileLogic(*repair)
+	if resp.Error != nil {
+		logger.Sugar().Fatal("Can't reconcile balances: ", resp.Error)
+	}
+
+	data, err := json.MarshalIndent(resp.Data, "", "\t")
+	if err != nil {
+		logger.Sugar().Fatal("Can't marshal report: ", err)
+	}
+	fmt.Println(string(data))
+}
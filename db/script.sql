@@ -1,7 +1,25 @@
 CREATE TABLE public.users
 (
     id bigint NOT NULL PRIMARY KEY,
-    balance bigint NOT NULL
+    state character varying(10) NOT NULL DEFAULT 'active' CHECK (state IN ('active', 'frozen', 'closed'))
+);
+
+CREATE TABLE IF NOT EXISTS public.account_states
+(
+    id SERIAL PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES public.users (id) ON DELETE CASCADE,
+    state character varying(10) NOT NULL,
+    reason character varying(200) NOT NULL,
+    changed_at timestamp with time zone NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS public.wallets
+(
+    user_id bigint NOT NULL REFERENCES public.users (id) ON DELETE CASCADE,
+    currency character(3) NOT NULL,
+    balance bigint NOT NULL,
+    credit_limit bigint NOT NULL DEFAULT 0 CHECK (credit_limit >= 0),
+    CONSTRAINT wallets_pkey PRIMARY KEY (user_id, currency)
 );
 
 CREATE TABLE IF NOT EXISTS public.favors
@@ -11,10 +29,49 @@ CREATE TABLE IF NOT EXISTS public.favors
     CONSTRAINT favors_pkey PRIMARY KEY (id)
 );
 
+-- price of unit of the service is in effect since its effective date until the next price
+CREATE TABLE IF NOT EXISTS public.favor_prices
+(
+    id SERIAL PRIMARY KEY,
+    service_id bigint NOT NULL REFERENCES public.favors (id),
+    currency character(3) NOT NULL,
+    price bigint NOT NULL CHECK (price >= 0),
+    effective_from timestamp with time zone NOT NULL,
+    CONSTRAINT favor_prices_unique UNIQUE (service_id, currency, effective_from)
+);
+
+-- discount coupon without service fits every service, without currency fits every currency, limits are null if unlimited
+CREATE TABLE IF NOT EXISTS public.coupons
+(
+    id SERIAL PRIMARY KEY,
+    code character varying(50) NOT NULL UNIQUE,
+    kind character varying(10) NOT NULL CHECK (kind IN ('percent', 'fixed')),
+    percent numeric CHECK (percent > 0 AND percent <= 100),
+    fixed bigint CHECK (fixed > 0),
+    currency character(3),
+    service_id bigint REFERENCES public.favors (id),
+    usage_limit integer CHECK (usage_limit > 0),
+    per_user_limit integer CHECK (per_user_limit > 0),
+    expires_at timestamp with time zone,
+    used integer NOT NULL DEFAULT 0 CHECK (used >= 0)
+);
+
+CREATE TABLE IF NOT EXISTS public.coupon_redemptions
+(
+    id SERIAL PRIMARY KEY,
+    coupon_id bigint NOT NULL REFERENCES public.coupons (id),
+    user_id bigint NOT NULL,
+    order_id bigint NOT NULL,
+    redeemed_at timestamp with time zone NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS coupon_redemptions_user_idx ON public.coupon_redemptions (coupon_id, user_id);
+
 CREATE TABLE IF NOT EXISTS public.chains(
     id SERIAL PRIMARY KEY,
     order_id bigint NOT NULL,
-    service_id bigint NOT NULL
+    service_id bigint NOT NULL,
+    coupon_id bigint REFERENCES public.coupons (id)
 );
 
 CREATE TABLE IF NOT EXISTS public.transactions
@@ -22,13 +79,256 @@ CREATE TABLE IF NOT EXISTS public.transactions
     id SERIAL PRIMARY KEY,
     user_id bigint NOT NULL,
     direction character varying(10) NOT NULL,
+    kind character varying(20),
     closed_at timestamp with time zone,
     chain_id bigint,
     is_completed boolean NOT NULL,
     cost bigint NOT NULL,
-    comment character varying(50)
+    currency character(3) NOT NULL,
+    comment character varying(50),
+    reversal_of bigint UNIQUE REFERENCES public.transactions (id),
+    reason character varying(200),
+    source_cost bigint,
+    source_currency character(3),
+    rate numeric,
+    linked_id bigint REFERENCES public.transactions (id),
+    fee bigint,
+    net bigint,
+    payee_id bigint REFERENCES public.users (id),
+    price_id bigint REFERENCES public.favor_prices (id),
+    quantity integer CHECK (quantity > 0),
+    discount bigint CHECK (discount >= 0),
+    created_at timestamp with time zone NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS transactions_closed_at_idx ON public.transactions (closed_at);
+
+CREATE INDEX IF NOT EXISTS transactions_reserved_idx ON public.transactions (user_id, currency)
+    WHERE direction = 'out' AND is_completed = false;
+
+CREATE INDEX IF NOT EXISTS transactions_created_at_idx ON public.transactions (user_id, created_at)
+    WHERE direction = 'out' AND chain_id IS NOT NULL;
+
+-- vouchers of the batch have the same value and expiry
+CREATE TABLE IF NOT EXISTS public.voucher_batches
+(
+    id SERIAL PRIMARY KEY,
+    value bigint NOT NULL CHECK (value > 0),
+    currency character(3) NOT NULL,
+    expires_at timestamp with time zone NOT NULL,
+    created_at timestamp with time zone NOT NULL DEFAULT now()
+);
+
+-- voucher is redeemed once, the top-up made by the redemption is kept along with it
+CREATE TABLE IF NOT EXISTS public.vouchers
+(
+    id SERIAL PRIMARY KEY,
+    batch_id bigint NOT NULL REFERENCES public.voucher_batches (id),
+    code character varying(20) NOT NULL UNIQUE,
+    redeemed_by bigint,
+    redeemed_at timestamp with time zone,
+    transaction_id bigint REFERENCES public.transactions (id)
+);
+
+-- top-up paid through the payment provider, balance is credited by the transaction when the payment succeeds
+CREATE TABLE IF NOT EXISTS public.top_ups
+(
+    id SERIAL PRIMARY KEY,
+    user_id bigint NOT NULL,
+    amount bigint NOT NULL CHECK (amount > 0),
+    currency character(3) NOT NULL,
+    status character varying(10) NOT NULL CHECK (status IN ('pending', 'succeeded', 'failed')),
+    provider character varying(20) NOT NULL,
+    payment_id character varying(100) NOT NULL,
+    payment_url character varying(200),
+    created_at timestamp with time zone NOT NULL,
+    completed_at timestamp with time zone,
+    transaction_id bigint REFERENCES public.transactions (id),
+    CONSTRAINT top_ups_payment_unique UNIQUE (provider, payment_id)
+);
+
+CREATE INDEX IF NOT EXISTS top_ups_user_idx ON public.top_ups (user_id, status);
+
+-- amount of withdrawal is held by the transaction until another admin approves or rejects it
+CREATE TABLE IF NOT EXISTS public.withdrawals
+(
+    id SERIAL PRIMARY KEY,
+    user_id bigint NOT NULL,
+    amount bigint NOT NULL CHECK (amount > 0),
+    currency character(3) NOT NULL,
+    status character varying(10) NOT NULL CHECK (status IN ('pending', 'approved', 'rejected')),
+    requested_by character varying(50) NOT NULL,
+    transaction_id bigint NOT NULL REFERENCES public.transactions (id)
+);
+
+CREATE INDEX IF NOT EXISTS withdrawals_user_idx ON public.withdrawals (user_id, status);
+
+-- manual adjustment of balance, the one above the threshold is applied by the transaction when it is approved
+CREATE TABLE IF NOT EXISTS public.adjustments
+(
+    id SERIAL PRIMARY KEY,
+    user_id bigint NOT NULL,
+    direction character varying(10) NOT NULL CHECK (direction IN ('credit', 'debit')),
+    amount bigint NOT NULL CHECK (amount > 0),
+    currency character(3) NOT NULL,
+    reason_code character varying(20) NOT NULL,
+    comment character varying(200),
+    status character varying(10) NOT NULL CHECK (status IN ('pending', 'applied', 'rejected', 'expired')),
+    requested_by character varying(50) NOT NULL,
+    requested_at timestamp with time zone NOT NULL,
+    expires_at timestamp with time zone,
+    decided_by character varying(50),
+    decided_at timestamp with time zone,
+    transaction_id bigint REFERENCES public.transactions (id)
 );
 
+CREATE INDEX IF NOT EXISTS adjustments_status_idx ON public.adjustments (status, expires_at);
+
+-- every change of status of withdrawal with its actor
+CREATE TABLE IF NOT EXISTS public.withdrawal_events
+(
+    id SERIAL PRIMARY KEY,
+    withdrawal_id bigint NOT NULL REFERENCES public.withdrawals (id),
+    status character varying(10) NOT NULL,
+    actor character varying(50) NOT NULL,
+    reason character varying(200),
+    at timestamp with time zone NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS public.spending_limits
+(
+    id SERIAL PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES public.users (id) ON DELETE CASCADE,
+    service_id bigint REFERENCES public.favors (id),
+    period character varying(10) NOT NULL CHECK (period IN ('day', 'month')),
+    currency character(3) NOT NULL,
+    amount bigint NOT NULL CHECK (amount >= 0)
+);
+
+-- limit on all services has no service, it is unique as well
+CREATE UNIQUE INDEX IF NOT EXISTS spending_limits_unique ON public.spending_limits (user_id, (COALESCE(service_id, 0)), period, currency);
+
+-- bonuses are part of the wallet balance, buckets track how much of it is still bonus
+CREATE TABLE IF NOT EXISTS public.bonus_buckets
+(
+    id SERIAL PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES public.users (id) ON DELETE CASCADE,
+    currency character(3) NOT NULL,
+    source character varying(50) NOT NULL,
+    amount bigint NOT NULL CHECK (amount > 0),
+    remaining bigint NOT NULL CHECK (remaining >= 0),
+    expires_at timestamp with time zone NOT NULL,
+    granted_at timestamp with time zone NOT NULL,
+    transaction_id bigint NOT NULL REFERENCES public.transactions (id),
+    expiry_transaction_id bigint REFERENCES public.transactions (id)
+);
+
+CREATE INDEX IF NOT EXISTS bonus_buckets_spendable_idx ON public.bonus_buckets (user_id, currency, expires_at)
+    WHERE remaining > 0;
+
+-- buckets the reservation was paid from
+CREATE TABLE IF NOT EXISTS public.reservation_bonuses
+(
+    transaction_id bigint NOT NULL REFERENCES public.transactions (id),
+    bucket_id bigint NOT NULL REFERENCES public.bonus_buckets (id) ON DELETE CASCADE,
+    amount bigint NOT NULL CHECK (amount > 0),
+    returned bigint NOT NULL DEFAULT 0 CHECK (returned >= 0 AND returned <= amount),
+    CONSTRAINT reservation_bonuses_pkey PRIMARY KEY (transaction_id, bucket_id)
+);
+
+CREATE TABLE IF NOT EXISTS public.cashback_rules
+(
+    id SERIAL PRIMARY KEY,
+    service_id bigint NOT NULL REFERENCES public.favors (id),
+    currency character(3) NOT NULL,
+    percent numeric NOT NULL CHECK (percent > 0 AND percent <= 100),
+    cap bigint CHECK (cap >= 0),
+    valid_from timestamp with time zone NOT NULL,
+    valid_to timestamp with time zone CHECK (valid_to > valid_from)
+);
+
+CREATE INDEX IF NOT EXISTS cashback_rules_service_idx ON public.cashback_rules (service_id, currency, valid_from);
+
+-- platform fee taken from revenue of the service, fields of the kind are set only
+CREATE TABLE IF NOT EXISTS public.fee_schedules
+(
+    service_id bigint NOT NULL REFERENCES public.favors (id),
+    currency character(3) NOT NULL,
+    kind character varying(10) NOT NULL CHECK (kind IN ('percent', 'fixed', 'tiered')),
+    percent numeric CHECK (percent >= 0 AND percent <= 100),
+    fixed bigint CHECK (fixed >= 0),
+    tiers jsonb,
+    CONSTRAINT fee_schedules_pkey PRIMARY KEY (service_id, currency)
+);
+
+CREATE TABLE IF NOT EXISTS public.exchange_rates
+(
+    id SERIAL PRIMARY KEY,
+    base character(3) NOT NULL,
+    quote character(3) NOT NULL,
+    rate numeric NOT NULL CHECK (rate > 0),
+    effective_from timestamp with time zone NOT NULL,
+    CONSTRAINT exchange_rates_unique UNIQUE (base, quote, effective_from)
+);
+
+CREATE TABLE IF NOT EXISTS public.revenue_daily
+(
+    day date NOT NULL,
+    service_id bigint NOT NULL,
+    user_id bigint NOT NULL,
+    revenue bigint NOT NULL,
+    orders bigint NOT NULL,
+    refunds bigint NOT NULL DEFAULT 0,
+    cashback bigint NOT NULL DEFAULT 0,
+    fees bigint NOT NULL DEFAULT 0,
+    currency character(3) NOT NULL,
+    CONSTRAINT revenue_daily_pkey PRIMARY KEY (day, service_id, user_id, currency)
+);
+
+CREATE TABLE IF NOT EXISTS public.accounts
+(
+    id SERIAL PRIMARY KEY,
+    kind character varying(20) NOT NULL,
+    user_id bigint NOT NULL DEFAULT 0,
+    service_id bigint NOT NULL DEFAULT 0,
+    currency character(3) NOT NULL,
+    CONSTRAINT accounts_unique UNIQUE (kind, user_id, service_id, currency)
+);
+
+CREATE TABLE IF NOT EXISTS public.journal_entries
+(
+    id SERIAL PRIMARY KEY,
+    kind character varying(20) NOT NULL,
+    transaction_id bigint,
+    created_at timestamp with time zone NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS public.postings
+(
+    id SERIAL PRIMARY KEY,
+    entry_id bigint NOT NULL REFERENCES public.journal_entries (id) ON DELETE CASCADE,
+    account_id bigint NOT NULL REFERENCES public.accounts (id),
+    amount bigint NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS postings_account_idx ON public.postings (account_id);
+
+-- postings of every journal entry must sum to zero in each currency when the transaction commits
+CREATE OR REPLACE FUNCTION public.check_entry_balanced() RETURNS trigger AS $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM public.postings JOIN public.accounts ON account_id = accounts.id
+        WHERE entry_id = NEW.entry_id GROUP BY accounts.currency HAVING SUM(amount) <> 0) THEN
+        RAISE EXCEPTION 'journal entry % is not balanced', NEW.entry_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE CONSTRAINT TRIGGER postings_balanced
+    AFTER INSERT OR UPDATE ON public.postings
+    DEFERRABLE INITIALLY DEFERRED
+    FOR EACH ROW EXECUTE FUNCTION public.check_entry_balanced();
+
 INSERT INTO favors (id, name) VALUES 
 (1, 'Favor 1'),
 (2, 'Favor 2'),
@@ -0,0 +1,123 @@
+package adjustment
+
+import (
+	"time"
+
+	"github.com/antsrp/balance_service/internal/currency"
+	"github.com/antsrp/balance_service/internal/money"
+	"github.com/pkg/errors"
+)
+
+// directions of adjustments
+const (
+	DirectionCredit = "credit"
+	DirectionDebit  = "debit"
+)
+
+// statuses of adjustments
+const (
+	StatusPending  = "pending"  // waits for the second approver
+	StatusApplied  = "applied"  // balance is changed
+	StatusRejected = "rejected" // balance is left as it was
+	StatusExpired  = "expired"  // nobody approved it in time
+)
+
+// codes of reasons of adjustments
+const (
+	ReasonCorrection = "correction" // mistake of operation made earlier
+	ReasonGoodwill   = "goodwill"   // compensation to user
+	ReasonChargeback = "chargeback" // payment disputed at the provider
+	ReasonFraud      = "fraud"      // money of fraudulent operations
+	ReasonMigration  = "migration"  // balance moved from another system
+)
+
+const (
+	InvalidDirection  = "Invalid direction of adjustment"
+	InvalidReasonCode = "Invalid reason code of adjustment"
+	InvalidStatus     = "Invalid status of adjustment"
+)
+
+var (
+	ErrInvalidDirection  = errors.New(InvalidDirection)
+	ErrInvalidReasonCode = errors.New(InvalidReasonCode)
+	ErrInvalidStatus     = errors.New(InvalidStatus)
+)
+
+// Adjustment is a manual change of balance of user made by support staff.
+// Adjustment above the approval threshold is applied once another admin approves it, unless it expires before
+type Adjustment struct {
+	ID            int         `json:"id,omitempty"`
+	UserID        int         `json:"user_id"`
+	Direction     string      `json:"direction" enums:"credit,debit"`
+	Amount        money.Money `json:"amount" swaggertype:"string"`
+	Currency      string      `json:"currency"`
+	ReasonCode    string      `json:"reason_code" enums:"correction,goodwill,chargeback,fraud,migration"`
+	Comment       string      `json:"comment,omitempty"`
+	Status        string      `json:"status" enums:"pending,applied,rejected,expired"`
+	RequestedBy   string      `json:"requested_by"`
+	RequestedAt   time.Time   `json:"requested_at"`
+	ExpiresAt     *time.Time  `json:"expires_at,omitempty"` // set for adjustments waiting for approval
+	DecidedBy     string      `json:"decided_by,omitempty"`
+	DecidedAt     *time.Time  `json:"decided_at,omitempty"`
+	TransactionID int         `json:"transaction_id,omitempty"` // transaction the adjustment is applied by
+}
+
+// Expiry is a result of expiration of adjustments nobody approved in time
+type Expiry struct {
+	Adjustments int `json:"adjustments"`
+}
+
+// Decision is an approval or rejection of the pending adjustment
+type Decision struct {
+	ID     int    `json:"id"`
+	Actor  string `json:"actor"`
+	Status string `json:"-"`
+}
+
+type Storage interface {
+	Request(*Adjustment) error
+	GetAdjustments(userID int, status string) ([]Adjustment, error)
+	Decide(Decision) (*Adjustment, error)
+	Expire(at time.Time) (int, error)
+	DeleteAllAdjustments() error
+}
+
+// Validate checks direction and reason code of the adjustment are known
+func (a Adjustment) Validate() error {
+	if a.Direction != DirectionCredit && a.Direction != DirectionDebit {
+		return ErrInvalidDirection
+	}
+	switch a.ReasonCode {
+	case ReasonCorrection, ReasonGoodwill, ReasonChargeback, ReasonFraud, ReasonMigration:
+		return nil
+	}
+	return ErrInvalidReasonCode
+}
+
+// ParseThresholds reads approval thresholds by currency from configuration, amounts are brought to minor units of their currencies
+func ParseThresholds(cfg map[string]string) (map[string]money.Money, error) {
+	thresholds := make(map[string]money.Money, len(cfg))
+	for code, value := range cfg {
+		cur, err := currency.Parse(code)
+		if err != nil {
+			return nil, errors.Wrapf(err, "currency %s", code)
+		}
+		amount, err := money.Parse(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "threshold of %s", cur)
+		}
+		if thresholds[cur], err = currency.Normalize(amount, cur); err != nil {
+			return nil, errors.Wrapf(err, "threshold of %s", cur)
+		}
+	}
+	return thresholds, nil
+}
+
+// ValidStatus checks the status is known
+func ValidStatus(status string) bool {
+	switch status {
+	case StatusPending, StatusApplied, StatusRejected, StatusExpired:
+		return true
+	}
+	return false
+}
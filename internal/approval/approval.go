@@ -0,0 +1,20 @@
+package approval
+
+import "strings"
+
+const MaxActorLength = 50
+
+// Actor returns the name of admin trimmed and case-folded, so "Alice " and "alice" name the same admin
+func Actor(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// ValidActor checks the normalized actor is named and fits its column
+func ValidActor(actor string) bool {
+	return actor != "" && len(actor) <= MaxActorLength
+}
+
+// SameActor reports whether both names belong to the same admin, the one requested an operation can't decide it
+func SameActor(a, b string) bool {
+	return Actor(a) == Actor(b)
+}
@@ -0,0 +1,43 @@
+package bonus
+
+import (
+	"time"
+
+	"github.com/antsrp/balance_service/internal/money"
+)
+
+// Bucket is a bonus granted to the wallet of user. Bonuses are spent on orders before the rest of balance,
+// soonest expiring first, and can't be transferred. The amount left at expiry is written off
+type Bucket struct {
+	ID        int         `json:"id,omitempty"`
+	UserID    int         `json:"user_id"`
+	Currency  string      `json:"currency"`
+	Source    string      `json:"source"` // campaign or other reason of the grant
+	Amount    money.Money `json:"amount" swaggertype:"string"`
+	Remaining money.Money `json:"remaining" swaggertype:"string"`
+	ExpiresAt *time.Time  `json:"expires_at"`
+	GrantedAt *time.Time  `json:"granted_at,omitempty"`
+	Comment   string      `json:"comment,omitempty"`
+	Usages    []Usage     `json:"usages,omitempty"`
+}
+
+// Usage is a part of the order cost paid from the bucket, returned part comes back to the bucket by refunds and reversals
+type Usage struct {
+	TransactionID int         `json:"transaction_id"`
+	Amount        money.Money `json:"amount" swaggertype:"string"`
+	Returned      money.Money `json:"returned" swaggertype:"string"`
+}
+
+// Expiry is the result of writing off expired bonuses
+type Expiry struct {
+	Buckets int `json:"buckets"`
+	// written off amounts by currency
+	Amounts map[string]money.Money `json:"amounts" swaggertype:"object,string"`
+}
+
+type Storage interface {
+	Grant(*Bucket) (int, error)
+	GetBuckets(userID int) ([]Bucket, error)
+	Expire(at time.Time) (*Expiry, error)
+	DeleteAllBuckets() error
+}
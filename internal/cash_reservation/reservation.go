@@ -1,12 +1,59 @@
 package reservation
 
-import "time"
+import (
+	"time"
+
+	"github.com/antsrp/balance_service/internal/money"
+)
 
 type CashReservation struct {
-	UserID   int        `json:"user_id"`
-	FavorID  int        `json:"service_id"`
-	OrderID  int        `json:"order_id"`
-	ClosedAt *time.Time `json:"closed_at,omitempty"`
-	Comment  string     `json:"comment"`
-	Cost     uint64     `json:"cost"`
+	UserID   int         `json:"user_id"`
+	FavorID  int         `json:"service_id"`
+	OrderID  int         `json:"order_id"`
+	ClosedAt *time.Time  `json:"closed_at,omitempty"`
+	Comment  string      `json:"comment"`
+	Cost     money.Money `json:"cost"`
+	Currency string      `json:"currency"`
+	PayeeID  int         `json:"payee_id,omitempty"` // user the revenue of order is paid out to, if any
+	Quantity int         `json:"quantity,omitempty"` // units of service the cost is calculated for by its price
+	Coupon   string      `json:"coupon,omitempty"`   // code of discount coupon
+}
+
+// OrderLine is a service of the multi-line order along with its cost
+type OrderLine struct {
+	FavorID  int         `json:"service_id"`
+	Cost     money.Money `json:"cost"`
+	Comment  string      `json:"comment"`
+	PayeeID  int         `json:"payee_id,omitempty"`
+	Quantity int         `json:"quantity,omitempty"`
+	PriceID  int         `json:"-"` // version of price the cost is calculated by
+	CouponID int         `json:"-"` // coupon applied to the line, its discount is taken off the cost
+	Discount money.Money `json:"-"`
+}
+
+// Order is a request to reserve or recognize several services of one order of user together, all or none of them
+type Order struct {
+	UserID   int         `json:"user_id"`
+	OrderID  int         `json:"order_id"`
+	Currency string      `json:"currency"`
+	ClosedAt *time.Time  `json:"closed_at,omitempty"`
+	Coupon   string      `json:"coupon,omitempty"`
+	Lines    []OrderLine `json:"lines"`
+}
+
+// Reversal is a request to reverse the completed transaction
+type Reversal struct {
+	TransactionID int        `json:"transaction_id"`
+	Reason        string     `json:"reason"`
+	Time          *time.Time `json:"time,omitempty"`
+}
+
+// Refund is a request to return money of the recognized order to the user, the whole rest of cost if amount is zero
+type Refund struct {
+	UserID  int         `json:"user_id"`
+	FavorID int         `json:"service_id"`
+	OrderID int         `json:"order_id"`
+	Amount  money.Money `json:"amount"`
+	Comment string      `json:"comment"`
+	Time    *time.Time  `json:"time,omitempty"`
 }
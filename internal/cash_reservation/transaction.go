@@ -1,6 +1,10 @@
 package reservation
 
-import "time"
+import (
+	"time"
+
+	"github.com/antsrp/balance_service/internal/money"
+)
 
 type Transaction struct {
 	ID          int
@@ -9,11 +13,12 @@ type Transaction struct {
 	IsCompleted bool
 	ChainID     int
 	ClosedAt    *time.Time
-	Cost        uint64
+	Cost        money.Money
+	Currency    string
 	Comment     string
 }
 
-func NewTransaction(id, user_id int, direction string, cost uint64, comment string) *Transaction {
+func NewTransaction(id, user_id int, direction string, cost money.Money, comment string) *Transaction {
 	return &Transaction{
 		ID:          id,
 		UserID:      user_id,
@@ -27,10 +32,13 @@ func NewTransaction(id, user_id int, direction string, cost uint64, comment stri
 }
 
 type Storage interface {
-	CreateIn(int, *time.Time, uint64, string) error
-	CreateOut(int, int, int, uint64, string) error
-	GetAmountOfReservedCash(int) (uint64, error)
+	CreateOut(int, int, int, money.Money, string, string, int) error
+	GetAmountOfReservedCash(int, string) (money.Money, error)
 	FindTransaction(CashReservation) (int, error)
-	CloseTransaction(int, *time.Time, chan bool, chan bool, chan error)
+	CloseTransaction(int, *time.Time) error
+	ReserveOrder(*Order) error
+	CloseOrder(Order) error
+	Reverse(Reversal) (int, int, error) // id of reversal and user of the reversed transaction
+	Refund(Refund) (int, error)
 	DeleteAllTransactions() error
 }
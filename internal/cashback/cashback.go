@@ -0,0 +1,49 @@
+package cashback
+
+import (
+	"time"
+
+	"github.com/antsrp/balance_service/internal/money"
+	"github.com/antsrp/balance_service/internal/percent"
+	"github.com/pkg/errors"
+)
+
+const (
+	InvalidWindow = "Rule must end after it begins"
+)
+
+var (
+	ErrInvalidWindow = errors.New(InvalidWindow)
+)
+
+// Rule pays the percent of the cost of order recognized in its window back to the user, but not more than the cap.
+// The rule applies to orders of the service in its currency, the latest beginning rule wins if windows overlap
+type Rule struct {
+	ID        int          `json:"id,omitempty"`
+	ServiceID int          `json:"service_id"`
+	Currency  string       `json:"currency"`
+	Percent   string       `json:"percent"`
+	Cap       *money.Money `json:"cap,omitempty" swaggertype:"string"` // limit of cashback of a single order
+	ValidFrom *time.Time   `json:"valid_from"`
+	ValidTo   *time.Time   `json:"valid_to,omitempty"` // rule without end is valid until it is deleted
+}
+
+type Storage interface {
+	CreateRule(*Rule) (int, error)
+	GetRules(serviceID int) ([]Rule, error)
+	DeleteRule(id int) error
+	DeleteAllRules() error
+}
+
+// Calculate returns cashback of the order cost by the rule, rounded down to minor units of the cost
+func (r Rule) Calculate(cost money.Money) (money.Money, error) {
+	p, err := percent.ParsePositive(r.Percent)
+	if err != nil {
+		return money.Money{}, err
+	}
+	amount := cost.Percent(p)
+	if r.Cap != nil && amount.Cmp(*r.Cap) > 0 {
+		amount = *r.Cap
+	}
+	return amount, nil
+}
@@ -0,0 +1,126 @@
+package coupon
+
+import (
+	"time"
+
+	"github.com/antsrp/balance_service/internal/money"
+	"github.com/antsrp/balance_service/internal/percent"
+	"github.com/pkg/errors"
+)
+
+// kinds of coupons
+const (
+	KindPercent = "percent" // percent of the cost of every line the coupon fits
+	KindFixed   = "fixed"   // amount taken off lines the coupon fits in turn
+)
+
+const (
+	CodeRequired = "Code of coupon is required"
+	InvalidKind  = "Invalid kind of coupon"
+	InvalidFixed = "Fixed discount must be positive and have currency"
+	InvalidLimit = "Usage limits of coupon must not be negative"
+)
+
+var (
+	ErrCodeRequired = errors.New(CodeRequired)
+	ErrInvalidKind  = errors.New(InvalidKind)
+	ErrInvalidFixed = errors.New(InvalidFixed)
+	ErrInvalidLimit = errors.New(InvalidLimit)
+)
+
+// Coupon is a discount code applied to the reservation. Coupon without service fits every service,
+// coupon with currency fits orders in it only. Zero limits don't limit usage
+type Coupon struct {
+	ID           int          `json:"id,omitempty"`
+	Code         string       `json:"code"`
+	Kind         string       `json:"kind" enums:"percent,fixed"`
+	Percent      string       `json:"percent,omitempty"`
+	Fixed        *money.Money `json:"fixed,omitempty" swaggertype:"string"`
+	Currency     string       `json:"currency,omitempty"`
+	ServiceID    int          `json:"service_id,omitempty"`
+	UsageLimit   int          `json:"usage_limit,omitempty"`    // redemptions by all users
+	PerUserLimit int          `json:"per_user_limit,omitempty"` // redemptions by a single user
+	ExpiresAt    *time.Time   `json:"expires_at,omitempty"`
+	Used         int          `json:"used"`
+}
+
+type Storage interface {
+	CreateCoupon(*Coupon) (int, error)
+	GetCoupons() ([]Coupon, error)
+	DeleteAllCoupons() error
+}
+
+// ClearOtherKinds drops the fields of other kinds than the kind of coupon, they are not kept
+func (c *Coupon) ClearOtherKinds() {
+	switch c.Kind {
+	case KindPercent:
+		c.Fixed = nil
+	case KindFixed:
+		c.Percent = ""
+	}
+}
+
+// Validate checks the coupon has the fields of its kind
+func (c Coupon) Validate() error {
+	if c.Code == "" {
+		return ErrCodeRequired
+	}
+	if c.UsageLimit < 0 || c.PerUserLimit < 0 {
+		return ErrInvalidLimit
+	}
+	switch c.Kind {
+	case KindPercent:
+		_, err := percent.ParsePositive(c.Percent)
+		return err
+	case KindFixed:
+		if c.Fixed == nil || c.Fixed.IsNegative() || c.Fixed.IsZero() || c.Currency == "" {
+			return ErrInvalidFixed
+		}
+		return nil
+	}
+	return ErrInvalidKind
+}
+
+// Fits reports whether the coupon applies to the service in the currency
+func (c Coupon) Fits(serviceID int, code string) bool {
+	return (c.ServiceID == 0 || c.ServiceID == serviceID) && (c.Currency == "" || c.Currency == code)
+}
+
+// Expired reports whether the coupon can't be used at the time
+func (c Coupon) Expired(at time.Time) bool {
+	return c.ExpiresAt != nil && !at.Before(*c.ExpiresAt)
+}
+
+// Discounts returns discounts of the costs the coupon fits, rounded down to minor units of the costs.
+// Fixed discount is taken off the costs in turn, it never exceeds them
+func (c Coupon) Discounts(costs []money.Money) ([]money.Money, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	discounts := make([]money.Money, len(costs))
+	if c.Kind == KindPercent {
+		p, err := percent.ParsePositive(c.Percent)
+		if err != nil {
+			return nil, err
+		}
+		for i, cost := range costs {
+			discounts[i] = cost.Percent(p)
+		}
+		return discounts, nil
+	}
+	rest := *c.Fixed
+	for i, cost := range costs {
+		d := rest
+		if d.Cmp(cost) > 0 {
+			d = cost
+		}
+		var err error
+		if discounts[i], err = d.Rescale(cost.Exponent); err != nil {
+			return nil, err
+		}
+		if rest, err = rest.Sub(d); err != nil {
+			return nil, err
+		}
+	}
+	return discounts, nil
+}
@@ -0,0 +1,100 @@
+package coupon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/antsrp/balance_service/internal/money"
+	"github.com/antsrp/balance_service/internal/percent"
+)
+
+func amount(m money.Money) *money.Money {
+	return &m
+}
+
+func TestValidate(t *testing.T) {
+
+	input := []struct {
+		coupon Coupon
+		err    error
+	}{
+		{Coupon{Code: "SALE10", Kind: KindPercent, Percent: "10"}, nil},
+		{Coupon{Code: "SALE", Kind: KindPercent, Percent: "0.01"}, nil},
+		{Coupon{Code: "SALE", Kind: KindPercent, Percent: "0"}, percent.ErrInvalid},
+		{Coupon{Code: "SALE", Kind: KindPercent, Percent: "100.5"}, percent.ErrInvalid},
+		{Coupon{Code: "SALE", Kind: KindPercent, Percent: "-5"}, percent.ErrInvalid},
+		{Coupon{Code: "SALE", Kind: KindPercent, Percent: "5%"}, percent.ErrInvalid},
+		{Coupon{Code: "SALE", Kind: KindPercent, Percent: "Inf"}, percent.ErrInvalid},
+		{Coupon{Kind: KindPercent, Percent: "10"}, ErrCodeRequired},
+		{Coupon{Code: "SALE", Kind: KindPercent, Percent: "10", UsageLimit: -1}, ErrInvalidLimit},
+		{Coupon{Code: "SALE", Kind: KindPercent, Percent: "10", PerUserLimit: -1}, ErrInvalidLimit},
+		{Coupon{Code: "FIX", Kind: KindFixed, Fixed: amount(money.New(500, 2)), Currency: "RUB"}, nil},
+		{Coupon{Code: "FIX", Kind: KindFixed, Fixed: amount(money.New(500, 2))}, ErrInvalidFixed},
+		{Coupon{Code: "FIX", Kind: KindFixed, Fixed: amount(money.New(0, 2)), Currency: "RUB"}, ErrInvalidFixed},
+		{Coupon{Code: "FIX", Kind: KindFixed, Fixed: amount(money.New(-1, 2)), Currency: "RUB"}, ErrInvalidFixed},
+		{Coupon{Code: "FIX", Kind: KindFixed, Currency: "RUB"}, ErrInvalidFixed},
+		{Coupon{Code: "FREE", Kind: "gift"}, ErrInvalidKind},
+	}
+	for i, val := range input {
+		if err := val.coupon.Validate(); err != val.err {
+			t.Errorf("Row %v, actual error: %v, expected: %v", i+1, err, val.err)
+		}
+	}
+}
+
+func TestDiscounts(t *testing.T) {
+
+	input := []struct {
+		coupon  Coupon
+		costs   []money.Money
+		results []money.Money
+		err     error
+	}{
+		{Coupon{Code: "P", Kind: KindPercent, Percent: "10"}, []money.Money{money.New(10000, 2), money.New(999, 2)},
+			[]money.Money{money.New(1000, 2), money.New(99, 2)}, nil}, // rounded down
+		{Coupon{Code: "P", Kind: KindPercent, Percent: "33.33"}, []money.Money{money.New(1, 0)}, []money.Money{money.New(0, 0)}, nil},
+		// fixed discount is taken off the costs in turn and never exceeds them
+		{Coupon{Code: "F", Kind: KindFixed, Fixed: amount(money.New(15, 0)), Currency: "RUB"}, []money.Money{money.New(1000, 2), money.New(1000, 2), money.New(1000, 2)},
+			[]money.Money{money.New(1000, 2), money.New(500, 2), money.New(0, 2)}, nil},
+		{Coupon{Code: "F", Kind: KindFixed, Fixed: amount(money.New(150, 2)), Currency: "JPY"}, []money.Money{money.New(100, 0)}, nil, money.ErrPrecision},
+		{Coupon{Code: "P", Kind: KindPercent, Percent: "x"}, []money.Money{money.New(100, 0)}, nil, percent.ErrInvalid},
+	}
+	for i, val := range input {
+		results, err := val.coupon.Discounts(val.costs)
+		if err != val.err || len(results) != len(val.results) {
+			t.Errorf("Row %v, actual: %v, %v, expected: %v, %v", i+1, results, err, val.results, val.err)
+			continue
+		}
+		for j := range results {
+			if results[j] != val.results[j] {
+				t.Errorf("Row %v, line %v, actual discount: %v, expected: %v", i+1, j+1, results[j], val.results[j])
+			}
+		}
+	}
+}
+
+func TestFitsAndExpired(t *testing.T) {
+
+	at := time.Date(2023, 5, 10, 0, 0, 0, 0, time.UTC)
+	c := Coupon{ServiceID: 7, Currency: "RUB", ExpiresAt: &at}
+	input := []struct {
+		serviceID int
+		code      string
+		fits      bool
+	}{
+		{7, "RUB", true},
+		{8, "RUB", false},
+		{7, "USD", false},
+	}
+	for i, val := range input {
+		if fits := c.Fits(val.serviceID, val.code); fits != val.fits {
+			t.Errorf("Row %v, actual fits: %v, expected: %v", i+1, fits, val.fits)
+		}
+	}
+	if !(Coupon{}).Fits(1, "USD") {
+		t.Errorf("Test fits, coupon without service and currency must fit everything")
+	}
+	if c.Expired(at.Add(-time.Second)) || !c.Expired(at) {
+		t.Errorf("Test expired, coupon must expire exactly at %v", at)
+	}
+}
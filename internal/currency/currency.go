@@ -0,0 +1,58 @@
+package currency
+
+import (
+	"strings"
+
+	"github.com/antsrp/balance_service/internal/money"
+	"github.com/pkg/errors"
+)
+
+const UnknownCurrency = "Unknown currency"
+
+var ErrUnknownCurrency = errors.New(UnknownCurrency)
+
+// exponents of minor units of the supported ISO 4217 currencies
+var exponents = map[string]int{
+	"RUB": 2,
+	"USD": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"CNY": 2,
+	"KZT": 2,
+	"BYN": 2,
+	"TRY": 2,
+	"AED": 2,
+	"JPY": 0,
+	"KRW": 0,
+	"KWD": 3,
+}
+
+// Parse normalizes ISO 4217 code and checks the currency is supported
+func Parse(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if _, ok := exponents[code]; !ok {
+		return "", ErrUnknownCurrency
+	}
+	return code, nil
+}
+
+// Exponent returns number of digits of minor units of the currency
+func Exponent(code string) (int, bool) {
+	e, ok := exponents[code]
+	return e, ok
+}
+
+// Amount returns money given in minor units of the currency
+func Amount(minor int64, code string) money.Money {
+	e, _ := Exponent(code)
+	return money.New(minor, e)
+}
+
+// Normalize brings the amount to minor units of the currency, it fails if the amount has more decimal places
+func Normalize(m money.Money, code string) (money.Money, error) {
+	e, ok := Exponent(code)
+	if !ok {
+		return money.Money{}, ErrUnknownCurrency
+	}
+	return m.Rescale(e)
+}
@@ -0,0 +1,81 @@
+package exchange
+
+import (
+	"math/big"
+	"regexp"
+	"time"
+
+	"github.com/antsrp/balance_service/internal/currency"
+	"github.com/antsrp/balance_service/internal/money"
+	"github.com/pkg/errors"
+)
+
+const (
+	InvalidRate        = "Invalid exchange rate"
+	ConversionOverflow = "Converted amount is too large"
+)
+
+var decimalRe = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?$`)
+
+var (
+	ErrInvalidRate        = errors.New(InvalidRate)
+	ErrConversionOverflow = errors.New(ConversionOverflow)
+)
+
+// Rate is an amount of quote currency paid for one unit of base currency, it is in effect since EffectiveFrom
+// until the next rate of the pair
+type Rate struct {
+	ID            int        `json:"id,omitempty"`
+	Base          string     `json:"base"`
+	Quote         string     `json:"quote"`
+	Rate          string     `json:"rate"`
+	EffectiveFrom *time.Time `json:"effective_from,omitempty"`
+}
+
+type Storage interface {
+	CreateRate(*Rate) (int, error)
+	GetRates(base, quote string) ([]Rate, error)
+	DeleteAllRates() error
+}
+
+// ParseRate checks the rate is a positive decimal number
+func ParseRate(rate string) (*big.Rat, error) {
+	if !decimalRe.MatchString(rate) {
+		return nil, ErrInvalidRate
+	}
+	r, ok := new(big.Rat).SetString(rate)
+	if !ok || r.Sign() <= 0 {
+		return nil, ErrInvalidRate
+	}
+	return r, nil
+}
+
+// Convert converts amount of base currency to minor units of quote currency by the rate.
+// The result is rounded down
+func Convert(amount money.Money, rate, quote string) (money.Money, error) {
+	r, err := ParseRate(rate)
+	if err != nil {
+		return money.Money{}, err
+	}
+	eq, ok := currency.Exponent(quote)
+	if !ok {
+		return money.Money{}, currency.ErrUnknownCurrency
+	}
+
+	v := new(big.Rat).Mul(new(big.Rat).SetInt64(amount.Amount), r)
+	if eq > amount.Exponent {
+		v.Mul(v, new(big.Rat).SetInt(pow10(eq-amount.Exponent)))
+	} else if eq < amount.Exponent {
+		v.Quo(v, new(big.Rat).SetInt(pow10(amount.Exponent-eq)))
+	}
+
+	converted := new(big.Int).Quo(v.Num(), v.Denom())
+	if !converted.IsInt64() {
+		return money.Money{}, ErrConversionOverflow
+	}
+	return money.New(converted.Int64(), eq), nil
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
@@ -0,0 +1,116 @@
+package fee
+
+import (
+	"github.com/antsrp/balance_service/internal/money"
+	"github.com/antsrp/balance_service/internal/percent"
+	"github.com/pkg/errors"
+)
+
+// kinds of fee schedules
+const (
+	KindPercent = "percent" // percent of the cost
+	KindFixed   = "fixed"   // fixed amount per order
+	KindTiered  = "tiered"  // percent of the tier the cost falls into
+)
+
+const (
+	InvalidKind  = "Invalid kind of fee schedule"
+	InvalidFixed = "Fixed fee must be set and not negative"
+	InvalidTiers = "Tiers must begin at zero and go in ascending order"
+)
+
+var (
+	ErrInvalidKind  = errors.New(InvalidKind)
+	ErrInvalidFixed = errors.New(InvalidFixed)
+	ErrInvalidTiers = errors.New(InvalidTiers)
+)
+
+// Tier applies its percent to the cost not less than its beginning
+type Tier struct {
+	From    money.Money `json:"from" swaggertype:"string"`
+	Percent string      `json:"percent"`
+}
+
+// Schedule is the platform fee taken from revenue of the service in the currency when an order is recognized
+type Schedule struct {
+	ServiceID int          `json:"service_id"`
+	Currency  string       `json:"currency"`
+	Kind      string       `json:"kind" enums:"percent,fixed,tiered"`
+	Percent   string       `json:"percent,omitempty"`
+	Fixed     *money.Money `json:"fixed,omitempty" swaggertype:"string"`
+	Tiers     []Tier       `json:"tiers,omitempty"`
+}
+
+type Storage interface {
+	SetSchedule(*Schedule) error
+	GetSchedules(serviceID int) ([]Schedule, error)
+	DeleteSchedule(serviceID int, currency string) error
+	DeleteAllSchedules() error
+}
+
+// ClearOtherKinds drops the fields of other kinds than the kind of schedule, they are not kept
+func (s *Schedule) ClearOtherKinds() {
+	switch s.Kind {
+	case KindPercent:
+		s.Fixed, s.Tiers = nil, nil
+	case KindFixed:
+		s.Percent, s.Tiers = "", nil
+	case KindTiered:
+		s.Percent, s.Fixed = "", nil
+	}
+}
+
+// Validate checks the schedule has the fields of its kind
+func (s Schedule) Validate() error {
+	switch s.Kind {
+	case KindPercent:
+		_, err := percent.Parse(s.Percent)
+		return err
+	case KindFixed:
+		if s.Fixed == nil || s.Fixed.IsNegative() {
+			return ErrInvalidFixed
+		}
+		return nil
+	case KindTiered:
+		if len(s.Tiers) == 0 || !s.Tiers[0].From.IsZero() {
+			return ErrInvalidTiers
+		}
+		for i, t := range s.Tiers {
+			if i > 0 && t.From.Cmp(s.Tiers[i-1].From) <= 0 {
+				return ErrInvalidTiers
+			}
+			if _, err := percent.Parse(t.Percent); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return ErrInvalidKind
+}
+
+// Calculate returns the fee of the order cost rounded down to minor units of the cost, fee never exceeds the cost
+func (s Schedule) Calculate(cost money.Money) (money.Money, error) {
+	if err := s.Validate(); err != nil {
+		return money.Money{}, err
+	}
+	rate := s.Percent
+	switch s.Kind {
+	case KindFixed:
+		if s.Fixed.Cmp(cost) > 0 {
+			return cost, nil
+		}
+		return s.Fixed.Rescale(cost.Exponent)
+	case KindTiered:
+		for _, t := range s.Tiers {
+			if t.From.Cmp(cost) > 0 {
+				break
+			}
+			rate = t.Percent
+		}
+	}
+	p, err := percent.Parse(rate)
+	if err != nil {
+		return money.Money{}, err
+	}
+	return cost.Percent(p), nil
+}
@@ -0,0 +1,86 @@
+package fee
+
+import (
+	"testing"
+
+	"github.com/antsrp/balance_service/internal/money"
+	"github.com/antsrp/balance_service/internal/percent"
+)
+
+func amount(m money.Money) *money.Money {
+	return &m
+}
+
+func TestValidate(t *testing.T) {
+
+	tiers := []Tier{{From: money.New(0, 2), Percent: "10"}, {From: money.New(100000, 2), Percent: "5"}}
+	input := []struct {
+		schedule Schedule
+		err      error
+	}{
+		{Schedule{Kind: KindPercent, Percent: "2.5"}, nil},
+		{Schedule{Kind: KindPercent, Percent: "0"}, nil},
+		{Schedule{Kind: KindPercent, Percent: "100"}, nil},
+		{Schedule{Kind: KindPercent, Percent: "100.01"}, percent.ErrInvalid},
+		{Schedule{Kind: KindPercent, Percent: "-1"}, percent.ErrInvalid},
+		{Schedule{Kind: KindPercent, Percent: "1e1"}, percent.ErrInvalid},
+		{Schedule{Kind: KindPercent, Percent: "1/2"}, percent.ErrInvalid},
+		{Schedule{Kind: KindPercent}, percent.ErrInvalid},
+		{Schedule{Kind: KindFixed, Fixed: amount(money.New(0, 2))}, nil},
+		{Schedule{Kind: KindFixed, Fixed: amount(money.New(-1, 2))}, ErrInvalidFixed},
+		{Schedule{Kind: KindFixed}, ErrInvalidFixed},
+		{Schedule{Kind: KindTiered, Tiers: tiers}, nil},
+		{Schedule{Kind: KindTiered}, ErrInvalidTiers},
+		{Schedule{Kind: KindTiered, Tiers: tiers[1:]}, ErrInvalidTiers},
+		{Schedule{Kind: KindTiered, Tiers: []Tier{tiers[0], tiers[0]}}, ErrInvalidTiers},
+		{Schedule{Kind: KindTiered, Tiers: []Tier{tiers[0], {From: money.New(1, 0), Percent: "abc"}}}, percent.ErrInvalid},
+		{Schedule{Kind: "flat", Percent: "1"}, ErrInvalidKind},
+	}
+	for i, val := range input {
+		if err := val.schedule.Validate(); err != val.err {
+			t.Errorf("Row %v, actual error: %v, expected: %v", i+1, err, val.err)
+		}
+	}
+}
+
+func TestCalculate(t *testing.T) {
+
+	tiered := Schedule{Kind: KindTiered, Tiers: []Tier{
+		{From: money.New(0, 0), Percent: "10"},
+		{From: money.New(1000, 0), Percent: "5"},
+		{From: money.New(5000, 0), Percent: "2.5"},
+	}}
+	input := []struct {
+		schedule Schedule
+		cost     money.Money
+		result   money.Money
+		err      error
+	}{
+		{Schedule{Kind: KindPercent, Percent: "10"}, money.New(30000, 2), money.New(3000, 2), nil},
+		{Schedule{Kind: KindPercent, Percent: "10"}, money.New(999, 2), money.New(99, 2), nil}, // rounded down
+		{Schedule{Kind: KindPercent, Percent: "0.5"}, money.New(199, 0), money.New(0, 0), nil},
+		{Schedule{Kind: KindPercent, Percent: "0"}, money.New(10000, 2), money.New(0, 2), nil},
+		{Schedule{Kind: KindFixed, Fixed: amount(money.New(15, 0))}, money.New(30000, 2), money.New(1500, 2), nil},
+		{Schedule{Kind: KindFixed, Fixed: amount(money.New(500, 2))}, money.New(300, 2), money.New(300, 2), nil}, // never exceeds the cost
+		{Schedule{Kind: KindFixed, Fixed: amount(money.New(155, 2))}, money.New(100, 0), money.Money{}, money.ErrPrecision},
+		{tiered, money.New(999, 0), money.New(99, 0), nil},
+		{tiered, money.New(1000, 0), money.New(50, 0), nil},
+		{tiered, money.New(6000, 0), money.New(150, 0), nil},
+		{Schedule{Kind: KindPercent, Percent: "abc"}, money.New(100, 0), money.Money{}, percent.ErrInvalid},
+	}
+	for i, val := range input {
+		result, err := val.schedule.Calculate(val.cost)
+		if result != val.result || err != val.err {
+			t.Errorf("Row %v, actual: %v, %v, expected: %v, %v", i+1, result, err, val.result, val.err)
+		}
+	}
+}
+
+func TestClearOtherKinds(t *testing.T) {
+
+	s := Schedule{Kind: KindFixed, Percent: "10", Fixed: amount(money.New(1, 0)), Tiers: []Tier{{Percent: "1"}}}
+	s.ClearOtherKinds()
+	if s.Percent != "" || s.Tiers != nil || s.Fixed == nil {
+		t.Errorf("Test clear, unexpected schedule: %+v", s)
+	}
+}
@@ -0,0 +1,132 @@
+package ledger
+
+// kinds of accounts
+const (
+	AccountWallet   = "wallet"   // money of user available for operations
+	AccountHold     = "hold"     // money of user reserved for orders
+	AccountRevenue  = "revenue"  // revenue of service
+	AccountExternal = "external" // funding coming from outside of the system
+	AccountExchange = "exchange" // position of the system in the currency after conversions
+	AccountPromo    = "promo"    // bonuses granted by marketing
+	AccountFee      = "fee"      // platform fee taken from revenue of service
+)
+
+// kinds of journal entries
+const (
+	EntryTopUp       = "top_up"
+	EntryReserve     = "reserve"
+	EntryRevenue     = "revenue"
+	EntryAdjustment  = "adjustment"
+	EntryReversal    = "reversal"
+	EntryRefund      = "refund"
+	EntryTransfer    = "transfer"
+	EntryBonus       = "bonus"
+	EntryBonusExpiry = "bonus_expiry"
+	EntryCashback    = "cashback"
+	EntryPayout      = "payout"
+	EntryVoucher     = "voucher"
+	EntryWithdrawal  = "withdrawal"
+)
+
+type Account struct {
+	Kind      string `json:"kind"`
+	UserID    int    `json:"user_id,omitempty"`
+	ServiceID int    `json:"service_id,omitempty"`
+	Currency  string `json:"currency"`
+}
+
+func Wallet(userID int, currency string) Account {
+	return Account{Kind: AccountWallet, UserID: userID, Currency: currency}
+}
+
+func Hold(userID int, currency string) Account {
+	return Account{Kind: AccountHold, UserID: userID, Currency: currency}
+}
+
+func Revenue(serviceID int, currency string) Account {
+	return Account{Kind: AccountRevenue, ServiceID: serviceID, Currency: currency}
+}
+
+func External(currency string) Account {
+	return Account{Kind: AccountExternal, Currency: currency}
+}
+
+func Exchange(currency string) Account {
+	return Account{Kind: AccountExchange, Currency: currency}
+}
+
+func Promo(currency string) Account {
+	return Account{Kind: AccountPromo, Currency: currency}
+}
+
+func Fee(serviceID int, currency string) Account {
+	return Account{Kind: AccountFee, ServiceID: serviceID, Currency: currency}
+}
+
+// Posting is a signed movement on the account: positive amount credits it, negative one debits
+type Posting struct {
+	Account Account `json:"account"`
+	Amount  int64   `json:"amount"`
+}
+
+// Entry is a journal entry bound with the transaction it was made for
+type Entry struct {
+	Kind          string    `json:"kind"`
+	TransactionID int       `json:"transaction_id,omitempty"`
+	Postings      []Posting `json:"postings"`
+}
+
+// Transfer creates an entry moving amount from one account to another
+func Transfer(kind string, transactionID int, from, to Account, amount int64) *Entry {
+	return &Entry{
+		Kind:          kind,
+		TransactionID: transactionID,
+		Postings: []Posting{
+			{Account: from, Amount: -amount},
+			{Account: to, Amount: amount},
+		},
+	}
+}
+
+// Move adds postings moving amount from one account to another to the entry, zero amount adds nothing
+func (e *Entry) Move(from, to Account, amount int64) *Entry {
+	if amount != 0 {
+		e.Postings = append(e.Postings, Posting{Account: from, Amount: -amount}, Posting{Account: to, Amount: amount})
+	}
+	return e
+}
+
+// Convert creates an entry moving amount from one account to another in a different currency
+// through the exchange accounts of both currencies
+func Convert(kind string, transactionID int, from, to Account, amount, converted int64) *Entry {
+	if from.Currency == to.Currency {
+		return Transfer(kind, transactionID, from, to, amount)
+	}
+	return &Entry{
+		Kind:          kind,
+		TransactionID: transactionID,
+		Postings: []Posting{
+			{Account: from, Amount: -amount},
+			{Account: Exchange(from.Currency), Amount: amount},
+			{Account: Exchange(to.Currency), Amount: -converted},
+			{Account: to, Amount: converted},
+		},
+	}
+}
+
+// Balanced reports whether postings of the entry sum to zero in each currency
+func (e *Entry) Balanced() bool {
+	if len(e.Postings) < 2 {
+		return false
+	}
+	sums := make(map[string]int64)
+	for _, p := range e.Postings {
+		sums[p.Account.Currency] += p.Amount
+	}
+	for _, sum := range sums {
+		if sum != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,69 @@
+package ledger
+
+import (
+	"testing"
+)
+
+func TestBalanced(t *testing.T) {
+
+	input := []struct {
+		entry    *Entry
+		balanced bool
+	}{
+		{Transfer(EntryTopUp, 1, External("RUB"), Wallet(1, "RUB"), 1000), true},
+		{Transfer(EntryRevenue, 2, Hold(1, "RUB"), Revenue(7, "RUB"), 30000).Move(Revenue(7, "RUB"), Fee(7, "RUB"), 3000), true},
+		{Convert(EntryTransfer, 3, Wallet(1, "USD"), Wallet(2, "RUB"), 100, 6200), true},
+		{Convert(EntryTransfer, 4, Wallet(1, "RUB"), Wallet(2, "RUB"), 100, 100), true},
+		{&Entry{Kind: EntryAdjustment}, false},
+		{&Entry{Kind: EntryAdjustment, Postings: []Posting{{Account: Wallet(1, "RUB"), Amount: 100}}}, false},
+		{&Entry{Kind: EntryAdjustment, Postings: []Posting{{Account: Wallet(1, "RUB"), Amount: 100}, {Account: External("RUB"), Amount: -99}}}, false},
+		// postings in different currencies don't offset each other
+		{&Entry{Kind: EntryTransfer, Postings: []Posting{{Account: Wallet(1, "USD"), Amount: -100}, {Account: Wallet(2, "RUB"), Amount: 100}}}, false},
+	}
+	for i, val := range input {
+		if balanced := val.entry.Balanced(); balanced != val.balanced {
+			t.Errorf("Row %v, actual balanced: %v, expected: %v, entry: %+v", i+1, balanced, val.balanced, val.entry)
+		}
+	}
+}
+
+func TestMove(t *testing.T) {
+
+	input := []struct {
+		amount   int64
+		postings int
+	}{
+		{0, 2}, // zero amount adds nothing
+		{500, 4},
+		{-500, 4},
+	}
+	for i, val := range input {
+		e := Transfer(EntryRevenue, 1, Hold(1, "RUB"), Revenue(7, "RUB"), 1000).Move(Revenue(7, "RUB"), Fee(7, "RUB"), val.amount)
+		if len(e.Postings) != val.postings || !e.Balanced() {
+			t.Errorf("Row %v, actual postings: %+v, expected: %v", i+1, e.Postings, val.postings)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+
+	e := Convert(EntryTransfer, 1, Wallet(1, "USD"), Wallet(2, "RUB"), 100, 6200)
+	expected := []Posting{
+		{Account: Wallet(1, "USD"), Amount: -100},
+		{Account: Exchange("USD"), Amount: 100},
+		{Account: Exchange("RUB"), Amount: -6200},
+		{Account: Wallet(2, "RUB"), Amount: 6200},
+	}
+	if len(e.Postings) != len(expected) {
+		t.Fatalf("Test convert, actual postings: %+v, expected: %+v", e.Postings, expected)
+	}
+	for i := range expected {
+		if e.Postings[i] != expected[i] {
+			t.Errorf("Posting %v, actual: %+v, expected: %+v", i+1, e.Postings[i], expected[i])
+		}
+	}
+	// the same currency is moved without exchange accounts
+	if same := Convert(EntryTransfer, 2, Wallet(1, "RUB"), Wallet(2, "RUB"), 100, 100); len(same.Postings) != 2 {
+		t.Errorf("Test convert, actual postings in the same currency: %+v", same.Postings)
+	}
+}
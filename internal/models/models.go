@@ -1,6 +1,10 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"github.com/antsrp/balance_service/internal/money"
+)
 
 type Chain struct {
 	ID        int `json:"user_id" example:"1"`
@@ -10,22 +14,203 @@ type Chain struct {
 
 type Frame struct {
 	Chain
-	Cost uint64 `json:"cost" example:"100"`
+	Cost     money.Money `json:"cost" swaggertype:"string" example:"100.00"`
+	Currency string      `json:"currency" example:"RUB"`
 }
 
 type AddBalanceRequest struct {
-	ID      int        `json:"user_id" example:"1"`
-	Time    *time.Time `json:"time" example:"2020-03-21T12:00:00Z"`
-	Comment string     `json:"comment" example:"some description of comment"`
-	Balance uint64     `json:"balance" example:"200"`
+	ID         int         `json:"user_id" example:"1"`
+	Time       *time.Time  `json:"time" example:"2020-03-21T12:00:00Z"`
+	Comment    string      `json:"comment" example:"some description of comment"`
+	Balance    money.Money `json:"balance" swaggertype:"string" example:"200.00"`
+	Currency   string      `json:"currency" example:"RUB"`
+	ToCurrency string      `json:"to_currency" example:"USD"`
 }
 
 type ReserveRequest struct {
 	Frame
-	Comment string `json:"comment" example:"some description of comment"`
+	Comment  string `json:"comment" example:"some description of comment"`
+	PayeeID  int    `json:"payee_id" example:"2"`
+	Quantity int    `json:"quantity" example:"2"`
+	Coupon   string `json:"coupon" example:"SPRING10"`
 }
 
 type RevenueRequest struct {
 	Frame
 	ClosedAt *time.Time `json:"closed_at" example:"2020-03-21T12:00:00Z"`
 }
+
+type OrderLine struct {
+	ServiceID int         `json:"service_id" example:"1"`
+	Cost      money.Money `json:"cost" swaggertype:"string" example:"100.00"`
+	Comment   string      `json:"comment" example:"some description of comment"`
+	PayeeID   int         `json:"payee_id" example:"2"`
+	Quantity  int         `json:"quantity" example:"2"`
+}
+
+type OrderRequest struct {
+	ID       int         `json:"user_id" example:"1"`
+	OrderID  int         `json:"order_id" example:"1"`
+	Currency string      `json:"currency" example:"RUB"`
+	Coupon   string      `json:"coupon" example:"SPRING10"`
+	Lines    []OrderLine `json:"lines"`
+}
+
+type OrderRevenueRequest struct {
+	OrderRequest
+	ClosedAt *time.Time `json:"closed_at" example:"2020-03-21T12:00:00Z"`
+}
+
+type ReversalRequest struct {
+	TransactionID int        `json:"transaction_id" example:"1"`
+	Reason        string     `json:"reason" example:"mistaken top-up"`
+	Time          *time.Time `json:"time" example:"2020-03-21T12:00:00Z"`
+}
+
+type RefundRequest struct {
+	Chain
+	Amount  money.Money `json:"amount" swaggertype:"string" example:"50.00"`
+	Comment string      `json:"comment" example:"returned goods"`
+	Time    *time.Time  `json:"time" example:"2020-03-21T12:00:00Z"`
+}
+
+type TransferRequest struct {
+	FromUserID int         `json:"from_user_id" example:"1"`
+	ToUserID   int         `json:"to_user_id" example:"2"`
+	Amount     money.Money `json:"amount" swaggertype:"string" example:"100.00"`
+	Currency   string      `json:"currency" example:"RUB"`
+	ToCurrency string      `json:"to_currency" example:"USD"`
+	Comment    string      `json:"comment" example:"payback"`
+	Time       *time.Time  `json:"time" example:"2020-03-21T12:00:00Z"`
+}
+
+type CreditLimitRequest struct {
+	ID          int         `json:"user_id" example:"1"`
+	Currency    string      `json:"currency" example:"RUB"`
+	CreditLimit money.Money `json:"credit_limit" swaggertype:"string" example:"5000.00"`
+}
+
+type SpendingLimitRequest struct {
+	ID        int         `json:"user_id" example:"1"`
+	ServiceID *int        `json:"service_id" example:"1"`
+	Period    string      `json:"period" example:"day" enums:"day,month"`
+	Currency  string      `json:"currency" example:"RUB"`
+	Amount    money.Money `json:"amount" swaggertype:"string" example:"1000.00"`
+}
+
+type AccountStateRequest struct {
+	ID     int        `json:"user_id" example:"1"`
+	State  string     `json:"state" example:"frozen" enums:"active,frozen,closed"`
+	Reason string     `json:"reason" example:"suspicious activity"`
+	Time   *time.Time `json:"time" example:"2020-03-21T12:00:00Z"`
+}
+
+type BonusRequest struct {
+	ID        int         `json:"user_id" example:"1"`
+	Currency  string      `json:"currency" example:"RUB"`
+	Amount    money.Money `json:"amount" swaggertype:"string" example:"300.00"`
+	Source    string      `json:"source" example:"spring campaign"`
+	ExpiresAt *time.Time  `json:"expires_at" example:"2020-04-21T00:00:00Z"`
+	Comment   string      `json:"comment" example:"welcome bonus"`
+}
+
+type CashbackRuleRequest struct {
+	ServiceID int         `json:"service_id" example:"1"`
+	Currency  string      `json:"currency" example:"RUB"`
+	Percent   string      `json:"percent" example:"5"`
+	Cap       money.Money `json:"cap" swaggertype:"string" example:"100.00"`
+	ValidFrom *time.Time  `json:"valid_from" example:"2020-03-01T00:00:00Z"`
+	ValidTo   *time.Time  `json:"valid_to" example:"2020-04-01T00:00:00Z"`
+}
+
+type FeeTierRequest struct {
+	From    money.Money `json:"from" swaggertype:"string" example:"1000.00"`
+	Percent string      `json:"percent" example:"3"`
+}
+
+type FeeScheduleRequest struct {
+	ServiceID int              `json:"service_id" example:"1"`
+	Currency  string           `json:"currency" example:"RUB"`
+	Kind      string           `json:"kind" enums:"percent,fixed,tiered" example:"tiered"`
+	Percent   string           `json:"percent" example:"5"`
+	Fixed     money.Money      `json:"fixed" swaggertype:"string" example:"10.00"`
+	Tiers     []FeeTierRequest `json:"tiers"`
+}
+
+type CouponRequest struct {
+	Code         string      `json:"code" example:"SPRING10"`
+	Kind         string      `json:"kind" enums:"percent,fixed" example:"percent"`
+	Percent      string      `json:"percent" example:"10"`
+	Fixed        money.Money `json:"fixed" swaggertype:"string" example:"50.00"`
+	Currency     string      `json:"currency" example:"RUB"`
+	ServiceID    int         `json:"service_id" example:"1"`
+	UsageLimit   int         `json:"usage_limit" example:"100"`
+	PerUserLimit int         `json:"per_user_limit" example:"1"`
+	ExpiresAt    *time.Time  `json:"expires_at" example:"2030-01-01T00:00:00Z"`
+}
+
+type VoucherBatchRequest struct {
+	Count     int         `json:"count" example:"100"`
+	Value     money.Money `json:"value" swaggertype:"string" example:"500.00"`
+	Currency  string      `json:"currency" example:"RUB"`
+	ExpiresAt *time.Time  `json:"expires_at" example:"2030-01-01T00:00:00Z"`
+}
+
+type RedeemVoucherRequest struct {
+	ID   int    `json:"user_id" example:"1"`
+	Code string `json:"code" example:"ABCD-EFGH-JKLM"`
+}
+
+type TopUpRequest struct {
+	ID       int         `json:"user_id" example:"1"`
+	Amount   money.Money `json:"amount" swaggertype:"string" example:"500.00"`
+	Currency string      `json:"currency" example:"RUB"`
+}
+
+type PaymentCallbackRequest struct {
+	PaymentID string `json:"payment_id" example:"mock_3f2a9c0d1e7b4a65"`
+	Status    string `json:"status" enums:"succeeded,failed" example:"succeeded"`
+}
+
+type WithdrawalRequest struct {
+	ID          int         `json:"user_id" example:"1"`
+	Amount      money.Money `json:"amount" swaggertype:"string" example:"5000.00"`
+	Currency    string      `json:"currency" example:"RUB"`
+	Comment     string      `json:"comment" example:"to card *1234"`
+	RequestedBy string      `json:"requested_by" example:"alice"`
+}
+
+type WithdrawalDecisionRequest struct {
+	ID     int    `json:"id" example:"1"`
+	Actor  string `json:"actor" example:"bob"`
+	Reason string `json:"reason" example:"card of another person"`
+}
+
+type AdjustmentRequest struct {
+	ID          int         `json:"user_id" example:"1"`
+	Direction   string      `json:"direction" enums:"credit,debit" example:"credit"`
+	Amount      money.Money `json:"amount" swaggertype:"string" example:"1500.00"`
+	Currency    string      `json:"currency" example:"RUB"`
+	ReasonCode  string      `json:"reason_code" enums:"correction,goodwill,chargeback,fraud,migration" example:"correction"`
+	Comment     string      `json:"comment" example:"top-up #1234 was credited twice"`
+	RequestedBy string      `json:"requested_by" example:"alice"`
+}
+
+type AdjustmentDecisionRequest struct {
+	ID    int    `json:"id" example:"1"`
+	Actor string `json:"actor" example:"bob"`
+}
+
+type PriceRequest struct {
+	ServiceID     int         `json:"service_id" example:"1"`
+	Currency      string      `json:"currency" example:"RUB"`
+	Price         money.Money `json:"price" swaggertype:"string" example:"50.00"`
+	EffectiveFrom *time.Time  `json:"effective_from" example:"2020-03-21T00:00:00Z"`
+}
+
+type ExchangeRateRequest struct {
+	Base          string     `json:"base" example:"USD"`
+	Quote         string     `json:"quote" example:"RUB"`
+	Rate          string     `json:"rate" example:"61.25"`
+	EffectiveFrom *time.Time `json:"effective_from" example:"2020-03-21T00:00:00Z"`
+}
@@ -0,0 +1,195 @@
+package money
+
+import (
+	"bytes"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	InvalidAmount = "Invalid amount"
+	Overflow      = "Amount overflow"
+	Precision     = "Amount has more decimal places than currency allows"
+
+	maxExponent = 18
+)
+
+var (
+	ErrInvalidAmount = errors.New(InvalidAmount)
+	ErrOverflow      = errors.New(Overflow)
+	ErrPrecision     = errors.New(Precision)
+)
+
+var decimalRe = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+
+// Money is an amount in minor units of currency along with the exponent of minor units,
+// e.g. {Amount: 12345, Exponent: 2} is 123.45
+type Money struct {
+	Amount   int64
+	Exponent int
+}
+
+func New(amount int64, exponent int) Money {
+	return Money{Amount: amount, Exponent: exponent}
+}
+
+// Parse reads decimal string, exponent of the result is the number of its decimal places
+func Parse(s string) (Money, error) {
+	if !decimalRe.MatchString(s) {
+		return Money{}, ErrInvalidAmount
+	}
+	exponent := 0
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		exponent = len(s) - i - 1
+		s = s[:i] + s[i+1:]
+	}
+	if exponent > maxExponent {
+		return Money{}, ErrPrecision
+	}
+	amount, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return Money{}, ErrOverflow
+	}
+	return New(amount, exponent), nil
+}
+
+// String formats the amount as decimal with all decimal places of minor units
+func (m Money) String() string {
+	sign := ""
+	abs := uint64(m.Amount)
+	if m.Amount < 0 {
+		sign, abs = "-", -abs
+	}
+	digits := strconv.FormatUint(abs, 10)
+	if m.Exponent <= 0 {
+		return sign + digits
+	}
+	if len(digits) <= m.Exponent {
+		digits = strings.Repeat("0", m.Exponent-len(digits)+1) + digits
+	}
+	point := len(digits) - m.Exponent
+	return sign + digits[:point] + "." + digits[point:]
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(m.String())), nil
+}
+
+// UnmarshalJSON accepts decimal string as well as JSON number
+func (m *Money) UnmarshalJSON(b []byte) error {
+	s := string(bytes.TrimSpace(b))
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+	parsed, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+// Rescale returns the same amount in minor units of other exponent,
+// decimal places are never dropped silently
+func (m Money) Rescale(exponent int) (Money, error) {
+	if exponent < 0 || exponent > maxExponent {
+		return Money{}, ErrPrecision
+	}
+	amount := m.Amount
+	for e := m.Exponent; e < exponent; e++ {
+		if amount > math.MaxInt64/10 || amount < math.MinInt64/10 {
+			return Money{}, ErrOverflow
+		}
+		amount *= 10
+	}
+	for e := m.Exponent; e > exponent; e-- {
+		if amount%10 != 0 {
+			return Money{}, ErrPrecision
+		}
+		amount /= 10
+	}
+	return New(amount, exponent), nil
+}
+
+// Add returns the sum, amounts of different exponents are brought to the larger one
+func (m Money) Add(o Money) (Money, error) {
+	a, b, err := align(m, o)
+	if err != nil {
+		return Money{}, err
+	}
+	if (b.Amount > 0 && a.Amount > math.MaxInt64-b.Amount) || (b.Amount < 0 && a.Amount < math.MinInt64-b.Amount) {
+		return Money{}, ErrOverflow
+	}
+	return New(a.Amount+b.Amount, a.Exponent), nil
+}
+
+// Sub returns the difference, amounts of different exponents are brought to the larger one
+func (m Money) Sub(o Money) (Money, error) {
+	a, b, err := align(m, o)
+	if err != nil {
+		return Money{}, err
+	}
+	if (b.Amount < 0 && a.Amount > math.MaxInt64+b.Amount) || (b.Amount > 0 && a.Amount < math.MinInt64+b.Amount) {
+		return Money{}, ErrOverflow
+	}
+	return New(a.Amount-b.Amount, a.Exponent), nil
+}
+
+// Cmp compares amounts, it returns -1, 0 or +1
+func (m Money) Cmp(o Money) int {
+	a, b, err := align(m, o)
+	if err != nil { // the amount brought to the larger exponent overflows, so it is larger by magnitude
+		if m.Exponent < o.Exponent {
+			return sign(m.Amount)
+		}
+		return -sign(o.Amount)
+	}
+	switch {
+	case a.Amount < b.Amount:
+		return -1
+	case a.Amount > b.Amount:
+		return 1
+	}
+	return 0
+}
+
+// Percent returns the percent of the amount rounded down to its minor units,
+// the percent must not be greater than 100, so the result fits the amount
+func (m Money) Percent(p *big.Rat) Money {
+	v := new(big.Rat).Mul(new(big.Rat).SetInt64(m.Amount), p)
+	v.Quo(v, big.NewRat(100, 1))
+	return New(new(big.Int).Quo(v.Num(), v.Denom()).Int64(), m.Exponent)
+}
+
+func align(m, o Money) (Money, Money, error) {
+	var err error
+	if m.Exponent < o.Exponent {
+		m, err = m.Rescale(o.Exponent)
+	} else if o.Exponent < m.Exponent {
+		o, err = o.Rescale(m.Exponent)
+	}
+	return m, o, err
+}
+
+func sign(a int64) int {
+	switch {
+	case a < 0:
+		return -1
+	case a > 0:
+		return 1
+	}
+	return 0
+}
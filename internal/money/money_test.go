@@ -0,0 +1,149 @@
+package money
+
+import (
+	"encoding/json"
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+
+	input := []struct {
+		data   string
+		result Money
+		err    error
+	}{
+		{"100", New(100, 0), nil},
+		{"123.45", New(12345, 2), nil},
+		{"-0.5", New(-5, 1), nil},
+		{"0.000000000000000001", New(1, 18), nil},
+		{"0.0000000000000000001", Money{}, ErrPrecision},
+		{"9223372036854775807", New(math.MaxInt64, 0), nil},
+		{"9223372036854775808", Money{}, ErrOverflow},
+		{"92233720368547758.08", Money{}, ErrOverflow},
+		{"", Money{}, ErrInvalidAmount},
+		{"1.", Money{}, ErrInvalidAmount},
+		{".5", Money{}, ErrInvalidAmount},
+		{"+1", Money{}, ErrInvalidAmount},
+		{"1e3", Money{}, ErrInvalidAmount},
+		{"1,5", Money{}, ErrInvalidAmount},
+		{" 1", Money{}, ErrInvalidAmount},
+	}
+	for i, val := range input {
+		result, err := Parse(val.data)
+		if result != val.result || err != val.err {
+			t.Errorf("Row %v, actual: %v, %v, expected: %v, %v", i+1, result, err, val.result, val.err)
+		}
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+
+	input := []struct {
+		data   string
+		result Money
+		err    error
+	}{
+		{`"10.50"`, New(1050, 2), nil},
+		{`10.5`, New(105, 1), nil},
+		{` 7 `, New(7, 0), nil},
+		{`"-3"`, New(-3, 0), nil},
+		{`1e2`, Money{}, ErrInvalidAmount},
+		{`"ten"`, Money{}, ErrInvalidAmount},
+		{`null`, Money{}, ErrInvalidAmount},
+		{`"99999999999999999999"`, Money{}, ErrOverflow},
+	}
+	for i, val := range input {
+		var result Money
+		err := json.Unmarshal([]byte(val.data), &result)
+		if result != val.result || err != val.err {
+			t.Errorf("Row %v, actual: %v, %v, expected: %v, %v", i+1, result, err, val.result, val.err)
+		}
+	}
+
+	// amounts are written back as decimal strings with all places of minor units
+	data, err := json.Marshal(struct {
+		Amount Money `json:"amount"`
+	}{New(-5, 3)})
+	if err != nil || string(data) != `{"amount":"-0.005"}` {
+		t.Errorf("Test marshal, actual: %s, %v, expected: %s", data, err, `{"amount":"-0.005"}`)
+	}
+}
+
+func TestRescale(t *testing.T) {
+
+	input := []struct {
+		money    Money
+		exponent int
+		result   Money
+		err      error
+	}{
+		{New(5, 0), 2, New(500, 2), nil},
+		{New(500, 2), 0, New(5, 0), nil},
+		{New(-150, 2), 1, New(-15, 1), nil},
+		{New(155, 2), 1, Money{}, ErrPrecision},
+		{New(1, 0), -1, Money{}, ErrPrecision},
+		{New(1, 0), 19, Money{}, ErrPrecision},
+		{New(math.MaxInt64/10+1, 0), 1, Money{}, ErrOverflow},
+		{New(math.MinInt64/10-1, 0), 1, Money{}, ErrOverflow},
+	}
+	for i, val := range input {
+		result, err := val.money.Rescale(val.exponent)
+		if result != val.result || err != val.err {
+			t.Errorf("Row %v, actual: %v, %v, expected: %v, %v", i+1, result, err, val.result, val.err)
+		}
+	}
+}
+
+func TestAddSub(t *testing.T) {
+
+	input := []struct {
+		a, b     Money
+		sum      Money
+		sumErr   error
+		diff     Money
+		diffErr  error
+		compared int
+	}{
+		{New(150, 2), New(250, 2), New(400, 2), nil, New(-100, 2), nil, -1},
+		{New(1, 0), New(5, 1), New(15, 1), nil, New(5, 1), nil, 1},
+		{New(-3, 0), New(-300, 2), New(-600, 2), nil, New(0, 2), nil, 0},
+		{New(math.MaxInt64, 0), New(1, 0), Money{}, ErrOverflow, New(math.MaxInt64-1, 0), nil, 1},
+		{New(math.MinInt64, 0), New(1, 0), New(math.MinInt64+1, 0), nil, Money{}, ErrOverflow, -1},
+		{New(math.MinInt64, 0), New(-1, 0), Money{}, ErrOverflow, New(math.MinInt64+1, 0), nil, -1},
+		// the larger exponent doesn't fit int64
+		{New(math.MaxInt64, 0), New(1, 2), Money{}, ErrOverflow, Money{}, ErrOverflow, 1},
+	}
+	for i, val := range input {
+		if sum, err := val.a.Add(val.b); sum != val.sum || err != val.sumErr {
+			t.Errorf("Row %v, actual sum: %v, %v, expected: %v, %v", i+1, sum, err, val.sum, val.sumErr)
+		}
+		if diff, err := val.a.Sub(val.b); diff != val.diff || err != val.diffErr {
+			t.Errorf("Row %v, actual difference: %v, %v, expected: %v, %v", i+1, diff, err, val.diff, val.diffErr)
+		}
+		if compared := val.a.Cmp(val.b); compared != val.compared {
+			t.Errorf("Row %v, actual comparison: %v, expected: %v", i+1, compared, val.compared)
+		}
+	}
+}
+
+func TestPercent(t *testing.T) {
+
+	input := []struct {
+		money   Money
+		percent *big.Rat
+		result  Money
+	}{
+		{New(10000, 2), big.NewRat(10, 1), New(1000, 2)},
+		{New(999, 2), big.NewRat(10, 1), New(99, 2)}, // 0.999 is rounded down
+		{New(1, 2), big.NewRat(99, 1), New(0, 2)},
+		{New(333, 0), big.NewRat(100, 3), New(111, 0)},
+		{New(math.MaxInt64, 0), big.NewRat(100, 1), New(math.MaxInt64, 0)},
+	}
+	for i, val := range input {
+		if result := val.money.Percent(val.percent); result != val.result {
+			t.Errorf("Row %v, actual: %v, expected: %v", i+1, result, val.result)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package payment
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+const MockName = "mock"
+
+// MockProvider accepts every payment without charging anybody, it is used for local testing.
+// Callbacks are signed by HMAC-SHA256 of their body with the shared secret
+type MockProvider struct {
+	secret []byte
+}
+
+var _ Provider = &MockProvider{}
+
+func NewMockProvider(secret string) *MockProvider {
+	return &MockProvider{secret: []byte(secret)}
+}
+
+func (p *MockProvider) Name() string {
+	return MockName
+}
+
+func (p *MockProvider) CreatePayment(t TopUp) (string, string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", errors.Wrap(err, "can't generate id of payment")
+	}
+	id := "mock_" + hex.EncodeToString(b)
+	return id, fmt.Sprintf("https://pay.example.com/mock/%s", id), nil
+}
+
+// Sign returns the signature of the callback body
+func (p *MockProvider) Sign(body []byte) string {
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (p *MockProvider) ParseCallback(body []byte, signature string) (*Callback, error) {
+	if !hmac.Equal([]byte(p.Sign(body)), []byte(signature)) {
+		return nil, ErrInvalidSignature
+	}
+	var c Callback
+	if err := json.Unmarshal(body, &c); err != nil {
+		return nil, errors.Wrap(err, "can't unmarshal callback")
+	}
+	return &c, nil
+}
+
+// Callback returns the signed callback the provider sends when the payment ends with the status
+func (p *MockProvider) Callback(paymentID, status string) ([]byte, string, error) {
+	body, err := json.Marshal(Callback{PaymentID: paymentID, Status: status})
+	if err != nil {
+		return nil, "", errors.Wrap(err, "can't marshal callback")
+	}
+	return body, p.Sign(body), nil
+}
@@ -0,0 +1,115 @@
+package payment
+
+import (
+	"time"
+
+	"github.com/antsrp/balance_service/internal/money"
+	"github.com/pkg/errors"
+)
+
+// statuses of top-ups
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// longest comment of transaction
+const commentLength = 50
+
+const (
+	InvalidSignature = "Invalid signature of callback"
+	InvalidStatus    = "Invalid status of payment"
+	UnknownProvider  = "Unknown payment provider"
+	EmptySecret      = "Secret of payment provider is required"
+	MockNotAllowed   = "Mock payment provider is allowed for development and tests only"
+)
+
+var (
+	ErrInvalidSignature = errors.New(InvalidSignature)
+	ErrInvalidStatus    = errors.New(InvalidStatus)
+	ErrUnknownProvider  = errors.New(UnknownProvider)
+	ErrEmptySecret      = errors.New(EmptySecret)
+	ErrMockNotAllowed   = errors.New(MockNotAllowed)
+)
+
+// TopUp is a top-up of balance of user paid through the payment provider,
+// balance is credited when the provider reports the payment succeeded
+type TopUp struct {
+	ID            int         `json:"id,omitempty"`
+	UserID        int         `json:"user_id"`
+	Amount        money.Money `json:"amount" swaggertype:"string"`
+	Currency      string      `json:"currency"`
+	Status        string      `json:"status" enums:"pending,succeeded,failed"`
+	Provider      string      `json:"provider"`
+	PaymentID     string      `json:"payment_id"`            // id of payment at the provider
+	PaymentURL    string      `json:"payment_url,omitempty"` // page the user pays at
+	CreatedAt     time.Time   `json:"created_at"`
+	CompletedAt   *time.Time  `json:"completed_at,omitempty"`
+	TransactionID int         `json:"transaction_id,omitempty"` // top-up of balance made when the payment succeeded
+}
+
+// Comment returns comment of the operation crediting balance by the top-up. It is cut to fit the comment of transaction,
+// the full id of payment stays with the top-up linked with the operation
+func (t TopUp) Comment() string {
+	c := []rune("payment " + t.PaymentID)
+	if len(c) > commentLength {
+		c = c[:commentLength]
+	}
+	return string(c)
+}
+
+// Callback is a notification of the provider about the final status of payment
+type Callback struct {
+	PaymentID string `json:"payment_id"`
+	Status    string `json:"status" enums:"succeeded,failed"`
+}
+
+// ValidStatus checks the status is known
+func ValidStatus(status string) bool {
+	switch status {
+	case StatusPending, StatusSucceeded, StatusFailed:
+		return true
+	}
+	return false
+}
+
+// Validate checks the callback reports the final status
+func (c Callback) Validate() error {
+	if c.Status != StatusSucceeded && c.Status != StatusFailed {
+		return ErrInvalidStatus
+	}
+	return nil
+}
+
+// Provider is a payment provider the top-ups are paid through
+type Provider interface {
+	Name() string
+	// CreatePayment registers payment of the top-up at the provider, id of payment and page to pay at are returned
+	CreatePayment(t TopUp) (id, url string, err error)
+	// ParseCallback verifies the signature of callback and reads it
+	ParseCallback(body []byte, signature string) (*Callback, error)
+}
+
+type Storage interface {
+	CreateTopUp(*TopUp) error
+	GetTopUps(userID int, status string) ([]TopUp, error)
+	Complete(provider string, c Callback) (*TopUp, error)
+	DeleteAllTopUps() error
+}
+
+// NewProvider creates the provider by its name from configuration, callbacks signed with the empty secret could be forged by anybody.
+// The mock provider credits balance without payment, so it is created only if it is allowed explicitly
+func NewProvider(name, secret string, allowMock bool) (Provider, error) {
+	if secret == "" {
+		return nil, ErrEmptySecret
+	}
+	switch name {
+	case MockName:
+		if !allowMock {
+			return nil, ErrMockNotAllowed
+		}
+		return NewMockProvider(secret), nil
+	}
+	return nil, ErrUnknownProvider
+}
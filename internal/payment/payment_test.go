@@ -0,0 +1,24 @@
+package payment
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestComment(t *testing.T) {
+
+	input := []struct {
+		paymentID string
+		comment   string
+	}{
+		{"mock_3f2a9c0d1e7b4a65", "payment mock_3f2a9c0d1e7b4a65"},
+		{strings.Repeat("a", 42), "payment " + strings.Repeat("a", 42)},
+		{strings.Repeat("a", 100), "payment " + strings.Repeat("a", 42)},
+		{strings.Repeat("я", 100), "payment " + strings.Repeat("я", 42)}, // cut by characters, not bytes
+	}
+	for i, val := range input {
+		if comment := (TopUp{PaymentID: val.paymentID}).Comment(); comment != val.comment {
+			t.Errorf("Row %v, actual comment: %v, expected: %v", i+1, comment, val.comment)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package percent
+
+import (
+	"math/big"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	Invalid = "Invalid percent"
+)
+
+// plain decimal number, signs, fractions and exponents big.Rat would read are not percents
+var percentRe = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?$`)
+
+var (
+	ErrInvalid = errors.New(Invalid)
+)
+
+// Parse checks the percent is a decimal number not greater than 100
+func Parse(percent string) (*big.Rat, error) {
+	if !percentRe.MatchString(percent) {
+		return nil, ErrInvalid
+	}
+	p, ok := new(big.Rat).SetString(percent)
+	if !ok || p.Cmp(big.NewRat(100, 1)) > 0 {
+		return nil, ErrInvalid
+	}
+	return p, nil
+}
+
+// ParsePositive checks the percent is a decimal number greater than zero and not greater than 100
+func ParsePositive(percent string) (*big.Rat, error) {
+	p, err := Parse(percent)
+	if err != nil {
+		return nil, err
+	}
+	if p.Sign() == 0 {
+		return nil, ErrInvalid
+	}
+	return p, nil
+}
@@ -0,0 +1,185 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/antsrp/balance_service/internal/user"
+	"github.com/pkg/errors"
+)
+
+const (
+	findStateQ  = "SELECT state FROM users WHERE id = $1"
+	shareStateQ = "SELECT state FROM users WHERE id = $1 FOR SHARE"
+	lockStateQ  = "SELECT state FROM users WHERE id = $1 FOR UPDATE"
+	setStateQ   = "UPDATE users SET state = $2 WHERE id = $1"
+	// history of states of account
+	createStateChangeQ = "INSERT INTO account_states (user_id, state, reason, changed_at) VALUES ($1, $2, $3, $4)"
+	// account can be closed only if it has neither money nor debt, nor open reservations
+	// revenue of orders not recognized yet is still to be paid out to their payee
+	accountInUseQ = `SELECT EXISTS (SELECT 1 FROM wallets WHERE user_id = $1 AND balance <> 0)
+	OR EXISTS (SELECT 1 FROM transactions WHERE user_id = $1 AND direction = 'out' AND is_completed = false)
+	OR EXISTS (SELECT 1 FROM transactions WHERE payee_id = $1 AND direction = 'out' AND is_completed = false)`
+
+	AccountFrozen   = "Account is frozen"
+	AccountClosed   = "Account is closed"
+	AccountInUse    = "Account has balance, open reservations or orders to pay out"
+	StateNotChanged = "Account is already in the state"
+	UnknownState    = "Unknown state of account"
+)
+
+var (
+	ErrAccountFrozen   = errors.New(AccountFrozen)
+	ErrAccountClosed   = errors.New(AccountClosed)
+	ErrAccountInUse    = errors.New(AccountInUse)
+	ErrStateNotChanged = errors.New(StateNotChanged)
+	ErrUnknownState    = errors.New(UnknownState)
+)
+
+type AccountStorage struct {
+	StatementStorage
+
+	findStateStmt         *sql.Stmt
+	shareStateStmt        *sql.Stmt
+	lockStateStmt         *sql.Stmt
+	setStateStmt          *sql.Stmt
+	createStateChangeStmt *sql.Stmt
+	accountInUseStmt      *sql.Stmt
+
+	frozenTopUps bool
+}
+
+var _ user.StateStorage = &AccountStorage{}
+
+// CreateAccountStorage creates new storage of account states, frozenTopUps allows money to come to frozen accounts
+func CreateAccountStorage(d *Dbsql, frozenTopUps bool) (*AccountStorage, error) {
+	s := &AccountStorage{StatementStorage: Create(d), frozenTopUps: frozenTopUps}
+
+	stmts := []stmt{
+		{Query: findStateQ, Dst: &s.findStateStmt},
+		{Query: shareStateQ, Dst: &s.shareStateStmt},
+		{Query: lockStateQ, Dst: &s.lockStateStmt},
+		{Query: setStateQ, Dst: &s.setStateStmt},
+		{Query: createStateChangeQ, Dst: &s.createStateChangeStmt},
+		{Query: accountInUseQ, Dst: &s.accountInUseStmt},
+	}
+
+	if err := s.initStatements(stmts); err != nil {
+		return nil, errors.Wrap(err, "can't init statements")
+	}
+
+	return s, nil
+}
+
+func (s *AccountStorage) GetState(id int) (string, error) {
+	var state string
+	if err := s.findStateStmt.QueryRow(&id).Scan(&state); err != nil {
+		if err == sql.ErrNoRows {
+			return "", ErrUserNotFound
+		}
+		return "", errors.Wrap(err, "can't get state of account")
+	}
+	return state, nil
+}
+
+// SetState changes state of the account and records the change with its reason.
+// Closed account is final, it can be closed only if it is empty
+func (s *AccountStorage) SetState(c user.StateChange) error {
+	if !user.ValidState(c.State) {
+		return ErrUnknownState
+	}
+
+	tx, err := s.db.DB.Begin()
+	if err != nil {
+		return errors.Wrap(err, "can't create a transaction")
+	}
+
+	var state string
+	if err := tx.Stmt(s.lockStateStmt).QueryRow(&c.UserID).Scan(&state); err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return ErrUserNotFound
+		}
+		return errors.Wrap(err, "can't lock state of account")
+	}
+	if state == user.StateClosed {
+		tx.Rollback()
+		return ErrAccountClosed
+	}
+	if state == c.State {
+		tx.Rollback()
+		return ErrStateNotChanged
+	}
+	if c.State == user.StateClosed {
+		var inUse bool
+		if err := tx.Stmt(s.accountInUseStmt).QueryRow(&c.UserID).Scan(&inUse); err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "can't check balance of account")
+		}
+		if inUse {
+			tx.Rollback()
+			return ErrAccountInUse
+		}
+	}
+
+	at := time.Now().UTC()
+	if c.Time != nil {
+		at = *c.Time
+	}
+	if _, err := tx.Stmt(s.setStateStmt).Exec(&c.UserID, &c.State); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "can't set state of account")
+	}
+	if _, err := tx.Stmt(s.createStateChangeStmt).Exec(&c.UserID, &c.State, &c.Reason, &at); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "can't record change of state")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "can't commit transaction")
+	}
+	return nil
+}
+
+// shareState reads state of the account, the lock keeps it unchanged until the transaction of operation ends.
+// Unknown user is reported as active, the operation handles it by itself
+func (s *AccountStorage) shareState(tx *sql.Tx, userID int) (string, error) {
+	var state string
+	if err := tx.Stmt(s.shareStateStmt).QueryRow(&userID).Scan(&state); err != nil {
+		if err == sql.ErrNoRows {
+			return user.StateActive, nil
+		}
+		return "", errors.Wrap(err, "can't get state of account")
+	}
+	return state, nil
+}
+
+// checkDebit allows money to leave only the active account
+func (s *AccountStorage) checkDebit(tx *sql.Tx, userID int) error {
+	state, err := s.shareState(tx, userID)
+	if err != nil {
+		return err
+	}
+	switch state {
+	case user.StateFrozen:
+		return ErrAccountFrozen
+	case user.StateClosed:
+		return ErrAccountClosed
+	}
+	return nil
+}
+
+// checkCredit allows money to come to the active account, and to the frozen one if it is configured
+func (s *AccountStorage) checkCredit(tx *sql.Tx, userID int) error {
+	state, err := s.shareState(tx, userID)
+	if err != nil {
+		return err
+	}
+	switch {
+	case state == user.StateFrozen && !s.frozenTopUps:
+		return ErrAccountFrozen
+	case state == user.StateClosed:
+		return ErrAccountClosed
+	}
+	return nil
+}
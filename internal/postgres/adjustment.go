@@ -0,0 +1,285 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/antsrp/balance_service/internal/adjustment"
+	"github.com/antsrp/balance_service/internal/approval"
+	"github.com/antsrp/balance_service/internal/currency"
+	"github.com/antsrp/balance_service/internal/ledger"
+	"github.com/antsrp/balance_service/internal/money"
+	"github.com/antsrp/balance_service/internal/user"
+	"github.com/pkg/errors"
+)
+
+const (
+	KindAdjustment = "adjustment"
+
+	createAdjustmentRequestQ = `INSERT INTO adjustments (user_id, direction, amount, currency, reason_code, comment, status, requested_by, requested_at, expires_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id`
+	adjustmentColumnsQ = `SELECT id, user_id, direction, amount, currency, reason_code, comment, status, requested_by, requested_at, expires_at,
+	decided_by, decided_at, transaction_id
+	FROM adjustments`
+	// zero user and empty status match any
+	adjustmentsQ = adjustmentColumnsQ + `
+	WHERE ($1::bigint = 0 OR user_id = $1) AND ($2 = '' OR status = $2)
+	ORDER BY id`
+	// decisions of the same adjustment wait for each other
+	lockAdjustmentQ   = adjustmentColumnsQ + " WHERE id = $1 FOR UPDATE"
+	decideAdjustmentQ = "UPDATE adjustments SET status = $2, decided_by = $3, decided_at = $4, transaction_id = $5 WHERE id = $1"
+	// adjustment expires at its time, whenever it is noticed
+	expireAdjustmentsQ    = "UPDATE adjustments SET status = 'expired', decided_at = expires_at WHERE status = 'pending' AND expires_at <= $1"
+	deleteAllAdjustmentsQ = "DELETE FROM adjustments"
+
+	AdjustmentNotFound = "Adjustment not found"
+	AdjustmentDecided  = "Adjustment is already decided"
+	AdjustmentExpired  = "Adjustment is expired"
+	AdjustmentReversal = "Adjustment can't be reversed"
+)
+
+var (
+	ErrAdjustmentNotFound = errors.New(AdjustmentNotFound)
+	ErrAdjustmentDecided  = errors.New(AdjustmentDecided)
+	ErrAdjustmentExpired  = errors.New(AdjustmentExpired)
+	ErrAdjustmentReversal = errors.New(AdjustmentReversal)
+)
+
+type AdjustmentStorage struct {
+	StatementStorage
+
+	createAdjustmentRequestStmt *sql.Stmt
+	adjustmentsStmt             *sql.Stmt
+	lockAdjustmentStmt          *sql.Stmt
+	decideAdjustmentStmt        *sql.Stmt
+	expireAdjustmentsStmt       *sql.Stmt
+	createAdjustmentStmt        *sql.Stmt
+	decreaseUserBalanceStmt     *sql.Stmt
+	deleteAllAdjustmentsStmt    *sql.Stmt
+
+	users        *UserStorage
+	transactions *TransactionStorage
+	thresholds   map[string]money.Money // approval thresholds by currency
+	ttl          time.Duration
+}
+
+var _ adjustment.Storage = &AdjustmentStorage{}
+
+// CreateAdjustmentStorage creates new storage of manual adjustments of balances. Adjustments above the threshold of their currency,
+// or in currency without threshold, wait for approval for ttl, the rest are applied at once. Credits top up balances through the storage of users,
+// debits are checked against wallets as reservations are
+func CreateAdjustmentStorage(d *Dbsql, us *UserStorage, ts *TransactionStorage, thresholds map[string]money.Money, ttl time.Duration) (*AdjustmentStorage, error) {
+	s := &AdjustmentStorage{StatementStorage: Create(d), users: us, transactions: ts, thresholds: thresholds, ttl: ttl}
+
+	stmts := []stmt{
+		{Query: createAdjustmentRequestQ, Dst: &s.createAdjustmentRequestStmt},
+		{Query: adjustmentsQ, Dst: &s.adjustmentsStmt},
+		{Query: lockAdjustmentQ, Dst: &s.lockAdjustmentStmt},
+		{Query: decideAdjustmentQ, Dst: &s.decideAdjustmentStmt},
+		{Query: expireAdjustmentsQ, Dst: &s.expireAdjustmentsStmt},
+		{Query: createAdjustmentQ, Dst: &s.createAdjustmentStmt},
+		{Query: decreaseUserBalanceQ, Dst: &s.decreaseUserBalanceStmt},
+		{Query: deleteAllAdjustmentsQ, Dst: &s.deleteAllAdjustmentsStmt},
+	}
+
+	if err := s.initStatements(stmts); err != nil {
+		return nil, errors.Wrap(err, "can't init statements")
+	}
+
+	return s, nil
+}
+
+// Request records the adjustment, it is applied at once unless its amount is above the approval threshold of its currency
+func (s *AdjustmentStorage) Request(a *adjustment.Adjustment) error {
+	at := time.Now().UTC()
+	a.RequestedAt, a.Status = at, adjustment.StatusApplied
+	if threshold, ok := s.thresholds[a.Currency]; !ok || a.Amount.Cmp(threshold) > 0 {
+		expiresAt := at.Add(s.ttl)
+		a.Status, a.ExpiresAt = adjustment.StatusPending, &expiresAt
+	}
+
+	tx, err := s.db.DB.Begin()
+	if err != nil {
+		return errors.Wrap(err, "can't create a transaction")
+	}
+
+	c := sql.NullString{String: a.Comment, Valid: a.Comment != ""}
+	if err := tx.Stmt(s.createAdjustmentRequestStmt).QueryRow(&a.UserID, &a.Direction, &a.Amount.Amount, &a.Currency, &a.ReasonCode, &c,
+		&a.Status, &a.RequestedBy, &at, a.ExpiresAt).Scan(&a.ID); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "can't create adjustment")
+	}
+	if a.Status == adjustment.StatusApplied {
+		if err := s.apply(tx, a, a.RequestedBy, at); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "can't commit transaction")
+	}
+	return nil
+}
+
+// apply changes balance of user by the adjustment on behalf of the actor and marks it applied
+func (s *AdjustmentStorage) apply(tx *sql.Tx, a *adjustment.Adjustment, actor string, at time.Time) error {
+	comment := fmt.Sprintf("adjustment %d", a.ID)
+	var err error
+	if a.Direction == adjustment.DirectionCredit {
+		u := user.User{ID: a.UserID, Time: &at, Comment: comment, Balance: a.Amount, Currency: a.Currency}
+		if a.TransactionID, err = s.users.addBalance(tx, &u, KindAdjustment, ledger.EntryAdjustment); err != nil {
+			return err
+		}
+	} else if a.TransactionID, err = s.debit(tx, a, comment, at); err != nil {
+		return err
+	}
+
+	a.Status, a.DecidedBy, a.DecidedAt = adjustment.StatusApplied, actor, &at
+	if _, err := tx.Stmt(s.decideAdjustmentStmt).Exec(&a.ID, &a.Status, &a.DecidedBy, a.DecidedAt, &a.TransactionID); err != nil {
+		return errors.Wrap(err, "can't apply adjustment")
+	}
+	return nil
+}
+
+// debit takes the amount of adjustment out of the wallet, available funds are checked under its lock
+func (s *AdjustmentStorage) debit(tx *sql.Tx, a *adjustment.Adjustment, comment string, at time.Time) (int, error) {
+	if err := s.transactions.accounts.checkDebit(tx, a.UserID); err != nil {
+		return -1, err
+	}
+	wallet, err := s.transactions.lockWallet(tx, a.UserID, a.Currency)
+	if err != nil {
+		if err == sql.ErrNoRows { // no wallet in the currency
+			return -1, ErrInsufficientFunds
+		}
+		return -1, err
+	}
+	available, err := availableFunds(*wallet)
+	if err != nil {
+		return -1, err
+	}
+	if available.Cmp(a.Amount) < 0 {
+		return -1, ErrInsufficientFunds
+	}
+
+	var transactionID int
+	if err := tx.Stmt(s.createAdjustmentStmt).QueryRow(&a.UserID, "out", &at, &a.Amount.Amount, &a.Currency, &comment).Scan(&transactionID); err != nil {
+		return -1, errors.Wrap(err, "can't create adjusting transaction")
+	}
+	if _, err := tx.Stmt(s.decreaseUserBalanceStmt).Exec(&a.Amount.Amount, &a.UserID, &a.Currency); err != nil {
+		return -1, errors.Wrap(err, "can't decrease balance of user")
+	}
+	entry := ledger.Transfer(ledger.EntryAdjustment, transactionID, ledger.Wallet(a.UserID, a.Currency), ledger.External(a.Currency), a.Amount.Amount)
+	if err := s.transactions.ledger.post(tx, entry); err != nil {
+		return -1, err
+	}
+	return transactionID, nil
+}
+
+func scanAdjustment(row interface{ Scan(...interface{}) error }) (*adjustment.Adjustment, error) {
+	var a adjustment.Adjustment
+	var comment, decidedBy sql.NullString
+	var transactionID sql.NullInt64
+	if err := row.Scan(&a.ID, &a.UserID, &a.Direction, &a.Amount.Amount, &a.Currency, &a.ReasonCode, &comment, &a.Status, &a.RequestedBy,
+		&a.RequestedAt, &a.ExpiresAt, &decidedBy, &a.DecidedAt, &transactionID); err != nil {
+		return nil, err
+	}
+	a.Amount = currency.Amount(a.Amount.Amount, a.Currency)
+	a.Comment, a.DecidedBy, a.TransactionID = comment.String, decidedBy.String, int(transactionID.Int64)
+	return &a, nil
+}
+
+// GetAdjustments returns adjustments of the user in the status, zero user or empty status matches any
+func (s *AdjustmentStorage) GetAdjustments(userID int, status string) ([]adjustment.Adjustment, error) {
+	rows, err := s.adjustmentsStmt.Query(&userID, &status)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't get adjustments")
+	}
+	defer rows.Close()
+
+	adjustments := []adjustment.Adjustment{}
+	for rows.Next() {
+		a, err := scanAdjustment(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't scan adjustment")
+		}
+		adjustments = append(adjustments, *a)
+	}
+	return adjustments, nil
+}
+
+// Decide applies or rejects the pending adjustment on behalf of another admin than the one requested it.
+// Adjustment expired by now is marked expired and can't be decided. Found adjustment is returned with the error too
+func (s *AdjustmentStorage) Decide(d adjustment.Decision) (*adjustment.Adjustment, error) {
+	at := time.Now().UTC()
+
+	tx, err := s.db.DB.Begin()
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create a transaction")
+	}
+
+	a, err := scanAdjustment(tx.Stmt(s.lockAdjustmentStmt).QueryRow(&d.ID))
+	if err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return nil, ErrAdjustmentNotFound
+		}
+		return nil, errors.Wrap(err, "can't lock adjustment")
+	}
+	switch {
+	case a.Status == adjustment.StatusExpired:
+		tx.Rollback()
+		return a, ErrAdjustmentExpired
+	case a.Status != adjustment.StatusPending:
+		tx.Rollback()
+		return a, ErrAdjustmentDecided
+	case a.ExpiresAt != nil && !a.ExpiresAt.After(at):
+		tx.Rollback()
+		if _, err := s.Expire(at); err != nil {
+			return a, err
+		}
+		return a, ErrAdjustmentExpired
+	case approval.SameActor(a.RequestedBy, d.Actor):
+		tx.Rollback()
+		return a, ErrSameActor
+	}
+
+	if d.Status == adjustment.StatusApplied {
+		if err := s.apply(tx, a, d.Actor, at); err != nil {
+			tx.Rollback()
+			return a, err
+		}
+	} else {
+		a.Status, a.DecidedBy, a.DecidedAt = d.Status, d.Actor, &at
+		if _, err := tx.Stmt(s.decideAdjustmentStmt).Exec(&a.ID, &a.Status, &a.DecidedBy, a.DecidedAt, nil); err != nil {
+			tx.Rollback()
+			return a, errors.Wrap(err, "can't reject adjustment")
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return a, errors.Wrap(err, "can't commit transaction")
+	}
+	return a, nil
+}
+
+// Expire marks pending adjustments expired by the time, number of them is returned
+func (s *AdjustmentStorage) Expire(at time.Time) (int, error) {
+	res, err := s.expireAdjustmentsStmt.Exec(&at)
+	if err != nil {
+		return 0, errors.Wrap(err, "can't expire adjustments")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "can't expire adjustments")
+	}
+	return int(n), nil
+}
+
+func (s *AdjustmentStorage) DeleteAllAdjustments() error {
+	if _, err := s.deleteAllAdjustmentsStmt.Exec(); err != nil {
+		return errors.Wrap(err, "can't delete adjustments")
+	}
+	return nil
+}
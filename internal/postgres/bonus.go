@@ -0,0 +1,448 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/antsrp/balance_service/internal/bonus"
+	"github.com/antsrp/balance_service/internal/currency"
+	"github.com/antsrp/balance_service/internal/ledger"
+	"github.com/antsrp/balance_service/internal/money"
+	"github.com/pkg/errors"
+)
+
+const (
+	KindBonus       = "bonus"
+	KindBonusExpiry = "bonus_expiry"
+
+	createBonusInQ = `INSERT INTO transactions (user_id, direction, kind, is_completed, closed_at, cost, currency, comment)
+	VALUES ($1, 'in', 'bonus', true, $2, $3, $4, $5) RETURNING id`
+	createBucketQ = `INSERT INTO bonus_buckets (user_id, currency, source, amount, remaining, expires_at, granted_at, transaction_id)
+	VALUES ($1, $2, $3, $4, $4, $5, $6, $7) RETURNING id`
+	bucketsQ = `SELECT bonus_buckets.id, bonus_buckets.currency, source, amount, remaining, expires_at, granted_at, transactions.comment
+	FROM bonus_buckets
+	JOIN transactions ON transaction_id = transactions.id
+	WHERE bonus_buckets.user_id = $1
+	ORDER BY expires_at, bonus_buckets.id`
+	usagesQ = `SELECT bucket_id, reservation_bonuses.transaction_id, reservation_bonuses.amount, returned
+	FROM reservation_bonuses
+	JOIN bonus_buckets ON bucket_id = bonus_buckets.id
+	WHERE bonus_buckets.user_id = $1
+	ORDER BY reservation_bonuses.transaction_id`
+	// buckets are spent soonest expiring first
+	lockSpendableBucketsQ = `SELECT id, remaining FROM bonus_buckets
+	WHERE user_id = $1 AND currency = $2 AND remaining > 0 AND expires_at > $3
+	ORDER BY expires_at, id
+	FOR UPDATE`
+	spendBucketQ = "UPDATE bonus_buckets SET remaining = remaining - $2 WHERE id = $1"
+	createUsageQ = "INSERT INTO reservation_bonuses (transaction_id, bucket_id, amount) VALUES ($1, $2, $3)"
+	// bonuses come back to the latest expiring buckets first
+	lockUsagesQ = `SELECT bucket_id, reservation_bonuses.amount - returned
+	FROM reservation_bonuses
+	JOIN bonus_buckets ON bucket_id = bonus_buckets.id
+	WHERE reservation_bonuses.transaction_id = $1 AND reservation_bonuses.amount > returned
+	ORDER BY expires_at DESC, bucket_id DESC
+	FOR UPDATE`
+	// bonuses returned by refunds are taken back from what is left of them when refund is reversed
+	lockReturnedQ = `SELECT bucket_id, LEAST(returned, remaining)
+	FROM reservation_bonuses
+	JOIN bonus_buckets ON bucket_id = bonus_buckets.id
+	WHERE reservation_bonuses.transaction_id = $1 AND returned > 0 AND remaining > 0
+	ORDER BY expires_at, bucket_id
+	FOR UPDATE`
+	returnUsageQ   = "UPDATE reservation_bonuses SET returned = returned + $3 WHERE transaction_id = $1 AND bucket_id = $2"
+	restoreBucketQ = "UPDATE bonus_buckets SET remaining = remaining + $2 WHERE id = $1"
+	// bonuses are in the balance of wallet until they are spent or expire, even expired ones not written off yet
+	unspentBonusesQ = "SELECT COALESCE(SUM(remaining), 0) FROM bonus_buckets WHERE user_id = $1 AND currency = $2"
+	expiredBucketsQ = "SELECT id, user_id, currency FROM bonus_buckets WHERE remaining > 0 AND expires_at <= $1 ORDER BY expires_at, id"
+	lockBucketQ     = "SELECT user_id, currency, source, remaining, expires_at FROM bonus_buckets WHERE id = $1 FOR UPDATE"
+	createExpiryQ   = `INSERT INTO transactions (user_id, direction, kind, is_completed, closed_at, cost, currency, comment)
+	VALUES ($1, 'out', 'bonus_expiry', true, $2, $3, $4, $5) RETURNING id`
+	expireBucketQ     = "UPDATE bonus_buckets SET remaining = 0, expiry_transaction_id = $2 WHERE id = $1"
+	deleteUsagesQ     = "DELETE FROM reservation_bonuses"
+	deleteAllBucketsQ = "DELETE FROM bonus_buckets"
+
+	BonusReversal = "Bonus can't be reversed"
+)
+
+var (
+	ErrBonusReversal = errors.New(BonusReversal)
+)
+
+type BonusStorage struct {
+	StatementStorage
+
+	createUserStmt           *sql.Stmt
+	addBalanceStmt           *sql.Stmt
+	decreaseUserBalanceStmt  *sql.Stmt
+	createBonusInStmt        *sql.Stmt
+	createBucketStmt         *sql.Stmt
+	bucketsStmt              *sql.Stmt
+	usagesStmt               *sql.Stmt
+	lockSpendableBucketsStmt *sql.Stmt
+	spendBucketStmt          *sql.Stmt
+	createUsageStmt          *sql.Stmt
+	lockUsagesStmt           *sql.Stmt
+	lockReturnedStmt         *sql.Stmt
+	returnUsageStmt          *sql.Stmt
+	restoreBucketStmt        *sql.Stmt
+	unspentBonusesStmt       *sql.Stmt
+	expiredBucketsStmt       *sql.Stmt
+	lockWalletStmt           *sql.Stmt
+	lockBucketStmt           *sql.Stmt
+	createExpiryStmt         *sql.Stmt
+	expireBucketStmt         *sql.Stmt
+	deleteUsagesStmt         *sql.Stmt
+	deleteAllBucketsStmt     *sql.Stmt
+
+	ledger   *LedgerStorage
+	accounts *AccountStorage
+}
+
+var _ bonus.Storage = &BonusStorage{}
+
+// CreateBonusStorage creates new storage of bonus buckets
+func CreateBonusStorage(d *Dbsql, ls *LedgerStorage, as *AccountStorage) (*BonusStorage, error) {
+	s := &BonusStorage{StatementStorage: Create(d), ledger: ls, accounts: as}
+
+	stmts := []stmt{
+		{Query: createUserQ, Dst: &s.createUserStmt},
+		{Query: addUserBalanceQ, Dst: &s.addBalanceStmt},
+		{Query: decreaseUserBalanceQ, Dst: &s.decreaseUserBalanceStmt},
+		{Query: createBonusInQ, Dst: &s.createBonusInStmt},
+		{Query: createBucketQ, Dst: &s.createBucketStmt},
+		{Query: bucketsQ, Dst: &s.bucketsStmt},
+		{Query: usagesQ, Dst: &s.usagesStmt},
+		{Query: lockSpendableBucketsQ, Dst: &s.lockSpendableBucketsStmt},
+		{Query: spendBucketQ, Dst: &s.spendBucketStmt},
+		{Query: createUsageQ, Dst: &s.createUsageStmt},
+		{Query: lockUsagesQ, Dst: &s.lockUsagesStmt},
+		{Query: lockReturnedQ, Dst: &s.lockReturnedStmt},
+		{Query: returnUsageQ, Dst: &s.returnUsageStmt},
+		{Query: restoreBucketQ, Dst: &s.restoreBucketStmt},
+		{Query: unspentBonusesQ, Dst: &s.unspentBonusesStmt},
+		{Query: expiredBucketsQ, Dst: &s.expiredBucketsStmt},
+		{Query: lockWalletQ, Dst: &s.lockWalletStmt},
+		{Query: lockBucketQ, Dst: &s.lockBucketStmt},
+		{Query: createExpiryQ, Dst: &s.createExpiryStmt},
+		{Query: expireBucketQ, Dst: &s.expireBucketStmt},
+		{Query: deleteUsagesQ, Dst: &s.deleteUsagesStmt},
+		{Query: deleteAllBucketsQ, Dst: &s.deleteAllBucketsStmt},
+	}
+
+	if err := s.initStatements(stmts); err != nil {
+		return nil, errors.Wrap(err, "can't init statements")
+	}
+
+	return s, nil
+}
+
+// Grant adds the bonus to the balance of user (creating him and the wallet if needed) and opens its bucket.
+// Returns id of the bucket
+func (s *BonusStorage) Grant(b *bonus.Bucket) (int, error) {
+	at := time.Now().UTC()
+	if b.GrantedAt != nil {
+		at = *b.GrantedAt
+	}
+
+	tx, err := s.db.DB.Begin()
+	if err != nil {
+		return -1, errors.Wrap(err, "can't create a transaction")
+	}
+
+	if _, err := tx.Stmt(s.createUserStmt).Exec(&b.UserID); err != nil {
+		tx.Rollback()
+		return -1, errors.Wrap(err, "can't create user")
+	}
+	if err := s.accounts.checkCredit(tx, b.UserID); err != nil {
+		tx.Rollback()
+		return -1, err
+	}
+	if _, err := tx.Stmt(s.addBalanceStmt).Exec(&b.UserID, &b.Currency, &b.Amount.Amount); err != nil {
+		tx.Rollback()
+		return -1, errors.Wrap(err, "can't add balance of user")
+	}
+
+	var transactionID, bucketID int
+	c := sql.NullString{String: b.Comment, Valid: b.Comment != ""}
+	if err := tx.Stmt(s.createBonusInStmt).QueryRow(&b.UserID, &at, &b.Amount.Amount, &b.Currency, &c).Scan(&transactionID); err != nil {
+		tx.Rollback()
+		return -1, errors.Wrap(err, "can't create input transaction")
+	}
+	if err := tx.Stmt(s.createBucketStmt).QueryRow(&b.UserID, &b.Currency, &b.Source, &b.Amount.Amount, b.ExpiresAt, &at, &transactionID).Scan(&bucketID); err != nil {
+		tx.Rollback()
+		return -1, errors.Wrap(err, "can't create bonus bucket")
+	}
+
+	entry := ledger.Transfer(ledger.EntryBonus, transactionID, ledger.Promo(b.Currency), ledger.Wallet(b.UserID, b.Currency), b.Amount.Amount)
+	if err := s.ledger.post(tx, entry); err != nil {
+		tx.Rollback()
+		return -1, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return -1, errors.Wrap(err, "can't commit transaction")
+	}
+	return bucketID, nil
+}
+
+// GetBuckets returns bonuses of user with the reservations they were spent on
+func (s *BonusStorage) GetBuckets(userID int) ([]bonus.Bucket, error) {
+	rows, err := s.bucketsStmt.Query(&userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't get bonus buckets")
+	}
+	defer rows.Close()
+
+	buckets := []bonus.Bucket{}
+	index := make(map[int]int)
+	for rows.Next() {
+		b := bonus.Bucket{UserID: userID}
+		var comment sql.NullString
+		if err := rows.Scan(&b.ID, &b.Currency, &b.Source, &b.Amount.Amount, &b.Remaining.Amount, &b.ExpiresAt, &b.GrantedAt, &comment); err != nil {
+			return nil, errors.Wrap(err, "can't scan bonus bucket")
+		}
+		b.Comment = comment.String
+		inCurrency(b.Currency, &b.Amount, &b.Remaining)
+		index[b.ID] = len(buckets)
+		buckets = append(buckets, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "can't get bonus buckets")
+	}
+
+	usages, err := s.usagesStmt.Query(&userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't get usages of bonuses")
+	}
+	defer usages.Close()
+
+	for usages.Next() {
+		var bucketID int
+		var u bonus.Usage
+		if err := usages.Scan(&bucketID, &u.TransactionID, &u.Amount.Amount, &u.Returned.Amount); err != nil {
+			return nil, errors.Wrap(err, "can't scan usage of bonus")
+		}
+		b := &buckets[index[bucketID]]
+		inCurrency(b.Currency, &u.Amount, &u.Returned)
+		b.Usages = append(b.Usages, u)
+	}
+	return buckets, nil
+}
+
+// Expire writes off amounts left in buckets expired by the time, each bucket by its own output transaction.
+// Buckets are handled one by one so the job doesn't hold locks of many wallets at once
+func (s *BonusStorage) Expire(at time.Time) (*bonus.Expiry, error) {
+	rows, err := s.expiredBucketsStmt.Query(&at)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't get expired bonus buckets")
+	}
+	var expired []bonus.Bucket
+	for rows.Next() {
+		var b bonus.Bucket
+		if err := rows.Scan(&b.ID, &b.UserID, &b.Currency); err != nil {
+			rows.Close()
+			return nil, errors.Wrap(err, "can't scan expired bonus bucket")
+		}
+		expired = append(expired, b)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "can't get expired bonus buckets")
+	}
+
+	res := &bonus.Expiry{Amounts: make(map[string]money.Money)}
+	for _, e := range expired {
+		b, err := s.expireBucket(e, at)
+		if err != nil {
+			return res, err
+		}
+		if b == nil { // spent or restored concurrently
+			continue
+		}
+		total, ok := res.Amounts[b.Currency]
+		if !ok {
+			total = currency.Amount(0, b.Currency)
+		}
+		if res.Amounts[b.Currency], err = total.Add(b.Remaining); err != nil {
+			return res, errors.Wrap(err, "can't sum expired bonuses")
+		}
+		res.Buckets++
+	}
+	return res, nil
+}
+
+// expireBucket writes off the rest of bucket, nil is returned if it has nothing to write off anymore
+func (s *BonusStorage) expireBucket(e bonus.Bucket, at time.Time) (*bonus.Bucket, error) {
+	tx, err := s.db.DB.Begin()
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create a transaction")
+	}
+
+	// reservations lock the wallet before buckets, the same order keeps them from deadlock
+	var balance, limit int64
+	if err := tx.Stmt(s.lockWalletStmt).QueryRow(&e.UserID, &e.Currency).Scan(&balance, &limit); err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "can't lock balance of user")
+	}
+	id, b := e.ID, bonus.Bucket{ID: e.ID}
+	if err := tx.Stmt(s.lockBucketStmt).QueryRow(&id).Scan(&b.UserID, &b.Currency, &b.Source, &b.Remaining.Amount, &b.ExpiresAt); err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "can't lock bonus bucket")
+	}
+	if b.Remaining.Amount <= 0 || b.ExpiresAt.After(at) {
+		tx.Rollback()
+		return nil, nil
+	}
+	inCurrency(b.Currency, &b.Remaining)
+
+	var transactionID int
+	if err := tx.Stmt(s.createExpiryStmt).QueryRow(&b.UserID, &at, &b.Remaining.Amount, &b.Currency, &b.Source).Scan(&transactionID); err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "can't create output transaction")
+	}
+	if _, err := tx.Stmt(s.decreaseUserBalanceStmt).Exec(&b.Remaining.Amount, &b.UserID, &b.Currency); err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "can't decrease balance of user")
+	}
+	if _, err := tx.Stmt(s.expireBucketStmt).Exec(&id, &transactionID); err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "can't expire bonus bucket")
+	}
+
+	entry := ledger.Transfer(ledger.EntryBonusExpiry, transactionID, ledger.Wallet(b.UserID, b.Currency), ledger.Promo(b.Currency), b.Remaining.Amount)
+	if err := s.ledger.post(tx, entry); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "can't commit transaction")
+	}
+	return &b, nil
+}
+
+// draw pays the reserved cost from bonuses of user not expired at the time, soonest expiring first,
+// and records the buckets used by the reservation. Returns the part of cost paid by bonuses
+func (s *BonusStorage) draw(tx *sql.Tx, userID int, code string, cost money.Money, transactionID int, at time.Time) (money.Money, error) {
+	drawn := currency.Amount(0, code)
+
+	rows, err := tx.Stmt(s.lockSpendableBucketsStmt).Query(&userID, &code, &at)
+	if err != nil {
+		return drawn, errors.Wrap(err, "can't lock bonus buckets")
+	}
+	var usages []bonus.Usage
+	var buckets []int
+	rest := cost.Amount
+	for rows.Next() && rest > 0 {
+		var id int
+		var remaining int64
+		if err := rows.Scan(&id, &remaining); err != nil {
+			rows.Close()
+			return drawn, errors.Wrap(err, "can't scan bonus bucket")
+		}
+		if remaining > rest {
+			remaining = rest
+		}
+		rest -= remaining
+		buckets = append(buckets, id)
+		usages = append(usages, bonus.Usage{Amount: currency.Amount(remaining, code)})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return drawn, errors.Wrap(err, "can't lock bonus buckets")
+	}
+
+	for i, u := range usages {
+		if _, err := tx.Stmt(s.spendBucketStmt).Exec(&buckets[i], &u.Amount.Amount); err != nil {
+			return drawn, errors.Wrap(err, "can't spend bonus bucket")
+		}
+		if _, err := tx.Stmt(s.createUsageStmt).Exec(&transactionID, &buckets[i], &u.Amount.Amount); err != nil {
+			return drawn, errors.Wrap(err, "can't record usage of bonus bucket")
+		}
+		if drawn, err = drawn.Add(u.Amount); err != nil {
+			return drawn, errors.Wrap(err, "can't sum bonuses drawn")
+		}
+	}
+	return drawn, nil
+}
+
+// restore returns up to amount of bonuses spent by the order transaction to their buckets.
+// Bonuses restored to expired buckets are written off by the next expiration
+func (s *BonusStorage) restore(tx *sql.Tx, transactionID int, amount int64) error {
+	return s.moveBack(tx, s.lockUsagesStmt, transactionID, amount, 1)
+}
+
+// reclaim takes up to amount of bonuses restored by refunds of the order transaction back from their buckets
+func (s *BonusStorage) reclaim(tx *sql.Tx, transactionID int, amount int64) error {
+	return s.moveBack(tx, s.lockReturnedStmt, transactionID, amount, -1)
+}
+
+// moveBack moves bonuses between the order transaction and buckets it used, sign 1 returns them to buckets
+func (s *BonusStorage) moveBack(tx *sql.Tx, lock *sql.Stmt, transactionID int, amount, sign int64) error {
+	rows, err := tx.Stmt(lock).Query(&transactionID)
+	if err != nil {
+		return errors.Wrap(err, "can't lock usages of bonuses")
+	}
+	var buckets []int
+	var returns []int64
+	for rows.Next() && amount > 0 {
+		var id int
+		var spent int64
+		if err := rows.Scan(&id, &spent); err != nil {
+			rows.Close()
+			return errors.Wrap(err, "can't scan usage of bonus")
+		}
+		if spent > amount {
+			spent = amount
+		}
+		amount -= spent
+		buckets = append(buckets, id)
+		returns = append(returns, spent)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return errors.Wrap(err, "can't lock usages of bonuses")
+	}
+
+	for i, id := range buckets {
+		delta := sign * returns[i]
+		if _, err := tx.Stmt(s.returnUsageStmt).Exec(&transactionID, &id, &delta); err != nil {
+			return errors.Wrap(err, "can't return usage of bonus")
+		}
+		if _, err := tx.Stmt(s.restoreBucketStmt).Exec(&id, &delta); err != nil {
+			return errors.Wrap(err, "can't restore bonus bucket")
+		}
+	}
+	return nil
+}
+
+// unspent returns bonuses in the balance of wallet, they can be spent only on orders
+func (s *BonusStorage) unspent(tx *sql.Tx, userID int, code string) (money.Money, error) {
+	amount := currency.Amount(0, code)
+	if err := tx.Stmt(s.unspentBonusesStmt).QueryRow(&userID, &code).Scan(&amount.Amount); err != nil {
+		return amount, errors.Wrap(err, "can't get unspent bonuses")
+	}
+	return amount, nil
+}
+
+func (s *BonusStorage) DeleteAllBuckets() error {
+	tx, err := s.db.DB.Begin()
+	if err != nil {
+		return errors.Wrap(err, "can't create transaction")
+	}
+
+	if _, err := tx.Stmt(s.deleteUsagesStmt).Exec(); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "can't delete usages of bonuses")
+	}
+	if _, err := tx.Stmt(s.deleteAllBucketsStmt).Exec(); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "can't delete bonus buckets")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "can't commit transaction")
+	}
+	return nil
+}
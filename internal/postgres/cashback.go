@@ -0,0 +1,202 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	reservation "github.com/antsrp/balance_service/internal/cash_reservation"
+	"github.com/antsrp/balance_service/internal/cashback"
+	"github.com/antsrp/balance_service/internal/currency"
+	"github.com/antsrp/balance_service/internal/ledger"
+	"github.com/pkg/errors"
+)
+
+const (
+	KindCashback = "cashback"
+
+	createRuleQ = `INSERT INTO cashback_rules (service_id, currency, percent, cap, valid_from, valid_to)
+	SELECT id, $2, $3, $4, $5, $6 FROM favors WHERE id = $1
+	RETURNING id`
+	rulesQ = `SELECT id, service_id, currency, percent, cap, valid_from, valid_to FROM cashback_rules
+	WHERE $1::bigint = 0 OR service_id = $1
+	ORDER BY service_id, currency, valid_from, id`
+	// the latest beginning rule wins if windows of rules overlap
+	findRuleQ = `SELECT id, service_id, currency, percent, cap, valid_from, valid_to FROM cashback_rules
+	WHERE service_id = $1 AND currency = $2 AND valid_from <= $3 AND (valid_to IS NULL OR $3 < valid_to)
+	ORDER BY valid_from DESC, id DESC
+	LIMIT 1`
+	deleteRuleQ     = "DELETE FROM cashback_rules WHERE id = $1"
+	deleteAllRulesQ = "DELETE FROM cashback_rules"
+
+	createCashbackQ = `INSERT INTO transactions (user_id, direction, kind, is_completed, closed_at, cost, currency, linked_id)
+	VALUES ($1, 'in', 'cashback', true, $2, $3, $4, $5) RETURNING id`
+	// cashback is accounted to the service of order $1 in the day of time $2
+	updateCashbackDailyQ = `INSERT INTO revenue_daily (day, service_id, user_id, currency, revenue, orders, refunds, cashback)
+	SELECT ($2::timestamptz AT TIME ZONE 'UTC')::date, chains.service_id, user_id, currency, 0, 0, 0, $3
+	FROM transactions
+	JOIN chains ON chain_id = chains.id
+	WHERE transactions.id = $1
+	ON CONFLICT (day, service_id, user_id, currency) DO UPDATE
+	SET cashback = revenue_daily.cashback + EXCLUDED.cashback`
+	// cashback paid for the order net of its reversals
+	orderHasCashbackQ = `SELECT EXISTS (SELECT 1 FROM transactions AS cashbacks
+		WHERE cashbacks.linked_id = $1 AND cashbacks.kind = 'cashback'
+		AND NOT EXISTS (SELECT 1 FROM transactions AS reversals WHERE reversals.reversal_of = cashbacks.id))`
+
+	ServiceNotFound  = "Service not found"
+	RuleNotFound     = "Cashback rule not found"
+	OrderHasCashback = "Order has cashback"
+)
+
+var (
+	ErrServiceNotFound  = errors.New(ServiceNotFound)
+	ErrRuleNotFound     = errors.New(RuleNotFound)
+	ErrOrderHasCashback = errors.New(OrderHasCashback)
+)
+
+type CashbackStorage struct {
+	StatementStorage
+
+	createRuleStmt     *sql.Stmt
+	rulesStmt          *sql.Stmt
+	findRuleStmt       *sql.Stmt
+	deleteRuleStmt     *sql.Stmt
+	deleteAllRulesStmt *sql.Stmt
+}
+
+var _ cashback.Storage = &CashbackStorage{}
+
+// CreateCashbackStorage creates new storage of cashback rules
+func CreateCashbackStorage(d *Dbsql) (*CashbackStorage, error) {
+	s := &CashbackStorage{StatementStorage: Create(d)}
+
+	stmts := []stmt{
+		{Query: createRuleQ, Dst: &s.createRuleStmt},
+		{Query: rulesQ, Dst: &s.rulesStmt},
+		{Query: findRuleQ, Dst: &s.findRuleStmt},
+		{Query: deleteRuleQ, Dst: &s.deleteRuleStmt},
+		{Query: deleteAllRulesQ, Dst: &s.deleteAllRulesStmt},
+	}
+
+	if err := s.initStatements(stmts); err != nil {
+		return nil, errors.Wrap(err, "can't init statements")
+	}
+
+	return s, nil
+}
+
+// CreateRule adds the rule of existing service
+func (s *CashbackStorage) CreateRule(r *cashback.Rule) (int, error) {
+	var id int
+	var limit sql.NullInt64
+	if r.Cap != nil {
+		limit = sql.NullInt64{Int64: r.Cap.Amount, Valid: true}
+	}
+	if err := s.createRuleStmt.QueryRow(&r.ServiceID, &r.Currency, &r.Percent, &limit, r.ValidFrom, r.ValidTo).Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			return -1, ErrServiceNotFound
+		}
+		return -1, errors.Wrap(err, "can't create cashback rule")
+	}
+	return id, nil
+}
+
+func scanRule(row interface{ Scan(...interface{}) error }) (*cashback.Rule, error) {
+	var r cashback.Rule
+	var limit sql.NullInt64
+	if err := row.Scan(&r.ID, &r.ServiceID, &r.Currency, &r.Percent, &limit, &r.ValidFrom, &r.ValidTo); err != nil {
+		return nil, err
+	}
+	if limit.Valid {
+		c := currency.Amount(limit.Int64, r.Currency)
+		r.Cap = &c
+	}
+	return &r, nil
+}
+
+// GetRules returns rules of the service, or rules of all services if it is zero
+func (s *CashbackStorage) GetRules(serviceID int) ([]cashback.Rule, error) {
+	rows, err := s.rulesStmt.Query(&serviceID)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't get cashback rules")
+	}
+	defer rows.Close()
+
+	rules := []cashback.Rule{}
+	for rows.Next() {
+		r, err := scanRule(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't scan cashback rule")
+		}
+		rules = append(rules, *r)
+	}
+	return rules, nil
+}
+
+func (s *CashbackStorage) DeleteRule(id int) error {
+	res, err := s.deleteRuleStmt.Exec(&id)
+	if err != nil {
+		return errors.Wrap(err, "can't delete cashback rule")
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return errors.Wrap(err, "can't delete cashback rule")
+	} else if n == 0 {
+		return ErrRuleNotFound
+	}
+	return nil
+}
+
+func (s *CashbackStorage) DeleteAllRules() error {
+	if _, err := s.deleteAllRulesStmt.Exec(); err != nil {
+		return errors.Wrap(err, "can't delete cashback rules")
+	}
+	return nil
+}
+
+// findRule returns the rule of service in effect at the time, nil is returned if there is none
+func (s *CashbackStorage) findRule(tx *sql.Tx, serviceID int, code string, at time.Time) (*cashback.Rule, error) {
+	r, err := scanRule(tx.Stmt(s.findRuleStmt).QueryRow(&serviceID, &code, &at))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "can't find cashback rule")
+	}
+	return r, nil
+}
+
+// payCashback credits cashback of the order recognized at the time by the rule of its service.
+// Account which doesn't accept money gets no cashback, the order is recognized anyway
+func (s *TransactionStorage) payCashback(tx *sql.Tx, t reservation.Transaction, serviceID int, at time.Time) error {
+	rule, err := s.cashback.findRule(tx, serviceID, t.Currency, at)
+	if err != nil || rule == nil {
+		return err
+	}
+	amount, err := rule.Calculate(t.Cost)
+	if err != nil {
+		return errors.Wrap(err, "can't calculate cashback")
+	}
+	if amount.IsZero() {
+		return nil
+	}
+	if err := s.accounts.checkCredit(tx, t.UserID); err != nil {
+		if err == ErrAccountFrozen || err == ErrAccountClosed {
+			return nil
+		}
+		return err
+	}
+
+	var cashbackID int
+	if err := tx.Stmt(s.createCashbackStmt).QueryRow(&t.UserID, &at, &amount.Amount, &t.Currency, &t.ID).Scan(&cashbackID); err != nil {
+		return errors.Wrap(err, "can't create cashback transaction")
+	}
+	if _, err := tx.Stmt(s.changeUserBalanceStmt).Exec(&amount.Amount, &t.UserID, &t.Currency); err != nil {
+		return errors.Wrap(err, "can't change balance of user")
+	}
+	if _, err := tx.Stmt(s.updateCashbackDailyStmt).Exec(&t.ID, &at, &amount.Amount); err != nil {
+		return errors.Wrap(err, "can't update daily cashback")
+	}
+
+	entry := ledger.Transfer(ledger.EntryCashback, cashbackID, ledger.Revenue(serviceID, t.Currency), ledger.Wallet(t.UserID, t.Currency), amount.Amount)
+	return s.ledger.post(tx, entry)
+}
@@ -0,0 +1,217 @@
+package postgres
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	reservation "github.com/antsrp/balance_service/internal/cash_reservation"
+	"github.com/antsrp/balance_service/internal/coupon"
+	"github.com/antsrp/balance_service/internal/currency"
+	"github.com/antsrp/balance_service/internal/money"
+	"github.com/pkg/errors"
+)
+
+const (
+	createCouponQ = `INSERT INTO coupons (code, kind, percent, fixed, currency, service_id, usage_limit, per_user_limit, expires_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	ON CONFLICT (code) DO NOTHING
+	RETURNING id`
+	couponsQ = `SELECT id, code, kind, percent, fixed, currency, service_id, usage_limit, per_user_limit, expires_at, used
+	FROM coupons ORDER BY id`
+	// coupon is locked until the reservation ends, so concurrent reservations redeem it one by one
+	lockCouponQ = `SELECT id, code, kind, percent, fixed, currency, service_id, usage_limit, per_user_limit, expires_at, used
+	FROM coupons WHERE code = $1 FOR UPDATE`
+	userRedemptionsQ   = "SELECT COUNT(*) FROM coupon_redemptions WHERE coupon_id = $1 AND user_id = $2"
+	redeemCouponQ      = "UPDATE coupons SET used = used + 1 WHERE id = $1"
+	createRedemptionQ  = "INSERT INTO coupon_redemptions (coupon_id, user_id, order_id, redeemed_at) VALUES ($1, $2, $3, $4)"
+	deleteRedemptionsQ = "DELETE FROM coupon_redemptions"
+	deleteCouponsQ     = "DELETE FROM coupons"
+
+	CouponExists        = "Coupon already exists"
+	CouponNotFound      = "Coupon not found"
+	CouponExpired       = "Coupon is expired"
+	CouponExhausted     = "Coupon is used up"
+	CouponUserLimit     = "Coupon is used up by the user"
+	CouponNotApplicable = "Coupon doesn't fit the order"
+)
+
+var (
+	ErrCouponExists        = errors.New(CouponExists)
+	ErrCouponNotFound      = errors.New(CouponNotFound)
+	ErrCouponExpired       = errors.New(CouponExpired)
+	ErrCouponExhausted     = errors.New(CouponExhausted)
+	ErrCouponUserLimit     = errors.New(CouponUserLimit)
+	ErrCouponNotApplicable = errors.New(CouponNotApplicable)
+)
+
+type CouponStorage struct {
+	StatementStorage
+
+	createCouponStmt      *sql.Stmt
+	findFavorStmt         *sql.Stmt
+	couponsStmt           *sql.Stmt
+	lockCouponStmt        *sql.Stmt
+	userRedemptionsStmt   *sql.Stmt
+	redeemCouponStmt      *sql.Stmt
+	createRedemptionStmt  *sql.Stmt
+	deleteRedemptionsStmt *sql.Stmt
+	deleteCouponsStmt     *sql.Stmt
+}
+
+var _ coupon.Storage = &CouponStorage{}
+
+// CreateCouponStorage creates new storage of discount coupons
+func CreateCouponStorage(d *Dbsql) (*CouponStorage, error) {
+	s := &CouponStorage{StatementStorage: Create(d)}
+
+	stmts := []stmt{
+		{Query: createCouponQ, Dst: &s.createCouponStmt},
+		{Query: findFavorQ, Dst: &s.findFavorStmt},
+		{Query: couponsQ, Dst: &s.couponsStmt},
+		{Query: lockCouponQ, Dst: &s.lockCouponStmt},
+		{Query: userRedemptionsQ, Dst: &s.userRedemptionsStmt},
+		{Query: redeemCouponQ, Dst: &s.redeemCouponStmt},
+		{Query: createRedemptionQ, Dst: &s.createRedemptionStmt},
+		{Query: deleteRedemptionsQ, Dst: &s.deleteRedemptionsStmt},
+		{Query: deleteCouponsQ, Dst: &s.deleteCouponsStmt},
+	}
+
+	if err := s.initStatements(stmts); err != nil {
+		return nil, errors.Wrap(err, "can't init statements")
+	}
+
+	return s, nil
+}
+
+// CreateCoupon adds the coupon with the new code, service of the coupon must exist
+func (s *CouponStorage) CreateCoupon(c *coupon.Coupon) (int, error) {
+	var id int
+	if c.ServiceID != 0 {
+		if err := s.findFavorStmt.QueryRow(&c.ServiceID).Scan(&id); err != nil {
+			if err == sql.ErrNoRows {
+				return -1, ErrServiceNotFound
+			}
+			return -1, errors.Wrap(err, "can't find service")
+		}
+	}
+
+	var percent, cur sql.NullString
+	var fixed, serviceID, usageLimit, perUserLimit sql.NullInt64
+	percent = sql.NullString{String: c.Percent, Valid: c.Kind == coupon.KindPercent}
+	if c.Fixed != nil {
+		fixed = sql.NullInt64{Int64: c.Fixed.Amount, Valid: true}
+	}
+	cur = sql.NullString{String: c.Currency, Valid: c.Currency != ""}
+	serviceID = sql.NullInt64{Int64: int64(c.ServiceID), Valid: c.ServiceID != 0}
+	usageLimit = sql.NullInt64{Int64: int64(c.UsageLimit), Valid: c.UsageLimit != 0}
+	perUserLimit = sql.NullInt64{Int64: int64(c.PerUserLimit), Valid: c.PerUserLimit != 0}
+
+	if err := s.createCouponStmt.QueryRow(&c.Code, &c.Kind, &percent, &fixed, &cur, &serviceID, &usageLimit, &perUserLimit, c.ExpiresAt).Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			return -1, ErrCouponExists
+		}
+		return -1, errors.Wrap(err, "can't create coupon")
+	}
+	return id, nil
+}
+
+func scanCoupon(row interface{ Scan(...interface{}) error }) (*coupon.Coupon, error) {
+	var c coupon.Coupon
+	var percent, cur sql.NullString
+	var fixed, serviceID, usageLimit, perUserLimit sql.NullInt64
+	if err := row.Scan(&c.ID, &c.Code, &c.Kind, &percent, &fixed, &cur, &serviceID, &usageLimit, &perUserLimit, &c.ExpiresAt, &c.Used); err != nil {
+		return nil, err
+	}
+	c.Percent, c.Currency = percent.String, strings.TrimSpace(cur.String)
+	c.ServiceID, c.UsageLimit, c.PerUserLimit = int(serviceID.Int64), int(usageLimit.Int64), int(perUserLimit.Int64)
+	if fixed.Valid {
+		f := currency.Amount(fixed.Int64, c.Currency)
+		c.Fixed = &f
+	}
+	return &c, nil
+}
+
+func (s *CouponStorage) GetCoupons() ([]coupon.Coupon, error) {
+	rows, err := s.couponsStmt.Query()
+	if err != nil {
+		return nil, errors.Wrap(err, "can't get coupons")
+	}
+	defer rows.Close()
+
+	coupons := []coupon.Coupon{}
+	for rows.Next() {
+		c, err := scanCoupon(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't scan coupon")
+		}
+		coupons = append(coupons, *c)
+	}
+	return coupons, nil
+}
+
+func (s *CouponStorage) DeleteAllCoupons() error {
+	if _, err := s.deleteRedemptionsStmt.Exec(); err != nil {
+		return errors.Wrap(err, "can't delete redemptions of coupons")
+	}
+	if _, err := s.deleteCouponsStmt.Exec(); err != nil {
+		return errors.Wrap(err, "can't delete coupons")
+	}
+	return nil
+}
+
+// redeem counts the redemption of coupon of the order by its user and takes the discount off costs of lines the coupon fits
+func (s *CouponStorage) redeem(tx *sql.Tx, o *reservation.Order, at time.Time) error {
+	c, err := scanCoupon(tx.Stmt(s.lockCouponStmt).QueryRow(&o.Coupon))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrCouponNotFound
+		}
+		return errors.Wrap(err, "can't lock coupon")
+	}
+	if c.Expired(at) {
+		return ErrCouponExpired
+	}
+	if c.UsageLimit != 0 && c.Used >= c.UsageLimit {
+		return ErrCouponExhausted
+	}
+	if c.PerUserLimit != 0 {
+		var used int
+		if err := tx.Stmt(s.userRedemptionsStmt).QueryRow(&c.ID, &o.UserID).Scan(&used); err != nil {
+			return errors.Wrap(err, "can't count redemptions of coupon")
+		}
+		if used >= c.PerUserLimit {
+			return ErrCouponUserLimit
+		}
+	}
+
+	var fitting []int
+	var costs []money.Money
+	for i, l := range o.Lines {
+		if c.Fits(l.FavorID, o.Currency) {
+			fitting, costs = append(fitting, i), append(costs, l.Cost)
+		}
+	}
+	if len(fitting) == 0 {
+		return ErrCouponNotApplicable
+	}
+	discounts, err := c.Discounts(costs)
+	if err != nil {
+		return errors.Wrap(err, "can't calculate discount")
+	}
+	for j, i := range fitting {
+		l := &o.Lines[i]
+		if l.Cost, err = l.Cost.Sub(discounts[j]); err != nil {
+			return errors.Wrap(err, "can't calculate discount")
+		}
+		l.CouponID, l.Discount = c.ID, discounts[j]
+	}
+
+	if _, err := tx.Stmt(s.redeemCouponStmt).Exec(&c.ID); err != nil {
+		return errors.Wrap(err, "can't redeem coupon")
+	}
+	if _, err := tx.Stmt(s.createRedemptionStmt).Exec(&c.ID, &o.UserID, &o.OrderID, &at); err != nil {
+		return errors.Wrap(err, "can't create redemption of coupon")
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package postgres
+
+import (
+	"database/sql"
+
+	"github.com/antsrp/balance_service/internal/money"
+	"github.com/antsrp/balance_service/internal/user"
+	"github.com/pkg/errors"
+)
+
+const (
+	lockWalletQ     = "SELECT balance, credit_limit FROM wallets WHERE user_id = $1 AND currency = $2 FOR UPDATE"
+	setCreditLimitQ = `INSERT INTO wallets (user_id, currency, balance, credit_limit) VALUES ($1, $2, 0, $3)
+	ON CONFLICT (user_id, currency) DO UPDATE SET credit_limit = EXCLUDED.credit_limit`
+)
+
+// SetCreditLimit sets the amount the wallet of user may go negative by, user and wallet are created if they don't exist.
+// Lowering the limit below the credit in use doesn't change the balance, it only blocks further spending
+func (s *UserStorage) SetCreditLimit(id int, limit money.Money, currency string) error {
+	tx, err := s.db.DB.Begin()
+	if err != nil {
+		return errors.Wrap(err, "can't create a transaction")
+	}
+
+	if _, err := tx.Stmt(s.createUserStmt).Exec(&id); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "can't create user")
+	}
+	if state, err := s.accounts.shareState(tx, id); err != nil || state == user.StateClosed {
+		tx.Rollback()
+		if err == nil {
+			err = ErrAccountClosed
+		}
+		return err
+	}
+	if _, err := tx.Stmt(s.setCreditLimitStmt).Exec(&id, &currency, &limit.Amount); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "can't set credit limit of user")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "can't commit transaction")
+	}
+	return nil
+}
+
+// availableFunds returns the amount user can spend from the wallet: balance and credit limit less reserved cash
+func availableFunds(w user.Wallet) (money.Money, error) {
+	funds, err := w.Balance.Add(w.CreditLimit)
+	if err != nil {
+		return funds, errors.Wrap(err, "can't calculate available funds")
+	}
+	if funds, err = funds.Sub(w.Reserved); err != nil {
+		return funds, errors.Wrap(err, "can't calculate available funds")
+	}
+	return funds, nil
+}
+
+// lockWallet locks the wallet of user in the currency and reads its balance, credit limit and reserved cash.
+// sql.ErrNoRows is returned as is if the user has no wallet in the currency
+func (s *TransactionStorage) lockWallet(tx *sql.Tx, userID int, code string) (*user.Wallet, error) {
+	w := &user.Wallet{Currency: code}
+	if err := tx.Stmt(s.lockWalletStmt).QueryRow(&userID, &code).Scan(&w.Balance.Amount, &w.CreditLimit.Amount); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, err
+		}
+		return nil, errors.Wrap(err, "can't lock balance of user")
+	}
+	if err := tx.Stmt(s.reservedCashStmt).QueryRow(&userID, &code).Scan(&w.Reserved.Amount); err != nil {
+		return nil, errors.Wrap(err, "can't get an amount of reserved cash")
+	}
+	inCurrency(code, &w.Balance, &w.CreditLimit, &w.Reserved)
+	return w, nil
+}
@@ -0,0 +1,111 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/antsrp/balance_service/internal/exchange"
+	"github.com/pkg/errors"
+)
+
+const (
+	createRateQ = `INSERT INTO exchange_rates (base, quote, rate, effective_from) VALUES ($1, $2, $3, $4)
+	ON CONFLICT (base, quote, effective_from) DO NOTHING
+	RETURNING id`
+	getRatesQ = `SELECT id, base, quote, rate, effective_from FROM exchange_rates
+	WHERE ($1 = '' OR base = $1) AND ($2 = '' OR quote = $2)
+	ORDER BY base, quote, effective_from`
+	// rate of the pair in effect at the time
+	findRateQ = `SELECT rate FROM exchange_rates
+	WHERE base = $1 AND quote = $2 AND effective_from <= $3
+	ORDER BY effective_from DESC
+	LIMIT 1`
+	deleteRatesQ = "DELETE FROM exchange_rates"
+
+	RateExists   = "Rate already exists"
+	RateNotFound = "Rate not found"
+)
+
+var (
+	ErrRateExists   = errors.New(RateExists)
+	ErrRateNotFound = errors.New(RateNotFound)
+)
+
+type ExchangeStorage struct {
+	StatementStorage
+
+	createRateStmt  *sql.Stmt
+	getRatesStmt    *sql.Stmt
+	findRateStmt    *sql.Stmt
+	deleteRatesStmt *sql.Stmt
+}
+
+var _ exchange.Storage = &ExchangeStorage{}
+
+// CreateExchangeStorage creates new storage of exchange rates
+func CreateExchangeStorage(d *Dbsql) (*ExchangeStorage, error) {
+	s := &ExchangeStorage{StatementStorage: Create(d)}
+
+	stmts := []stmt{
+		{Query: createRateQ, Dst: &s.createRateStmt},
+		{Query: getRatesQ, Dst: &s.getRatesStmt},
+		{Query: findRateQ, Dst: &s.findRateStmt},
+		{Query: deleteRatesQ, Dst: &s.deleteRatesStmt},
+	}
+
+	if err := s.initStatements(stmts); err != nil {
+		return nil, errors.Wrap(err, "can't init statements")
+	}
+
+	return s, nil
+}
+
+// CreateRate adds the rate of currency pair effective from the given time, rates already in effect are kept
+func (s *ExchangeStorage) CreateRate(r *exchange.Rate) (int, error) {
+	var id int
+	if err := s.createRateStmt.QueryRow(&r.Base, &r.Quote, &r.Rate, r.EffectiveFrom).Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			return -1, ErrRateExists
+		}
+		return -1, errors.Wrap(err, "can't create exchange rate")
+	}
+	return id, nil
+}
+
+// GetRates returns history of rates, empty base or quote matches any currency
+func (s *ExchangeStorage) GetRates(base, quote string) ([]exchange.Rate, error) {
+	rows, err := s.getRatesStmt.Query(&base, &quote)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't get exchange rates")
+	}
+	defer rows.Close()
+
+	rates := []exchange.Rate{}
+	for rows.Next() {
+		var r exchange.Rate
+		if err := rows.Scan(&r.ID, &r.Base, &r.Quote, &r.Rate, &r.EffectiveFrom); err != nil {
+			return nil, errors.Wrap(err, "can't scan exchange rate")
+		}
+		rates = append(rates, r)
+	}
+	return rates, nil
+}
+
+// findRate returns the rate of the pair in effect at the time within the transaction of operation
+func (s *ExchangeStorage) findRate(tx *sql.Tx, base, quote string, at time.Time) (string, error) {
+	var rate string
+	if err := tx.Stmt(s.findRateStmt).QueryRow(&base, &quote, &at).Scan(&rate); err != nil {
+		if err == sql.ErrNoRows {
+			return "", ErrRateNotFound
+		}
+		return "", errors.Wrap(err, "can't find exchange rate")
+	}
+	return rate, nil
+}
+
+func (s *ExchangeStorage) DeleteAllRates() error {
+	if _, err := s.deleteRatesStmt.Exec(); err != nil {
+		return errors.Wrap(err, "can't delete exchange rates")
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	reservation "github.com/antsrp/balance_service/internal/cash_reservation"
+	"github.com/antsrp/balance_service/internal/currency"
+	"github.com/antsrp/balance_service/internal/fee"
+	"github.com/antsrp/balance_service/internal/money"
+	"github.com/pkg/errors"
+)
+
+const (
+	// schedule of the service in the currency is replaced by the new one
+	setScheduleQ = `INSERT INTO fee_schedules (service_id, currency, kind, percent, fixed, tiers)
+	SELECT id, $2, $3, $4, $5, $6 FROM favors WHERE id = $1
+	ON CONFLICT (service_id, currency) DO UPDATE
+	SET kind = EXCLUDED.kind, percent = EXCLUDED.percent, fixed = EXCLUDED.fixed, tiers = EXCLUDED.tiers
+	RETURNING service_id`
+	schedulesQ = `SELECT service_id, currency, kind, percent, fixed, tiers FROM fee_schedules
+	WHERE $1::bigint = 0 OR service_id = $1
+	ORDER BY service_id, currency`
+	findScheduleQ       = "SELECT service_id, currency, kind, percent, fixed, tiers FROM fee_schedules WHERE service_id = $1 AND currency = $2"
+	deleteScheduleQ     = "DELETE FROM fee_schedules WHERE service_id = $1 AND currency = $2"
+	deleteAllSchedulesQ = "DELETE FROM fee_schedules"
+
+	setFeeQ = "UPDATE transactions SET fee = $2, net = $3 WHERE id = $1"
+
+	ScheduleNotFound = "Fee schedule not found"
+)
+
+var ErrScheduleNotFound = errors.New(ScheduleNotFound)
+
+type FeeStorage struct {
+	StatementStorage
+
+	setScheduleStmt        *sql.Stmt
+	schedulesStmt          *sql.Stmt
+	findScheduleStmt       *sql.Stmt
+	deleteScheduleStmt     *sql.Stmt
+	deleteAllSchedulesStmt *sql.Stmt
+}
+
+var _ fee.Storage = &FeeStorage{}
+
+// CreateFeeStorage creates new storage of fee schedules
+func CreateFeeStorage(d *Dbsql) (*FeeStorage, error) {
+	s := &FeeStorage{StatementStorage: Create(d)}
+
+	stmts := []stmt{
+		{Query: setScheduleQ, Dst: &s.setScheduleStmt},
+		{Query: schedulesQ, Dst: &s.schedulesStmt},
+		{Query: findScheduleQ, Dst: &s.findScheduleStmt},
+		{Query: deleteScheduleQ, Dst: &s.deleteScheduleStmt},
+		{Query: deleteAllSchedulesQ, Dst: &s.deleteAllSchedulesStmt},
+	}
+
+	if err := s.initStatements(stmts); err != nil {
+		return nil, errors.Wrap(err, "can't init statements")
+	}
+
+	return s, nil
+}
+
+// SetSchedule sets the schedule of existing service in the currency
+func (s *FeeStorage) SetSchedule(sc *fee.Schedule) error {
+	var percent, tiers sql.NullString
+	var fixed sql.NullInt64
+	switch sc.Kind {
+	case fee.KindPercent:
+		percent = sql.NullString{String: sc.Percent, Valid: true}
+	case fee.KindFixed:
+		fixed = sql.NullInt64{Int64: sc.Fixed.Amount, Valid: true}
+	case fee.KindTiered:
+		b, err := json.Marshal(sc.Tiers)
+		if err != nil {
+			return errors.Wrap(err, "can't marshal tiers of fee schedule")
+		}
+		tiers = sql.NullString{String: string(b), Valid: true}
+	}
+
+	var id int
+	if err := s.setScheduleStmt.QueryRow(&sc.ServiceID, &sc.Currency, &sc.Kind, &percent, &fixed, &tiers).Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrServiceNotFound
+		}
+		return errors.Wrap(err, "can't set fee schedule")
+	}
+	return nil
+}
+
+func scanSchedule(row interface{ Scan(...interface{}) error }) (*fee.Schedule, error) {
+	var sc fee.Schedule
+	var percent, tiers sql.NullString
+	var fixed sql.NullInt64
+	if err := row.Scan(&sc.ServiceID, &sc.Currency, &sc.Kind, &percent, &fixed, &tiers); err != nil {
+		return nil, err
+	}
+	sc.Percent = percent.String
+	if fixed.Valid {
+		f := currency.Amount(fixed.Int64, sc.Currency)
+		sc.Fixed = &f
+	}
+	if tiers.Valid {
+		if err := json.Unmarshal([]byte(tiers.String), &sc.Tiers); err != nil {
+			return nil, errors.Wrap(err, "can't unmarshal tiers of fee schedule")
+		}
+		for i := range sc.Tiers {
+			from, err := currency.Normalize(sc.Tiers[i].From, sc.Currency)
+			if err != nil {
+				return nil, err
+			}
+			sc.Tiers[i].From = from
+		}
+	}
+	return &sc, nil
+}
+
+// GetSchedules returns schedules of the service, or schedules of all services if it is zero
+func (s *FeeStorage) GetSchedules(serviceID int) ([]fee.Schedule, error) {
+	rows, err := s.schedulesStmt.Query(&serviceID)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't get fee schedules")
+	}
+	defer rows.Close()
+
+	schedules := []fee.Schedule{}
+	for rows.Next() {
+		sc, err := scanSchedule(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't scan fee schedule")
+		}
+		schedules = append(schedules, *sc)
+	}
+	return schedules, nil
+}
+
+func (s *FeeStorage) DeleteSchedule(serviceID int, code string) error {
+	res, err := s.deleteScheduleStmt.Exec(&serviceID, &code)
+	if err != nil {
+		return errors.Wrap(err, "can't delete fee schedule")
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return errors.Wrap(err, "can't delete fee schedule")
+	} else if n == 0 {
+		return ErrScheduleNotFound
+	}
+	return nil
+}
+
+func (s *FeeStorage) DeleteAllSchedules() error {
+	if _, err := s.deleteAllSchedulesStmt.Exec(); err != nil {
+		return errors.Wrap(err, "can't delete fee schedules")
+	}
+	return nil
+}
+
+// findSchedule returns the schedule of service in the currency, nil is returned if there is none
+func (s *FeeStorage) findSchedule(tx *sql.Tx, serviceID int, code string) (*fee.Schedule, error) {
+	sc, err := scanSchedule(tx.Stmt(s.findScheduleStmt).QueryRow(&serviceID, &code))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "can't find fee schedule")
+	}
+	return sc, nil
+}
+
+// chargeFee calculates the fee of the order transaction by the schedule of its service and stores gross split into fee and net.
+// Order of service without schedule has no fee. Returns the fee and the net
+func (s *TransactionStorage) chargeFee(tx *sql.Tx, t reservation.Transaction, serviceID int) (money.Money, money.Money, error) {
+	charged := money.New(0, t.Cost.Exponent)
+	sc, err := s.fees.findSchedule(tx, serviceID, t.Currency)
+	if err != nil {
+		return money.Money{}, money.Money{}, err
+	}
+	if sc != nil {
+		if charged, err = sc.Calculate(t.Cost); err != nil {
+			return money.Money{}, money.Money{}, errors.Wrap(err, "can't calculate fee")
+		}
+	}
+	net, err := t.Cost.Sub(charged)
+	if err != nil {
+		return money.Money{}, money.Money{}, errors.Wrap(err, "can't calculate net of transaction")
+	}
+	if _, err := tx.Stmt(s.setFeeStmt).Exec(&t.ID, &charged.Amount, &net.Amount); err != nil {
+		return money.Money{}, money.Money{}, errors.Wrap(err, "can't set fee of transaction")
+	}
+	return charged, net, nil
+}
@@ -0,0 +1,109 @@
+package postgres
+
+import (
+	"database/sql"
+
+	"github.com/antsrp/balance_service/internal/ledger"
+	"github.com/pkg/errors"
+)
+
+const (
+	findAccountQ = `INSERT INTO accounts (kind, user_id, service_id, currency) VALUES ($1, $2, $3, $4)
+	ON CONFLICT (kind, user_id, service_id, currency) DO UPDATE SET kind = EXCLUDED.kind
+	RETURNING id`
+	createEntryQ    = "INSERT INTO journal_entries (kind, transaction_id) VALUES ($1, $2) RETURNING id"
+	createPostingQ  = "INSERT INTO postings (entry_id, account_id, amount) VALUES ($1, $2, $3)"
+	deletePostingsQ = "DELETE FROM postings"
+	deleteEntriesQ  = "DELETE FROM journal_entries"
+	deleteAccountsQ = "DELETE FROM accounts"
+
+	// balance of user in every currency derived from postings on his wallet and hold accounts
+	ledgerBalanceQ = `SELECT accounts.user_id, accounts.currency, SUM(amount) AS balance
+	FROM postings
+	JOIN accounts ON account_id = accounts.id
+	WHERE accounts.kind IN ('wallet', 'hold')
+	GROUP BY accounts.user_id, accounts.currency`
+
+	UnbalancedEntry = "Journal entry is not balanced"
+)
+
+var (
+	ErrUnbalancedEntry = errors.New(UnbalancedEntry)
+)
+
+type LedgerStorage struct {
+	StatementStorage
+
+	findAccountStmt    *sql.Stmt
+	createEntryStmt    *sql.Stmt
+	createPostingStmt  *sql.Stmt
+	deletePostingsStmt *sql.Stmt
+	deleteEntriesStmt  *sql.Stmt
+	deleteAccountsStmt *sql.Stmt
+}
+
+// CreateLedgerStorage creates new storage of journal entries
+func CreateLedgerStorage(d *Dbsql) (*LedgerStorage, error) {
+	s := &LedgerStorage{StatementStorage: Create(d)}
+
+	stmts := []stmt{
+		{Query: findAccountQ, Dst: &s.findAccountStmt},
+		{Query: createEntryQ, Dst: &s.createEntryStmt},
+		{Query: createPostingQ, Dst: &s.createPostingStmt},
+		{Query: deletePostingsQ, Dst: &s.deletePostingsStmt},
+		{Query: deleteEntriesQ, Dst: &s.deleteEntriesStmt},
+		{Query: deleteAccountsQ, Dst: &s.deleteAccountsStmt},
+	}
+
+	if err := s.initStatements(stmts); err != nil {
+		return nil, errors.Wrap(err, "can't init statements")
+	}
+
+	return s, nil
+}
+
+func (s *LedgerStorage) findAccount(tx *sql.Tx, a ledger.Account) (int, error) {
+	var id int
+	if err := tx.Stmt(s.findAccountStmt).QueryRow(a.Kind, &a.UserID, &a.ServiceID, a.Currency).Scan(&id); err != nil {
+		return -1, errors.Wrapf(err, "can't find %s account in %s", a.Kind, a.Currency)
+	}
+	return id, nil
+}
+
+// post writes the journal entry within the transaction of the operation it belongs to
+func (s *LedgerStorage) post(tx *sql.Tx, e *ledger.Entry) error {
+	if !e.Balanced() {
+		return ErrUnbalancedEntry
+	}
+
+	var entryID int
+	tid := sql.NullInt64{Int64: int64(e.TransactionID), Valid: e.TransactionID > 0}
+	if err := tx.Stmt(s.createEntryStmt).QueryRow(e.Kind, &tid).Scan(&entryID); err != nil {
+		return errors.Wrap(err, "can't create journal entry")
+	}
+
+	for _, p := range e.Postings {
+		accountID, err := s.findAccount(tx, p.Account)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Stmt(s.createPostingStmt).Exec(&entryID, &accountID, &p.Amount); err != nil {
+			return errors.Wrap(err, "can't create posting")
+		}
+	}
+	return nil
+}
+
+// deleteAll removes the whole ledger within the transaction
+func (s *LedgerStorage) deleteAll(tx *sql.Tx) error {
+	if _, err := tx.Stmt(s.deletePostingsStmt).Exec(); err != nil {
+		return errors.Wrap(err, "can't delete postings")
+	}
+	if _, err := tx.Stmt(s.deleteEntriesStmt).Exec(); err != nil {
+		return errors.Wrap(err, "can't delete journal entries")
+	}
+	if _, err := tx.Stmt(s.deleteAccountsStmt).Exec(); err != nil {
+		return errors.Wrap(err, "can't delete accounts")
+	}
+	return nil
+}
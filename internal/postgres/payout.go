@@ -0,0 +1,85 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	reservation "github.com/antsrp/balance_service/internal/cash_reservation"
+	"github.com/antsrp/balance_service/internal/ledger"
+	"github.com/pkg/errors"
+)
+
+const (
+	KindPayout = "payout"
+
+	createPayoutQ = `INSERT INTO transactions (user_id, direction, kind, is_completed, closed_at, cost, currency, linked_id)
+	VALUES ($1, 'in', 'payout', true, $2, $3, $4, $5) RETURNING id`
+	// payouts of the order net of their reversals
+	orderHasPayoutQ = `SELECT EXISTS (SELECT 1 FROM transactions AS payouts
+		WHERE payouts.linked_id = $1 AND payouts.kind = 'payout'
+		AND NOT EXISTS (SELECT 1 FROM transactions AS reversals WHERE reversals.reversal_of = payouts.id))`
+
+	PayeeNotFound  = "Payee not found"
+	PayeeIsPayer   = "Payee is the payer"
+	OrderHasPayout = "Order has payout"
+)
+
+var (
+	ErrPayeeNotFound  = errors.New(PayeeNotFound)
+	ErrPayeeIsPayer   = errors.New(PayeeIsPayer)
+	ErrOrderHasPayout = errors.New(OrderHasPayout)
+)
+
+// checkPayee verifies the payee of the order line exists and accepts money
+func (s *TransactionStorage) checkPayee(tx *sql.Tx, userID, payeeID int) error {
+	if payeeID == userID {
+		return ErrPayeeIsPayer
+	}
+	var id int
+	if err := tx.Stmt(s.findUserStmt).QueryRow(&payeeID).Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrPayeeNotFound
+		}
+		return errors.Wrap(err, "can't find payee")
+	}
+	return s.accounts.checkCredit(tx, payeeID)
+}
+
+// lockPayout locks wallets of the payer and the payee of the order in the same order as transfers do,
+// so payouts and transfers between the same users can't deadlock
+func (s *TransactionStorage) lockPayout(tx *sql.Tx, userID, payeeID int, code string) error {
+	if _, err := tx.Stmt(s.createWalletStmt).Exec(&payeeID, &code); err != nil {
+		return errors.Wrap(err, "can't create wallet of payee")
+	}
+	rows, err := tx.Stmt(s.lockWalletsStmt).Query(&userID, &code, &payeeID, &code)
+	if err != nil {
+		return errors.Wrap(err, "can't lock wallets")
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return errors.Wrap(err, "can't lock wallets")
+	}
+	return nil
+}
+
+// payOut releases revenue of the recognized order net of the platform fee from the service to the wallet of payee.
+// Order of the frozen payee isn't recognized until the payee is active again, payee with orders to pay out can't be closed
+func (s *TransactionStorage) payOut(tx *sql.Tx, t reservation.Transaction, serviceID, payeeID int, net int64, at time.Time) error {
+	if net == 0 {
+		return nil
+	}
+	if err := s.accounts.checkCredit(tx, payeeID); err != nil {
+		return err
+	}
+
+	var payoutID int
+	if err := tx.Stmt(s.createPayoutStmt).QueryRow(&payeeID, &at, &net, &t.Currency, &t.ID).Scan(&payoutID); err != nil {
+		return errors.Wrap(err, "can't create payout transaction")
+	}
+	if _, err := tx.Stmt(s.changeUserBalanceStmt).Exec(&net, &payeeID, &t.Currency); err != nil {
+		return errors.Wrap(err, "can't change balance of payee")
+	}
+
+	entry := ledger.Transfer(ledger.EntryPayout, payoutID, ledger.Revenue(serviceID, t.Currency), ledger.Wallet(payeeID, t.Currency), net)
+	return s.ledger.post(tx, entry)
+}
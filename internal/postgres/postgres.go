@@ -21,6 +21,29 @@ type PSQLConfig struct {
 	Limitations struct {
 		PageLimit int `yaml:"operations_per_page"`
 	} `yaml:"limitations"`
+	Accounts struct {
+		FrozenTopUps bool `yaml:"frozen_top_ups"` // money may come to frozen accounts
+	} `yaml:"accounts"`
+	Pricing struct {
+		ServerSide bool `yaml:"server_side"` // cost of every reservation is calculated by prices of services
+	} `yaml:"pricing"`
+	Payments struct {
+		Provider string `yaml:"provider"` // payment provider top-ups are paid through, top-ups are disabled without it
+		Secret   string `yaml:"-"`        // key callbacks of the provider are signed with, it is read from the environment only
+		// the mock provider accepts every payment without charging anybody, so it is refused without the flag
+		AllowMock bool `yaml:"allow_mock"`
+		// exposes /api/v1/payments/mock/complete, which signs callbacks for anybody, for development and tests only
+		MockComplete bool `yaml:"mock_complete"`
+	} `yaml:"payments"`
+	Internal struct {
+		// exposes /api/v1/add-balance, which credits balance without approval, for deployments reachable by internal services only
+		AddBalance bool `yaml:"add_balance"`
+	} `yaml:"internal"`
+	Adjustments struct {
+		// larger manual adjustments in the currency wait for the second approver, every adjustment in currency without threshold does
+		ApprovalThresholds map[string]string `yaml:"approval_thresholds"`
+		PendingHours       int               `yaml:"pending_hours"` // time the adjustment waits for approval before it expires
+	} `yaml:"adjustments"`
 }
 
 // Dbsql struct for connection
@@ -0,0 +1,151 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	reservation "github.com/antsrp/balance_service/internal/cash_reservation"
+	"github.com/antsrp/balance_service/internal/currency"
+	"github.com/antsrp/balance_service/internal/pricing"
+	"github.com/pkg/errors"
+)
+
+const (
+	createPriceQ = `INSERT INTO favor_prices (service_id, currency, price, effective_from) VALUES ($1, $2, $3, $4)
+	ON CONFLICT (service_id, currency, effective_from) DO NOTHING
+	RETURNING id`
+	// favor is checked separately to tell missing service from existing price
+	findFavorQ = "SELECT id FROM favors WHERE id = $1"
+	getPricesQ = `SELECT id, service_id, currency, price, effective_from FROM favor_prices
+	WHERE ($1::bigint = 0 OR service_id = $1) AND ($2 = '' OR currency = $2)
+	ORDER BY service_id, currency, effective_from`
+	// price of the service in effect at the time
+	findPriceQ = `SELECT id, service_id, currency, price, effective_from FROM favor_prices
+	WHERE service_id = $1 AND currency = $2 AND effective_from <= $3
+	ORDER BY effective_from DESC
+	LIMIT 1`
+	deletePricesQ = "DELETE FROM favor_prices"
+
+	PriceExists   = "Price already exists"
+	PriceNotFound = "Price not found"
+	PriceMismatch = "Cost doesn't match the price"
+)
+
+var (
+	ErrPriceExists   = errors.New(PriceExists)
+	ErrPriceNotFound = errors.New(PriceNotFound)
+	ErrPriceMismatch = errors.New(PriceMismatch)
+)
+
+type PriceStorage struct {
+	StatementStorage
+
+	createPriceStmt  *sql.Stmt
+	findFavorStmt    *sql.Stmt
+	getPricesStmt    *sql.Stmt
+	findPriceStmt    *sql.Stmt
+	deletePricesStmt *sql.Stmt
+
+	serverSide bool
+}
+
+var _ pricing.Storage = &PriceStorage{}
+
+// CreatePriceStorage creates new storage of prices of services, in server side mode every reservation is priced by them
+func CreatePriceStorage(d *Dbsql, serverSide bool) (*PriceStorage, error) {
+	s := &PriceStorage{StatementStorage: Create(d), serverSide: serverSide}
+
+	stmts := []stmt{
+		{Query: createPriceQ, Dst: &s.createPriceStmt},
+		{Query: findFavorQ, Dst: &s.findFavorStmt},
+		{Query: getPricesQ, Dst: &s.getPricesStmt},
+		{Query: findPriceQ, Dst: &s.findPriceStmt},
+		{Query: deletePricesQ, Dst: &s.deletePricesStmt},
+	}
+
+	if err := s.initStatements(stmts); err != nil {
+		return nil, errors.Wrap(err, "can't init statements")
+	}
+
+	return s, nil
+}
+
+// CreatePrice adds the price of existing service effective from the given time, prices already in effect are kept
+func (s *PriceStorage) CreatePrice(p *pricing.Price) (int, error) {
+	var id int
+	if err := s.findFavorStmt.QueryRow(&p.ServiceID).Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			return -1, ErrServiceNotFound
+		}
+		return -1, errors.Wrap(err, "can't find service")
+	}
+	if err := s.createPriceStmt.QueryRow(&p.ServiceID, &p.Currency, &p.Price.Amount, p.EffectiveFrom).Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			return -1, ErrPriceExists
+		}
+		return -1, errors.Wrap(err, "can't create price")
+	}
+	return id, nil
+}
+
+func scanPrice(row interface{ Scan(...interface{}) error }) (*pricing.Price, error) {
+	var p pricing.Price
+	if err := row.Scan(&p.ID, &p.ServiceID, &p.Currency, &p.Price.Amount, &p.EffectiveFrom); err != nil {
+		return nil, err
+	}
+	p.Price = currency.Amount(p.Price.Amount, p.Currency)
+	return &p, nil
+}
+
+// GetPrices returns history of prices, zero service or empty currency matches any
+func (s *PriceStorage) GetPrices(serviceID int, code string) ([]pricing.Price, error) {
+	rows, err := s.getPricesStmt.Query(&serviceID, &code)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't get prices")
+	}
+	defer rows.Close()
+
+	prices := []pricing.Price{}
+	for rows.Next() {
+		p, err := scanPrice(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't scan price")
+		}
+		prices = append(prices, *p)
+	}
+	return prices, nil
+}
+
+func (s *PriceStorage) DeleteAllPrices() error {
+	if _, err := s.deletePricesStmt.Exec(); err != nil {
+		return errors.Wrap(err, "can't delete prices")
+	}
+	return nil
+}
+
+// price prices the order line by the price of its service in effect at the time, if the line has quantity
+// or every line must be priced. Cost given by the client must match the calculated one
+func (s *PriceStorage) price(tx *sql.Tx, l *reservation.OrderLine, code string, at time.Time) error {
+	if l.Quantity == 0 && !s.serverSide {
+		return nil
+	}
+	if l.Quantity == 0 {
+		l.Quantity = 1
+	}
+	p, err := scanPrice(tx.Stmt(s.findPriceStmt).QueryRow(&l.FavorID, &code, &at))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrPriceNotFound
+		}
+		return errors.Wrap(err, "can't find price")
+	}
+	cost, err := p.Cost(l.Quantity)
+	if err != nil {
+		return err
+	}
+	if !l.Cost.IsZero() && l.Cost.Cmp(cost) != 0 {
+		return ErrPriceMismatch
+	}
+	l.Cost, l.PriceID = cost, p.ID
+	return nil
+}
@@ -0,0 +1,175 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/antsrp/balance_service/internal/ledger"
+	"github.com/antsrp/balance_service/internal/reconciliation"
+	"github.com/pkg/errors"
+)
+
+const (
+	// balance of user in every currency recomputed from the completed transactions
+	historyBalanceQ = `SELECT user_id, currency,
+	SUM(CASE WHEN direction = 'in' THEN cost ELSE -cost END) AS balance,
+	COUNT(*) AS count
+	FROM transactions
+	WHERE is_completed = true
+	GROUP BY user_id, currency`
+
+	reconcileQ = `SELECT ids.user_id, ids.currency, COALESCE(wallets.balance, 0),
+	COALESCE(history.balance, 0), COALESCE(history.count, 0), COALESCE(journal.balance, 0)
+	FROM (
+		SELECT user_id, currency FROM wallets
+		UNION SELECT user_id, currency FROM transactions
+		UNION SELECT user_id, currency FROM accounts WHERE kind IN ('wallet', 'hold')
+	) AS ids
+	LEFT JOIN wallets ON wallets.user_id = ids.user_id AND wallets.currency = ids.currency
+	LEFT JOIN (` + historyBalanceQ + `) AS history ON history.user_id = ids.user_id AND history.currency = ids.currency
+	LEFT JOIN (` + ledgerBalanceQ + `) AS journal ON journal.user_id = ids.user_id AND journal.currency = ids.currency
+	ORDER BY 1, 2`
+	lockUserBalanceQ    = "SELECT balance FROM wallets WHERE user_id = $1 AND currency = $2 FOR UPDATE"
+	userHistoryBalanceQ = `SELECT COALESCE(SUM(CASE WHEN direction = 'in' THEN cost ELSE -cost END), 0)
+	FROM transactions
+	WHERE user_id = $1 AND currency = $2 AND is_completed = true`
+	userLedgerBalanceQ = `SELECT COALESCE(SUM(amount), 0)
+	FROM postings
+	JOIN accounts ON account_id = accounts.id
+	WHERE accounts.kind IN ('wallet', 'hold') AND accounts.user_id = $1 AND accounts.currency = $2`
+	createAdjustmentQ = `INSERT INTO transactions (user_id, direction, kind, is_completed, closed_at, cost, currency, comment)
+	VALUES ($1, $2, 'adjustment', true, $3, $4, $5, $6) RETURNING id`
+)
+
+type ReconciliationStorage struct {
+	StatementStorage
+
+	reconcileStmt          *sql.Stmt
+	lockUserBalanceStmt    *sql.Stmt
+	userHistoryBalanceStmt *sql.Stmt
+	userLedgerBalanceStmt  *sql.Stmt
+	createAdjustmentStmt   *sql.Stmt
+
+	ledger   *LedgerStorage
+	accounts *AccountStorage
+}
+
+var _ reconciliation.Storage = &ReconciliationStorage{}
+
+// CreateReconciliationStorage creates new storage of balance reconciliation
+func CreateReconciliationStorage(d *Dbsql, ls *LedgerStorage, as *AccountStorage) (*ReconciliationStorage, error) {
+	s := &ReconciliationStorage{StatementStorage: Create(d), ledger: ls, accounts: as}
+
+	stmts := []stmt{
+		{Query: reconcileQ, Dst: &s.reconcileStmt},
+		{Query: lockUserBalanceQ, Dst: &s.lockUserBalanceStmt},
+		{Query: userHistoryBalanceQ, Dst: &s.userHistoryBalanceStmt},
+		{Query: userLedgerBalanceQ, Dst: &s.userLedgerBalanceStmt},
+		{Query: createAdjustmentQ, Dst: &s.createAdjustmentStmt},
+	}
+
+	if err := s.initStatements(stmts); err != nil {
+		return nil, errors.Wrap(err, "can't init statements")
+	}
+
+	return s, nil
+}
+
+// Reconcile recomputes balance of every wallet from transactions history and journal postings and reports mismatches
+func (s *ReconciliationStorage) Reconcile() (*reconciliation.Report, error) {
+	rows, err := s.reconcileStmt.Query()
+	if err != nil {
+		return nil, errors.Wrap(err, "can't reconcile balances")
+	}
+	defer rows.Close()
+
+	report := &reconciliation.Report{}
+	for rows.Next() {
+		var m reconciliation.Mismatch
+		if err := rows.Scan(&m.UserID, &m.Currency, &m.Balance.Amount, &m.Computed.Amount, &m.Transactions, &m.Ledger.Amount); err != nil {
+			return nil, errors.Wrap(err, "can't scan reconciliation row")
+		}
+		report.Checked++
+		if m.Balance.Amount != m.Computed.Amount || m.Balance.Amount != m.Ledger.Amount {
+			inCurrency(m.Currency, &m.Balance, &m.Computed, &m.Ledger)
+			if m.Difference, err = m.Balance.Sub(m.Computed); err != nil {
+				return nil, errors.Wrap(err, "can't calculate difference of balance")
+			}
+			report.Mismatches = append(report.Mismatches, m)
+		}
+	}
+	return report, nil
+}
+
+// Repair writes adjusting entries so the transactions history and the journal match the stored balance.
+// The differences are recomputed under the lock of the user, false is returned if they have gone.
+// State of the account must allow money to come or leave, so nothing is credited to the closed account.
+func (s *ReconciliationStorage) Repair(m reconciliation.Mismatch) (bool, error) {
+	tx, err := s.db.DB.Begin()
+	if err != nil {
+		return false, errors.Wrap(err, "can't create transaction")
+	}
+
+	var balance, computed, journal int64
+	if err := tx.Stmt(s.lockUserBalanceStmt).QueryRow(&m.UserID, &m.Currency).Scan(&balance); err != nil && err != sql.ErrNoRows {
+		tx.Rollback()
+		return false, errors.Wrap(err, "can't lock balance of user")
+	}
+	if err := tx.Stmt(s.userHistoryBalanceStmt).QueryRow(&m.UserID, &m.Currency).Scan(&computed); err != nil {
+		tx.Rollback()
+		return false, errors.Wrap(err, "can't recompute balance of user")
+	}
+	if err := tx.Stmt(s.userLedgerBalanceStmt).QueryRow(&m.UserID, &m.Currency).Scan(&journal); err != nil {
+		tx.Rollback()
+		return false, errors.Wrap(err, "can't recompute ledger balance of user")
+	}
+
+	if balance == computed && balance == journal {
+		tx.Rollback()
+		return false, nil
+	}
+
+	difference := balance - computed
+	if difference == 0 {
+		difference = balance - journal
+	}
+	check := s.accounts.checkCredit
+	if difference < 0 {
+		check = s.accounts.checkDebit
+	}
+	if err := check(tx, m.UserID); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	if difference := balance - computed; difference != 0 {
+		direction, cost := "in", difference
+		if difference < 0 {
+			direction, cost = "out", -difference
+		}
+		var transactionID int
+		now := time.Now().UTC()
+		if err := tx.Stmt(s.createAdjustmentStmt).QueryRow(&m.UserID, direction, &now, &cost, &m.Currency, reconciliation.AdjustmentComment).Scan(&transactionID); err != nil {
+			tx.Rollback()
+			return false, errors.Wrap(err, "can't create adjusting transaction")
+		}
+		if err := s.ledger.post(tx, ledger.Transfer(ledger.EntryAdjustment, transactionID, ledger.External(m.Currency), ledger.Wallet(m.UserID, m.Currency), difference)); err != nil {
+			tx.Rollback()
+			return false, err
+		}
+		journal += difference
+	}
+
+	// journal may be out of sync by itself, e.g. for operations made before the ledger was introduced
+	if difference := balance - journal; difference != 0 {
+		if err := s.ledger.post(tx, ledger.Transfer(ledger.EntryAdjustment, 0, ledger.External(m.Currency), ledger.Wallet(m.UserID, m.Currency), difference)); err != nil {
+			tx.Rollback()
+			return false, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, errors.Wrap(err, "can't commit transaction")
+	}
+	return true, nil
+}
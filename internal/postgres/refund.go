@@ -0,0 +1,156 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	reservation "github.com/antsrp/balance_service/internal/cash_reservation"
+	"github.com/antsrp/balance_service/internal/currency"
+	"github.com/antsrp/balance_service/internal/ledger"
+	"github.com/pkg/errors"
+)
+
+const (
+	KindRefund = "refund"
+
+	lockOrderTransactionQ = `SELECT transactions.id, user_id, cost, currency, is_completed, chains.service_id,
+	EXISTS (SELECT 1 FROM transactions AS reversals WHERE reversals.reversal_of = transactions.id)
+	FROM transactions
+	JOIN chains ON chain_id = chains.id
+	WHERE chain_id = $1 AND direction = 'out'
+	FOR UPDATE OF transactions`
+	// refunds of the order net of their reversals
+	refundedCashQ = `SELECT COALESCE(SUM(CASE WHEN transactions.direction = 'in' THEN transactions.cost ELSE -transactions.cost END), 0)
+	FROM transactions
+	LEFT JOIN transactions AS original ON original.id = transactions.reversal_of
+	WHERE transactions.chain_id = $1 AND ` + operationKindQ + ` = 'refund'`
+	createRefundQ = `INSERT INTO transactions (user_id, direction, kind, is_completed, closed_at, chain_id, cost, currency, comment)
+	VALUES ($1, 'in', 'refund', true, $2, $3, $4, $5, $6)
+	RETURNING id`
+
+	AlreadyRefunded = "Order is already refunded in full"
+	RefundExceeds   = "Refund exceeds the rest of order cost"
+)
+
+var (
+	ErrAlreadyRefunded = errors.New(AlreadyRefunded)
+	ErrRefundExceeds   = errors.New(RefundExceeds)
+)
+
+// Refund returns money of the recognized order to the user fully or partially.
+// Bonuses spent on the order are returned to their buckets first, the rest comes as money.
+// Money of refund comes to the account of user, so it must accept credit.
+// Returns id of the refund transaction.
+func (s *TransactionStorage) Refund(r reservation.Refund) (int, error) {
+	chainID, err := s.findChainID(r.OrderID, r.FavorID)
+	if err != nil {
+		return -1, err
+	}
+
+	tx, err := s.db.DB.Begin()
+	if err != nil {
+		return -1, errors.Wrap(err, "can't create a transaction")
+	}
+
+	var t reservation.Transaction
+	var serviceID int
+	var reversed bool
+	if err := tx.Stmt(s.lockOrderTransactionStmt).QueryRow(&chainID).Scan(&t.ID, &t.UserID, &t.Cost.Amount, &t.Currency, &t.IsCompleted, &serviceID, &reversed); err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return -1, ErrOrderNotFound
+		}
+		return -1, errors.Wrap(err, "can't lock transaction of order")
+	}
+	if t.UserID != r.UserID {
+		tx.Rollback()
+		return -1, ErrOperationOfDifferentUser
+	}
+	if !t.IsCompleted {
+		tx.Rollback()
+		return -1, ErrNotCompletedTransaction
+	}
+	if reversed {
+		tx.Rollback()
+		return -1, ErrAlreadyReversed
+	}
+	if err := s.accounts.checkCredit(tx, t.UserID); err != nil {
+		tx.Rollback()
+		return -1, err
+	}
+	var hasPayout bool // money of refund comes from revenue, it must not be paid out
+	if err := tx.Stmt(s.orderHasPayoutStmt).QueryRow(&t.ID).Scan(&hasPayout); err != nil {
+		tx.Rollback()
+		return -1, errors.Wrap(err, "can't check payout of order")
+	}
+	if hasPayout {
+		tx.Rollback()
+		return -1, ErrOrderHasPayout
+	}
+
+	t.Cost = currency.Amount(t.Cost.Amount, t.Currency)
+	refunded := currency.Amount(0, t.Currency)
+	if err := tx.Stmt(s.refundedCashStmt).QueryRow(&chainID).Scan(&refunded.Amount); err != nil {
+		tx.Rollback()
+		return -1, errors.Wrap(err, "can't get refunded cash of order")
+	}
+	rest, err := t.Cost.Sub(refunded)
+	if err != nil {
+		tx.Rollback()
+		return -1, errors.Wrap(err, "can't calculate the rest of order cost")
+	}
+	if rest.IsZero() {
+		tx.Rollback()
+		return -1, ErrAlreadyRefunded
+	}
+	// amount is given in the currency of order, it can't be more precise than its minor units
+	amount, err := currency.Normalize(r.Amount, t.Currency)
+	if err != nil {
+		tx.Rollback()
+		return -1, err
+	}
+	if amount.IsZero() { // full refund of the rest
+		amount = rest
+	}
+	if amount.Cmp(rest) > 0 {
+		tx.Rollback()
+		return -1, ErrRefundExceeds
+	}
+
+	at := time.Now().UTC()
+	if r.Time != nil {
+		at = *r.Time
+	}
+	var refundID int
+	c := sql.NullString{String: r.Comment, Valid: r.Comment != ""}
+	if err := tx.Stmt(s.createRefundStmt).QueryRow(&t.UserID, &at, &chainID, &amount.Amount, &t.Currency, &c).Scan(&refundID); err != nil {
+		tx.Rollback()
+		return -1, errors.Wrap(err, "can't create refund transaction")
+	}
+
+	delta := amount.Amount
+	if _, err := tx.Stmt(s.changeUserBalanceStmt).Exec(&delta, &t.UserID, &t.Currency); err != nil {
+		tx.Rollback()
+		return -1, errors.Wrap(err, "can't change balance of user")
+	}
+	if err := s.bonuses.restore(tx, t.ID, delta); err != nil {
+		tx.Rollback()
+		return -1, err
+	}
+
+	if _, err := tx.Stmt(s.updateRevenueDailyStmt).Exec(&refundID, -delta, 0, &delta, 0); err != nil {
+		tx.Rollback()
+		return -1, errors.Wrap(err, "can't update daily revenue")
+	}
+
+	entry := ledger.Transfer(ledger.EntryRefund, refundID, ledger.Revenue(serviceID, t.Currency), ledger.Wallet(t.UserID, t.Currency), delta)
+	if err := s.ledger.post(tx, entry); err != nil {
+		tx.Rollback()
+		return -1, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return -1, errors.Wrap(err, "can't commit transaction")
+	}
+	return refundID, nil
+}
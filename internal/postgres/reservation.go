@@ -6,31 +6,66 @@ import (
 	"time"
 
 	reservation "github.com/antsrp/balance_service/internal/cash_reservation"
+	"github.com/antsrp/balance_service/internal/currency"
+	"github.com/antsrp/balance_service/internal/ledger"
+	"github.com/antsrp/balance_service/internal/money"
 	"github.com/antsrp/balance_service/internal/reports"
 	"github.com/pkg/errors"
 )
 
 const (
-	getAmountOfReservedCashQ = "SELECT SUM(cost) FROM transactions WHERE user_id = $1 AND direction = 'out' AND is_completed = false GROUP BY(user_id)"
-	createChainQ             = "INSERT INTO chains (order_id, service_id) VALUES ($1, $2) RETURNING id;"
-	findChainQ               = "SELECT id FROM chains WHERE order_id = $1 AND service_id = $2"
-	createInQ                = "INSERT INTO transactions (user_id, direction, is_completed, closed_at, cost, comment) VALUES ($1, 'in', true, $2, $3, $4);"
-	createOutQ               = "INSERT INTO transactions (user_id, direction, is_completed, chain_id, cost, comment) VALUES ($1, 'out', false, $2, $3, $4);"
-	findTransactionQ         = "SELECT user_id, is_completed, cost FROM transactions WHERE chain_id = $1"
-	updateTransactionQ       = `UPDATE transactions 
+	createChainQ = "INSERT INTO chains (order_id, service_id, coupon_id) VALUES ($1, $2, $3) RETURNING id;"
+	findChainQ   = "SELECT id FROM chains WHERE order_id = $1 AND service_id = $2"
+	createInQ    = `INSERT INTO transactions (user_id, direction, is_completed, closed_at, cost, currency, comment, source_cost, source_currency, rate, kind)
+	VALUES ($1, 'in', true, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id;`
+	createOutQ = `INSERT INTO transactions (user_id, direction, is_completed, chain_id, cost, currency, comment, payee_id, price_id, quantity, discount)
+	VALUES ($1, 'out', false, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id;`
+	findTransactionQ   = "SELECT user_id, is_completed, cost, currency FROM transactions WHERE chain_id = $1 AND direction = 'out'"
+	updateTransactionQ = `UPDATE transactions 
 	SET closed_at = $1, is_completed = true
-	WHERE chain_id = $2`
+	FROM chains
+	WHERE chain_id = $2 AND chains.id = chain_id AND direction = 'out' AND is_completed = false
+	RETURNING transactions.id, user_id, cost, currency, chains.service_id, payee_id`
 	deleteChainsQ       = "DELETE FROM chains WHERE id > 0"
 	deleteTransactionsQ = "DELETE FROM transactions WHERE id > 0"
 
-	summaryOfMonthQ = `SELECT favors.name, SUM(cost)
+	// $2, $3, $4, $5 are changes of revenue, orders, refunds and fees made by the transaction $1
+	updateRevenueDailyQ = `INSERT INTO revenue_daily (day, service_id, user_id, currency, revenue, orders, refunds, fees)
+	SELECT (closed_at AT TIME ZONE 'UTC')::date, chains.service_id, user_id, currency, $2, $3, $4, $5
 	FROM transactions
-	LEFT JOIN chains ON chain_id = chains.id
-	JOIN favors ON chains.service_id = favors.id
-	WHERE direction = 'out' AND $1 <= closed_at AND closed_at < $2
-	GROUP BY service_id, favors.name;`
-
-	operationsCarcassQ = `SELECT direction, favors.name, cost, comment, closed_at 
+	JOIN chains ON chain_id = chains.id
+	WHERE transactions.id = $1
+	ON CONFLICT (day, service_id, user_id, currency) DO UPDATE
+	SET revenue = revenue_daily.revenue + EXCLUDED.revenue, orders = revenue_daily.orders + EXCLUDED.orders,
+	refunds = revenue_daily.refunds + EXCLUDED.refunds, fees = revenue_daily.fees + EXCLUDED.fees`
+	deleteRevenueDailyQ = "DELETE FROM revenue_daily"
+
+	summaryOfMonthQ = `SELECT favors.name, figures.currency,
+	COALESCE(SUM(revenue) FILTER (WHERE $1 <= day AND day < $2), 0),
+	COALESCE(SUM(refunds) FILTER (WHERE $1 <= day AND day < $2), 0),
+	COALESCE(SUM(cashback) FILTER (WHERE $1 <= day AND day < $2), 0),
+	COALESCE(SUM(fees) FILTER (WHERE $1 <= day AND day < $2), 0),
+	COALESCE(SUM(orders) FILTER (WHERE $1 <= day AND day < $2), 0),
+	COUNT(DISTINCT user_id) FILTER (WHERE $1 <= day AND day < $2 AND orders > 0),
+	COALESCE(SUM(reserved), 0),
+	COALESCE(SUM(revenue) FILTER (WHERE $3 <= day AND day < $1), 0)
+	FROM (
+		SELECT day, service_id, user_id, currency, revenue, refunds, cashback, fees, orders, 0 AS reserved
+		FROM revenue_daily
+		WHERE $3 <= day AND day < $2
+		UNION ALL
+		SELECT NULL, chains.service_id, user_id, currency, 0, 0, 0, 0, 0, cost
+		FROM transactions
+		JOIN chains ON chain_id = chains.id
+		WHERE direction = 'out' AND is_completed = false
+	) AS figures
+	JOIN favors ON service_id = favors.id
+	GROUP BY GROUPING SETS ((figures.currency, service_id, favors.name), (figures.currency))
+	ORDER BY figures.currency, favors.name NULLS LAST;`
+
+	operationsCarcassQ = `SELECT transactions.id, direction, kind, favors.name, cost, currency, comment, closed_at, reversal_of, reason,
+	(SELECT id FROM transactions AS reversals WHERE reversals.reversal_of = transactions.id) AS reversed_by,
+	source_cost, source_currency, rate, linked_id, payee_id, price_id, quantity, chains.coupon_id, discount
 	FROM transactions 
 	LEFT JOIN chains ON chain_id = chains.id
 	LEFT JOIN favors ON chains.service_id = favors.id
@@ -52,6 +87,7 @@ const (
 
 	ClosedTransaction = "Transaction is already closed"
 	DifferentCosts    = "Different costs"
+	DifferentCurrency = "Different currencies"
 	OrderNotFound     = "Wrong order"
 	UserNotFound      = "User not found"
 	SortParamNotFound = "Wrong sorting param"
@@ -62,11 +98,14 @@ const (
 	SORT_SUM      = `sum`
 	ORDER_BY_SUM  = ` ORDER BY cost `
 	ORDER_BY_DATE = ` ORDER BY closed_at `
+
+	dayLayout = "2006-01-02"
 )
 
 var (
 	ErrClosedTransaction        = errors.New(ClosedTransaction)
 	ErrDifferentCosts           = errors.New(DifferentCosts)
+	ErrDifferentCurrency        = errors.New(DifferentCurrency)
 	ErrOrderNotFound            = errors.New(OrderNotFound)
 	ErrUserNotFound             = errors.New(UserNotFound)
 	ErrSortParamNotFound        = errors.New(SortParamNotFound)
@@ -76,10 +115,9 @@ var (
 type TransactionStorage struct {
 	StatementStorage
 
-	getAmountOfReservedCashStmt  *sql.Stmt
 	createChainStmt              *sql.Stmt
 	findChainStmt                *sql.Stmt
-	createInStmt                 *sql.Stmt
+	findOrderTransactionStmt     *sql.Stmt
 	createOutStmt                *sql.Stmt
 	findTransactionStmt          *sql.Stmt
 	updateTransactionStmt        *sql.Stmt
@@ -96,18 +134,53 @@ type TransactionStorage struct {
 	operationsCostWPagesAscStmt  *sql.Stmt
 	deleteChainsStmt             *sql.Stmt
 	deleteTransactionsStmt       *sql.Stmt
-
+	updateRevenueDailyStmt       *sql.Stmt
+	deleteRevenueDailyStmt       *sql.Stmt
+	rebuildRevenueDailyStmt      *sql.Stmt
+	decreaseUserBalanceStmt      *sql.Stmt
+	changeUserBalanceStmt        *sql.Stmt
+	lockWalletStmt               *sql.Stmt
+	reservedCashStmt             *sql.Stmt
+	lockTransactionStmt          *sql.Stmt
+	findReversalStmt             *sql.Stmt
+	createReversalStmt           *sql.Stmt
+	lockOrderTransactionStmt     *sql.Stmt
+	refundedCashStmt             *sql.Stmt
+	createRefundStmt             *sql.Stmt
+	findUserStmt                 *sql.Stmt
+	createWalletStmt             *sql.Stmt
+	lockWalletsStmt              *sql.Stmt
+	createTransferOutStmt        *sql.Stmt
+	createTransferInStmt         *sql.Stmt
+	linkTransactionStmt          *sql.Stmt
+	createCashbackStmt           *sql.Stmt
+	updateCashbackDailyStmt      *sql.Stmt
+	rebuildCashbackDailyStmt     *sql.Stmt
+	orderHasCashbackStmt         *sql.Stmt
+	setFeeStmt                   *sql.Stmt
+	createPayoutStmt             *sql.Stmt
+	orderHasPayoutStmt           *sql.Stmt
+	usersSummaryStmts            map[string]*sql.Stmt
+
+	ledger    *LedgerStorage
+	exchange  *ExchangeStorage
+	spending  *SpendingStorage
+	accounts  *AccountStorage
+	bonuses   *BonusStorage
+	cashback  *CashbackStorage
+	fees      *FeeStorage
+	prices    *PriceStorage
+	coupons   *CouponStorage
 	pageLimit int
 }
 
-func CreateTransactionStorage(d *Dbsql, limit int) (*TransactionStorage, error) {
-	s := &TransactionStorage{StatementStorage: Create(d)}
+func CreateTransactionStorage(d *Dbsql, ls *LedgerStorage, es *ExchangeStorage, ss *SpendingStorage, as *AccountStorage, bs *BonusStorage, cs *CashbackStorage, fs *FeeStorage, ps *PriceStorage, cps *CouponStorage, limit int) (*TransactionStorage, error) {
+	s := &TransactionStorage{StatementStorage: Create(d), ledger: ls, exchange: es, spending: ss, accounts: as, bonuses: bs, cashback: cs, fees: fs, prices: ps, coupons: cps}
 
 	stmts := []stmt{
-		{Query: getAmountOfReservedCashQ, Dst: &s.getAmountOfReservedCashStmt},
 		{Query: findChainQ, Dst: &s.findChainStmt},
+		{Query: findOrderTransactionQ, Dst: &s.findOrderTransactionStmt},
 		{Query: createChainQ, Dst: &s.createChainStmt},
-		{Query: createInQ, Dst: &s.createInStmt},
 		{Query: createOutQ, Dst: &s.createOutStmt},
 		{Query: findTransactionQ, Dst: &s.findTransactionStmt},
 		{Query: updateTransactionQ, Dst: &s.updateTransactionStmt},
@@ -124,11 +197,40 @@ func CreateTransactionStorage(d *Dbsql, limit int) (*TransactionStorage, error)
 		{Query: operationsByCostWPagesASCQ, Dst: &s.operationsCostWPagesAscStmt},
 		{Query: deleteChainsQ, Dst: &s.deleteChainsStmt},
 		{Query: deleteTransactionsQ, Dst: &s.deleteTransactionsStmt},
+		{Query: updateRevenueDailyQ, Dst: &s.updateRevenueDailyStmt},
+		{Query: deleteRevenueDailyQ, Dst: &s.deleteRevenueDailyStmt},
+		{Query: rebuildRevenueDailyQ, Dst: &s.rebuildRevenueDailyStmt},
+		{Query: decreaseUserBalanceQ, Dst: &s.decreaseUserBalanceStmt},
+		{Query: changeUserBalanceQ, Dst: &s.changeUserBalanceStmt},
+		{Query: lockWalletQ, Dst: &s.lockWalletStmt},
+		{Query: reservedCashQ, Dst: &s.reservedCashStmt},
+		{Query: lockTransactionQ, Dst: &s.lockTransactionStmt},
+		{Query: findReversalQ, Dst: &s.findReversalStmt},
+		{Query: createReversalQ, Dst: &s.createReversalStmt},
+		{Query: lockOrderTransactionQ, Dst: &s.lockOrderTransactionStmt},
+		{Query: refundedCashQ, Dst: &s.refundedCashStmt},
+		{Query: createRefundQ, Dst: &s.createRefundStmt},
+		{Query: findUserByIDQ, Dst: &s.findUserStmt},
+		{Query: createWalletQ, Dst: &s.createWalletStmt},
+		{Query: lockWalletsQ, Dst: &s.lockWalletsStmt},
+		{Query: createTransferOutQ, Dst: &s.createTransferOutStmt},
+		{Query: createTransferInQ, Dst: &s.createTransferInStmt},
+		{Query: linkTransactionQ, Dst: &s.linkTransactionStmt},
+		{Query: createCashbackQ, Dst: &s.createCashbackStmt},
+		{Query: updateCashbackDailyQ, Dst: &s.updateCashbackDailyStmt},
+		{Query: rebuildCashbackDailyQ, Dst: &s.rebuildCashbackDailyStmt},
+		{Query: orderHasCashbackQ, Dst: &s.orderHasCashbackStmt},
+		{Query: setFeeQ, Dst: &s.setFeeStmt},
+		{Query: createPayoutQ, Dst: &s.createPayoutStmt},
+		{Query: orderHasPayoutQ, Dst: &s.orderHasPayoutStmt},
 	}
 
 	if err := s.initStatements(stmts); err != nil {
 		return nil, errors.Wrap(err, "can't init statements")
 	}
+	if err := s.initUsersSummaryStatements(); err != nil {
+		return nil, errors.Wrap(err, "can't init statements of users summary")
+	}
 
 	s.pageLimit = limit
 
@@ -137,31 +239,79 @@ func CreateTransactionStorage(d *Dbsql, limit int) (*TransactionStorage, error)
 
 var _ reservation.Storage = &TransactionStorage{}
 
-func (s *TransactionStorage) CreateIn(user_id int, at *time.Time, value uint64, comment string) error {
-	c := sql.NullString{String: comment, Valid: comment != ""}
-	if _, err := s.createInStmt.Exec(&user_id, &at, &value, &c); err != nil {
-		return errors.Wrap(err, "can't create input transaction")
-	}
-	return nil
+// CreateOut reserves cost of the order on the wallet of user in the currency, bonuses of user are drawn first.
+// Available funds, including the credit limit of the wallet, are checked under its lock, so concurrent reservations can't overdraw it.
+// Revenue of the order is paid out to the payee when it is recognized, unless the payee is zero
+func (s *TransactionStorage) CreateOut(user_id, order_id, favor_id int, cost money.Money, code, comment string, payee_id int) error {
+	return s.ReserveOrder(&reservation.Order{
+		UserID:   user_id,
+		OrderID:  order_id,
+		Currency: code,
+		Lines:    []reservation.OrderLine{{FavorID: favor_id, Cost: cost, Comment: comment, PayeeID: payee_id}},
+	})
 }
 
-func (s *TransactionStorage) CreateOut(user_id, order_id, favor_id int, cost uint64, comment string) error {
-	var chainID int
+// ReserveOrder reserves every line of the order in the single DB transaction, so all of them are reserved or none.
+// Lines are priced by prices of their services in effect now, then the coupon of order takes its discount off them,
+// resulting costs of lines are set in the order.
+// Available funds are checked against the total cost of lines, spending limits against each line in turn
+func (s *TransactionStorage) ReserveOrder(o *reservation.Order) error {
+	at := time.Now().UTC()
+	code := o.Currency
 
 	tx, err := s.db.DB.Begin()
 	if err != nil {
 		return errors.Wrap(err, "can't create a transaction")
 	}
 
-	if err := tx.Stmt(s.createChainStmt).QueryRow(&order_id, &favor_id).Scan(&chainID); err != nil {
-		tx.Rollback()
-		return errors.Wrap(err, "can't create chain of order_id & service_id")
+	for i := range o.Lines {
+		if err := s.prices.price(tx, &o.Lines[i], code, at); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if o.Coupon != "" {
+		if err := s.coupons.redeem(tx, o, at); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	total := currency.Amount(0, code)
+	for _, l := range o.Lines {
+		if total, err = total.Add(l.Cost); err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "can't calculate total cost of order")
+		}
 	}
 
-	c := sql.NullString{String: comment, Valid: comment != ""}
-	if _, err := tx.Stmt(s.createOutStmt).Exec(&user_id, &chainID, &cost, &c); err != nil {
+	if err := s.accounts.checkDebit(tx, o.UserID); err != nil {
 		tx.Rollback()
-		return errors.Wrap(err, "can't create output transaction")
+		return err
+	}
+	wallet, err := s.lockWallet(tx, o.UserID, code)
+	if err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows { // no wallet in the currency
+			return ErrInsufficientFunds
+		}
+		return err
+	}
+	available, err := availableFunds(*wallet)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if available.Cmp(total) < 0 {
+		tx.Rollback()
+		return ErrInsufficientFunds
+	}
+
+	for _, l := range o.Lines {
+		if err := s.reserveLine(tx, o.UserID, o.OrderID, code, l, at); err != nil {
+			tx.Rollback()
+			return err
+		}
 	}
 
 	if err := tx.Commit(); err != nil {
@@ -170,11 +320,52 @@ func (s *TransactionStorage) CreateOut(user_id, order_id, favor_id int, cost uin
 	}
 	return nil
 }
-func (s *TransactionStorage) GetAmountOfReservedCash(user_id int) (uint64, error) {
 
-	var amount uint64
-	if _, err := s.getAmountOfReservedCashStmt.Exec(&user_id); err != nil {
-		return 0, errors.Wrap(err, "can't get an amount of reserved cash")
+// reserveLine creates the chain and the output transaction of the order line on the locked wallet,
+// reservations of previous lines are counted by spending limits as they are made by the same transaction
+func (s *TransactionStorage) reserveLine(tx *sql.Tx, userID, orderID int, code string, l reservation.OrderLine, at time.Time) error {
+	if err := s.spending.checkLimits(tx, userID, l.FavorID, code, l.Cost, at); err != nil {
+		return err
+	}
+	var payee, price, quantity, coupon, discount sql.NullInt64
+	if l.PriceID != 0 {
+		price = sql.NullInt64{Int64: int64(l.PriceID), Valid: true}
+		quantity = sql.NullInt64{Int64: int64(l.Quantity), Valid: true}
+	}
+	if l.CouponID != 0 {
+		coupon = sql.NullInt64{Int64: int64(l.CouponID), Valid: true}
+		discount = sql.NullInt64{Int64: l.Discount.Amount, Valid: true}
+	}
+	if l.PayeeID != 0 {
+		if err := s.checkPayee(tx, userID, l.PayeeID); err != nil {
+			return err
+		}
+		payee = sql.NullInt64{Int64: int64(l.PayeeID), Valid: true}
+	}
+
+	var chainID int
+	if err := tx.Stmt(s.createChainStmt).QueryRow(&orderID, &l.FavorID, &coupon).Scan(&chainID); err != nil {
+		return errors.Wrap(err, "can't create chain of order_id & service_id")
+	}
+
+	var transactionID int
+	c := sql.NullString{String: l.Comment, Valid: l.Comment != ""}
+	if err := tx.Stmt(s.createOutStmt).QueryRow(&userID, &chainID, &l.Cost.Amount, &code, &c, &payee, &price, &quantity, &discount).Scan(&transactionID); err != nil {
+		return errors.Wrap(err, "can't create output transaction")
+	}
+	if _, err := s.bonuses.draw(tx, userID, code, l.Cost, transactionID, at); err != nil {
+		return err
+	}
+
+	entry := ledger.Transfer(ledger.EntryReserve, transactionID, ledger.Wallet(userID, code), ledger.Hold(userID, code), l.Cost.Amount)
+	return s.ledger.post(tx, entry)
+}
+
+func (s *TransactionStorage) GetAmountOfReservedCash(user_id int, code string) (money.Money, error) {
+
+	amount := currency.Amount(0, code)
+	if err := s.reservedCashStmt.QueryRow(&user_id, &code).Scan(&amount.Amount); err != nil {
+		return amount, errors.Wrap(err, "can't get an amount of reserved cash")
 	}
 
 	return amount, nil
@@ -182,9 +373,10 @@ func (s *TransactionStorage) GetAmountOfReservedCash(user_id int) (uint64, error
 
 func (s *TransactionStorage) getTransactionData(chain_id int) (*reservation.Transaction, error) {
 	var transaction reservation.Transaction
-	if err := s.findTransactionStmt.QueryRow(&chain_id).Scan(&transaction.UserID, &transaction.IsCompleted, &transaction.Cost); err != nil {
+	if err := s.findTransactionStmt.QueryRow(&chain_id).Scan(&transaction.UserID, &transaction.IsCompleted, &transaction.Cost.Amount, &transaction.Currency); err != nil {
 		return nil, errors.Wrap(err, "can't get transaction status and cost")
 	}
+	transaction.Cost = currency.Amount(transaction.Cost.Amount, transaction.Currency)
 	return &transaction, nil
 }
 
@@ -214,56 +406,196 @@ func (s *TransactionStorage) FindTransaction(data reservation.CashReservation) (
 	if td.UserID != data.UserID {
 		return -1, ErrOperationOfDifferentUser
 	}
-	if td.Cost != data.Cost {
+	if td.Currency != data.Currency {
+		return -1, ErrDifferentCurrency
+	}
+	if td.Cost.Cmp(data.Cost) != 0 {
 		return -1, ErrDifferentCosts
 	}
 	return chainID, nil
 }
-func (s *TransactionStorage) CloseTransaction(chainID int, closeTime *time.Time, in, out chan bool, result chan error) {
-	val := <-in
-	if !val { // chained part returns an error
-		result <- nil
-		return
-	}
 
+// CloseTransaction recognizes revenue of the reserved order: closes its transaction, charges the balance of user,
+// takes the platform fee, updates daily revenue, posts the journal entry and pays cashback of the service in the single DB transaction
+func (s *TransactionStorage) CloseTransaction(chainID int, closeTime *time.Time) error {
 	tx, err := s.db.DB.Begin()
 	if err != nil {
-		out <- false
-		result <- err
-		return
+		return errors.Wrap(err, "can't create a transaction")
 	}
 
-	if _, err := tx.Stmt(s.updateTransactionStmt).Exec(closeTime, &chainID); err != nil {
+	if err := s.closeChain(tx, chainID, closeTime); err != nil {
 		tx.Rollback()
-		out <- false
-		result <- err
-		return
+		return err
 	}
-	out <- true
-	tx.Commit()
-	result <- nil
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "can't commit transaction")
+	}
+	return nil
+}
+
+// CloseOrder recognizes revenue of every line of the reserved order in the single DB transaction, so all of them are recognized or none
+func (s *TransactionStorage) CloseOrder(o reservation.Order) error {
+	chains := make([]int, 0, len(o.Lines))
+	for _, l := range o.Lines {
+		chainID, err := s.FindTransaction(reservation.CashReservation{UserID: o.UserID, FavorID: l.FavorID, OrderID: o.OrderID, Cost: l.Cost, Currency: o.Currency})
+		if err != nil {
+			return err
+		}
+		chains = append(chains, chainID)
+	}
+
+	tx, err := s.db.DB.Begin()
+	if err != nil {
+		return errors.Wrap(err, "can't create a transaction")
+	}
+
+	for _, chainID := range chains {
+		if err := s.closeChain(tx, chainID, o.ClosedAt); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "can't commit transaction")
+	}
+	return nil
+}
+
+// closeChain recognizes revenue of the reserved transaction of the chain within the transaction,
+// revenue net of the fee is paid out to the payee of the order if it has one. Revenue is recognized now if close time is omitted
+func (s *TransactionStorage) closeChain(tx *sql.Tx, chainID int, closeTime *time.Time) error {
+	at := time.Now().UTC()
+	if closeTime != nil {
+		at = *closeTime
+	}
+
+	var t reservation.Transaction
+	var serviceID int
+	var payee sql.NullInt64
+	if err := tx.Stmt(s.updateTransactionStmt).QueryRow(&at, &chainID).Scan(&t.ID, &t.UserID, &t.Cost.Amount, &t.Currency, &serviceID, &payee); err != nil {
+		if err == sql.ErrNoRows { // closed concurrently
+			return ErrClosedTransaction
+		}
+		return errors.Wrap(err, "can't close transaction")
+	}
+	t.Cost = currency.Amount(t.Cost.Amount, t.Currency)
+	if payee.Valid {
+		if err := s.lockPayout(tx, t.UserID, int(payee.Int64), t.Currency); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Stmt(s.decreaseUserBalanceStmt).Exec(&t.Cost.Amount, &t.UserID, &t.Currency); err != nil {
+		return errors.Wrap(err, "can't decrease balance of user")
+	}
+
+	fee, net, err := s.chargeFee(tx, t, serviceID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Stmt(s.updateRevenueDailyStmt).Exec(&t.ID, &t.Cost.Amount, 1, 0, &fee.Amount); err != nil {
+		return errors.Wrap(err, "can't update daily revenue")
+	}
+
+	entry := ledger.Transfer(ledger.EntryRevenue, t.ID, ledger.Hold(t.UserID, t.Currency), ledger.Revenue(serviceID, t.Currency), t.Cost.Amount).
+		Move(ledger.Revenue(serviceID, t.Currency), ledger.Fee(serviceID, t.Currency), fee.Amount)
+	if err := s.ledger.post(tx, entry); err != nil {
+		return err
+	}
+
+	if payee.Valid {
+		if err := s.payOut(tx, t, serviceID, int(payee.Int64), net.Amount, at); err != nil {
+			return err
+		}
+	}
+	return s.payCashback(tx, t, serviceID, at)
 }
 
 func (s *TransactionStorage) GetMonthSummary(year, month int) ([]reports.SummaryCSV, error) {
 
 	begin := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
 	end := begin.AddDate(0, 1, 0)
+	previous := begin.AddDate(0, -1, 0)
 
-	rows, err := s.getMonthSummaryStmt.Query(begin, end)
+	rows, err := s.getMonthSummaryStmt.Query(begin.Format(dayLayout), end.Format(dayLayout), previous.Format(dayLayout))
 	if err != nil {
 		return nil, errors.Wrap(err, "can't get summary of month")
 	}
+	defer rows.Close()
+
 	var sum []reports.SummaryCSV
 	for rows.Next() {
 		var s reports.SummaryCSV
-		if err := rows.Scan(&s.Name, &s.Value); err != nil {
+		var name sql.NullString
+		if err := rows.Scan(&name, &s.Currency, &s.Value.Amount, &s.Refunds.Amount, &s.Cashback.Amount, &s.Fee.Amount, &s.Orders, &s.Users, &s.Reserved.Amount, &s.Previous.Amount); err != nil {
 			return nil, errors.Wrap(err, "can't get row of month summary")
 		}
+		if name.Valid {
+			s.Name = name.String
+		} else { // grand total row of grouping sets
+			s.Name = reports.TotalRowName
+		}
+		inCurrency(s.Currency, &s.Value, &s.Refunds, &s.Cashback, &s.Fee, &s.Reserved, &s.Previous)
+		if err := s.Calculate(); err != nil {
+			return nil, err
+		}
 		sum = append(sum, s)
 	}
 	return sum, nil
 }
 
+func scanOperation(rows *sql.Rows) (reports.Operation, error) {
+	var o reports.Operation
+	var kind, comm, favor, reason, sourceCurrency, rate sql.NullString
+	var reversalOf, reversedBy, sourceCost, linkedID, payeeID, priceID, quantity, couponID, discount sql.NullInt64
+	if err := rows.Scan(&o.ID, &o.Type, &kind, &favor, &o.Sum.Amount, &o.Currency, &comm, &o.Time, &reversalOf, &reason, &reversedBy,
+		&sourceCost, &sourceCurrency, &rate, &linkedID, &payeeID, &priceID, &quantity, &couponID, &discount); err != nil {
+		return o, errors.Wrap(err, "can't scan operation row")
+	}
+	inCurrency(o.Currency, &o.Sum)
+	if kind.Valid {
+		o.Kind = kind.String
+	}
+	if reversalOf.Valid {
+		o.ReversalOf = int(reversalOf.Int64)
+	}
+	if reversedBy.Valid {
+		o.ReversedBy = int(reversedBy.Int64)
+	}
+	if reason.Valid {
+		o.Reason = reason.String
+	}
+	if favor.Valid {
+		o.Favor = favor.String
+	}
+	if comm.Valid {
+		o.Comment = comm.String
+	}
+	if sourceCost.Valid { // operation was converted from other currency
+		sum := currency.Amount(sourceCost.Int64, sourceCurrency.String)
+		o.SourceSum = &sum
+		o.SourceCurrency = sourceCurrency.String
+		o.Rate = rate.String
+	}
+	if linkedID.Valid {
+		o.LinkedID = int(linkedID.Int64)
+	}
+	if payeeID.Valid {
+		o.PayeeID = int(payeeID.Int64)
+	}
+	if priceID.Valid { // cost was calculated by the price of service
+		o.PriceID, o.Quantity = int(priceID.Int64), int(quantity.Int64)
+	}
+	if couponID.Valid {
+		d := currency.Amount(discount.Int64, o.Currency)
+		o.CouponID, o.Discount = int(couponID.Int64), &d
+	}
+	return o, nil
+}
+
 func (s *TransactionStorage) getOperationsDefault(stmt *sql.Stmt, user_id int) ([]reports.Operation, error) {
 	rows, err := stmt.Query(&user_id)
 	if err != nil {
@@ -273,16 +605,9 @@ func (s *TransactionStorage) getOperationsDefault(stmt *sql.Stmt, user_id int) (
 	var ops []reports.Operation
 
 	for rows.Next() {
-		var o reports.Operation
-		var comm, favor sql.NullString
-		if err := rows.Scan(&o.Type, &favor, &o.Sum, &comm, &o.Time); err != nil {
-			return nil, errors.Wrap(err, "can't scan operation row")
-		}
-		if favor.Valid {
-			o.Favor = favor.String
-		}
-		if comm.Valid {
-			o.Comment = comm.String
+		o, err := scanOperation(rows)
+		if err != nil {
+			return nil, err
 		}
 		ops = append(ops, o)
 	}
@@ -344,16 +669,9 @@ func (s *TransactionStorage) GetOperations(user_id, page int, sortby, direction
 	var ops []reports.Operation
 
 	for rows.Next() {
-		var o reports.Operation
-		var comm, favor sql.NullString
-		if err := rows.Scan(&o.Type, &favor, &o.Sum, &comm, &o.Time); err != nil {
-			return nil, errors.Wrap(err, "can't scan operation row")
-		}
-		if favor.Valid {
-			o.Favor = favor.String
-		}
-		if comm.Valid {
-			o.Comment = comm.String
+		o, err := scanOperation(rows)
+		if err != nil {
+			return nil, err
 		}
 		ops = append(ops, o)
 	}
@@ -378,7 +696,24 @@ func (s *TransactionStorage) DeleteAllTransactions() error {
 		return errors.Wrap(err, "can't delete chains")
 	}
 
+	if _, err := tx.Stmt(s.deleteRevenueDailyStmt).Exec(); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "can't delete daily revenue")
+	}
+
+	if err := s.ledger.deleteAll(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	tx.Commit()
 
 	return nil
 }
+
+// inCurrency sets exponent of the currency to amounts scanned in minor units
+func inCurrency(code string, amounts ...*money.Money) {
+	for _, m := range amounts {
+		*m = currency.Amount(m.Amount, code)
+	}
+}
@@ -0,0 +1,232 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	reservation "github.com/antsrp/balance_service/internal/cash_reservation"
+	"github.com/antsrp/balance_service/internal/ledger"
+	"github.com/pkg/errors"
+)
+
+const (
+	lockTransactionQ = `SELECT transactions.user_id, direction, kind, chain_id, chains.service_id, cost, currency, is_completed, reversal_of,
+	linked_id, (SELECT chains.service_id FROM transactions AS orders JOIN chains ON orders.chain_id = chains.id WHERE orders.id = transactions.linked_id),
+	COALESCE(fee, 0)
+	FROM transactions
+	LEFT JOIN chains ON chain_id = chains.id
+	WHERE transactions.id = $1
+	FOR UPDATE OF transactions`
+	findReversalQ         = "SELECT id FROM transactions WHERE reversal_of = $1"
+	findOrderTransactionQ = "SELECT id FROM transactions WHERE chain_id = $1 AND direction = 'out' AND kind IS NULL"
+	createReversalQ       = `INSERT INTO transactions (user_id, direction, kind, is_completed, closed_at, chain_id, cost, currency, comment, reversal_of, reason, fee, net)
+	SELECT user_id, CASE WHEN direction = 'in' THEN 'out' ELSE 'in' END, 'reversal', true, $2, chain_id, cost, currency, comment, id, $3, fee, net
+	FROM transactions
+	WHERE id = $1
+	RETURNING id`
+	reservedCashQ = `SELECT COALESCE(SUM(cost), 0) FROM transactions
+	WHERE user_id = $1 AND currency = $2 AND direction = 'out' AND is_completed = false`
+	changeUserBalanceQ = "UPDATE wallets SET balance = balance + $1 WHERE user_id = $2 AND currency = $3"
+
+	TransactionNotFound     = "Transaction not found"
+	NotCompletedTransaction = "Transaction is not completed"
+	AlreadyReversed         = "Transaction is already reversed"
+	ReversalOfReversal      = "Reversal can't be reversed"
+	TransferReversal        = "Transfer can't be reversed"
+	OrderHasRefunds         = "Order has refunds"
+	InsufficientFunds       = "Insufficient funds"
+)
+
+var (
+	ErrTransactionNotFound     = errors.New(TransactionNotFound)
+	ErrNotCompletedTransaction = errors.New(NotCompletedTransaction)
+	ErrAlreadyReversed         = errors.New(AlreadyReversed)
+	ErrReversalOfReversal      = errors.New(ReversalOfReversal)
+	ErrTransferReversal        = errors.New(TransferReversal)
+	ErrOrderHasRefunds         = errors.New(OrderHasRefunds)
+	ErrInsufficientFunds       = errors.New(InsufficientFunds)
+)
+
+// Reverse creates the opposite entry linked with the completed transaction and adjusts balance of user atomically.
+// Returns id of the reversing transaction and the user it belongs to, the user is known once the transaction is found.
+func (s *TransactionStorage) Reverse(r reservation.Reversal) (int, int, error) {
+	tx, err := s.db.DB.Begin()
+	if err != nil {
+		return -1, 0, errors.Wrap(err, "can't create a transaction")
+	}
+
+	var t reservation.Transaction
+	var kind sql.NullString
+	var chainID, serviceID, reversalOf, linkedID, linkedServiceID sql.NullInt64
+	var fee int64 // platform fee of the order goes back with its revenue
+	if err := tx.Stmt(s.lockTransactionStmt).QueryRow(&r.TransactionID).Scan(&t.UserID, &t.Direction, &kind, &chainID, &serviceID, &t.Cost.Amount, &t.Currency, &t.IsCompleted, &reversalOf,
+		&linkedID, &linkedServiceID, &fee); err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return -1, t.UserID, ErrTransactionNotFound
+		}
+		return -1, t.UserID, errors.Wrap(err, "can't lock transaction")
+	}
+	if !t.IsCompleted {
+		tx.Rollback()
+		return -1, t.UserID, ErrNotCompletedTransaction
+	}
+	if reversalOf.Valid {
+		tx.Rollback()
+		return -1, t.UserID, ErrReversalOfReversal
+	}
+	if kind.String == KindTransfer { // both sides must be moved back together, by the opposite transfer
+		tx.Rollback()
+		return -1, t.UserID, ErrTransferReversal
+	}
+	if kind.String == KindBonus || kind.String == KindBonusExpiry { // buckets are changed by grants and expiration only
+		tx.Rollback()
+		return -1, t.UserID, ErrBonusReversal
+	}
+	if kind.String == KindAdjustment { // it was approved by two admins, so it is undone by the opposite adjustment only
+		tx.Rollback()
+		return -1, t.UserID, ErrAdjustmentReversal
+	}
+	if kind.String == KindWithdrawal { // money has left the service, status and events of the withdrawal would contradict the balance
+		tx.Rollback()
+		return -1, t.UserID, ErrWithdrawalReversal
+	}
+
+	var reversalID int
+	if err := tx.Stmt(s.findReversalStmt).QueryRow(&r.TransactionID).Scan(&reversalID); err != sql.ErrNoRows {
+		tx.Rollback()
+		if err != nil {
+			return -1, t.UserID, errors.Wrap(err, "can't find reversal of transaction")
+		}
+		return -1, t.UserID, ErrAlreadyReversed
+	}
+
+	// changes of daily revenue, orders, refunds and fees made by the reversal
+	revenue, orders, refunds, fees := -t.Cost.Amount, -1, int64(0), -fee
+	if kind.String == KindRefund {
+		revenue, orders, refunds, fees = t.Cost.Amount, 0, -t.Cost.Amount, 0
+	} else if chainID.Valid { // revenue is reversed in full, so it must not be refunded partially
+		var refunded int64
+		if err := tx.Stmt(s.refundedCashStmt).QueryRow(&chainID).Scan(&refunded); err != nil {
+			tx.Rollback()
+			return -1, t.UserID, errors.Wrap(err, "can't get refunded cash of order")
+		}
+		if refunded > 0 {
+			tx.Rollback()
+			return -1, t.UserID, ErrOrderHasRefunds
+		}
+		var hasCashback bool // cashback of the order is reversed first, by its own reversal
+		if err := tx.Stmt(s.orderHasCashbackStmt).QueryRow(&r.TransactionID).Scan(&hasCashback); err != nil {
+			tx.Rollback()
+			return -1, t.UserID, errors.Wrap(err, "can't check cashback of order")
+		}
+		if hasCashback {
+			tx.Rollback()
+			return -1, t.UserID, ErrOrderHasCashback
+		}
+		var hasPayout bool // revenue paid out to the payee is taken back first, by reversal of the payout
+		if err := tx.Stmt(s.orderHasPayoutStmt).QueryRow(&r.TransactionID).Scan(&hasPayout); err != nil {
+			tx.Rollback()
+			return -1, t.UserID, errors.Wrap(err, "can't check payout of order")
+		}
+		if hasPayout {
+			tx.Rollback()
+			return -1, t.UserID, ErrOrderHasPayout
+		}
+	}
+
+	// state of the account must allow money to move back, e.g. nothing comes to the closed one
+	check := s.accounts.checkCredit
+	if t.Direction == "in" {
+		check = s.accounts.checkDebit
+	}
+	if err := check(tx, t.UserID); err != nil {
+		tx.Rollback()
+		return -1, t.UserID, err
+	}
+
+	delta := t.Cost.Amount
+	if t.Direction == "in" { // money goes back out of the wallet, it must be available
+		wallet, err := s.lockWallet(tx, t.UserID, t.Currency)
+		if err != nil {
+			tx.Rollback()
+			if err == sql.ErrNoRows {
+				return -1, t.UserID, errors.Wrap(err, "can't lock balance of user")
+			}
+			return -1, t.UserID, err
+		}
+		available, err := availableFunds(*wallet)
+		if err != nil {
+			tx.Rollback()
+			return -1, t.UserID, err
+		}
+		if available.Amount < delta {
+			tx.Rollback()
+			return -1, t.UserID, ErrInsufficientFunds
+		}
+		delta = -delta
+	}
+
+	at := time.Now().UTC()
+	if r.Time != nil {
+		at = *r.Time
+	}
+	if err := tx.Stmt(s.createReversalStmt).QueryRow(&r.TransactionID, &at, &r.Reason).Scan(&reversalID); err != nil {
+		tx.Rollback()
+		return -1, t.UserID, errors.Wrap(err, "can't create reversing transaction")
+	}
+
+	if _, err := tx.Stmt(s.changeUserBalanceStmt).Exec(&delta, &t.UserID, &t.Currency); err != nil {
+		tx.Rollback()
+		return -1, t.UserID, errors.Wrap(err, "can't change balance of user")
+	}
+
+	// bonuses spent on the order come back to buckets with its revenue, and are taken back with its refund
+	if chainID.Valid && kind.String == KindRefund {
+		var orderID int
+		if err := tx.Stmt(s.findOrderTransactionStmt).QueryRow(&chainID).Scan(&orderID); err != nil {
+			tx.Rollback()
+			return -1, t.UserID, errors.Wrap(err, "can't find transaction of order")
+		}
+		if err := s.bonuses.reclaim(tx, orderID, t.Cost.Amount); err != nil {
+			tx.Rollback()
+			return -1, t.UserID, err
+		}
+	} else if chainID.Valid {
+		if err := s.bonuses.restore(tx, r.TransactionID, t.Cost.Amount); err != nil {
+			tx.Rollback()
+			return -1, t.UserID, err
+		}
+	}
+
+	// counterpart account of the original operation
+	counterpart := ledger.External(t.Currency)
+	if kind.String == KindCashback {
+		counterpart = ledger.Revenue(int(linkedServiceID.Int64), t.Currency)
+		if _, err := tx.Stmt(s.updateCashbackDailyStmt).Exec(&linkedID, &at, -t.Cost.Amount); err != nil {
+			tx.Rollback()
+			return -1, t.UserID, errors.Wrap(err, "can't update daily cashback")
+		}
+	} else if kind.String == KindPayout {
+		counterpart = ledger.Revenue(int(linkedServiceID.Int64), t.Currency)
+	} else if chainID.Valid {
+		counterpart = ledger.Revenue(int(serviceID.Int64), t.Currency)
+		if _, err := tx.Stmt(s.updateRevenueDailyStmt).Exec(&reversalID, &revenue, &orders, &refunds, &fees); err != nil {
+			tx.Rollback()
+			return -1, t.UserID, errors.Wrap(err, "can't update daily revenue")
+		}
+	}
+	entry := ledger.Transfer(ledger.EntryReversal, reversalID, counterpart, ledger.Wallet(t.UserID, t.Currency), delta)
+	if chainID.Valid {
+		entry.Move(ledger.Fee(int(serviceID.Int64), t.Currency), counterpart, fee)
+	}
+	if err := s.ledger.post(tx, entry); err != nil {
+		tx.Rollback()
+		return -1, t.UserID, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return -1, t.UserID, errors.Wrap(err, "can't commit transaction")
+	}
+	return reversalID, t.UserID, nil
+}
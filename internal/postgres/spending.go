@@ -0,0 +1,186 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/antsrp/balance_service/internal/currency"
+	"github.com/antsrp/balance_service/internal/money"
+	"github.com/antsrp/balance_service/internal/spending"
+	"github.com/pkg/errors"
+)
+
+const (
+	setLimitQ = `INSERT INTO spending_limits (user_id, service_id, period, currency, amount) VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (user_id, (COALESCE(service_id, 0)), period, currency) DO UPDATE SET amount = EXCLUDED.amount
+	RETURNING id`
+	getLimitsQ = `SELECT id, user_id, service_id, period, currency, amount FROM spending_limits
+	WHERE user_id = $1
+	ORDER BY currency, period, service_id NULLS FIRST`
+	// limits applied to the order of user on the service
+	findLimitsQ = `SELECT period, service_id, amount FROM spending_limits
+	WHERE user_id = $1 AND currency = $2 AND (service_id IS NULL OR service_id = $3)`
+	deleteLimitQ     = "DELETE FROM spending_limits WHERE id = $1"
+	deleteAllLimitsQ = "DELETE FROM spending_limits"
+	// orders of user reserved within the window, reversed ones are not counted
+	spentQ = `SELECT COALESCE(SUM(cost), 0)
+	FROM transactions
+	JOIN chains ON chain_id = chains.id
+	WHERE transactions.user_id = $1 AND currency = $2 AND direction = 'out' AND kind IS NULL
+	AND ($3::bigint IS NULL OR chains.service_id = $3)
+	AND $4 <= created_at AND created_at < $5
+	AND NOT EXISTS (SELECT 1 FROM transactions AS reversals WHERE reversals.reversal_of = transactions.id)`
+
+	LimitNotFound         = "Spending limit not found"
+	SpendingLimitExceeded = "Spending limit exceeded"
+)
+
+var (
+	ErrLimitNotFound         = errors.New(LimitNotFound)
+	ErrSpendingLimitExceeded = errors.New(SpendingLimitExceeded)
+)
+
+type SpendingStorage struct {
+	StatementStorage
+
+	setLimitStmt        *sql.Stmt
+	getLimitsStmt       *sql.Stmt
+	findLimitsStmt      *sql.Stmt
+	deleteLimitStmt     *sql.Stmt
+	deleteAllLimitsStmt *sql.Stmt
+	spentStmt           *sql.Stmt
+}
+
+var _ spending.Storage = &SpendingStorage{}
+
+// CreateSpendingStorage creates new storage of spending limits
+func CreateSpendingStorage(d *Dbsql) (*SpendingStorage, error) {
+	s := &SpendingStorage{StatementStorage: Create(d)}
+
+	stmts := []stmt{
+		{Query: setLimitQ, Dst: &s.setLimitStmt},
+		{Query: getLimitsQ, Dst: &s.getLimitsStmt},
+		{Query: findLimitsQ, Dst: &s.findLimitsStmt},
+		{Query: deleteLimitQ, Dst: &s.deleteLimitStmt},
+		{Query: deleteAllLimitsQ, Dst: &s.deleteAllLimitsStmt},
+		{Query: spentQ, Dst: &s.spentStmt},
+	}
+
+	if err := s.initStatements(stmts); err != nil {
+		return nil, errors.Wrap(err, "can't init statements")
+	}
+
+	return s, nil
+}
+
+// SetLimit creates the limit or changes amount of the existing one of the same user, service, period and currency
+func (s *SpendingStorage) SetLimit(l *spending.Limit) (int, error) {
+	var id int
+	if err := s.setLimitStmt.QueryRow(&l.UserID, l.ServiceID, &l.Period, &l.Currency, &l.Amount.Amount).Scan(&id); err != nil {
+		return -1, errors.Wrap(err, "can't set spending limit")
+	}
+	return id, nil
+}
+
+// GetLimits returns limits of user along with amounts used in their current windows
+func (s *SpendingStorage) GetLimits(userID int) ([]spending.Limit, error) {
+	rows, err := s.getLimitsStmt.Query(&userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't get spending limits")
+	}
+	defer rows.Close()
+
+	limits := []spending.Limit{}
+	for rows.Next() {
+		var l spending.Limit
+		var serviceID sql.NullInt64
+		if err := rows.Scan(&l.ID, &l.UserID, &serviceID, &l.Period, &l.Currency, &l.Amount.Amount); err != nil {
+			return nil, errors.Wrap(err, "can't scan spending limit")
+		}
+		if serviceID.Valid {
+			id := int(serviceID.Int64)
+			l.ServiceID = &id
+		}
+		limits = append(limits, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "can't get spending limits")
+	}
+
+	now := time.Now().UTC()
+	for i := range limits {
+		l := &limits[i]
+		begin, end, err := spending.Window(l.Period, now)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.spentStmt.QueryRow(&l.UserID, &l.Currency, l.ServiceID, &begin, &end).Scan(&l.Used.Amount); err != nil {
+			return nil, errors.Wrap(err, "can't get spent amount")
+		}
+		inCurrency(l.Currency, &l.Amount, &l.Used)
+	}
+	return limits, nil
+}
+
+func (s *SpendingStorage) DeleteLimit(id int) error {
+	res, err := s.deleteLimitStmt.Exec(&id)
+	if err != nil {
+		return errors.Wrap(err, "can't delete spending limit")
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrLimitNotFound
+	}
+	return nil
+}
+
+func (s *SpendingStorage) DeleteAllLimits() error {
+	if _, err := s.deleteAllLimitsStmt.Exec(); err != nil {
+		return errors.Wrap(err, "can't delete spending limits")
+	}
+	return nil
+}
+
+// checkLimits verifies the order of user on the service fits every limit applied to it, within the transaction of
+// reservation. The wallet of user must be locked by the transaction, so concurrent reservations are counted
+func (s *SpendingStorage) checkLimits(tx *sql.Tx, userID, serviceID int, code string, cost money.Money, at time.Time) error {
+	rows, err := tx.Stmt(s.findLimitsStmt).Query(&userID, &code, &serviceID)
+	if err != nil {
+		return errors.Wrap(err, "can't find spending limits")
+	}
+	var limits []spending.Limit
+	for rows.Next() {
+		var l spending.Limit
+		var limitService sql.NullInt64
+		if err := rows.Scan(&l.Period, &limitService, &l.Amount.Amount); err != nil {
+			rows.Close()
+			return errors.Wrap(err, "can't scan spending limit")
+		}
+		if limitService.Valid {
+			l.ServiceID = &serviceID
+		}
+		limits = append(limits, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return errors.Wrap(err, "can't find spending limits")
+	}
+
+	for _, l := range limits {
+		begin, end, err := spending.Window(l.Period, at)
+		if err != nil {
+			return err
+		}
+		spent := currency.Amount(0, code)
+		if err := tx.Stmt(s.spentStmt).QueryRow(&userID, &code, l.ServiceID, &begin, &end).Scan(&spent.Amount); err != nil {
+			return errors.Wrap(err, "can't get spent amount")
+		}
+		total, err := spent.Add(cost)
+		if err != nil {
+			return errors.Wrap(err, "can't calculate spent amount")
+		}
+		if total.Cmp(currency.Amount(l.Amount.Amount, code)) > 0 {
+			return ErrSpendingLimitExceeded
+		}
+	}
+	return nil
+}
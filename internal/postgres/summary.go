@@ -0,0 +1,160 @@
+package postgres
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/antsrp/balance_service/internal/reports"
+	"github.com/pkg/errors"
+)
+
+const (
+	// kind of the operation, reversals are accounted as the operations they reverse
+	operationKindQ = `COALESCE(original.kind, transactions.kind, '')`
+
+	usersSummaryCarcassQ = `SELECT transactions.user_id, transactions.currency,
+	COALESCE(SUM(CASE WHEN transactions.direction = 'out' THEN transactions.cost ELSE -transactions.cost END)
+		FILTER (WHERE favors.id IS NOT NULL), 0) AS spent,
+	COALESCE(SUM(CASE WHEN transactions.direction = 'in' THEN transactions.cost ELSE -transactions.cost END)
+		FILTER (WHERE transactions.chain_id IS NULL AND ` + operationKindQ + ` NOT IN ('adjustment', 'transfer', 'bonus', 'bonus_expiry', 'cashback', 'payout', 'withdrawal')), 0) AS top_ups,
+	COALESCE(SUM(CASE WHEN transactions.direction = 'in' THEN transactions.cost ELSE -transactions.cost END)
+		FILTER (WHERE ` + operationKindQ + ` = 'voucher'), 0) AS vouchers,
+	COALESCE(SUM(CASE WHEN transactions.direction = 'out' THEN 1 ELSE -1 END)
+		FILTER (WHERE favors.id IS NOT NULL AND ` + operationKindQ + ` <> 'refund'), 0) AS orders
+	FROM transactions
+	LEFT JOIN transactions AS original ON original.id = transactions.reversal_of
+	LEFT JOIN chains ON transactions.chain_id = chains.id
+	LEFT JOIN favors ON chains.service_id = favors.id
+	WHERE transactions.is_completed = true AND $1 <= transactions.closed_at AND transactions.closed_at < $2
+	GROUP BY transactions.user_id, transactions.currency
+	`
+
+	lockRevenueDailyQ    = "LOCK TABLE revenue_daily IN EXCLUSIVE MODE"
+	rebuildRevenueDailyQ = `INSERT INTO revenue_daily (day, service_id, user_id, currency, revenue, orders, refunds, fees)
+	SELECT (transactions.closed_at AT TIME ZONE 'UTC')::date, chains.service_id, transactions.user_id, transactions.currency,
+	SUM(CASE WHEN transactions.direction = 'out' THEN transactions.cost ELSE -transactions.cost END),
+	COALESCE(SUM(CASE WHEN transactions.direction = 'out' THEN 1 ELSE -1 END) FILTER (WHERE ` + operationKindQ + ` <> 'refund'), 0),
+	COALESCE(SUM(CASE WHEN transactions.direction = 'in' THEN transactions.cost ELSE -transactions.cost END) FILTER (WHERE ` + operationKindQ + ` = 'refund'), 0),
+	COALESCE(SUM(CASE WHEN transactions.direction = 'out' THEN transactions.fee ELSE -transactions.fee END), 0)
+	FROM transactions
+	LEFT JOIN transactions AS original ON original.id = transactions.reversal_of
+	JOIN chains ON transactions.chain_id = chains.id
+	WHERE transactions.is_completed = true
+	GROUP BY 1, chains.service_id, transactions.user_id, transactions.currency`
+	// cashback is accounted to the service of order it is linked with, rows of revenue exist already
+	rebuildCashbackDailyQ = `INSERT INTO revenue_daily (day, service_id, user_id, currency, revenue, orders, refunds, cashback)
+	SELECT (transactions.closed_at AT TIME ZONE 'UTC')::date, chains.service_id, transactions.user_id, transactions.currency, 0, 0, 0,
+	SUM(CASE WHEN transactions.direction = 'in' THEN transactions.cost ELSE -transactions.cost END)
+	FROM transactions
+	LEFT JOIN transactions AS original ON original.id = transactions.reversal_of
+	JOIN transactions AS orders ON orders.id = COALESCE(original.linked_id, transactions.linked_id)
+	JOIN chains ON orders.chain_id = chains.id
+	WHERE transactions.is_completed = true AND ` + operationKindQ + ` = 'cashback'
+	GROUP BY 1, chains.service_id, transactions.user_id, transactions.currency
+	ON CONFLICT (day, service_id, user_id, currency) DO UPDATE SET cashback = EXCLUDED.cashback`
+
+	SORT_USER    = `user`
+	SORT_SPENT   = `spent`
+	SORT_TOP_UPS = `top_ups`
+	SORT_ORDERS  = `orders`
+)
+
+var usersSummaryOrders = map[string]string{
+	SORT_USER:    ` ORDER BY user_id `,
+	SORT_SPENT:   ` ORDER BY spent `,
+	SORT_TOP_UPS: ` ORDER BY top_ups `,
+	SORT_ORDERS:  ` ORDER BY orders `,
+}
+
+func usersSummaryKey(sortby, direction string) string {
+	return sortby + " " + direction
+}
+
+// initUsersSummaryStatements prepares a statement for every sorting param and direction of users summary
+func (s *TransactionStorage) initUsersSummaryStatements() error {
+	s.usersSummaryStmts = make(map[string]*sql.Stmt)
+
+	for sortby, order := range usersSummaryOrders {
+		for _, direction := range []string{SORT_ASC, SORT_DESC} {
+			stmt, err := s.prepareStatement(usersSummaryCarcassQ + order + direction + `, user_id, currency`)
+			if err != nil {
+				return err
+			}
+			s.statements = append(s.statements, stmt)
+			s.usersSummaryStmts[usersSummaryKey(sortby, direction)] = stmt
+		}
+	}
+
+	return nil
+}
+
+func (s *TransactionStorage) GetUsersMonthSummary(year, month int, sortby, direction string) ([]reports.UserSummaryCSV, error) {
+	sortby, direction = strings.ToLower(sortby), strings.ToUpper(direction)
+	if sortby == "" {
+		sortby = SORT_USER
+	}
+	if direction != SORT_DESC {
+		direction = SORT_ASC
+	}
+
+	stmt, ok := s.usersSummaryStmts[usersSummaryKey(sortby, direction)]
+	if !ok {
+		return nil, ErrSortParamNotFound
+	}
+
+	begin := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+	end := begin.AddDate(0, 1, 0)
+
+	rows, err := stmt.Query(begin, end)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't get summary of users")
+	}
+	defer rows.Close()
+
+	var sum []reports.UserSummaryCSV
+	for rows.Next() {
+		var u reports.UserSummaryCSV
+		if err := rows.Scan(&u.UserID, &u.Currency, &u.Spent.Amount, &u.TopUps.Amount, &u.Vouchers.Amount, &u.Orders); err != nil {
+			return nil, errors.Wrap(err, "can't get row of users summary")
+		}
+		inCurrency(u.Currency, &u.Spent, &u.TopUps, &u.Vouchers)
+		sum = append(sum, u)
+	}
+	return sum, nil
+}
+
+// RebuildRevenueDaily recomputes the daily revenue aggregate from the raw transactions
+func (s *TransactionStorage) RebuildRevenueDaily() error {
+
+	tx, err := s.db.DB.Begin()
+	if err != nil {
+		return errors.Wrap(err, "can't create transaction")
+	}
+
+	if _, err := tx.Exec(lockRevenueDailyQ); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "can't lock daily revenue")
+	}
+
+	if _, err := tx.Stmt(s.deleteRevenueDailyStmt).Exec(); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "can't delete daily revenue")
+	}
+
+	if _, err := tx.Stmt(s.rebuildRevenueDailyStmt).Exec(); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "can't rebuild daily revenue")
+	}
+
+	if _, err := tx.Stmt(s.rebuildCashbackDailyStmt).Exec(); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "can't rebuild daily cashback")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "can't commit transaction")
+	}
+
+	return nil
+}
@@ -0,0 +1,167 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/antsrp/balance_service/internal/currency"
+	"github.com/antsrp/balance_service/internal/ledger"
+	"github.com/antsrp/balance_service/internal/payment"
+	"github.com/antsrp/balance_service/internal/user"
+	"github.com/pkg/errors"
+)
+
+const (
+	KindPayment = "payment"
+
+	createTopUpQ = `INSERT INTO top_ups (user_id, amount, currency, status, provider, payment_id, payment_url, created_at)
+	VALUES ($1, $2, $3, 'pending', $4, $5, $6, $7) RETURNING id`
+	topUpsQ = `SELECT id, user_id, amount, currency, status, provider, payment_id, payment_url, created_at, completed_at, transaction_id
+	FROM top_ups
+	WHERE ($1::bigint = 0 OR user_id = $1) AND ($2 = '' OR status = $2)
+	ORDER BY id`
+	// callbacks of the same payment wait for each other
+	lockTopUpQ = `SELECT id, user_id, amount, currency, status, provider, payment_id, payment_url, created_at, completed_at, transaction_id
+	FROM top_ups WHERE provider = $1 AND payment_id = $2 FOR UPDATE`
+	completeTopUpQ   = "UPDATE top_ups SET status = $2, completed_at = $3, transaction_id = $4 WHERE id = $1"
+	deleteAllTopUpsQ = "DELETE FROM top_ups"
+
+	TopUpNotFound      = "Top-up not found"
+	TopUpStateConflict = "Top-up is completed with another status"
+)
+
+var (
+	ErrTopUpNotFound      = errors.New(TopUpNotFound)
+	ErrTopUpStateConflict = errors.New(TopUpStateConflict)
+)
+
+type TopUpStorage struct {
+	StatementStorage
+
+	createTopUpStmt     *sql.Stmt
+	topUpsStmt          *sql.Stmt
+	lockTopUpStmt       *sql.Stmt
+	completeTopUpStmt   *sql.Stmt
+	deleteAllTopUpsStmt *sql.Stmt
+
+	users *UserStorage
+}
+
+var _ payment.Storage = &TopUpStorage{}
+
+// CreateTopUpStorage creates new storage of top-ups paid through payment providers,
+// succeeded ones top up balances through the storage of users
+func CreateTopUpStorage(d *Dbsql, us *UserStorage) (*TopUpStorage, error) {
+	s := &TopUpStorage{StatementStorage: Create(d), users: us}
+
+	stmts := []stmt{
+		{Query: createTopUpQ, Dst: &s.createTopUpStmt},
+		{Query: topUpsQ, Dst: &s.topUpsStmt},
+		{Query: lockTopUpQ, Dst: &s.lockTopUpStmt},
+		{Query: completeTopUpQ, Dst: &s.completeTopUpStmt},
+		{Query: deleteAllTopUpsQ, Dst: &s.deleteAllTopUpsStmt},
+	}
+
+	if err := s.initStatements(stmts); err != nil {
+		return nil, errors.Wrap(err, "can't init statements")
+	}
+
+	return s, nil
+}
+
+// CreateTopUp records the pending top-up registered at the provider
+func (s *TopUpStorage) CreateTopUp(t *payment.TopUp) error {
+	url := sql.NullString{String: t.PaymentURL, Valid: t.PaymentURL != ""}
+	if err := s.createTopUpStmt.QueryRow(&t.UserID, &t.Amount.Amount, &t.Currency, &t.Provider, &t.PaymentID, &url, &t.CreatedAt).Scan(&t.ID); err != nil {
+		return errors.Wrap(err, "can't create top-up")
+	}
+	t.Status = payment.StatusPending
+	return nil
+}
+
+func scanTopUp(row interface{ Scan(...interface{}) error }) (*payment.TopUp, error) {
+	var t payment.TopUp
+	var url sql.NullString
+	var transactionID sql.NullInt64
+	if err := row.Scan(&t.ID, &t.UserID, &t.Amount.Amount, &t.Currency, &t.Status, &t.Provider, &t.PaymentID, &url,
+		&t.CreatedAt, &t.CompletedAt, &transactionID); err != nil {
+		return nil, err
+	}
+	t.Amount = currency.Amount(t.Amount.Amount, t.Currency)
+	t.PaymentURL, t.TransactionID = url.String, int(transactionID.Int64)
+	return &t, nil
+}
+
+// GetTopUps returns top-ups of the user in the status, zero user or empty status matches any
+func (s *TopUpStorage) GetTopUps(userID int, status string) ([]payment.TopUp, error) {
+	rows, err := s.topUpsStmt.Query(&userID, &status)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't get top-ups")
+	}
+	defer rows.Close()
+
+	topUps := []payment.TopUp{}
+	for rows.Next() {
+		t, err := scanTopUp(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't scan top-up")
+		}
+		topUps = append(topUps, *t)
+	}
+	return topUps, nil
+}
+
+// Complete sets the final status of the pending top-up reported by the provider, balance of user is credited
+// in the same DB transaction if the payment succeeded. Repeated callback with the same status changes nothing.
+// Found top-up is returned with the error too
+func (s *TopUpStorage) Complete(provider string, c payment.Callback) (*payment.TopUp, error) {
+	tx, err := s.db.DB.Begin()
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create a transaction")
+	}
+
+	t, err := scanTopUp(tx.Stmt(s.lockTopUpStmt).QueryRow(&provider, &c.PaymentID))
+	if err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return nil, ErrTopUpNotFound
+		}
+		return nil, errors.Wrap(err, "can't lock top-up")
+	}
+	if t.Status != payment.StatusPending {
+		tx.Rollback()
+		if t.Status != c.Status {
+			return t, ErrTopUpStateConflict
+		}
+		return t, nil
+	}
+
+	at := time.Now().UTC()
+	var transactionID sql.NullInt64
+	if c.Status == payment.StatusSucceeded {
+		u := user.User{ID: t.UserID, Time: &at, Comment: t.Comment(), Balance: t.Amount, Currency: t.Currency}
+		id, err := s.users.addBalance(tx, &u, KindPayment, ledger.EntryTopUp)
+		if err != nil {
+			tx.Rollback()
+			return t, err
+		}
+		transactionID = sql.NullInt64{Int64: int64(id), Valid: true}
+	}
+	if _, err := tx.Stmt(s.completeTopUpStmt).Exec(&t.ID, &c.Status, &at, &transactionID); err != nil {
+		tx.Rollback()
+		return t, errors.Wrap(err, "can't complete top-up")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return t, errors.Wrap(err, "can't commit transaction")
+	}
+	t.Status, t.CompletedAt, t.TransactionID = c.Status, &at, int(transactionID.Int64)
+	return t, nil
+}
+
+func (s *TopUpStorage) DeleteAllTopUps() error {
+	if _, err := s.deleteAllTopUpsStmt.Exec(); err != nil {
+		return errors.Wrap(err, "can't delete top-ups")
+	}
+	return nil
+}
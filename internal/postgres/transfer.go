@@ -0,0 +1,198 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/antsrp/balance_service/internal/currency"
+	"github.com/antsrp/balance_service/internal/exchange"
+	"github.com/antsrp/balance_service/internal/ledger"
+	"github.com/antsrp/balance_service/internal/transfer"
+	"github.com/antsrp/balance_service/internal/user"
+	"github.com/pkg/errors"
+)
+
+const (
+	KindTransfer = "transfer"
+
+	createWalletQ = `INSERT INTO wallets (user_id, currency, balance) VALUES ($1, $2, 0)
+	ON CONFLICT (user_id, currency) DO NOTHING`
+	// wallets are locked in the same order by every transfer, so opposite transfers can't deadlock
+	lockWalletsQ = `SELECT user_id, currency, balance, credit_limit FROM wallets
+	WHERE (user_id = $1 AND currency = $2) OR (user_id = $3 AND currency = $4)
+	ORDER BY user_id, currency
+	FOR UPDATE`
+	createTransferOutQ = `INSERT INTO transactions (user_id, direction, kind, is_completed, closed_at, cost, currency, comment)
+	VALUES ($1, 'out', 'transfer', true, $2, $3, $4, $5) RETURNING id`
+	createTransferInQ = `INSERT INTO transactions (user_id, direction, kind, is_completed, closed_at, cost, currency, comment,
+	source_cost, source_currency, rate, linked_id)
+	VALUES ($1, 'in', 'transfer', true, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id`
+	linkTransactionQ = "UPDATE transactions SET linked_id = $2 WHERE id = $1"
+
+	SameWallet = "Transfer to the same wallet"
+	ZeroAmount = "Amount must be positive"
+)
+
+var (
+	ErrSameWallet = errors.New(SameWallet)
+	ErrZeroAmount = errors.New(ZeroAmount)
+)
+
+var _ transfer.Storage = &TransactionStorage{}
+
+// Transfer moves money between wallets converting it at the rate in effect at the time of transfer if currencies differ.
+// Both transactions, balances of wallets and the journal entry are written atomically
+func (s *TransactionStorage) Transfer(t transfer.Transfer) (*transfer.Result, error) {
+	toCurrency := t.ToCurrency
+	if toCurrency == "" {
+		toCurrency = t.Currency
+	}
+	if t.FromUserID == t.ToUserID && t.Currency == toCurrency {
+		return nil, ErrSameWallet
+	}
+	if t.Amount.Amount <= 0 {
+		return nil, ErrZeroAmount
+	}
+	at := time.Now().UTC()
+	if t.Time != nil {
+		at = *t.Time
+	}
+
+	tx, err := s.db.DB.Begin()
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create a transaction")
+	}
+
+	var userID int
+	if err := tx.Stmt(s.findUserStmt).QueryRow(&t.ToUserID).Scan(&userID); err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return nil, ErrUserNotFound
+		}
+		return nil, errors.Wrap(err, "can't find recipient")
+	}
+	if err := s.accounts.checkDebit(tx, t.FromUserID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := s.accounts.checkCredit(tx, t.ToUserID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if _, err := tx.Stmt(s.createWalletStmt).Exec(&t.ToUserID, &toCurrency); err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "can't create wallet of recipient")
+	}
+
+	rows, err := tx.Stmt(s.lockWalletsStmt).Query(&t.FromUserID, &t.Currency, &t.ToUserID, &toCurrency)
+	if err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "can't lock wallets")
+	}
+	wallet := user.Wallet{Currency: t.Currency}
+	found := false
+	for rows.Next() {
+		var id int
+		var cur string
+		var b, limit int64
+		if err := rows.Scan(&id, &cur, &b, &limit); err != nil {
+			rows.Close()
+			tx.Rollback()
+			return nil, errors.Wrap(err, "can't scan wallet")
+		}
+		if id == t.FromUserID && cur == t.Currency {
+			wallet.Balance, wallet.CreditLimit, found = currency.Amount(b, cur), currency.Amount(limit, cur), true
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "can't lock wallets")
+	}
+	if !found { // sender has no wallet in the currency
+		tx.Rollback()
+		return nil, ErrInsufficientFunds
+	}
+
+	wallet.Reserved = currency.Amount(0, t.Currency)
+	if err := tx.Stmt(s.reservedCashStmt).QueryRow(&t.FromUserID, &t.Currency).Scan(&wallet.Reserved.Amount); err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "can't get an amount of reserved cash")
+	}
+	available, err := availableFunds(wallet)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	unspent, err := s.bonuses.unspent(tx, t.FromUserID, t.Currency)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if available, err = available.Sub(unspent); err != nil { // bonuses can be spent only on orders
+		tx.Rollback()
+		return nil, errors.Wrap(err, "can't calculate available funds")
+	}
+	if available.Cmp(t.Amount) < 0 {
+		tx.Rollback()
+		return nil, ErrInsufficientFunds
+	}
+
+	res := &transfer.Result{Credited: t.Amount, Currency: toCurrency}
+	var sourceCost sql.NullInt64
+	var sourceCurrency, rate sql.NullString
+	if toCurrency != t.Currency {
+		// rate in effect now, time of the request can't pick a better historical one
+		if res.Rate, err = s.exchange.findRate(tx, t.Currency, toCurrency, time.Now().UTC()); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if res.Credited, err = exchange.Convert(t.Amount, res.Rate, toCurrency); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if res.Credited.IsZero() {
+			tx.Rollback()
+			return nil, ErrZeroAmount
+		}
+		sourceCost = sql.NullInt64{Int64: t.Amount.Amount, Valid: true}
+		sourceCurrency = sql.NullString{String: t.Currency, Valid: true}
+		rate = sql.NullString{String: res.Rate, Valid: true}
+	}
+
+	c := sql.NullString{String: t.Comment, Valid: t.Comment != ""}
+	if err := tx.Stmt(s.createTransferOutStmt).QueryRow(&t.FromUserID, &at, &t.Amount.Amount, &t.Currency, &c).Scan(&res.OutID); err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "can't create output transaction")
+	}
+	if err := tx.Stmt(s.createTransferInStmt).QueryRow(&t.ToUserID, &at, &res.Credited.Amount, &toCurrency, &c,
+		&sourceCost, &sourceCurrency, &rate, &res.OutID).Scan(&res.InID); err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "can't create input transaction")
+	}
+	if _, err := tx.Stmt(s.linkTransactionStmt).Exec(&res.OutID, &res.InID); err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "can't link transactions of transfer")
+	}
+
+	amount, credited := t.Amount.Amount, res.Credited.Amount
+	if _, err := tx.Stmt(s.changeUserBalanceStmt).Exec(-amount, &t.FromUserID, &t.Currency); err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "can't change balance of sender")
+	}
+	if _, err := tx.Stmt(s.changeUserBalanceStmt).Exec(&credited, &t.ToUserID, &toCurrency); err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "can't change balance of recipient")
+	}
+
+	entry := ledger.Convert(ledger.EntryTransfer, res.OutID, ledger.Wallet(t.FromUserID, t.Currency), ledger.Wallet(t.ToUserID, toCurrency), amount, credited)
+	if err := s.ledger.post(tx, entry); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "can't commit transaction")
+	}
+	return res, nil
+}
@@ -2,7 +2,10 @@ package postgres
 
 import (
 	"database/sql"
+	"time"
 
+	"github.com/antsrp/balance_service/internal/exchange"
+	"github.com/antsrp/balance_service/internal/ledger"
 	"github.com/antsrp/balance_service/internal/user"
 	"github.com/pkg/errors"
 )
@@ -10,33 +13,57 @@ import (
 type UserStorage struct {
 	StatementStorage
 
-	createStmt         *sql.Stmt
 	findUserStmt       *sql.Stmt
 	findBalanceStmt    *sql.Stmt
-	updateBalanceStmt  *sql.Stmt
+	findWalletsStmt    *sql.Stmt
+	createUserStmt     *sql.Stmt
+	addBalanceStmt     *sql.Stmt
+	createInStmt       *sql.Stmt
 	deleteAllUsersStmt *sql.Stmt
+	setCreditLimitStmt *sql.Stmt
+
+	ledger   *LedgerStorage
+	exchange *ExchangeStorage
+	accounts *AccountStorage
 }
 
 var _ user.Storage = &UserStorage{}
 
 const (
-	createUserQ        = "INSERT INTO users (id, balance) VALUES ($1, $2) RETURNING id"
-	findUserByIDQ      = "SELECT id, balance FROM users WHERE id = $1"
-	findUserBalanceQ   = "SELECT balance FROM users WHERE id = $1"
-	updateUserBalanceQ = "UPDATE users SET balance = $1 WHERE id = $2"
-	deleteAllUsersQ    = "DELETE FROM users WHERE id > 0"
+	findUserByIDQ    = "SELECT id FROM users WHERE id = $1"
+	findUserBalanceQ = `SELECT COALESCE(wallets.balance, 0), COALESCE(wallets.credit_limit, 0),
+	(SELECT COALESCE(SUM(cost), 0) FROM transactions
+		WHERE user_id = users.id AND currency = $2 AND direction = 'out' AND is_completed = false)
+	FROM users
+	LEFT JOIN wallets ON wallets.user_id = users.id AND wallets.currency = $2
+	WHERE users.id = $1`
+	findUserWalletsQ = `SELECT wallets.currency, wallets.balance, wallets.credit_limit,
+	(SELECT COALESCE(SUM(cost), 0) FROM transactions
+		WHERE user_id = users.id AND currency = wallets.currency AND direction = 'out' AND is_completed = false)
+	FROM users
+	LEFT JOIN wallets ON wallets.user_id = users.id
+	WHERE users.id = $1
+	ORDER BY wallets.currency`
+	decreaseUserBalanceQ = "UPDATE wallets SET balance = balance - $1 WHERE user_id = $2 AND currency = $3"
+	createUserQ          = "INSERT INTO users (id) VALUES ($1) ON CONFLICT (id) DO NOTHING"
+	addUserBalanceQ      = `INSERT INTO wallets (user_id, currency, balance) VALUES ($1, $2, $3)
+	ON CONFLICT (user_id, currency) DO UPDATE SET balance = wallets.balance + EXCLUDED.balance`
+	deleteAllUsersQ = "DELETE FROM users WHERE id > 0"
 )
 
 // CreateUserStorage creates new user storage
-func CreateUserStorage(d *Dbsql) (*UserStorage, error) {
-	s := &UserStorage{StatementStorage: Create(d)}
+func CreateUserStorage(d *Dbsql, ls *LedgerStorage, es *ExchangeStorage, as *AccountStorage) (*UserStorage, error) {
+	s := &UserStorage{StatementStorage: Create(d), ledger: ls, exchange: es, accounts: as}
 
 	stmts := []stmt{
-		{Query: createUserQ, Dst: &s.createStmt},
 		{Query: findUserBalanceQ, Dst: &s.findBalanceStmt},
 		{Query: findUserByIDQ, Dst: &s.findUserStmt},
-		{Query: updateUserBalanceQ, Dst: &s.updateBalanceStmt},
+		{Query: findUserWalletsQ, Dst: &s.findWalletsStmt},
+		{Query: createUserQ, Dst: &s.createUserStmt},
+		{Query: addUserBalanceQ, Dst: &s.addBalanceStmt},
+		{Query: createInQ, Dst: &s.createInStmt},
 		{Query: deleteAllUsersQ, Dst: &s.deleteAllUsersStmt},
+		{Query: setCreditLimitQ, Dst: &s.setCreditLimitStmt},
 	}
 
 	if err := s.initStatements(stmts); err != nil {
@@ -46,24 +73,78 @@ func CreateUserStorage(d *Dbsql) (*UserStorage, error) {
 	return s, nil
 }
 
-func (s *UserStorage) InsertUser(u *user.User) error {
-	var id int
-	if err := s.createStmt.QueryRow(&u.ID, &u.Balance).Scan(&id); err != nil {
-		return errors.Wrapf(err, "cannot create a new user")
+// AddBalance increases balance of user in the currency (creating him and the wallet if needed)
+// and records the input transaction atomically. Top-up is converted at the rate in effect at its time
+// if the currency of wallet differs
+func (s *UserStorage) AddBalance(u *user.User) error {
+	tx, err := s.db.DB.Begin()
+	if err != nil {
+		return errors.Wrap(err, "can't create a transaction")
+	}
+
+	if _, err := s.addBalance(tx, u, "", ledger.EntryTopUp); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "can't commit transaction")
 	}
 	return nil
 }
 
-func (s *UserStorage) UpdateUserBalance(u *user.User) error {
-	if _, err := s.updateBalanceStmt.Exec(&u.Balance, &u.ID); err != nil {
-		return errors.Wrapf(err, "cannot update balance of user")
+// addBalance tops up balance of user in the transaction, the input transaction of the kind is recorded
+// along with the journal entry of the kind. Id of the input transaction is returned
+func (s *UserStorage) addBalance(tx *sql.Tx, u *user.User, kind, entryKind string) (int, error) {
+	if _, err := tx.Stmt(s.createUserStmt).Exec(&u.ID); err != nil {
+		return -1, errors.Wrap(err, "can't create user")
 	}
-	return nil
+	if err := s.accounts.checkCredit(tx, u.ID); err != nil {
+		return -1, err
+	}
+
+	credited, cur := u.Balance, u.Currency
+	var sourceCost sql.NullInt64
+	var sourceCurrency, rate sql.NullString
+	if u.ToCurrency != "" && u.ToCurrency != u.Currency {
+		// rate in effect now, time of the top-up can't pick a better historical one
+		r, err := s.exchange.findRate(tx, u.Currency, u.ToCurrency, time.Now().UTC())
+		if err != nil {
+			return -1, err
+		}
+		if credited, err = exchange.Convert(u.Balance, r, u.ToCurrency); err != nil {
+			return -1, err
+		}
+		if credited.IsZero() {
+			return -1, ErrZeroAmount
+		}
+		cur = u.ToCurrency
+		sourceCost = sql.NullInt64{Int64: u.Balance.Amount, Valid: true}
+		sourceCurrency = sql.NullString{String: u.Currency, Valid: true}
+		rate = sql.NullString{String: r, Valid: true}
+	}
+
+	if _, err := tx.Stmt(s.addBalanceStmt).Exec(&u.ID, &cur, &credited.Amount); err != nil {
+		return -1, errors.Wrap(err, "can't add balance of user")
+	}
+
+	var transactionID int
+	c := sql.NullString{String: u.Comment, Valid: u.Comment != ""}
+	k := sql.NullString{String: kind, Valid: kind != ""}
+	if err := tx.Stmt(s.createInStmt).QueryRow(&u.ID, &u.Time, &credited.Amount, &cur, &c, &sourceCost, &sourceCurrency, &rate, &k).Scan(&transactionID); err != nil {
+		return -1, errors.Wrap(err, "can't create input transaction")
+	}
+
+	entry := ledger.Convert(entryKind, transactionID, ledger.External(u.Currency), ledger.Wallet(u.ID, cur), u.Balance.Amount, credited.Amount)
+	if err := s.ledger.post(tx, entry); err != nil {
+		return -1, err
+	}
+	return transactionID, nil
 }
 
 func (s *UserStorage) FindUser(id int) (*user.User, error) {
 	var u user.User
-	if err := s.findUserStmt.QueryRow(&id).Scan(&u.ID, &u.Balance); err != nil {
+	if err := s.findUserStmt.QueryRow(&id).Scan(&u.ID); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
@@ -72,49 +153,46 @@ func (s *UserStorage) FindUser(id int) (*user.User, error) {
 	return &u, nil
 }
 
-func (s *UserStorage) GetUserBalance(id int) (uint64, error) {
-	var balance uint64
-	if err := s.findBalanceStmt.QueryRow(&id).Scan(&balance); err != nil {
+func (s *UserStorage) GetUserBalance(id int, code string) (*user.Wallet, error) {
+	w := &user.Wallet{Currency: code}
+	if err := s.findBalanceStmt.QueryRow(&id, &code).Scan(&w.Balance.Amount, &w.CreditLimit.Amount, &w.Reserved.Amount); err != nil {
 		if err == sql.ErrNoRows {
-			return 0, ErrUserNotFound
+			return nil, ErrUserNotFound
 		}
-		return balance, errors.Wrapf(err, "cannot get balance of user")
+		return nil, errors.Wrapf(err, "cannot get balance of user")
 	}
-	return balance, nil
+	inCurrency(code, &w.Balance, &w.CreditLimit, &w.Reserved)
+	return w, nil
 }
 
-func (s *UserStorage) DecreaseBalanceChained(id int, deductable uint64, in, out chan bool, result chan error) {
-
-	balance, err := s.GetUserBalance(id)
+// GetUserWallets returns balances of user in all his currencies
+func (s *UserStorage) GetUserWallets(id int) ([]user.Wallet, error) {
+	rows, err := s.findWalletsStmt.Query(&id)
 	if err != nil {
-		out <- false
-		result <- err
-		return
+		return nil, errors.Wrap(err, "cannot get wallets of user")
 	}
-	balance -= deductable
-
-	tx, err := s.db.DB.Begin()
-	if err != nil {
-		out <- false
-		result <- err
-		return
-	}
-
-	if _, err := tx.Stmt(s.updateBalanceStmt).Exec(&balance, &id); err != nil {
-		out <- false
-		result <- err
-		return
+	defer rows.Close()
+
+	found := false
+	wallets := []user.Wallet{}
+	for rows.Next() {
+		found = true
+		var code sql.NullString
+		var balance, limit sql.NullInt64
+		var w user.Wallet
+		if err := rows.Scan(&code, &balance, &limit, &w.Reserved.Amount); err != nil {
+			return nil, errors.Wrap(err, "cannot scan wallet of user")
+		}
+		if code.Valid { // user without wallets has a single row of nulls
+			w.Currency, w.Balance.Amount, w.CreditLimit.Amount = code.String, balance.Int64, limit.Int64
+			inCurrency(w.Currency, &w.Balance, &w.CreditLimit, &w.Reserved)
+			wallets = append(wallets, w)
+		}
 	}
-	out <- true
-	val := <-in
-
-	if !val { // chained part returns an error
-		result <- nil
-		tx.Rollback()
-		return
+	if !found {
+		return nil, ErrUserNotFound
 	}
-	tx.Commit()
-	result <- nil
+	return wallets, nil
 }
 
 func (s *UserStorage) DeleteAllUsers() error {
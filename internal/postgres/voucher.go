@@ -0,0 +1,197 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/antsrp/balance_service/internal/currency"
+	"github.com/antsrp/balance_service/internal/ledger"
+	"github.com/antsrp/balance_service/internal/user"
+	"github.com/antsrp/balance_service/internal/voucher"
+	"github.com/pkg/errors"
+)
+
+const (
+	KindVoucher = "voucher"
+
+	createBatchQ   = "INSERT INTO voucher_batches (value, currency, expires_at) VALUES ($1, $2, $3) RETURNING id"
+	createVoucherQ = "INSERT INTO vouchers (batch_id, code) VALUES ($1, $2) RETURNING id"
+	vouchersQ      = `SELECT vouchers.id, batch_id, code, value, currency, expires_at, redeemed_by, redeemed_at, transaction_id
+	FROM vouchers
+	JOIN voucher_batches ON batch_id = voucher_batches.id
+	WHERE $1::bigint = 0 OR batch_id = $1
+	ORDER BY vouchers.id`
+	// the voucher is taken by the first redemption only, concurrent ones find it redeemed
+	redeemVoucherQ = `UPDATE vouchers SET redeemed_by = $2, redeemed_at = $3
+	FROM voucher_batches
+	WHERE batch_id = voucher_batches.id AND code = $1 AND redeemed_at IS NULL AND $3 < expires_at
+	RETURNING vouchers.id, batch_id, code, value, currency, expires_at`
+	voucherStateQ          = `SELECT redeemed_at IS NOT NULL FROM vouchers WHERE code = $1`
+	setVoucherTransactionQ = "UPDATE vouchers SET transaction_id = $2 WHERE id = $1"
+	deleteVouchersQ        = "DELETE FROM vouchers"
+	deleteBatchesQ         = "DELETE FROM voucher_batches"
+
+	VoucherNotFound = "Voucher not found"
+	VoucherRedeemed = "Voucher is already redeemed"
+	VoucherExpired  = "Voucher is expired"
+)
+
+var (
+	ErrVoucherNotFound = errors.New(VoucherNotFound)
+	ErrVoucherRedeemed = errors.New(VoucherRedeemed)
+	ErrVoucherExpired  = errors.New(VoucherExpired)
+)
+
+type VoucherStorage struct {
+	StatementStorage
+
+	createBatchStmt           *sql.Stmt
+	createVoucherStmt         *sql.Stmt
+	vouchersStmt              *sql.Stmt
+	redeemVoucherStmt         *sql.Stmt
+	voucherStateStmt          *sql.Stmt
+	setVoucherTransactionStmt *sql.Stmt
+	deleteVouchersStmt        *sql.Stmt
+	deleteBatchesStmt         *sql.Stmt
+
+	users *UserStorage
+}
+
+var _ voucher.Storage = &VoucherStorage{}
+
+// CreateVoucherStorage creates new storage of vouchers, they top up balances through the storage of users
+func CreateVoucherStorage(d *Dbsql, us *UserStorage) (*VoucherStorage, error) {
+	s := &VoucherStorage{StatementStorage: Create(d), users: us}
+
+	stmts := []stmt{
+		{Query: createBatchQ, Dst: &s.createBatchStmt},
+		{Query: createVoucherQ, Dst: &s.createVoucherStmt},
+		{Query: vouchersQ, Dst: &s.vouchersStmt},
+		{Query: redeemVoucherQ, Dst: &s.redeemVoucherStmt},
+		{Query: voucherStateQ, Dst: &s.voucherStateStmt},
+		{Query: setVoucherTransactionQ, Dst: &s.setVoucherTransactionStmt},
+		{Query: deleteVouchersQ, Dst: &s.deleteVouchersStmt},
+		{Query: deleteBatchesQ, Dst: &s.deleteBatchesStmt},
+	}
+
+	if err := s.initStatements(stmts); err != nil {
+		return nil, errors.Wrap(err, "can't init statements")
+	}
+
+	return s, nil
+}
+
+// CreateBatch generates the batch of vouchers with unique codes, generated vouchers are set in the batch
+func (s *VoucherStorage) CreateBatch(b *voucher.Batch) error {
+	tx, err := s.db.DB.Begin()
+	if err != nil {
+		return errors.Wrap(err, "can't create a transaction")
+	}
+
+	if err := tx.Stmt(s.createBatchStmt).QueryRow(&b.Value.Amount, &b.Currency, b.ExpiresAt).Scan(&b.ID); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "can't create batch of vouchers")
+	}
+	b.Vouchers = make([]voucher.Voucher, 0, b.Count)
+	for i := 0; i < b.Count; i++ {
+		v := voucher.Voucher{BatchID: b.ID, Value: b.Value, Currency: b.Currency, ExpiresAt: *b.ExpiresAt}
+		if v.Code, err = voucher.GenerateCode(); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Stmt(s.createVoucherStmt).QueryRow(&v.BatchID, &v.Code).Scan(&v.ID); err != nil {
+			tx.Rollback()
+			return errors.Wrap(err, "can't create voucher")
+		}
+		b.Vouchers = append(b.Vouchers, v)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "can't commit transaction")
+	}
+	return nil
+}
+
+// GetVouchers returns vouchers of the batch, or of all batches if it is zero
+func (s *VoucherStorage) GetVouchers(batchID int) ([]voucher.Voucher, error) {
+	rows, err := s.vouchersStmt.Query(&batchID)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't get vouchers")
+	}
+	defer rows.Close()
+
+	vouchers := []voucher.Voucher{}
+	for rows.Next() {
+		var v voucher.Voucher
+		var redeemedBy, transactionID sql.NullInt64
+		if err := rows.Scan(&v.ID, &v.BatchID, &v.Code, &v.Value.Amount, &v.Currency, &v.ExpiresAt, &redeemedBy, &v.RedeemedAt, &transactionID); err != nil {
+			return nil, errors.Wrap(err, "can't scan voucher")
+		}
+		v.Value = currency.Amount(v.Value.Amount, v.Currency)
+		v.RedeemedBy, v.TransactionID = int(redeemedBy.Int64), int(transactionID.Int64)
+		vouchers = append(vouchers, v)
+	}
+	return vouchers, nil
+}
+
+// Redeem takes the voucher and tops up balance of the user by its value in the single DB transaction,
+// the top-up refers to the voucher by its comment
+func (s *VoucherStorage) Redeem(r voucher.Redemption) (*voucher.Voucher, error) {
+	at := time.Now().UTC()
+
+	tx, err := s.db.DB.Begin()
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create a transaction")
+	}
+
+	v := voucher.Voucher{RedeemedBy: r.UserID, RedeemedAt: &at}
+	if err := tx.Stmt(s.redeemVoucherStmt).QueryRow(&r.Code, &r.UserID, &at).Scan(&v.ID, &v.BatchID, &v.Code, &v.Value.Amount, &v.Currency, &v.ExpiresAt); err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return nil, s.notRedeemable(r.Code)
+		}
+		return nil, errors.Wrap(err, "can't redeem voucher")
+	}
+	v.Value = currency.Amount(v.Value.Amount, v.Currency)
+
+	u := user.User{ID: r.UserID, Time: &at, Comment: fmt.Sprintf("voucher %d", v.ID), Balance: v.Value, Currency: v.Currency}
+	if v.TransactionID, err = s.users.addBalance(tx, &u, KindVoucher, ledger.EntryVoucher); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if _, err := tx.Stmt(s.setVoucherTransactionStmt).Exec(&v.ID, &v.TransactionID); err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "can't set transaction of voucher")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "can't commit transaction")
+	}
+	return &v, nil
+}
+
+// notRedeemable tells why the voucher can't be redeemed
+func (s *VoucherStorage) notRedeemable(code string) error {
+	var redeemed bool
+	if err := s.voucherStateStmt.QueryRow(&code).Scan(&redeemed); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrVoucherNotFound
+		}
+		return errors.Wrap(err, "can't find voucher")
+	}
+	if redeemed {
+		return ErrVoucherRedeemed
+	}
+	return ErrVoucherExpired
+}
+
+func (s *VoucherStorage) DeleteAllVouchers() error {
+	if _, err := s.deleteVouchersStmt.Exec(); err != nil {
+		return errors.Wrap(err, "can't delete vouchers")
+	}
+	if _, err := s.deleteBatchesStmt.Exec(); err != nil {
+		return errors.Wrap(err, "can't delete batches of vouchers")
+	}
+	return nil
+}
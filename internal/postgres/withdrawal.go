@@ -0,0 +1,308 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/antsrp/balance_service/internal/approval"
+	"github.com/antsrp/balance_service/internal/currency"
+	"github.com/antsrp/balance_service/internal/ledger"
+	"github.com/antsrp/balance_service/internal/withdrawal"
+	"github.com/pkg/errors"
+)
+
+const (
+	KindWithdrawal = "withdrawal"
+
+	// amount is held the same way reservations of orders hold it, by the output transaction not completed yet
+	createWithdrawalOutQ = `INSERT INTO transactions (user_id, direction, kind, is_completed, cost, currency, comment)
+	VALUES ($1, 'out', 'withdrawal', false, $2, $3, $4) RETURNING id`
+	createWithdrawalQ = `INSERT INTO withdrawals (user_id, amount, currency, status, requested_by, transaction_id)
+	VALUES ($1, $2, $3, 'pending', $4, $5) RETURNING id`
+	createWithdrawalEventQ = "INSERT INTO withdrawal_events (withdrawal_id, status, actor, reason, at) VALUES ($1, $2, $3, $4, $5)"
+	// zero user or id and empty status match any
+	withdrawalsQ = `SELECT withdrawals.id, withdrawals.user_id, amount, withdrawals.currency, transactions.comment, status, requested_by, transaction_id,
+	withdrawal_events.status, actor, withdrawal_events.reason, at
+	FROM withdrawals
+	JOIN transactions ON transaction_id = transactions.id
+	LEFT JOIN withdrawal_events ON withdrawal_id = withdrawals.id
+	WHERE ($1::bigint = 0 OR withdrawals.user_id = $1) AND ($2 = '' OR status = $2) AND ($3::bigint = 0 OR withdrawals.id = $3)
+	ORDER BY withdrawals.id, withdrawal_events.id`
+	// decisions of the same withdrawal wait for each other
+	lockWithdrawalQ = `SELECT user_id, amount, currency, status, requested_by, transaction_id
+	FROM withdrawals WHERE id = $1 FOR UPDATE`
+	setWithdrawalStatusQ = "UPDATE withdrawals SET status = $2 WHERE id = $1"
+	completeWithdrawalQ  = "UPDATE transactions SET is_completed = true, closed_at = $2 WHERE id = $1"
+	// rejected hold is closed by its reversal, so the wallet and its history stay as they were
+	createReleaseQ = `INSERT INTO transactions (user_id, direction, kind, is_completed, closed_at, cost, currency, comment, reversal_of, reason)
+	SELECT user_id, 'in', 'reversal', true, $2, cost, currency, comment, id, $3
+	FROM transactions
+	WHERE id = $1
+	RETURNING id`
+	deleteWithdrawalEventsQ = "DELETE FROM withdrawal_events"
+	deleteAllWithdrawalsQ   = "DELETE FROM withdrawals"
+
+	WithdrawalNotFound = "Withdrawal not found"
+	WithdrawalDecided  = "Withdrawal is already decided"
+	WithdrawalReversal = "Withdrawal can't be reversed"
+	SameActor          = "Request is decided by the admin made it"
+)
+
+var (
+	ErrWithdrawalNotFound = errors.New(WithdrawalNotFound)
+	ErrWithdrawalDecided  = errors.New(WithdrawalDecided)
+	ErrWithdrawalReversal = errors.New(WithdrawalReversal)
+	ErrSameActor          = errors.New(SameActor)
+)
+
+type WithdrawalStorage struct {
+	StatementStorage
+
+	createWithdrawalOutStmt    *sql.Stmt
+	createWithdrawalStmt       *sql.Stmt
+	createWithdrawalEventStmt  *sql.Stmt
+	withdrawalsStmt            *sql.Stmt
+	lockWithdrawalStmt         *sql.Stmt
+	setWithdrawalStatusStmt    *sql.Stmt
+	completeWithdrawalStmt     *sql.Stmt
+	createReleaseStmt          *sql.Stmt
+	decreaseUserBalanceStmt    *sql.Stmt
+	deleteWithdrawalEventsStmt *sql.Stmt
+	deleteAllWithdrawalsStmt   *sql.Stmt
+
+	transactions *TransactionStorage
+}
+
+var _ withdrawal.Storage = &WithdrawalStorage{}
+
+// CreateWithdrawalStorage creates new storage of withdrawals, wallets are locked and checked the same way the storage of transactions does
+func CreateWithdrawalStorage(d *Dbsql, ts *TransactionStorage) (*WithdrawalStorage, error) {
+	s := &WithdrawalStorage{StatementStorage: Create(d), transactions: ts}
+
+	stmts := []stmt{
+		{Query: createWithdrawalOutQ, Dst: &s.createWithdrawalOutStmt},
+		{Query: createWithdrawalQ, Dst: &s.createWithdrawalStmt},
+		{Query: createWithdrawalEventQ, Dst: &s.createWithdrawalEventStmt},
+		{Query: withdrawalsQ, Dst: &s.withdrawalsStmt},
+		{Query: lockWithdrawalQ, Dst: &s.lockWithdrawalStmt},
+		{Query: setWithdrawalStatusQ, Dst: &s.setWithdrawalStatusStmt},
+		{Query: completeWithdrawalQ, Dst: &s.completeWithdrawalStmt},
+		{Query: createReleaseQ, Dst: &s.createReleaseStmt},
+		{Query: decreaseUserBalanceQ, Dst: &s.decreaseUserBalanceStmt},
+		{Query: deleteWithdrawalEventsQ, Dst: &s.deleteWithdrawalEventsStmt},
+		{Query: deleteAllWithdrawalsQ, Dst: &s.deleteAllWithdrawalsStmt},
+	}
+
+	if err := s.initStatements(stmts); err != nil {
+		return nil, errors.Wrap(err, "can't init statements")
+	}
+
+	return s, nil
+}
+
+// Request holds the amount of withdrawal on the wallet of user until the request is decided.
+// Funds are checked under the lock of wallet as transfers check them, bonuses can't be withdrawn
+func (s *WithdrawalStorage) Request(w *withdrawal.Withdrawal) error {
+	at := time.Now().UTC()
+
+	tx, err := s.db.DB.Begin()
+	if err != nil {
+		return errors.Wrap(err, "can't create a transaction")
+	}
+
+	if err := s.transactions.accounts.checkDebit(tx, w.UserID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	wallet, err := s.transactions.lockWallet(tx, w.UserID, w.Currency)
+	if err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows { // no wallet in the currency
+			return ErrInsufficientFunds
+		}
+		return err
+	}
+	available, err := availableFunds(*wallet)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	unspent, err := s.transactions.bonuses.unspent(tx, w.UserID, w.Currency)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if available, err = available.Sub(unspent); err != nil { // bonuses can be spent only on orders
+		tx.Rollback()
+		return errors.Wrap(err, "can't calculate available funds")
+	}
+	if available.Cmp(w.Amount) < 0 {
+		tx.Rollback()
+		return ErrInsufficientFunds
+	}
+
+	c := sql.NullString{String: w.Comment, Valid: w.Comment != ""}
+	if err := tx.Stmt(s.createWithdrawalOutStmt).QueryRow(&w.UserID, &w.Amount.Amount, &w.Currency, &c).Scan(&w.TransactionID); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "can't create output transaction")
+	}
+	entry := ledger.Transfer(ledger.EntryReserve, w.TransactionID, ledger.Wallet(w.UserID, w.Currency), ledger.Hold(w.UserID, w.Currency), w.Amount.Amount)
+	if err := s.transactions.ledger.post(tx, entry); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Stmt(s.createWithdrawalStmt).QueryRow(&w.UserID, &w.Amount.Amount, &w.Currency, &w.RequestedBy, &w.TransactionID).Scan(&w.ID); err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "can't create withdrawal")
+	}
+	e := withdrawal.Event{Status: withdrawal.StatusPending, Actor: w.RequestedBy, At: at}
+	if err := s.record(tx, w.ID, e); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Wrap(err, "can't commit transaction")
+	}
+	w.Status, w.Events = withdrawal.StatusPending, []withdrawal.Event{e}
+	return nil
+}
+
+func (s *WithdrawalStorage) record(tx *sql.Tx, withdrawalID int, e withdrawal.Event) error {
+	reason := sql.NullString{String: e.Reason, Valid: e.Reason != ""}
+	if _, err := tx.Stmt(s.createWithdrawalEventStmt).Exec(&withdrawalID, &e.Status, &e.Actor, &reason, &e.At); err != nil {
+		return errors.Wrap(err, "can't record event of withdrawal")
+	}
+	return nil
+}
+
+// GetWithdrawals returns withdrawals of the user in the status along with their events, zero user or empty status matches any
+func (s *WithdrawalStorage) GetWithdrawals(userID int, status string) ([]withdrawal.Withdrawal, error) {
+	return s.withdrawals(userID, status, 0)
+}
+
+func (s *WithdrawalStorage) withdrawals(userID int, status string, id int) ([]withdrawal.Withdrawal, error) {
+	rows, err := s.withdrawalsStmt.Query(&userID, &status, &id)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't get withdrawals")
+	}
+	defer rows.Close()
+
+	withdrawals := []withdrawal.Withdrawal{}
+	for rows.Next() {
+		var w withdrawal.Withdrawal
+		var comment, eventStatus, actor, reason sql.NullString
+		var at sql.NullTime
+		if err := rows.Scan(&w.ID, &w.UserID, &w.Amount.Amount, &w.Currency, &comment, &w.Status, &w.RequestedBy, &w.TransactionID,
+			&eventStatus, &actor, &reason, &at); err != nil {
+			return nil, errors.Wrap(err, "can't scan withdrawal")
+		}
+		if n := len(withdrawals); n == 0 || withdrawals[n-1].ID != w.ID {
+			w.Amount = currency.Amount(w.Amount.Amount, w.Currency)
+			w.Comment = comment.String
+			withdrawals = append(withdrawals, w)
+		}
+		if eventStatus.Valid {
+			last := &withdrawals[len(withdrawals)-1]
+			last.Events = append(last.Events, withdrawal.Event{Status: eventStatus.String, Actor: actor.String, Reason: reason.String, At: at.Time})
+		}
+	}
+	return withdrawals, nil
+}
+
+// Decide approves or rejects the pending withdrawal on behalf of another admin than the one requested it.
+// Approval debits the held amount from the wallet, rejection releases it by reversal of the holding transaction
+func (s *WithdrawalStorage) Decide(d withdrawal.Decision) (*withdrawal.Withdrawal, error) {
+	at := time.Now().UTC()
+
+	tx, err := s.db.DB.Begin()
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create a transaction")
+	}
+
+	var w withdrawal.Withdrawal
+	if err := tx.Stmt(s.lockWithdrawalStmt).QueryRow(&d.ID).Scan(&w.UserID, &w.Amount.Amount, &w.Currency, &w.Status, &w.RequestedBy, &w.TransactionID); err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return nil, ErrWithdrawalNotFound
+		}
+		return nil, errors.Wrap(err, "can't lock withdrawal")
+	}
+	if w.Status != withdrawal.StatusPending {
+		tx.Rollback()
+		return nil, ErrWithdrawalDecided
+	}
+	if approval.SameActor(w.RequestedBy, d.Actor) {
+		tx.Rollback()
+		return nil, ErrSameActor
+	}
+
+	if d.Status == withdrawal.StatusApproved {
+		if err := s.transactions.accounts.checkDebit(tx, w.UserID); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	// balance and reserved cash of wallet change together, as recognition of orders changes them
+	if _, err := s.transactions.lockWallet(tx, w.UserID, w.Currency); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if _, err := tx.Stmt(s.completeWithdrawalStmt).Exec(&w.TransactionID, &at); err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "can't complete transaction of withdrawal")
+	}
+
+	var entry *ledger.Entry
+	if d.Status == withdrawal.StatusApproved {
+		if _, err := tx.Stmt(s.decreaseUserBalanceStmt).Exec(&w.Amount.Amount, &w.UserID, &w.Currency); err != nil {
+			tx.Rollback()
+			return nil, errors.Wrap(err, "can't decrease balance of user")
+		}
+		entry = ledger.Transfer(ledger.EntryWithdrawal, w.TransactionID, ledger.Hold(w.UserID, w.Currency), ledger.External(w.Currency), w.Amount.Amount)
+	} else {
+		reason := sql.NullString{String: d.Reason, Valid: d.Reason != ""}
+		var releaseID int
+		if err := tx.Stmt(s.createReleaseStmt).QueryRow(&w.TransactionID, &at, &reason).Scan(&releaseID); err != nil {
+			tx.Rollback()
+			return nil, errors.Wrap(err, "can't create reversing transaction")
+		}
+		entry = ledger.Transfer(ledger.EntryReversal, releaseID, ledger.Hold(w.UserID, w.Currency), ledger.Wallet(w.UserID, w.Currency), w.Amount.Amount)
+	}
+	if err := s.transactions.ledger.post(tx, entry); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if _, err := tx.Stmt(s.setWithdrawalStatusStmt).Exec(&d.ID, &d.Status); err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "can't set status of withdrawal")
+	}
+	if err := s.record(tx, d.ID, withdrawal.Event{Status: d.Status, Actor: d.Actor, Reason: d.Reason, At: at}); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "can't commit transaction")
+	}
+
+	withdrawals, err := s.withdrawals(0, "", d.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(withdrawals) == 0 {
+		return nil, ErrWithdrawalNotFound
+	}
+	return &withdrawals[0], nil
+}
+
+func (s *WithdrawalStorage) DeleteAllWithdrawals() error {
+	if _, err := s.deleteWithdrawalEventsStmt.Exec(); err != nil {
+		return errors.Wrap(err, "can't delete events of withdrawals")
+	}
+	if _, err := s.deleteAllWithdrawalsStmt.Exec(); err != nil {
+		return errors.Wrap(err, "can't delete withdrawals")
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package pricing
+
+import (
+	"math"
+	"time"
+
+	"github.com/antsrp/balance_service/internal/money"
+	"github.com/pkg/errors"
+)
+
+const (
+	InvalidQuantity = "Quantity must be positive"
+)
+
+var ErrInvalidQuantity = errors.New(InvalidQuantity)
+
+// Price is the price of unit of the service in the currency, it is in effect since EffectiveFrom
+// until the next price of the service in the currency
+type Price struct {
+	ID            int         `json:"id,omitempty"`
+	ServiceID     int         `json:"service_id"`
+	Currency      string      `json:"currency"`
+	Price         money.Money `json:"price" swaggertype:"string"`
+	EffectiveFrom *time.Time  `json:"effective_from,omitempty"`
+}
+
+type Storage interface {
+	CreatePrice(*Price) (int, error)
+	GetPrices(serviceID int, currency string) ([]Price, error)
+	DeleteAllPrices() error
+}
+
+// Cost returns the cost of quantity of units by the price
+func (p Price) Cost(quantity int) (money.Money, error) {
+	if quantity <= 0 {
+		return money.Money{}, ErrInvalidQuantity
+	}
+	if p.Price.Amount > 0 && int64(quantity) > math.MaxInt64/p.Price.Amount {
+		return money.Money{}, money.ErrOverflow
+	}
+	return money.New(p.Price.Amount*int64(quantity), p.Price.Exponent), nil
+}
@@ -0,0 +1,28 @@
+package reconciliation
+
+import "github.com/antsrp/balance_service/internal/money"
+
+const AdjustmentComment = "reconciliation adjustment"
+
+// Mismatch describes a wallet of user whose stored balance differs from the one recomputed from transactions history
+// or derived from the journal postings
+type Mismatch struct {
+	UserID       int         `json:"user_id"`
+	Currency     string      `json:"currency"`
+	Balance      money.Money `json:"balance" swaggertype:"string"`
+	Computed     money.Money `json:"computed_balance" swaggertype:"string"`
+	Ledger       money.Money `json:"ledger_balance" swaggertype:"string"`
+	Difference   money.Money `json:"difference" swaggertype:"string"` // stored balance minus the computed one
+	Transactions int         `json:"transactions"`
+	Repaired     bool        `json:"repaired"`
+}
+
+type Report struct {
+	Checked    int        `json:"checked_wallets"`
+	Mismatches []Mismatch `json:"mismatches"`
+}
+
+type Storage interface {
+	Reconcile() (*Report, error)
+	Repair(Mismatch) (bool, error)
+}
@@ -1,11 +1,31 @@
 package reports
 
-import "time"
+import (
+	"time"
+
+	"github.com/antsrp/balance_service/internal/money"
+)
 
 type Operation struct {
-	Type    string     `json:"operation_type"`
-	Favor   string     `json:"service_name,omitempty"`
-	Sum     uint64     `json:"sum"`
-	Comment string     `json:"comment"`
-	Time    *time.Time `json:"time"`
+	ID         int         `json:"id,omitempty"`
+	Type       string      `json:"operation_type"`
+	Kind       string      `json:"kind,omitempty"`
+	Favor      string      `json:"service_name,omitempty"`
+	Sum        money.Money `json:"sum" swaggertype:"string"`
+	Currency   string      `json:"currency"`
+	Comment    string      `json:"comment"`
+	Time       *time.Time  `json:"time"`
+	ReversalOf int         `json:"reversal_of,omitempty"` // id of the operation reversed by this one
+	ReversedBy int         `json:"reversed_by,omitempty"` // id of the operation reversing this one
+	Reason     string      `json:"reason,omitempty"`
+
+	SourceSum      *money.Money `json:"source_sum,omitempty" swaggertype:"string"` // sum in the currency the operation was converted from
+	SourceCurrency string       `json:"source_currency,omitempty"`
+	Rate           string       `json:"rate,omitempty"`      // exchange rate used for conversion
+	LinkedID       int          `json:"linked_id,omitempty"` // id of the other side of transfer, or of the order paid out or cashed back
+	PayeeID        int          `json:"payee_id,omitempty"`  // user the revenue of order is paid out to
+	PriceID        int          `json:"price_id,omitempty"`  // version of price the cost of order is calculated by
+	Quantity       int          `json:"quantity,omitempty"`
+	CouponID       int          `json:"coupon_id,omitempty"` // coupon applied to the order, its discount is taken off the sum
+	Discount       *money.Money `json:"discount,omitempty" swaggertype:"string"`
 }
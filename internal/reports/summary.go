@@ -5,28 +5,80 @@ import (
 	"os"
 	"time"
 
+	"github.com/antsrp/balance_service/internal/money"
 	"github.com/pkg/errors"
 )
 
+const (
+	TotalRowName = "Total"
+
+	summaryHeader = "service;currency;revenue;refunds;cashback;gross;fee;net;orders;users;average;reserved;previous;delta\n"
+)
+
 type SummaryCSV struct {
-	Name  string
-	Value uint64
+	Name     string
+	Currency string
+	Value    money.Money // revenue recognized in the period, net of refunds
+	Refunds  money.Money // revenue refunded in the period
+	Cashback money.Money // cashback paid for orders of the service in the period
+	Gross    money.Money // cost of orders recognized in the period
+	Fee      money.Money // platform fee taken from orders recognized in the period
+	Net      money.Money // gross net of the platform fee
+	Orders   uint64      // number of recognized orders
+	Users    uint64      // distinct paying users
+	Average  money.Money // average order value
+	Reserved money.Money // reserved but not yet recognized
+	Previous money.Money // revenue recognized in the previous period
+	Delta    money.Money // month-over-month delta of revenue
+}
+
+// Calculate fills metrics derived from the aggregated ones
+func (s *SummaryCSV) Calculate() error {
+	s.Average = money.New(0, s.Value.Exponent)
+	if s.Orders > 0 && s.Value.Amount > 0 {
+		s.Average.Amount = s.Value.Amount / int64(s.Orders)
+	}
+	gross, err := s.Value.Add(s.Refunds)
+	if err != nil {
+		return errors.Wrap(err, "can't calculate gross revenue")
+	}
+	s.Gross = gross
+	net, err := s.Gross.Sub(s.Fee)
+	if err != nil {
+		return errors.Wrap(err, "can't calculate net revenue")
+	}
+	s.Net = net
+	delta, err := s.Value.Sub(s.Previous)
+	if err != nil {
+		return errors.Wrap(err, "can't calculate delta of revenue")
+	}
+	s.Delta = delta
+	return nil
 }
 
 // returns filename
 func WriteToCSV(summary []SummaryCSV, path string) (string, error) {
-	t := time.Now().Unix()
-
-	name := fmt.Sprintf("%v.csv", t)
-
-	f, err := os.Create(path + "//" + name)
+	f, name, err := createCSV(path)
 	if err != nil {
-		return "", errors.Wrap(err, "can't create csv file")
+		return "", err
 	}
 	defer f.Close()
 
+	f.WriteString(summaryHeader)
 	for _, s := range summary {
-		f.WriteString(fmt.Sprintf("%s;%d\n", s.Name, s.Value))
+		f.WriteString(fmt.Sprintf("%s;%s;%s;%s;%s;%s;%s;%s;%d;%d;%s;%s;%s;%s\n", s.Name, s.Currency, s.Value, s.Refunds, s.Cashback, s.Gross, s.Fee, s.Net, s.Orders, s.Users, s.Average, s.Reserved, s.Previous, s.Delta))
 	}
 	return name, nil
 }
+
+func createCSV(path string) (*os.File, string, error) {
+	t := time.Now().UnixNano()
+
+	name := fmt.Sprintf("%v.csv", t)
+
+	f, err := os.Create(path + "//" + name)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "can't create csv file")
+	}
+	return f, name, nil
+}
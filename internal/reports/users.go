@@ -0,0 +1,33 @@
+package reports
+
+import (
+	"fmt"
+
+	"github.com/antsrp/balance_service/internal/money"
+)
+
+const usersSummaryHeader = "user_id;currency;spent;top_ups;vouchers;orders\n"
+
+type UserSummaryCSV struct {
+	UserID   int
+	Currency string
+	Spent    money.Money // revenue recognized from the user's orders
+	TopUps   money.Money
+	Vouchers money.Money // part of top-ups made by redemptions of vouchers
+	Orders   uint64
+}
+
+// returns filename
+func WriteUsersToCSV(summary []UserSummaryCSV, path string) (string, error) {
+	f, name, err := createCSV(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	f.WriteString(usersSummaryHeader)
+	for _, s := range summary {
+		f.WriteString(fmt.Sprintf("%d;%s;%s;%s;%s;%d\n", s.UserID, s.Currency, s.Spent, s.TopUps, s.Vouchers, s.Orders))
+	}
+	return name, nil
+}
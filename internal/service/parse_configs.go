@@ -9,6 +9,9 @@ import (
 	"gopkg.in/yaml.v2"
 )
 
+// PaymentsSecretEnv is the environment variable with the secret of payment provider, it is never kept in config files
+const PaymentsSecretEnv = "PAYMENTS_SECRET"
+
 func ParseDBConfig(logger *zap.Logger) *postgres.PSQLConfig {
 	f, err := os.Open(fmt.Sprintf("%s//%s", getPathToConfigsFolder(), "db_config.yaml"))
 	if err != nil {
@@ -23,6 +26,7 @@ func ParseDBConfig(logger *zap.Logger) *postgres.PSQLConfig {
 	if err != nil {
 		logger.Sugar().Fatal("Can't parse config of db: ", err)
 	}
+	cfg.Payments.Secret = os.Getenv(PaymentsSecretEnv)
 
 	return &cfg
 }
@@ -41,6 +45,7 @@ func ParseDBConfigTest(logger *zap.Logger) *postgres.PSQLConfig {
 	if err != nil {
 		logger.Sugar().Fatal("Can't parse config of db: ", err)
 	}
+	cfg.Payments.Secret = os.Getenv(PaymentsSecretEnv)
 
 	return &cfg
 }
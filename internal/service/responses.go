@@ -1,6 +1,7 @@
 package service
 
 import (
+	"github.com/antsrp/balance_service/internal/money"
 	"github.com/pkg/errors"
 )
 
@@ -10,22 +11,140 @@ const (
 	UserNotFound                       = "User with current id wasn't found!"
 	InsufficientFunds                  = "Insufficient funds on the balance!"
 	DifferentCosts                     = "Order with such parameters has different cost value!"
+	DifferentCurrency                  = "Order with such parameters has different currency!"
+	InvalidCurrency                    = "Unknown or missing currency code!"
+	SameCurrencies                     = "Base and quote currencies must differ!"
+	InvalidRate                        = "Rate must be a positive decimal number!"
+	RateExists                         = "Rate of the currency pair with such effective date already exists!"
+	RateNotFound                       = "No exchange rate of the currency pair is in effect at the time of operation!"
+	ConversionOverflow                 = "Converted amount is too large!"
+	SameWallet                         = "Can't transfer to the same wallet!"
+	InvalidAmount                      = "Amount must be positive!"
+	AmountPrecision                    = "Amount has more decimal places than currency allows!"
+	AmountOverflow                     = "Amount is too large!"
+	TransferReversal                   = "Transfer can't be reversed, make the opposite transfer!"
 	OrderNotFound                      = "Order with such parameters wasn't found!"
 	InvalidUnmarshalUser               = "Can't unmarshal user from input!"
 	InvalidUnmarshalOrder              = "Can't unmarshal order from input!"
+	InvalidUnmarshalTransfer           = "Can't unmarshal transfer from input!"
+	InvalidUnmarshalRate               = "Can't unmarshal exchange rate from input!"
+	InvalidUnmarshalCreditLimit        = "Can't unmarshal credit limit from input!"
+	InvalidUnmarshalLimit              = "Can't unmarshal spending limit from input!"
+	InvalidPeriod                      = "Period of limit must be day or month!"
+	LimitNotFound                      = "Spending limit with such id wasn't found!"
+	SpendingLimitExceeded              = "Order exceeds spending limit of user!"
+	InvalidUnmarshalState              = "Can't unmarshal state of account from input!"
+	InvalidState                       = "State of account must be active, frozen or closed!"
+	AccountFrozen                      = "Account is frozen, money can't leave it!"
+	AccountClosed                      = "Account is closed!"
+	AccountInUse                       = "Account with balance, open reservations or orders to pay out to it can't be closed!"
+	StateNotChanged                    = "Account is already in such state!"
+	InvalidUnmarshalBonus              = "Can't unmarshal bonus from input!"
+	SourceRequired                     = "Source of bonus is required!"
+	InvalidExpiry                      = "Bonus must expire in the future!"
+	BonusReversal                      = "Bonus can't be reversed!"
+	InvalidUnmarshalRule               = "Can't unmarshal cashback rule from input!"
+	InvalidPercent                     = "Percent must be a decimal number greater than 0 and not greater than 100!"
+	InvalidWindow                      = "Rule must end after it begins!"
+	ServiceNotFound                    = "Service with current id wasn't found!"
+	RuleNotFound                       = "Cashback rule with such id wasn't found!"
+	OrderHasCashback                   = "Order with cashback can't be reversed, reverse its cashback first!"
+	InvalidUnmarshalSchedule           = "Can't unmarshal fee schedule from input!"
+	InvalidFeeKind                     = "Kind of fee schedule must be percent, fixed or tiered!"
+	InvalidFeePercent                  = "Percent of fee must be a decimal number not greater than 100!"
+	InvalidFixedFee                    = "Fixed fee is required and must not be negative!"
+	InvalidTiers                       = "Tiers must begin at zero and go in ascending order!"
+	ScheduleNotFound                   = "Fee schedule of the service in such currency wasn't found!"
 	InvalidData                        = "Data don't fit input format!"
 	InvalidDate                        = "Invalid data format!"
 	AlreadyClosedTransaction           = "Can't get revenue of already closed transaction!"
 	OperationOfDifferentUser           = "Operation is bound with different user!"
+	ReasonRequired                     = "Reason of operation is required!"
+	TransactionNotFound                = "Transaction with such id wasn't found!"
+	NotCompletedTransaction            = "Only completed transaction can be reversed!"
+	AlreadyReversedTransaction         = "Transaction is already reversed!"
+	ReversalOfReversal                 = "Reversing transaction can't be reversed!"
+	OrderHasRefunds                    = "Order with refunds can't be reversed!"
+	NotRecognizedOrder                 = "Only order with recognized revenue can be refunded!"
+	ReversedOrder                      = "Reversed order can't be refunded!"
+	AlreadyRefundedOrder               = "Order is already refunded in full!"
+	RefundExceedsCost                  = "Refund exceeds the rest of order cost!"
+	EmptyOrder                         = "Order must have at least one line!"
+	DuplicateOrderLine                 = "Order has several lines of the same service!"
+	PayeeNotFound                      = "Payee with current id wasn't found!"
+	PayeeIsPayer                       = "Payee of order can't be the user paying for it!"
+	OrderHasPayout                     = "Revenue of order is paid out, reverse its payout first!"
+	InvalidUnmarshalPrice              = "Can't unmarshal price from input!"
+	InvalidQuantity                    = "Quantity must be positive!"
+	PriceExists                        = "Price of the service with such effective date already exists!"
+	PriceNotFound                      = "No price of the service is in effect at the time of reservation!"
+	PriceMismatch                      = "Cost doesn't match the price of the service!"
+	InvalidUnmarshalCoupon             = "Can't unmarshal coupon from input!"
+	CouponCodeRequired                 = "Code of coupon is required!"
+	InvalidCouponKind                  = "Kind of coupon must be percent or fixed!"
+	InvalidFixedDiscount               = "Fixed discount must be positive and have currency!"
+	InvalidUsageLimit                  = "Usage limits of coupon must not be negative!"
+	CouponExpiry                       = "Coupon must expire in the future!"
+	CouponExists                       = "Coupon with such code already exists!"
+	CouponNotFound                     = "Coupon with such code wasn't found!"
+	CouponExpired                      = "Coupon is expired!"
+	CouponExhausted                    = "Coupon is used up!"
+	CouponUserLimit                    = "Coupon is used up by the user!"
+	CouponNotApplicable                = "Coupon doesn't fit services or currency of the order!"
+	InvalidUnmarshalBatch              = "Can't unmarshal batch of vouchers from input!"
+	InvalidUnmarshalRedemption         = "Can't unmarshal redemption of voucher from input!"
+	InvalidVoucherCount                = "Number of vouchers in batch must be from 1 to 1000!"
+	VoucherExpiry                      = "Voucher must expire in the future!"
+	VoucherNotFound                    = "Voucher with such code wasn't found!"
+	VoucherRedeemed                    = "Voucher is already redeemed!"
+	VoucherExpired                     = "Voucher is expired!"
+	InvalidUnmarshalTopUp              = "Can't unmarshal top-up from input!"
+	InvalidUnmarshalCallback           = "Can't unmarshal callback of payment from input!"
+	InvalidTopUpStatus                 = "Status of top-up must be pending, succeeded or failed!"
+	InvalidPaymentStatus               = "Status of payment must be succeeded or failed!"
+	InvalidSignature                   = "Signature of callback is invalid!"
+	TopUpNotFound                      = "Top-up with such payment id wasn't found!"
+	TopUpStateConflict                 = "Top-up is already completed with another status!"
+	MockProviderDisabled               = "Mock payment provider is disabled!"
+	PaymentsDisabled                   = "Payment provider isn't configured, top-ups are disabled!"
+	InvalidUnmarshalWithdrawal         = "Can't unmarshal withdrawal from input!"
+	InvalidUnmarshalDecision           = "Can't unmarshal decision from input!"
+	ActorRequired                      = "Actor of operation is required and must be at most 50 characters long!"
+	InvalidWithdrawalStatus            = "Status of withdrawal must be pending, approved or rejected!"
+	WithdrawalNotFound                 = "Withdrawal wasn't found!"
+	WithdrawalDecided                  = "Withdrawal is already approved or rejected!"
+	WithdrawalReversal                 = "Withdrawal can't be reversed, money has already been paid out!"
+	SameActor                          = "Request must be decided by another admin than the one made it!"
+	InvalidUnmarshalAdjustment         = "Can't unmarshal adjustment from input!"
+	InvalidAdjustmentDirection         = "Direction of adjustment must be credit or debit!"
+	InvalidReasonCode                  = "Reason code must be correction, goodwill, chargeback, fraud or migration!"
+	InvalidAdjustmentStatus            = "Status of adjustment must be pending, applied, rejected or expired!"
+	AdjustmentNotFound                 = "Adjustment wasn't found!"
+	AdjustmentDecided                  = "Adjustment is already applied or rejected!"
+	AdjustmentExpired                  = "Adjustment is expired, nobody approved it in time!"
+	AdjustmentReversal                 = "Adjustment can't be reversed, request the opposite adjustment!"
 )
 
 var (
 	ErrInsufficientFunds        = errors.New(InsufficientFunds)
 	ErrDifferentCosts           = errors.New(DifferentCosts)
+	ErrDifferentCurrency        = errors.New(DifferentCurrency)
 	ErrAlreadyClosedTransaction = errors.New(AlreadyClosedTransaction)
 	ErrOrderNotFound            = errors.New(OrderNotFound)
 	ErrUserNotFound             = errors.New(UserNotFound)
 	ErrInvalidDate              = errors.New(InvalidDate)
+	ErrReasonRequired           = errors.New(ReasonRequired)
+	ErrSameCurrencies           = errors.New(SameCurrencies)
+	ErrInvalidAmount            = errors.New(InvalidAmount)
+	ErrSourceRequired           = errors.New(SourceRequired)
+	ErrInvalidExpiry            = errors.New(InvalidExpiry)
+	ErrEmptyOrder               = errors.New(EmptyOrder)
+	ErrDuplicateOrderLine       = errors.New(DuplicateOrderLine)
+	ErrCouponExpiry             = errors.New(CouponExpiry)
+	ErrVoucherExpiry            = errors.New(VoucherExpiry)
+	ErrMockProviderDisabled     = errors.New(MockProviderDisabled)
+	ErrPaymentsDisabled         = errors.New(PaymentsDisabled)
+	ErrActorRequired            = errors.New(ActorRequired)
 )
 
 func Wrapf(err error, msg string) error {
@@ -35,9 +154,34 @@ func Wrapf(err error, msg string) error {
 type Response struct {
 	Error   error       `json:"-"`
 	Message string      `json:"message"`
+	State   string      `json:"account_state,omitempty"` // state of the account of user the operation is made on
 	Data    interface{} `json:"data,omitempty"`
 }
 
 type Balance struct {
-	Value uint64 `json:"balance"`
+	Value    money.Money `json:"balance" swaggertype:"string"`
+	Currency string      `json:"currency"`
+	// set only for the wallet with credit limit, remaining credit is the part of limit not used yet
+	CreditLimit     *money.Money `json:"credit_limit,omitempty" swaggertype:"string"`
+	RemainingCredit *money.Money `json:"remaining_credit,omitempty" swaggertype:"string"`
+}
+
+type Reversal struct {
+	ID int `json:"reversal_id"`
+}
+
+type Refund struct {
+	ID int `json:"refund_id"`
+}
+
+// ReservedLine is the service reserved along with its cost, quantity and price are set if the cost is calculated by price,
+// coupon and discount if the coupon of order fits the service
+type ReservedLine struct {
+	ServiceID int          `json:"service_id"`
+	Cost      money.Money  `json:"cost" swaggertype:"string"`
+	Currency  string       `json:"currency"`
+	Quantity  int          `json:"quantity,omitempty"`
+	PriceID   int          `json:"price_id,omitempty"`
+	CouponID  int          `json:"coupon_id,omitempty"`
+	Discount  *money.Money `json:"discount,omitempty" swaggertype:"string"` // taken off the cost by the coupon
 }
@@ -5,10 +5,29 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/antsrp/balance_service/internal/adjustment"
+	"github.com/antsrp/balance_service/internal/approval"
+	"github.com/antsrp/balance_service/internal/bonus"
 	reservation "github.com/antsrp/balance_service/internal/cash_reservation"
+	"github.com/antsrp/balance_service/internal/cashback"
+	"github.com/antsrp/balance_service/internal/coupon"
+	"github.com/antsrp/balance_service/internal/currency"
+	"github.com/antsrp/balance_service/internal/exchange"
+	"github.com/antsrp/balance_service/internal/fee"
+	"github.com/antsrp/balance_service/internal/money"
+	"github.com/antsrp/balance_service/internal/payment"
+	"github.com/antsrp/balance_service/internal/percent"
+	"github.com/antsrp/balance_service/internal/pricing"
+	"github.com/antsrp/balance_service/internal/reconciliation"
 	"github.com/antsrp/balance_service/internal/reports"
+	"github.com/antsrp/balance_service/internal/spending"
+	"github.com/antsrp/balance_service/internal/transfer"
 	"github.com/antsrp/balance_service/internal/user"
+	"github.com/antsrp/balance_service/internal/voucher"
+	"github.com/antsrp/balance_service/internal/withdrawal"
 
 	"github.com/antsrp/balance_service/internal/postgres"
 )
@@ -41,99 +60,327 @@ func getPathToConfigsFolderTest() string {
 type Service struct {
 	userStorage        *postgres.UserStorage
 	transactionStorage *postgres.TransactionStorage
+	reconStorage       *postgres.ReconciliationStorage
+	exchangeStorage    *postgres.ExchangeStorage
+	spendingStorage    *postgres.SpendingStorage
+	accountStorage     *postgres.AccountStorage
+	bonusStorage       *postgres.BonusStorage
+	cashbackStorage    *postgres.CashbackStorage
+	feeStorage         *postgres.FeeStorage
+	priceStorage       *postgres.PriceStorage
+	couponStorage      *postgres.CouponStorage
+	voucherStorage     *postgres.VoucherStorage
+	topUpStorage       *postgres.TopUpStorage
+	provider           payment.Provider
+	withdrawalStorage  *postgres.WithdrawalStorage
+	adjustmentStorage  *postgres.AdjustmentStorage
 	reportsPath        string
 	configsPath        string
 }
 
-func CreateNewService(us *postgres.UserStorage, ts *postgres.TransactionStorage) *Service {
-	return &Service{
-		userStorage:        us,
-		transactionStorage: ts,
-		reportsPath:        getPathToReportsFolder(),
-		configsPath:        getPathToConfigsFolder(),
-	}
+// Deps are the storages and the payment provider the service works with, commands leave ones they don't use nil
+type Deps struct {
+	Users          *postgres.UserStorage
+	Transactions   *postgres.TransactionStorage
+	Reconciliation *postgres.ReconciliationStorage
+	Exchange       *postgres.ExchangeStorage
+	Spending       *postgres.SpendingStorage
+	Accounts       *postgres.AccountStorage
+	Bonuses        *postgres.BonusStorage
+	Cashback       *postgres.CashbackStorage
+	Fees           *postgres.FeeStorage
+	Prices         *postgres.PriceStorage
+	Coupons        *postgres.CouponStorage
+	Vouchers       *postgres.VoucherStorage
+	TopUps         *postgres.TopUpStorage
+	Provider       payment.Provider // top-ups are disabled without it
+	Withdrawals    *postgres.WithdrawalStorage
+	Adjustments    *postgres.AdjustmentStorage
+}
+
+func CreateNewService(d Deps) *Service {
+	return newService(d, getPathToReportsFolder(), getPathToConfigsFolder())
 }
 
-func CreateNewServiceTest(us *postgres.UserStorage, ts *postgres.TransactionStorage) *Service {
+func CreateNewServiceTest(d Deps) *Service {
+	return newService(d, getPathToReportsFolderTest(), getPathToConfigsFolderTest())
+}
+
+func newService(d Deps, reportsPath, configsPath string) *Service {
 	return &Service{
-		userStorage:        us,
-		transactionStorage: ts,
-		reportsPath:        getPathToReportsFolderTest(),
-		configsPath:        getPathToConfigsFolderTest(),
+		userStorage:        d.Users,
+		transactionStorage: d.Transactions,
+		reconStorage:       d.Reconciliation,
+		exchangeStorage:    d.Exchange,
+		spendingStorage:    d.Spending,
+		accountStorage:     d.Accounts,
+		bonusStorage:       d.Bonuses,
+		cashbackStorage:    d.Cashback,
+		feeStorage:         d.Fees,
+		priceStorage:       d.Prices,
+		couponStorage:      d.Coupons,
+		voucherStorage:     d.Vouchers,
+		topUpStorage:       d.TopUps,
+		provider:           d.Provider,
+		withdrawalStorage:  d.Withdrawals,
+		adjustmentStorage:  d.Adjustments,
+		reportsPath:        reportsPath,
+		configsPath:        configsPath,
 	}
 }
 
-func (s *Service) GetUserBalanceLogic(data string) *Response {
+// GetUserBalanceLogic returns balance of user in the currency or in all his currencies if it is empty
+func (s *Service) GetUserBalanceLogic(data, code string) *Response {
 	id, err := strconv.Atoi(data)
 	if err != nil {
 		return &Response{Error: err, Message: InvalidData}
 	}
-	resp := &Response{Message: OperationSuccessful}
-	if data, err := s.userStorage.GetUserBalance(id); err != nil {
+	if code == "" {
+		return s.getUserWallets(id)
+	}
+	cur, err := currency.Parse(code)
+	if err != nil {
+		return &Response{Error: err, Message: InvalidCurrency}
+	}
+	resp := s.withState(&Response{Message: OperationSuccessful}, id)
+	if data, err := s.userStorage.GetUserBalance(id, cur); err != nil {
 		resp.Error = err
 		if err == postgres.ErrUserNotFound {
 			resp.Message = UserNotFound
 		} else {
 			resp.Message = OperationUnsuccessfulInternalError
 		}
-	} else {
-		resp.Data = Balance{Value: data}
+	} else if resp.Data, err = balanceOf(*data); err != nil {
+		return &Response{Error: err, Message: OperationUnsuccessfulInternalError}
 	}
 	return resp
 }
 
+// balanceOf describes the wallet, credit is reported only if the wallet has the limit
+func balanceOf(w user.Wallet) (Balance, error) {
+	b := Balance{Value: w.Balance, Currency: w.Currency}
+	if w.CreditLimit.IsZero() {
+		return b, nil
+	}
+	credit, err := w.RemainingCredit()
+	if err != nil {
+		return b, err
+	}
+	b.CreditLimit, b.RemainingCredit = &w.CreditLimit, &credit
+	return b, nil
+}
+
+func (s *Service) getUserWallets(id int) *Response {
+	wallets, err := s.userStorage.GetUserWallets(id)
+	if err != nil {
+		if err == postgres.ErrUserNotFound {
+			return &Response{Error: err, Message: UserNotFound}
+		}
+		return &Response{Error: err, Message: OperationUnsuccessfulInternalError}
+	}
+	balances := make([]Balance, 0, len(wallets))
+	for _, w := range wallets {
+		b, err := balanceOf(w)
+		if err != nil {
+			return &Response{Error: err, Message: OperationUnsuccessfulInternalError}
+		}
+		balances = append(balances, b)
+	}
+	return s.withState(&Response{Message: OperationSuccessful, Data: balances}, id)
+}
+
 func (s *Service) AddBalanceLogic(data []byte) *Response {
 	var u user.User
 	if err := json.Unmarshal(data, &u); err != nil {
 		return &Response{Error: Wrapf(err, InvalidUnmarshalUser), Message: InvalidData}
 	}
-	uf, err := s.userStorage.FindUser(u.ID)
+	cur, err := currency.Parse(u.Currency)
 	if err != nil {
-		return &Response{Error: err, Message: OperationUnsuccessfulInternalError}
+		return &Response{Error: err, Message: InvalidCurrency}
 	}
-	resp := &Response{Message: OperationSuccessful}
-	value := u.Balance
-	if uf == nil { // no user in base
-		if err := s.userStorage.InsertUser(&u); err != nil {
-			resp.Error = err
-			resp.Message = OperationUnsuccessfulInternalError
-		}
-	} else { // user was found, update current balance
-		u.Balance += uf.Balance
-		if err := s.userStorage.UpdateUserBalance(&u); err != nil {
-			resp.Error = err
-			resp.Message = OperationUnsuccessfulInternalError
+	u.Currency = cur
+	if u.Balance, err = amountIn(u.Balance, cur); err != nil {
+		return &Response{Error: err, Message: amountMessage(err)}
+	}
+	if u.ToCurrency != "" {
+		if u.ToCurrency, err = currency.Parse(u.ToCurrency); err != nil {
+			return &Response{Error: err, Message: InvalidCurrency}
 		}
 	}
-	if err := s.transactionStorage.CreateIn(u.ID, u.Time, value, u.Comment); err != nil {
+	resp := &Response{Message: OperationSuccessful}
+	if err := s.userStorage.AddBalance(&u); err != nil {
 		resp.Error = err
-		resp.Message = OperationUnsuccessfulInternalError
+		if msg, ok := stateMessage(err); ok {
+			resp.Message = msg
+		} else {
+			resp.Message = conversionMessage(err)
+		}
+	}
+	return s.withState(resp, u.ID)
+}
+
+// conversionMessage returns message of the error of operation which may convert currencies
+func conversionMessage(err error) string {
+	switch err {
+	case postgres.ErrRateNotFound:
+		return RateNotFound
+	case exchange.ErrConversionOverflow:
+		return ConversionOverflow
+	case postgres.ErrZeroAmount:
+		return InvalidAmount
+	}
+	return OperationUnsuccessfulInternalError
+}
+
+// stateMessage returns message of the error of operation rejected by state of the account
+func stateMessage(err error) (string, bool) {
+	switch err {
+	case postgres.ErrAccountFrozen:
+		return AccountFrozen, true
+	case postgres.ErrAccountClosed:
+		return AccountClosed, true
+	}
+	return "", false
+}
+
+// withState adds state of the account of user to the response, it is omitted if the user is unknown
+func (s *Service) withState(resp *Response, userID int) *Response {
+	if state, err := s.accountStorage.GetState(userID); err == nil {
+		resp.State = state
 	}
 	return resp
 }
 
+// listFilter reads the user and the status the list is filtered by, both may be omitted.
+// Response is returned if the user isn't a number or the status isn't known
+func listFilter(data, status string, valid func(string) bool, errStatus error, statusMessage string) (int, *Response) {
+	var userID int
+	if data != "" {
+		var err error
+		if userID, err = strconv.Atoi(data); err != nil {
+			return 0, &Response{Error: err, Message: InvalidData}
+		}
+	}
+	if status != "" && !valid(status) {
+		return 0, &Response{Error: errStatus, Message: statusMessage}
+	}
+	return userID, nil
+}
+
+// amountIn brings the amount from input to minor units of the currency, negative amounts are rejected
+func amountIn(m money.Money, code string) (money.Money, error) {
+	if m.IsNegative() {
+		return m, ErrInvalidAmount
+	}
+	return currency.Normalize(m, code)
+}
+
+// amountMessage returns message of the error of amount from input
+func amountMessage(err error) string {
+	switch err {
+	case money.ErrPrecision:
+		return AmountPrecision
+	case money.ErrOverflow:
+		return AmountOverflow
+	}
+	return InvalidAmount
+}
+
 func (s *Service) CashReservationLogic(data []byte) *Response {
 	var reserve reservation.CashReservation
 	if err := json.Unmarshal(data, &reserve); err != nil {
 		return &Response{Error: Wrapf(err, InvalidUnmarshalOrder), Message: InvalidData}
 	}
-	amount, err := s.transactionStorage.GetAmountOfReservedCash(reserve.UserID)
+	cur, err := currency.Parse(reserve.Currency)
 	if err != nil {
-		return &Response{Error: err, Message: OperationUnsuccessfulInternalError}
+		return &Response{Error: err, Message: InvalidCurrency}
 	}
-	balance, err := s.userStorage.GetUserBalance(reserve.UserID)
-	if err != nil {
-		return &Response{Error: err, Message: OperationUnsuccessfulInternalError}
+	if reserve.Cost, err = amountIn(reserve.Cost, cur); err != nil {
+		return &Response{Error: err, Message: amountMessage(err)}
 	}
-	if balance < amount+reserve.Cost { // operation is not valid
-		return &Response{Error: ErrInsufficientFunds, Message: InsufficientFunds}
+	if reserve.Quantity < 0 {
+		return &Response{Error: pricing.ErrInvalidQuantity, Message: InvalidQuantity}
 	}
-	resp := &Response{Message: OperationSuccessful}
-	if err := s.transactionStorage.CreateOut(reserve.UserID, reserve.OrderID, reserve.FavorID, reserve.Cost, reserve.Comment); err != nil {
-		resp.Error = err
+	o := reservation.Order{
+		UserID:   reserve.UserID,
+		OrderID:  reserve.OrderID,
+		Currency: cur,
+		Lines: []reservation.OrderLine{{
+			FavorID:  reserve.FavorID,
+			Cost:     reserve.Cost,
+			Comment:  reserve.Comment,
+			PayeeID:  reserve.PayeeID,
+			Quantity: reserve.Quantity,
+		}},
+		Coupon: couponCode(reserve.Coupon),
+	}
+	if err := s.transactionStorage.ReserveOrder(&o); err != nil {
+		return s.reserveFailed(err, reserve.UserID)
+	}
+	return s.withState(&Response{Message: OperationSuccessful, Data: reservedLines(o)[0]}, reserve.UserID)
+}
+
+// reservedLines returns lines of the reserved order with their costs
+func reservedLines(o reservation.Order) []ReservedLine {
+	lines := make([]ReservedLine, 0, len(o.Lines))
+	for _, l := range o.Lines {
+		line := ReservedLine{ServiceID: l.FavorID, Cost: l.Cost, Currency: o.Currency, Quantity: l.Quantity, PriceID: l.PriceID}
+		if l.CouponID != 0 {
+			d := l.Discount
+			line.CouponID, line.Discount = l.CouponID, &d
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// couponCode brings the code of coupon from input to the stored form, codes don't depend on case
+func couponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// reserveFailed returns response of the reservation failed with the error
+func (s *Service) reserveFailed(err error, userID int) *Response {
+	if err == postgres.ErrInsufficientFunds { // operation is not valid
+		return s.withState(&Response{Error: ErrInsufficientFunds, Message: InsufficientFunds}, userID)
+	}
+	if err == postgres.ErrSpendingLimitExceeded {
+		return s.withState(&Response{Error: err, Message: SpendingLimitExceeded}, userID)
+	}
+	if err == postgres.ErrPayeeNotFound {
+		return s.withState(&Response{Error: err, Message: PayeeNotFound}, userID)
+	}
+	if err == postgres.ErrPayeeIsPayer {
+		return s.withState(&Response{Error: err, Message: PayeeIsPayer}, userID)
+	}
+	if err == postgres.ErrPriceNotFound {
+		return s.withState(&Response{Error: err, Message: PriceNotFound}, userID)
+	}
+	if err == postgres.ErrPriceMismatch {
+		return s.withState(&Response{Error: err, Message: PriceMismatch}, userID)
+	}
+	if err == money.ErrOverflow {
+		return s.withState(&Response{Error: err, Message: AmountOverflow}, userID)
+	}
+	switch err {
+	case postgres.ErrCouponNotFound:
+		return s.withState(&Response{Error: err, Message: CouponNotFound}, userID)
+	case postgres.ErrCouponExpired:
+		return s.withState(&Response{Error: err, Message: CouponExpired}, userID)
+	case postgres.ErrCouponExhausted:
+		return s.withState(&Response{Error: err, Message: CouponExhausted}, userID)
+	case postgres.ErrCouponUserLimit:
+		return s.withState(&Response{Error: err, Message: CouponUserLimit}, userID)
+	case postgres.ErrCouponNotApplicable:
+		return s.withState(&Response{Error: err, Message: CouponNotApplicable}, userID)
+	}
+	resp := &Response{Error: err}
+	if msg, ok := stateMessage(err); ok {
+		resp.Message = msg
+	} else {
 		resp.Message = OperationUnsuccessfulInternalError
 	}
-	return resp
+	return s.withState(resp, userID)
 }
 
 func (s *Service) RevenueLogic(data []byte) *Response {
@@ -141,46 +388,106 @@ func (s *Service) RevenueLogic(data []byte) *Response {
 	if err := json.Unmarshal(data, &reserve); err != nil {
 		return &Response{Error: Wrapf(err, InvalidUnmarshalOrder), Message: InvalidData}
 	}
+	cur, err := currency.Parse(reserve.Currency)
+	if err != nil {
+		return &Response{Error: err, Message: InvalidCurrency}
+	}
+	reserve.Currency = cur
+	if reserve.Cost, err = amountIn(reserve.Cost, cur); err != nil {
+		return &Response{Error: err, Message: amountMessage(err)}
+	}
 	chainID, err := s.transactionStorage.FindTransaction(reserve)
-
 	if err != nil {
-		resp := &Response{Message: OperationUnsuccessfulInternalError}
-
-		if err == postgres.ErrClosedTransaction {
-			resp.Error = ErrAlreadyClosedTransaction
-			resp.Message = AlreadyClosedTransaction
-		} else if err == postgres.ErrDifferentCosts {
-			resp.Error = ErrDifferentCosts
-			resp.Message = ErrDifferentCosts.Error()
-		} else if err == postgres.ErrOperationOfDifferentUser {
-			resp.Error = ErrOrderNotFound
-			resp.Message = OperationOfDifferentUser
-		} else if err == postgres.ErrOrderNotFound {
-			resp.Error = ErrOrderNotFound
-			resp.Message = OrderNotFound
-		} else {
-			resp.Error = err
-		}
-		return resp
+		return s.revenueFailed(err, reserve.UserID)
 	}
 
-	i, o := make(chan bool), make(chan bool)
-	result := make(chan error)
+	if err := s.transactionStorage.CloseTransaction(chainID, reserve.ClosedAt); err != nil {
+		return s.revenueFailed(err, reserve.UserID)
+	}
+	return s.withState(&Response{Message: OperationSuccessful}, reserve.UserID)
+}
 
-	resp := &Response{Message: OperationSuccessful}
+// revenueFailed returns response of the recognition failed with the error
+func (s *Service) revenueFailed(err error, userID int) *Response {
+	resp := &Response{Message: OperationUnsuccessfulInternalError}
 
-	go s.userStorage.DecreaseBalanceChained(reserve.UserID, reserve.Cost, i, o, result)
-	go s.transactionStorage.CloseTransaction(chainID, reserve.ClosedAt, o, i, result)
+	if err == postgres.ErrClosedTransaction {
+		resp.Error = ErrAlreadyClosedTransaction
+		resp.Message = AlreadyClosedTransaction
+	} else if err == postgres.ErrDifferentCosts {
+		resp.Error = ErrDifferentCosts
+		resp.Message = ErrDifferentCosts.Error()
+	} else if err == postgres.ErrDifferentCurrency {
+		resp.Error = ErrDifferentCurrency
+		resp.Message = DifferentCurrency
+	} else if err == postgres.ErrOperationOfDifferentUser {
+		resp.Error = ErrOrderNotFound
+		resp.Message = OperationOfDifferentUser
+	} else if err == postgres.ErrOrderNotFound {
+		resp.Error = ErrOrderNotFound
+		resp.Message = OrderNotFound
+	} else if msg, ok := stateMessage(err); ok { // the payee doesn't accept money
+		resp.Error = err
+		resp.Message = msg
+	} else {
+		resp.Error = err
+	}
+	return s.withState(resp, userID)
+}
 
-	if err1, err2 := <-result, <-result; err1 != nil || err2 != nil {
-		if err1 != nil {
-			resp.Error = err1
-		} else {
-			resp.Error = err2
+// orderFromInput reads the multi-line order, it must have lines of different services with costs in its currency
+func orderFromInput(data []byte) (*reservation.Order, *Response) {
+	var o reservation.Order
+	if err := json.Unmarshal(data, &o); err != nil {
+		return nil, &Response{Error: Wrapf(err, InvalidUnmarshalOrder), Message: InvalidData}
+	}
+	cur, err := currency.Parse(o.Currency)
+	if err != nil {
+		return nil, &Response{Error: err, Message: InvalidCurrency}
+	}
+	o.Currency = cur
+	o.Coupon = couponCode(o.Coupon)
+	if len(o.Lines) == 0 {
+		return nil, &Response{Error: ErrEmptyOrder, Message: EmptyOrder}
+	}
+	services := make(map[int]bool, len(o.Lines))
+	for i := range o.Lines {
+		if services[o.Lines[i].FavorID] {
+			return nil, &Response{Error: ErrDuplicateOrderLine, Message: DuplicateOrderLine}
+		}
+		services[o.Lines[i].FavorID] = true
+		if o.Lines[i].Cost, err = amountIn(o.Lines[i].Cost, cur); err != nil {
+			return nil, &Response{Error: err, Message: amountMessage(err)}
+		}
+		if o.Lines[i].Quantity < 0 {
+			return nil, &Response{Error: pricing.ErrInvalidQuantity, Message: InvalidQuantity}
 		}
-		resp.Message = OperationUnsuccessfulInternalError
 	}
-	return resp
+	return &o, nil
+}
+
+// ReserveOrderLogic reserves all lines of the order or none of them
+func (s *Service) ReserveOrderLogic(data []byte) *Response {
+	o, resp := orderFromInput(data)
+	if resp != nil {
+		return resp
+	}
+	if err := s.transactionStorage.ReserveOrder(o); err != nil {
+		return s.reserveFailed(err, o.UserID)
+	}
+	return s.withState(&Response{Message: OperationSuccessful, Data: reservedLines(*o)}, o.UserID)
+}
+
+// RevenueOrderLogic recognizes revenue of all lines of the order or none of them
+func (s *Service) RevenueOrderLogic(data []byte) *Response {
+	o, resp := orderFromInput(data)
+	if resp != nil {
+		return resp
+	}
+	if err := s.transactionStorage.CloseOrder(*o); err != nil {
+		return s.revenueFailed(err, o.UserID)
+	}
+	return s.withState(&Response{Message: OperationSuccessful}, o.UserID)
 }
 
 func (s *Service) GetSummaryLogic(year, month int) *Response {
@@ -198,6 +505,24 @@ func (s *Service) GetSummaryLogic(year, month int) *Response {
 	return &Response{Message: OperationSuccessful, Data: fn}
 }
 
+func (s *Service) GetUsersSummaryLogic(year, month int, sortby, direction string) *Response {
+	if (month > 12 || month <= 0) || year <= 0 {
+		return &Response{Error: ErrInvalidDate, Message: InvalidDate}
+	}
+	sum, err := s.transactionStorage.GetUsersMonthSummary(year, month, sortby, direction)
+	if err != nil {
+		if err == postgres.ErrSortParamNotFound {
+			return &Response{Error: err, Message: InvalidData}
+		}
+		return &Response{Error: err, Message: OperationUnsuccessfulInternalError}
+	}
+	fn, err := reports.WriteUsersToCSV(sum, s.reportsPath)
+	if err != nil {
+		return &Response{Error: err, Message: OperationUnsuccessfulInternalError}
+	}
+	return &Response{Message: OperationSuccessful, Data: fn}
+}
+
 func (s *Service) GetOperations(user_id, page int, sortby, direction string) *Response {
 	operations, err := s.transactionStorage.GetOperations(user_id, page, sortby, direction)
 	if err != nil {
@@ -206,5 +531,1015 @@ func (s *Service) GetOperations(user_id, page int, sortby, direction string) *Re
 		}
 		return &Response{Error: err, Message: OperationUnsuccessfulInternalError}
 	}
-	return &Response{Message: OperationSuccessful, Data: operations}
+	return s.withState(&Response{Message: OperationSuccessful, Data: operations}, user_id)
+}
+
+// ReverseLogic reverses the completed transaction by the linked opposite one
+func (s *Service) ReverseLogic(data []byte) *Response {
+	var r reservation.Reversal
+	if err := json.Unmarshal(data, &r); err != nil {
+		return &Response{Error: Wrapf(err, InvalidUnmarshalOrder), Message: InvalidData}
+	}
+	if strings.TrimSpace(r.Reason) == "" {
+		return &Response{Error: ErrReasonRequired, Message: ReasonRequired}
+	}
+	id, userID, err := s.transactionStorage.Reverse(r)
+	if err != nil {
+		resp := &Response{Error: err, Message: OperationUnsuccessfulInternalError}
+		switch err {
+		case postgres.ErrTransactionNotFound:
+			resp.Message = TransactionNotFound
+		case postgres.ErrNotCompletedTransaction:
+			resp.Message = NotCompletedTransaction
+		case postgres.ErrAlreadyReversed:
+			resp.Message = AlreadyReversedTransaction
+		case postgres.ErrReversalOfReversal:
+			resp.Message = ReversalOfReversal
+		case postgres.ErrOrderHasRefunds:
+			resp.Message = OrderHasRefunds
+		case postgres.ErrOrderHasCashback:
+			resp.Message = OrderHasCashback
+		case postgres.ErrOrderHasPayout:
+			resp.Message = OrderHasPayout
+		case postgres.ErrTransferReversal:
+			resp.Message = TransferReversal
+		case postgres.ErrBonusReversal:
+			resp.Message = BonusReversal
+		case postgres.ErrAdjustmentReversal:
+			resp.Message = AdjustmentReversal
+		case postgres.ErrWithdrawalReversal:
+			resp.Message = WithdrawalReversal
+		case postgres.ErrInsufficientFunds:
+			resp.Error = ErrInsufficientFunds
+			resp.Message = InsufficientFunds
+		default:
+			if msg, ok := stateMessage(err); ok {
+				resp.Message = msg
+			}
+		}
+		return s.withState(resp, userID)
+	}
+	return s.withState(&Response{Message: OperationSuccessful, Data: Reversal{ID: id}}, userID)
+}
+
+// RefundLogic returns money of the recognized order to the user, fully or partially
+func (s *Service) RefundLogic(data []byte) *Response {
+	var r reservation.Refund
+	if err := json.Unmarshal(data, &r); err != nil {
+		return &Response{Error: Wrapf(err, InvalidUnmarshalOrder), Message: InvalidData}
+	}
+	if r.Amount.IsNegative() {
+		return &Response{Error: ErrInvalidAmount, Message: InvalidAmount}
+	}
+	id, err := s.transactionStorage.Refund(r)
+	if err != nil {
+		resp := &Response{Error: err, Message: OperationUnsuccessfulInternalError}
+		switch err {
+		case postgres.ErrOrderNotFound:
+			resp.Error = ErrOrderNotFound
+			resp.Message = OrderNotFound
+		case postgres.ErrOperationOfDifferentUser:
+			resp.Message = OperationOfDifferentUser
+		case postgres.ErrNotCompletedTransaction:
+			resp.Message = NotRecognizedOrder
+		case postgres.ErrAlreadyReversed:
+			resp.Message = ReversedOrder
+		case postgres.ErrAlreadyRefunded:
+			resp.Message = AlreadyRefundedOrder
+		case postgres.ErrRefundExceeds:
+			resp.Message = RefundExceedsCost
+		case postgres.ErrOrderHasPayout:
+			resp.Message = OrderHasPayout
+		case money.ErrPrecision, money.ErrOverflow:
+			resp.Message = amountMessage(err)
+		case postgres.ErrAccountFrozen, postgres.ErrAccountClosed:
+			resp.Message, _ = stateMessage(err)
+		}
+		return s.withState(resp, r.UserID)
+	}
+	return s.withState(&Response{Message: OperationSuccessful, Data: Refund{ID: id}}, r.UserID)
+}
+
+// ReconcileLogic checks balances of users against transactions history, in repair mode mismatches are fixed by adjusting entries
+func (s *Service) ReconcileLogic(repair bool) *Response {
+	report, err := s.reconStorage.Reconcile()
+	if err != nil {
+		return &Response{Error: err, Message: OperationUnsuccessfulInternalError}
+	}
+	if repair {
+		for i := range report.Mismatches {
+			repaired, err := s.reconStorage.Repair(report.Mismatches[i])
+			if _, ok := stateMessage(err); ok { // left as it is until the account is active again
+				continue
+			}
+			if err != nil {
+				return &Response{Error: err, Message: OperationUnsuccessfulInternalError, Data: report}
+			}
+			report.Mismatches[i].Repaired = repaired
+		}
+	}
+	if report.Mismatches == nil {
+		report.Mismatches = []reconciliation.Mismatch{}
+	}
+	return &Response{Message: OperationSuccessful, Data: *report}
+}
+
+// TransferLogic moves money between wallets of users, converting it if currencies of wallets differ
+func (s *Service) TransferLogic(data []byte) *Response {
+	var t transfer.Transfer
+	if err := json.Unmarshal(data, &t); err != nil {
+		return &Response{Error: Wrapf(err, InvalidUnmarshalTransfer), Message: InvalidData}
+	}
+	var err error
+	if t.Currency, err = currency.Parse(t.Currency); err != nil {
+		return &Response{Error: err, Message: InvalidCurrency}
+	}
+	if t.Amount, err = amountIn(t.Amount, t.Currency); err != nil {
+		return &Response{Error: err, Message: amountMessage(err)}
+	}
+	if t.ToCurrency != "" {
+		if t.ToCurrency, err = currency.Parse(t.ToCurrency); err != nil {
+			return &Response{Error: err, Message: InvalidCurrency}
+		}
+	}
+	res, err := s.transactionStorage.Transfer(t)
+	if err != nil {
+		resp := &Response{Error: err, Message: conversionMessage(err)}
+		switch err {
+		case postgres.ErrUserNotFound:
+			resp.Error = ErrUserNotFound
+			resp.Message = UserNotFound
+		case postgres.ErrInsufficientFunds:
+			resp.Error = ErrInsufficientFunds
+			resp.Message = InsufficientFunds
+		case postgres.ErrSameWallet:
+			resp.Message = SameWallet
+		case postgres.ErrZeroAmount:
+			resp.Message = InvalidAmount
+		case postgres.ErrAccountFrozen, postgres.ErrAccountClosed:
+			resp.Message, _ = stateMessage(err)
+		}
+		return s.withState(resp, t.FromUserID)
+	}
+	return s.withState(&Response{Message: OperationSuccessful, Data: *res}, t.FromUserID)
+}
+
+// CreateExchangeRateLogic adds the rate of currency pair, it is in effect since its effective date or since now
+func (s *Service) CreateExchangeRateLogic(data []byte) *Response {
+	var r exchange.Rate
+	if err := json.Unmarshal(data, &r); err != nil {
+		return &Response{Error: Wrapf(err, InvalidUnmarshalRate), Message: InvalidData}
+	}
+	var err error
+	if r.Base, err = currency.Parse(r.Base); err != nil {
+		return &Response{Error: err, Message: InvalidCurrency}
+	}
+	if r.Quote, err = currency.Parse(r.Quote); err != nil {
+		return &Response{Error: err, Message: InvalidCurrency}
+	}
+	if r.Base == r.Quote {
+		return &Response{Error: ErrSameCurrencies, Message: SameCurrencies}
+	}
+	if _, err := exchange.ParseRate(r.Rate); err != nil {
+		return &Response{Error: err, Message: InvalidRate}
+	}
+	if r.EffectiveFrom == nil {
+		now := time.Now().UTC()
+		r.EffectiveFrom = &now
+	}
+	id, err := s.exchangeStorage.CreateRate(&r)
+	if err != nil {
+		if err == postgres.ErrRateExists {
+			return &Response{Error: err, Message: RateExists}
+		}
+		return &Response{Error: err, Message: OperationUnsuccessfulInternalError}
+	}
+	r.ID = id
+	return &Response{Message: OperationSuccessful, Data: r}
+}
+
+// GetExchangeRatesLogic returns history of rates, pair may be omitted partially or in full
+func (s *Service) GetExchangeRatesLogic(base, quote string) *Response {
+	var err error
+	if base != "" {
+		if base, err = currency.Parse(base); err != nil {
+			return &Response{Error: err, Message: InvalidCurrency}
+		}
+	}
+	if quote != "" {
+		if quote, err = currency.Parse(quote); err != nil {
+			return &Response{Error: err, Message: InvalidCurrency}
+		}
+	}
+	rates, err := s.exchangeStorage.GetRates(base, quote)
+	if err != nil {
+		return &Response{Error: err, Message: OperationUnsuccessfulInternalError}
+	}
+	return &Response{Message: OperationSuccessful, Data: rates}
+}
+
+// SetCreditLimitLogic sets the amount the wallet of user may go negative by, zero limit disables credit
+func (s *Service) SetCreditLimitLogic(data []byte) *Response {
+	var c user.CreditLimit
+	if err := json.Unmarshal(data, &c); err != nil {
+		return &Response{Error: Wrapf(err, InvalidUnmarshalCreditLimit), Message: InvalidData}
+	}
+	cur, err := currency.Parse(c.Currency)
+	if err != nil {
+		return &Response{Error: err, Message: InvalidCurrency}
+	}
+	if c.Limit, err = amountIn(c.Limit, cur); err != nil {
+		return &Response{Error: err, Message: amountMessage(err)}
+	}
+	if err := s.userStorage.SetCreditLimit(c.UserID, c.Limit, cur); err != nil {
+		if msg, ok := stateMessage(err); ok {
+			return s.withState(&Response{Error: err, Message: msg}, c.UserID)
+		}
+		return &Response{Error: err, Message: OperationUnsuccessfulInternalError}
+	}
+	return s.GetUserBalanceLogic(strconv.Itoa(c.UserID), cur)
+}
+
+// SetSpendingLimitLogic creates the spending limit of user or changes amount of the existing one
+func (s *Service) SetSpendingLimitLogic(data []byte) *Response {
+	var l spending.Limit
+	if err := json.Unmarshal(data, &l); err != nil {
+		return &Response{Error: Wrapf(err, InvalidUnmarshalLimit), Message: InvalidData}
+	}
+	if _, _, err := spending.Window(l.Period, time.Now()); err != nil {
+		return &Response{Error: err, Message: InvalidPeriod}
+	}
+	cur, err := currency.Parse(l.Currency)
+	if err != nil {
+		return &Response{Error: err, Message: InvalidCurrency}
+	}
+	l.Currency = cur
+	if l.Amount, err = amountIn(l.Amount, cur); err != nil {
+		return &Response{Error: err, Message: amountMessage(err)}
+	}
+	if u, err := s.userStorage.FindUser(l.UserID); err != nil {
+		return &Response{Error: err, Message: OperationUnsuccessfulInternalError}
+	} else if u == nil {
+		return &Response{Error: ErrUserNotFound, Message: UserNotFound}
+	}
+	if l.ID, err = s.spendingStorage.SetLimit(&l); err != nil {
+		return &Response{Error: err, Message: OperationUnsuccessfulInternalError}
+	}
+	return &Response{Message: OperationSuccessful, Data: l}
+}
+
+// GetSpendingLimitsLogic returns limits of user with amounts spent in their current periods
+func (s *Service) GetSpendingLimitsLogic(data string) *Response {
+	id, err := strconv.Atoi(data)
+	if err != nil {
+		return &Response{Error: err, Message: InvalidData}
+	}
+	limits, err := s.spendingStorage.GetLimits(id)
+	if err != nil {
+		return &Response{Error: err, Message: OperationUnsuccessfulInternalError}
+	}
+	return &Response{Message: OperationSuccessful, Data: limits}
+}
+
+func (s *Service) DeleteSpendingLimitLogic(data string) *Response {
+	id, err := strconv.Atoi(data)
+	if err != nil {
+		return &Response{Error: err, Message: InvalidData}
+	}
+	if err := s.spendingStorage.DeleteLimit(id); err != nil {
+		if err == postgres.ErrLimitNotFound {
+			return &Response{Error: err, Message: LimitNotFound}
+		}
+		return &Response{Error: err, Message: OperationUnsuccessfulInternalError}
+	}
+	return &Response{Message: OperationSuccessful}
+}
+
+// SetAccountStateLogic freezes, unfreezes or closes the account of user, the reason is required
+func (s *Service) SetAccountStateLogic(data []byte) *Response {
+	var c user.StateChange
+	if err := json.Unmarshal(data, &c); err != nil {
+		return &Response{Error: Wrapf(err, InvalidUnmarshalState), Message: InvalidData}
+	}
+	c.State = strings.ToLower(strings.TrimSpace(c.State))
+	if !user.ValidState(c.State) {
+		return &Response{Error: postgres.ErrUnknownState, Message: InvalidState}
+	}
+	if strings.TrimSpace(c.Reason) == "" {
+		return &Response{Error: ErrReasonRequired, Message: ReasonRequired}
+	}
+	if err := s.accountStorage.SetState(c); err != nil {
+		resp := &Response{Error: err, Message: OperationUnsuccessfulInternalError}
+		switch err {
+		case postgres.ErrUserNotFound:
+			resp.Error = ErrUserNotFound
+			resp.Message = UserNotFound
+		case postgres.ErrAccountClosed:
+			resp.Message = AccountClosed
+		case postgres.ErrAccountInUse:
+			resp.Message = AccountInUse
+		case postgres.ErrStateNotChanged:
+			resp.Message = StateNotChanged
+		}
+		return s.withState(resp, c.UserID)
+	}
+	return s.withState(&Response{Message: OperationSuccessful}, c.UserID)
+}
+
+// GrantBonusLogic adds the bonus to the balance of user, it is spent on orders first and written off at expiry
+func (s *Service) GrantBonusLogic(data []byte) *Response {
+	var b bonus.Bucket
+	if err := json.Unmarshal(data, &b); err != nil {
+		return &Response{Error: Wrapf(err, InvalidUnmarshalBonus), Message: InvalidData}
+	}
+	cur, err := currency.Parse(b.Currency)
+	if err != nil {
+		return &Response{Error: err, Message: InvalidCurrency}
+	}
+	b.Currency = cur
+	if b.Amount, err = amountIn(b.Amount, cur); err != nil {
+		return &Response{Error: err, Message: amountMessage(err)}
+	}
+	if b.Amount.IsZero() {
+		return &Response{Error: ErrInvalidAmount, Message: InvalidAmount}
+	}
+	if b.Source = strings.TrimSpace(b.Source); b.Source == "" {
+		return &Response{Error: ErrSourceRequired, Message: SourceRequired}
+	}
+	now := time.Now().UTC()
+	if b.GrantedAt == nil {
+		b.GrantedAt = &now
+	}
+	if b.ExpiresAt == nil || !b.ExpiresAt.After(*b.GrantedAt) {
+		return &Response{Error: ErrInvalidExpiry, Message: InvalidExpiry}
+	}
+	b.Remaining = b.Amount
+	if b.ID, err = s.bonusStorage.Grant(&b); err != nil {
+		if msg, ok := stateMessage(err); ok {
+			return s.withState(&Response{Error: err, Message: msg}, b.UserID)
+		}
+		return &Response{Error: err, Message: OperationUnsuccessfulInternalError}
+	}
+	return s.withState(&Response{Message: OperationSuccessful, Data: b}, b.UserID)
+}
+
+// GetBonusesLogic returns bonus buckets of user with the orders they were spent on
+func (s *Service) GetBonusesLogic(data string) *Response {
+	id, err := strconv.Atoi(data)
+	if err != nil {
+		return &Response{Error: err, Message: InvalidData}
+	}
+	buckets, err := s.bonusStorage.GetBuckets(id)
+	if err != nil {
+		return &Response{Error: err, Message: OperationUnsuccessfulInternalError}
+	}
+	return s.withState(&Response{Message: OperationSuccessful, Data: buckets}, id)
+}
+
+// ExpireBonusesLogic writes off bonuses left in buckets expired by now
+func (s *Service) ExpireBonusesLogic() *Response {
+	res, err := s.bonusStorage.Expire(time.Now().UTC())
+	if err != nil {
+		return &Response{Error: err, Message: OperationUnsuccessfulInternalError, Data: res}
+	}
+	return &Response{Message: OperationSuccessful, Data: *res}
+}
+
+// CreateCashbackRuleLogic adds the cashback rule of service, it is valid since now if the beginning is omitted
+func (s *Service) CreateCashbackRuleLogic(data []byte) *Response {
+	var r cashback.Rule
+	if err := json.Unmarshal(data, &r); err != nil {
+		return &Response{Error: Wrapf(err, InvalidUnmarshalRule), Message: InvalidData}
+	}
+	cur, err := currency.Parse(r.Currency)
+	if err != nil {
+		return &Response{Error: err, Message: InvalidCurrency}
+	}
+	r.Currency = cur
+	if _, err := percent.ParsePositive(r.Percent); err != nil {
+		return &Response{Error: err, Message: InvalidPercent}
+	}
+	if r.Cap != nil {
+		limit, err := amountIn(*r.Cap, cur)
+		if err != nil {
+			return &Response{Error: err, Message: amountMessage(err)}
+		}
+		r.Cap = &limit
+	}
+	if r.ValidFrom == nil {
+		now := time.Now().UTC()
+		r.ValidFrom = &now
+	}
+	if r.ValidTo != nil && !r.ValidTo.After(*r.ValidFrom) {
+		return &Response{Error: cashback.ErrInvalidWindow, Message: InvalidWindow}
+	}
+	if r.ID, err = s.cashbackStorage.CreateRule(&r); err != nil {
+		if err == postgres.ErrServiceNotFound {
+			return &Response{Error: err, Message: ServiceNotFound}
+		}
+		return &Response{Error: err, Message: OperationUnsuccessfulInternalError}
+	}
+	return &Response{Message: OperationSuccessful, Data: r}
+}
+
+// GetCashbackRulesLogic returns cashback rules of the service, or of all services if it is omitted
+func (s *Service) GetCashbackRulesLogic(data string) *Response {
+	var serviceID int
+	if data != "" {
+		var err error
+		if serviceID, err = strconv.Atoi(data); err != nil {
+			return &Response{Error: err, Message: InvalidData}
+		}
+	}
+	rules, err := s.cashbackStorage.GetRules(serviceID)
+	if err != nil {
+		return &Response{Error: err, Message: OperationUnsuccessfulInternalError}
+	}
+	return &Response{Message: OperationSuccessful, Data: rules}
+}
+
+func (s *Service) DeleteCashbackRuleLogic(data string) *Response {
+	id, err := strconv.Atoi(data)
+	if err != nil {
+		return &Response{Error: err, Message: InvalidData}
+	}
+	if err := s.cashbackStorage.DeleteRule(id); err != nil {
+		if err == postgres.ErrRuleNotFound {
+			return &Response{Error: err, Message: RuleNotFound}
+		}
+		return &Response{Error: err, Message: OperationUnsuccessfulInternalError}
+	}
+	return &Response{Message: OperationSuccessful}
+}
+
+// feeMessage returns message of the error of fee schedule from input
+func feeMessage(err error) string {
+	switch err {
+	case fee.ErrInvalidKind:
+		return InvalidFeeKind
+	case percent.ErrInvalid:
+		return InvalidFeePercent
+	case fee.ErrInvalidFixed:
+		return InvalidFixedFee
+	}
+	return InvalidTiers
+}
+
+// SetFeeScheduleLogic sets the fee schedule of service in the currency, it applies to orders recognized from now on
+func (s *Service) SetFeeScheduleLogic(data []byte) *Response {
+	var sc fee.Schedule
+	if err := json.Unmarshal(data, &sc); err != nil {
+		return &Response{Error: Wrapf(err, InvalidUnmarshalSchedule), Message: InvalidData}
+	}
+	cur, err := currency.Parse(sc.Currency)
+	if err != nil {
+		return &Response{Error: err, Message: InvalidCurrency}
+	}
+	sc.Currency = cur
+	if err := sc.Validate(); err != nil {
+		return &Response{Error: err, Message: feeMessage(err)}
+	}
+	sc.ClearOtherKinds()
+	if sc.Fixed != nil {
+		fixed, err := amountIn(*sc.Fixed, cur)
+		if err != nil {
+			return &Response{Error: err, Message: amountMessage(err)}
+		}
+		sc.Fixed = &fixed
+	}
+	for i := range sc.Tiers {
+		if sc.Tiers[i].From, err = amountIn(sc.Tiers[i].From, cur); err != nil {
+			return &Response{Error: err, Message: amountMessage(err)}
+		}
+	}
+	if err := s.feeStorage.SetSchedule(&sc); err != nil {
+		if err == postgres.ErrServiceNotFound {
+			return &Response{Error: err, Message: ServiceNotFound}
+		}
+		return &Response{Error: err, Message: OperationUnsuccessfulInternalError}
+	}
+	return &Response{Message: OperationSuccessful, Data: sc}
+}
+
+// GetFeeSchedulesLogic returns fee schedules of the service, or of all services if it is omitted
+func (s *Service) GetFeeSchedulesLogic(data string) *Response {
+	var serviceID int
+	if data != "" {
+		var err error
+		if serviceID, err = strconv.Atoi(data); err != nil {
+			return &Response{Error: err, Message: InvalidData}
+		}
+	}
+	schedules, err := s.feeStorage.GetSchedules(serviceID)
+	if err != nil {
+		return &Response{Error: err, Message: OperationUnsuccessfulInternalError}
+	}
+	return &Response{Message: OperationSuccessful, Data: schedules}
+}
+
+func (s *Service) DeleteFeeScheduleLogic(data, code string) *Response {
+	serviceID, err := strconv.Atoi(data)
+	if err != nil {
+		return &Response{Error: err, Message: InvalidData}
+	}
+	cur, err := currency.Parse(code)
+	if err != nil {
+		return &Response{Error: err, Message: InvalidCurrency}
+	}
+	if err := s.feeStorage.DeleteSchedule(serviceID, cur); err != nil {
+		if err == postgres.ErrScheduleNotFound {
+			return &Response{Error: err, Message: ScheduleNotFound}
+		}
+		return &Response{Error: err, Message: OperationUnsuccessfulInternalError}
+	}
+	return &Response{Message: OperationSuccessful}
+}
+
+// CreatePriceLogic adds the price of unit of the service, it is in effect since its effective date or since now
+func (s *Service) CreatePriceLogic(data []byte) *Response {
+	var p pricing.Price
+	if err := json.Unmarshal(data, &p); err != nil {
+		return &Response{Error: Wrapf(err, InvalidUnmarshalPrice), Message: InvalidData}
+	}
+	cur, err := currency.Parse(p.Currency)
+	if err != nil {
+		return &Response{Error: err, Message: InvalidCurrency}
+	}
+	p.Currency = cur
+	if p.Price, err = amountIn(p.Price, cur); err != nil {
+		return &Response{Error: err, Message: amountMessage(err)}
+	}
+	if p.EffectiveFrom == nil {
+		now := time.Now().UTC()
+		p.EffectiveFrom = &now
+	}
+	id, err := s.priceStorage.CreatePrice(&p)
+	if err != nil {
+		switch err {
+		case postgres.ErrServiceNotFound:
+			return &Response{Error: err, Message: ServiceNotFound}
+		case postgres.ErrPriceExists:
+			return &Response{Error: err, Message: PriceExists}
+		}
+		return &Response{Error: err, Message: OperationUnsuccessfulInternalError}
+	}
+	p.ID = id
+	return &Response{Message: OperationSuccessful, Data: p}
+}
+
+// GetPricesLogic returns history of prices, service and currency may be omitted
+func (s *Service) GetPricesLogic(data, code string) *Response {
+	var serviceID int
+	if data != "" {
+		var err error
+		if serviceID, err = strconv.Atoi(data); err != nil {
+			return &Response{Error: err, Message: InvalidData}
+		}
+	}
+	if code != "" {
+		var err error
+		if code, err = currency.Parse(code); err != nil {
+			return &Response{Error: err, Message: InvalidCurrency}
+		}
+	}
+	prices, err := s.priceStorage.GetPrices(serviceID, code)
+	if err != nil {
+		return &Response{Error: err, Message: OperationUnsuccessfulInternalError}
+	}
+	return &Response{Message: OperationSuccessful, Data: prices}
+}
+
+// couponMessage returns message of the error of coupon from input
+func couponMessage(err error) string {
+	switch err {
+	case coupon.ErrCodeRequired:
+		return CouponCodeRequired
+	case coupon.ErrInvalidKind:
+		return InvalidCouponKind
+	case percent.ErrInvalid:
+		return InvalidPercent
+	case coupon.ErrInvalidFixed:
+		return InvalidFixedDiscount
+	}
+	return InvalidUsageLimit
+}
+
+// CreateCouponLogic adds the discount coupon clients may pass to reservations
+func (s *Service) CreateCouponLogic(data []byte) *Response {
+	var c coupon.Coupon
+	if err := json.Unmarshal(data, &c); err != nil {
+		return &Response{Error: Wrapf(err, InvalidUnmarshalCoupon), Message: InvalidData}
+	}
+	c.Code, c.Used = couponCode(c.Code), 0
+	if c.Currency != "" {
+		cur, err := currency.Parse(c.Currency)
+		if err != nil {
+			return &Response{Error: err, Message: InvalidCurrency}
+		}
+		c.Currency = cur
+	}
+	if err := c.Validate(); err != nil {
+		return &Response{Error: err, Message: couponMessage(err)}
+	}
+	c.ClearOtherKinds()
+	if c.Fixed != nil {
+		fixed, err := amountIn(*c.Fixed, c.Currency)
+		if err != nil {
+			return &Response{Error: err, Message: amountMessage(err)}
+		}
+		c.Fixed = &fixed
+	}
+	if c.ExpiresAt != nil && !c.ExpiresAt.After(time.Now()) {
+		return &Response{Error: ErrCouponExpiry, Message: CouponExpiry}
+	}
+	id, err := s.couponStorage.CreateCoupon(&c)
+	if err != nil {
+		switch err {
+		case postgres.ErrServiceNotFound:
+			return &Response{Error: err, Message: ServiceNotFound}
+		case postgres.ErrCouponExists:
+			return &Response{Error: err, Message: CouponExists}
+		}
+		return &Response{Error: err, Message: OperationUnsuccessfulInternalError}
+	}
+	c.ID = id
+	return &Response{Message: OperationSuccessful, Data: c}
+}
+
+func (s *Service) GetCouponsLogic() *Response {
+	coupons, err := s.couponStorage.GetCoupons()
+	if err != nil {
+		return &Response{Error: err, Message: OperationUnsuccessfulInternalError}
+	}
+	return &Response{Message: OperationSuccessful, Data: coupons}
+}
+
+// CreateVoucherBatchLogic generates the batch of one-time vouchers of the same value and expiry
+func (s *Service) CreateVoucherBatchLogic(data []byte) *Response {
+	var b voucher.Batch
+	if err := json.Unmarshal(data, &b); err != nil {
+		return &Response{Error: Wrapf(err, InvalidUnmarshalBatch), Message: InvalidData}
+	}
+	cur, err := currency.Parse(b.Currency)
+	if err != nil {
+		return &Response{Error: err, Message: InvalidCurrency}
+	}
+	b.Currency = cur
+	if b.Value, err = amountIn(b.Value, cur); err != nil {
+		return &Response{Error: err, Message: amountMessage(err)}
+	}
+	if b.Value.IsZero() {
+		return &Response{Error: ErrInvalidAmount, Message: InvalidAmount}
+	}
+	if b.Count < 1 || b.Count > voucher.MaxBatchSize {
+		return &Response{Error: voucher.ErrInvalidCount, Message: InvalidVoucherCount}
+	}
+	if b.ExpiresAt == nil || !b.ExpiresAt.After(time.Now()) {
+		return &Response{Error: ErrVoucherExpiry, Message: VoucherExpiry}
+	}
+	if err := s.voucherStorage.CreateBatch(&b); err != nil {
+		return &Response{Error: err, Message: OperationUnsuccessfulInternalError}
+	}
+	return &Response{Message: OperationSuccessful, Data: b}
+}
+
+// GetVouchersLogic returns vouchers of the batch along with their redemptions, or of all batches if it is omitted
+func (s *Service) GetVouchersLogic(data string) *Response {
+	var batchID int
+	if data != "" {
+		var err error
+		if batchID, err = strconv.Atoi(data); err != nil {
+			return &Response{Error: err, Message: InvalidData}
+		}
+	}
+	vouchers, err := s.voucherStorage.GetVouchers(batchID)
+	if err != nil {
+		return &Response{Error: err, Message: OperationUnsuccessfulInternalError}
+	}
+	return &Response{Message: OperationSuccessful, Data: vouchers}
+}
+
+// RedeemVoucherLogic tops up balance of user by the value of voucher, every voucher is redeemed once
+func (s *Service) RedeemVoucherLogic(data []byte) *Response {
+	var r voucher.Redemption
+	if err := json.Unmarshal(data, &r); err != nil {
+		return &Response{Error: Wrapf(err, InvalidUnmarshalRedemption), Message: InvalidData}
+	}
+	r.Code = voucher.NormalizeCode(r.Code)
+	v, err := s.voucherStorage.Redeem(r)
+	if err != nil {
+		resp := &Response{Error: err}
+		switch err {
+		case postgres.ErrVoucherNotFound:
+			resp.Message = VoucherNotFound
+		case postgres.ErrVoucherRedeemed:
+			resp.Message = VoucherRedeemed
+		case postgres.ErrVoucherExpired:
+			resp.Message = VoucherExpired
+		default:
+			if msg, ok := stateMessage(err); ok {
+				resp.Message = msg
+			} else {
+				resp.Message = OperationUnsuccessfulInternalError
+			}
+		}
+		return s.withState(resp, r.UserID)
+	}
+	return s.withState(&Response{Message: OperationSuccessful, Data: *v}, r.UserID)
+}
+
+// CreateTopUpLogic registers payment of the top-up at the payment provider and records it as pending,
+// balance isn't changed until the provider reports the payment succeeded
+func (s *Service) CreateTopUpLogic(data []byte) *Response {
+	if s.provider == nil {
+		return &Response{Error: ErrPaymentsDisabled, Message: PaymentsDisabled}
+	}
+	var t payment.TopUp
+	if err := json.Unmarshal(data, &t); err != nil {
+		return &Response{Error: Wrapf(err, InvalidUnmarshalTopUp), Message: InvalidData}
+	}
+	cur, err := currency.Parse(t.Currency)
+	if err != nil {
+		return &Response{Error: err, Message: InvalidCurrency}
+	}
+	t.Currency = cur
+	if t.Amount, err = amountIn(t.Amount, cur); err != nil {
+		return &Response{Error: err, Message: amountMessage(err)}
+	}
+	if t.Amount.IsZero() {
+		return &Response{Error: ErrInvalidAmount, Message: InvalidAmount}
+	}
+	t.Provider, t.CreatedAt = s.provider.Name(), time.Now().UTC()
+	if t.PaymentID, t.PaymentURL, err = s.provider.CreatePayment(t); err != nil {
+		return &Response{Error: err, Message: OperationUnsuccessfulInternalError}
+	}
+	if err := s.topUpStorage.CreateTopUp(&t); err != nil {
+		return &Response{Error: err, Message: OperationUnsuccessfulInternalError}
+	}
+	return &Response{Message: OperationSuccessful, Data: t}
+}
+
+// GetTopUpsLogic returns top-ups of the user in the status, of all users or in any status if they are omitted
+func (s *Service) GetTopUpsLogic(data, status string) *Response {
+	userID, resp := listFilter(data, status, payment.ValidStatus, payment.ErrInvalidStatus, InvalidTopUpStatus)
+	if resp != nil {
+		return resp
+	}
+	topUps, err := s.topUpStorage.GetTopUps(userID, status)
+	if err != nil {
+		return &Response{Error: err, Message: OperationUnsuccessfulInternalError}
+	}
+	return &Response{Message: OperationSuccessful, Data: topUps}
+}
+
+// PaymentCallbackLogic completes the top-up by the signed callback of the payment provider,
+// callbacks are idempotent by id of payment
+func (s *Service) PaymentCallbackLogic(body []byte, signature string) *Response {
+	if s.provider == nil {
+		return &Response{Error: ErrPaymentsDisabled, Message: PaymentsDisabled}
+	}
+	c, err := s.provider.ParseCallback(body, signature)
+	if err != nil {
+		if err == payment.ErrInvalidSignature {
+			return &Response{Error: err, Message: InvalidSignature}
+		}
+		return &Response{Error: Wrapf(err, InvalidUnmarshalCallback), Message: InvalidData}
+	}
+	if err := c.Validate(); err != nil {
+		return &Response{Error: err, Message: InvalidPaymentStatus}
+	}
+	t, err := s.topUpStorage.Complete(s.provider.Name(), *c)
+	if err != nil {
+		if t == nil { // top-up wasn't found, so its user is unknown
+			return topUpResponse(err)
+		}
+		return s.withState(topUpResponse(err), t.UserID)
+	}
+	return s.withState(&Response{Message: OperationSuccessful, Data: *t}, t.UserID)
+}
+
+// topUpResponse returns response with message of the error of completing top-up
+func topUpResponse(err error) *Response {
+	resp := &Response{Error: err}
+	switch err {
+	case postgres.ErrTopUpNotFound:
+		resp.Message = TopUpNotFound
+	case postgres.ErrTopUpStateConflict:
+		resp.Message = TopUpStateConflict
+	default:
+		if msg, ok := stateMessage(err); ok {
+			resp.Message = msg
+		} else {
+			resp.Message = OperationUnsuccessfulInternalError
+		}
+	}
+	return resp
+}
+
+// SimulatePaymentLogic makes the mock provider send the signed callback about the payment, as the real provider would
+func (s *Service) SimulatePaymentLogic(data []byte) *Response {
+	mock, ok := s.provider.(*payment.MockProvider)
+	if !ok {
+		return &Response{Error: ErrMockProviderDisabled, Message: MockProviderDisabled}
+	}
+	var c payment.Callback
+	if err := json.Unmarshal(data, &c); err != nil {
+		return &Response{Error: Wrapf(err, InvalidUnmarshalCallback), Message: InvalidData}
+	}
+	body, signature, err := mock.Callback(c.PaymentID, c.Status)
+	if err != nil {
+		return &Response{Error: err, Message: OperationUnsuccessfulInternalError}
+	}
+	return s.PaymentCallbackLogic(body, signature)
+}
+
+// RequestWithdrawalLogic holds the amount of withdrawal on the wallet of user until another admin approves or rejects it
+func (s *Service) RequestWithdrawalLogic(data []byte) *Response {
+	var w withdrawal.Withdrawal
+	if err := json.Unmarshal(data, &w); err != nil {
+		return &Response{Error: Wrapf(err, InvalidUnmarshalWithdrawal), Message: InvalidData}
+	}
+	cur, err := currency.Parse(w.Currency)
+	if err != nil {
+		return &Response{Error: err, Message: InvalidCurrency}
+	}
+	w.Currency = cur
+	if w.Amount, err = amountIn(w.Amount, cur); err != nil {
+		return &Response{Error: err, Message: amountMessage(err)}
+	}
+	if w.Amount.IsZero() {
+		return &Response{Error: ErrInvalidAmount, Message: InvalidAmount}
+	}
+	if w.RequestedBy = approval.Actor(w.RequestedBy); !approval.ValidActor(w.RequestedBy) {
+		return &Response{Error: ErrActorRequired, Message: ActorRequired}
+	}
+	if err := s.withdrawalStorage.Request(&w); err != nil {
+		resp := &Response{Error: err}
+		switch err {
+		case postgres.ErrInsufficientFunds:
+			resp.Error = ErrInsufficientFunds
+			resp.Message = InsufficientFunds
+		default:
+			if msg, ok := stateMessage(err); ok {
+				resp.Message = msg
+			} else {
+				resp.Message = OperationUnsuccessfulInternalError
+			}
+		}
+		return s.withState(resp, w.UserID)
+	}
+	return s.withState(&Response{Message: OperationSuccessful, Data: w}, w.UserID)
+}
+
+// GetWithdrawalsLogic returns withdrawals of the user in the status, of all users or in any status if they are omitted
+func (s *Service) GetWithdrawalsLogic(data, status string) *Response {
+	userID, resp := listFilter(data, status, withdrawal.ValidStatus, withdrawal.ErrInvalidStatus, InvalidWithdrawalStatus)
+	if resp != nil {
+		return resp
+	}
+	withdrawals, err := s.withdrawalStorage.GetWithdrawals(userID, status)
+	if err != nil {
+		return &Response{Error: err, Message: OperationUnsuccessfulInternalError}
+	}
+	return &Response{Message: OperationSuccessful, Data: withdrawals}
+}
+
+// DecideWithdrawalLogic approves or rejects the pending withdrawal, the admin requested it can't decide it.
+// Reason is required to reject
+func (s *Service) DecideWithdrawalLogic(data []byte, status string) *Response {
+	var d withdrawal.Decision
+	if err := json.Unmarshal(data, &d); err != nil {
+		return &Response{Error: Wrapf(err, InvalidUnmarshalDecision), Message: InvalidData}
+	}
+	d.Status = status
+	if d.Actor = approval.Actor(d.Actor); !approval.ValidActor(d.Actor) {
+		return &Response{Error: ErrActorRequired, Message: ActorRequired}
+	}
+	if status == withdrawal.StatusRejected && strings.TrimSpace(d.Reason) == "" {
+		return &Response{Error: ErrReasonRequired, Message: ReasonRequired}
+	}
+	w, err := s.withdrawalStorage.Decide(d)
+	if err != nil {
+		resp := &Response{Error: err}
+		switch err {
+		case postgres.ErrWithdrawalNotFound:
+			resp.Message = WithdrawalNotFound
+		case postgres.ErrWithdrawalDecided:
+			resp.Message = WithdrawalDecided
+		case postgres.ErrSameActor:
+			resp.Message = SameActor
+		default:
+			if msg, ok := stateMessage(err); ok {
+				resp.Message = msg
+			} else {
+				resp.Message = OperationUnsuccessfulInternalError
+			}
+		}
+		return resp
+	}
+	return s.withState(&Response{Message: OperationSuccessful, Data: *w}, w.UserID)
+}
+
+// RequestAdjustmentLogic changes balance of user manually, the adjustment above the approval threshold
+// is applied only when another admin approves it
+func (s *Service) RequestAdjustmentLogic(data []byte) *Response {
+	var a adjustment.Adjustment
+	if err := json.Unmarshal(data, &a); err != nil {
+		return &Response{Error: Wrapf(err, InvalidUnmarshalAdjustment), Message: InvalidData}
+	}
+	cur, err := currency.Parse(a.Currency)
+	if err != nil {
+		return &Response{Error: err, Message: InvalidCurrency}
+	}
+	a.Currency = cur
+	if a.Amount, err = amountIn(a.Amount, cur); err != nil {
+		return &Response{Error: err, Message: amountMessage(err)}
+	}
+	if a.Amount.IsZero() {
+		return &Response{Error: ErrInvalidAmount, Message: InvalidAmount}
+	}
+	if err := a.Validate(); err != nil {
+		if err == adjustment.ErrInvalidDirection {
+			return &Response{Error: err, Message: InvalidAdjustmentDirection}
+		}
+		return &Response{Error: err, Message: InvalidReasonCode}
+	}
+	if a.RequestedBy = approval.Actor(a.RequestedBy); !approval.ValidActor(a.RequestedBy) {
+		return &Response{Error: ErrActorRequired, Message: ActorRequired}
+	}
+	if err := s.adjustmentStorage.Request(&a); err != nil {
+		return s.withState(adjustmentResponse(err), a.UserID)
+	}
+	return s.withState(&Response{Message: OperationSuccessful, Data: a}, a.UserID)
+}
+
+// adjustmentResponse returns response with message of the error of adjustment
+func adjustmentResponse(err error) *Response {
+	resp := &Response{Error: err}
+	switch err {
+	case postgres.ErrAdjustmentNotFound:
+		resp.Message = AdjustmentNotFound
+	case postgres.ErrAdjustmentDecided:
+		resp.Message = AdjustmentDecided
+	case postgres.ErrAdjustmentExpired:
+		resp.Message = AdjustmentExpired
+	case postgres.ErrSameActor:
+		resp.Message = SameActor
+	case postgres.ErrInsufficientFunds:
+		resp.Error = ErrInsufficientFunds
+		resp.Message = InsufficientFunds
+	default:
+		if msg, ok := stateMessage(err); ok {
+			resp.Message = msg
+		} else {
+			resp.Message = OperationUnsuccessfulInternalError
+		}
+	}
+	return resp
+}
+
+// GetAdjustmentsLogic returns adjustments of the user in the status, of all users or in any status if they are omitted.
+// Pending adjustments nobody approved in time are expired first
+func (s *Service) GetAdjustmentsLogic(data, status string) *Response {
+	userID, resp := listFilter(data, status, adjustment.ValidStatus, adjustment.ErrInvalidStatus, InvalidAdjustmentStatus)
+	if resp != nil {
+		return resp
+	}
+	if _, err := s.adjustmentStorage.Expire(time.Now().UTC()); err != nil {
+		return &Response{Error: err, Message: OperationUnsuccessfulInternalError}
+	}
+	adjustments, err := s.adjustmentStorage.GetAdjustments(userID, status)
+	if err != nil {
+		return &Response{Error: err, Message: OperationUnsuccessfulInternalError}
+	}
+	return &Response{Message: OperationSuccessful, Data: adjustments}
+}
+
+// ExpireAdjustmentsLogic marks expired pending adjustments nobody approved by now
+func (s *Service) ExpireAdjustmentsLogic() *Response {
+	n, err := s.adjustmentStorage.Expire(time.Now().UTC())
+	if err != nil {
+		return &Response{Error: err, Message: OperationUnsuccessfulInternalError}
+	}
+	return &Response{Message: OperationSuccessful, Data: adjustment.Expiry{Adjustments: n}}
+}
+
+// DecideAdjustmentLogic applies or rejects the pending adjustment, the admin requested it can't decide it
+func (s *Service) DecideAdjustmentLogic(data []byte, status string) *Response {
+	var d adjustment.Decision
+	if err := json.Unmarshal(data, &d); err != nil {
+		return &Response{Error: Wrapf(err, InvalidUnmarshalDecision), Message: InvalidData}
+	}
+	d.Status = status
+	if d.Actor = approval.Actor(d.Actor); !approval.ValidActor(d.Actor) {
+		return &Response{Error: ErrActorRequired, Message: ActorRequired}
+	}
+	a, err := s.adjustmentStorage.Decide(d)
+	if err != nil {
+		if a == nil { // adjustment wasn't found, so its user is unknown
+			return adjustmentResponse(err)
+		}
+		return s.withState(adjustmentResponse(err), a.UserID)
+	}
+	return s.withState(&Response{Message: OperationSuccessful, Data: *a}, a.UserID)
 }
@@ -5,15 +5,33 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/antsrp/balance_service/internal/adjustment"
+	"github.com/antsrp/balance_service/internal/bonus"
+	"github.com/antsrp/balance_service/internal/coupon"
+	"github.com/antsrp/balance_service/internal/currency"
+	"github.com/antsrp/balance_service/internal/exchange"
+	"github.com/antsrp/balance_service/internal/money"
+	"github.com/antsrp/balance_service/internal/payment"
 	"github.com/antsrp/balance_service/internal/postgres"
+	"github.com/antsrp/balance_service/internal/pricing"
+	"github.com/antsrp/balance_service/internal/reconciliation"
 	"github.com/antsrp/balance_service/internal/reports"
+	"github.com/antsrp/balance_service/internal/spending"
+	"github.com/antsrp/balance_service/internal/transfer"
+	"github.com/antsrp/balance_service/internal/user"
+	"github.com/antsrp/balance_service/internal/voucher"
+	"github.com/antsrp/balance_service/internal/withdrawal"
 	"go.uber.org/zap"
 )
 
 var service *Service
+var database *postgres.Dbsql // lets tests break stored state the way the service never does
 
 type OperationsParams struct {
 	userID    int
@@ -35,16 +53,101 @@ func TestMain(m *testing.M) {
 	if err != nil {
 		logger.Sugar().Fatal("Can't create db: ", err)
 	}
+	database = db
 
-	us, err := postgres.CreateUserStorage(db)
+	ls, err := postgres.CreateLedgerStorage(db)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create a ledger storage: ", err)
+	}
+	es, err := postgres.CreateExchangeStorage(db)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create an exchange storage: ", err)
+	}
+	ss, err := postgres.CreateSpendingStorage(db)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create a spending storage: ", err)
+	}
+	as, err := postgres.CreateAccountStorage(db, cfg.Accounts.FrozenTopUps)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create an account storage: ", err)
+	}
+	bs, err := postgres.CreateBonusStorage(db, ls, as)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create a bonus storage: ", err)
+	}
+	cs, err := postgres.CreateCashbackStorage(db)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create a cashback storage: ", err)
+	}
+	fs, err := postgres.CreateFeeStorage(db)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create a fee storage: ", err)
+	}
+	ps, err := postgres.CreatePriceStorage(db, cfg.Pricing.ServerSide)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create a price storage: ", err)
+	}
+	cps, err := postgres.CreateCouponStorage(db)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create a coupon storage: ", err)
+	}
+	us, err := postgres.CreateUserStorage(db, ls, es, as)
 	if err != nil {
 		logger.Sugar().Fatal("Can't create a user storage: ", err)
 	}
-	rs, err := postgres.CreateTransactionStorage(db, cfg.Limitations.PageLimit)
+	vs, err := postgres.CreateVoucherStorage(db, us)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create a voucher storage: ", err)
+	}
+	tus, err := postgres.CreateTopUpStorage(db, us)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create a top-up storage: ", err)
+	}
+	if cfg.Payments.Secret == "" { // callbacks are signed by the mock provider itself in tests, any secret fits
+		cfg.Payments.Secret = "test-secret"
+	}
+	pp, err := payment.NewProvider(cfg.Payments.Provider, cfg.Payments.Secret, cfg.Payments.AllowMock)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create a payment provider: ", err)
+	}
+	rs, err := postgres.CreateTransactionStorage(db, ls, es, ss, as, bs, cs, fs, ps, cps, cfg.Limitations.PageLimit)
 	if err != nil {
 		logger.Sugar().Fatal("Can't create a transaction storage: ", err)
 	}
-	service = CreateNewServiceTest(us, rs)
+	ws, err := postgres.CreateWithdrawalStorage(db, rs)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create a withdrawal storage: ", err)
+	}
+	thresholds, err := adjustment.ParseThresholds(cfg.Adjustments.ApprovalThresholds)
+	if err != nil {
+		logger.Sugar().Fatal("Can't parse approval thresholds of adjustments: ", err)
+	}
+	ads, err := postgres.CreateAdjustmentStorage(db, us, rs, thresholds, time.Duration(cfg.Adjustments.PendingHours)*time.Hour)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create an adjustment storage: ", err)
+	}
+	recs, err := postgres.CreateReconciliationStorage(db, ls, as)
+	if err != nil {
+		logger.Sugar().Fatal("Can't create a reconciliation storage: ", err)
+	}
+	service = CreateNewServiceTest(Deps{
+		Users:          us,
+		Transactions:   rs,
+		Reconciliation: recs,
+		Exchange:       es,
+		Spending:       ss,
+		Accounts:       as,
+		Bonuses:        bs,
+		Cashback:       cs,
+		Fees:           fs,
+		Prices:         ps,
+		Coupons:        cps,
+		Vouchers:       vs,
+		TopUps:         tus,
+		Provider:       pp,
+		Withdrawals:    ws,
+		Adjustments:    ads,
+	})
 	if err := refreshTables(); err != nil {
 		log.Fatal(err)
 		os.Exit(1)
@@ -62,6 +165,12 @@ const (
 	RESERVE
 	REVENUE
 	CHECK
+	CREDIT
+	TRANSFER
+	LIMIT
+	STATE
+	BONUS
+	REFUND
 )
 
 type TestObject struct {
@@ -80,21 +189,78 @@ func (o Operation) String() string {
 		return `REVENUE`
 	case CHECK:
 		return `CHECK`
+	case CREDIT:
+		return `CREDIT`
+	case TRANSFER:
+		return `TRANSFER`
+	case LIMIT:
+		return `LIMIT`
+	case STATE:
+		return `STATE`
+	case BONUS:
+		return `BONUS`
+	case REFUND:
+		return `REFUND`
 	default:
 		return `EMPTY`
 	}
 }
 
 func refreshTables() error {
+	if err := service.voucherStorage.DeleteAllVouchers(); err != nil {
+		return err
+	}
+	if err := service.topUpStorage.DeleteAllTopUps(); err != nil {
+		return err
+	}
+	if err := service.withdrawalStorage.DeleteAllWithdrawals(); err != nil {
+		return err
+	}
+	if err := service.adjustmentStorage.DeleteAllAdjustments(); err != nil {
+		return err
+	}
+	if err := service.bonusStorage.DeleteAllBuckets(); err != nil {
+		return err
+	}
 	if err := service.transactionStorage.DeleteAllTransactions(); err != nil {
 		return err
 	}
+	if err := service.priceStorage.DeleteAllPrices(); err != nil {
+		return err
+	}
+	if err := service.couponStorage.DeleteAllCoupons(); err != nil {
+		return err
+	}
 	if err := service.userStorage.DeleteAllUsers(); err != nil {
 		return err
 	}
+	if err := service.exchangeStorage.DeleteAllRates(); err != nil {
+		return err
+	}
+	if err := service.spendingStorage.DeleteAllLimits(); err != nil {
+		return err
+	}
+	if err := service.cashbackStorage.DeleteAllRules(); err != nil {
+		return err
+	}
+	if err := service.feeStorage.DeleteAllSchedules(); err != nil {
+		return err
+	}
 	return nil
 }
 
+// withoutIDs clears ids of operations, they depend on the order the tables were filled in
+func withoutIDs(data interface{}) interface{} {
+	ops, ok := data.([]reports.Operation)
+	if !ok {
+		return data
+	}
+	for i := range ops {
+		ops[i].ID = 0
+	}
+	return ops
+}
+
 func TestService(t *testing.T) {
 
 	input := []TestObject{
@@ -102,6 +268,7 @@ func TestService(t *testing.T) {
 		{
 			"user_id": 1,
 			"balance": 500,
+			"currency": "RUB",
 			"time": "2022-09-28T01:19:20Z",
 			"comment": "for breakfast"
 		}`)},
@@ -109,6 +276,7 @@ func TestService(t *testing.T) {
 		{
 			"user_id": 2,
 			"balance": 700,
+			"currency": "RUB",
 			"time": "2022-10-12T07:49:13Z",
 			"comment": "happy birthday!"
 		}`)},
@@ -118,6 +286,7 @@ func TestService(t *testing.T) {
 			"order_id": 1,
 			"service_id": 3,
 			"cost": 100,
+			"currency": "RUB",
 			"comment": "present"
 		}`)},
 		{operation: REVENUE, data: []byte(`
@@ -126,13 +295,15 @@ func TestService(t *testing.T) {
 			"order_id": 1,
 			"service_id": 3,
 			"closed_at": "2022-10-24T12:40:32Z",
-			"cost": 100
+			"cost": 100,
+			"currency": "RUB"
 		}`)},
 		{operation: CHECK, id: "2"},
 		{operation: ADD, data: []byte(`
 		{
 			"user_id": 3,
 			"balance": 400,
+			"currency": "RUB",
 			"time": "2022-10-26T20:14:39Z",
 			"comment": "..."
 		}`)},
@@ -140,6 +311,7 @@ func TestService(t *testing.T) {
 		{
 			"user_id": 3,
 			"balance": 1000,
+			"currency": "RUB",
 			"time": "2022-10-26T21:14:39Z",
 			"comment": "....."
 		}`)},
@@ -150,6 +322,7 @@ func TestService(t *testing.T) {
 			"order_id": 2,
 			"service_id": 1,
 			"cost": 300,
+			"currency": "RUB",
 			"comment": "i want this service too"
 		}`)},
 		{operation: REVENUE, data: []byte(`
@@ -158,7 +331,8 @@ func TestService(t *testing.T) {
 			"order_id": 2,
 			"service_id": 1,
 			"closed_at": "2022-10-27T03:40:12Z",
-			"cost": 300
+			"cost": 300,
+			"currency": "RUB"
 		}`)},
 		{operation: RESERVE, data: []byte(`
 		{
@@ -166,6 +340,7 @@ func TestService(t *testing.T) {
 			"order_id": 3,
 			"service_id": 3,
 			"cost": 100,
+			"currency": "RUB",
 			"comment": "i have money for sure"
 		}`)},
 		{operation: REVENUE, data: []byte(`
@@ -174,7 +349,8 @@ func TestService(t *testing.T) {
 			"order_id": 3,
 			"service_id": 3,
 			"closed_at": "2022-10-28T22:19:19Z",
-			"cost": 100
+			"cost": 100,
+			"currency": "RUB"
 		}`)},
 		{operation: RESERVE, data: []byte(`
 		{
@@ -182,6 +358,7 @@ func TestService(t *testing.T) {
 			"order_id": 4,
 			"service_id": 1,
 			"cost": 400,
+			"currency": "RUB",
 			"comment": "i wanna favor 1"
 		}`)},
 		{operation: CHECK, id: "1"},
@@ -191,7 +368,8 @@ func TestService(t *testing.T) {
 			"order_id": 5,
 			"service_id": 2,
 			"closed_at": "2022-11-04T06:15:51Z",
-			"cost": 300
+			"cost": 300,
+			"currency": "RUB"
 		}`)},
 		{operation: REVENUE, data: []byte(`
 		{
@@ -199,7 +377,8 @@ func TestService(t *testing.T) {
 			"order_id": 4,
 			"service_id": 1,
 			"closed_at": "2022-11-04T07:09:40Z",
-			"cost": 200
+			"cost": 200,
+			"currency": "RUB"
 		}`)},
 		{operation: REVENUE, data: []byte(`
 		{
@@ -207,7 +386,8 @@ func TestService(t *testing.T) {
 			"order_id": 4,
 			"service_id": 1,
 			"closed_at": "2022-11-04T07:09:40Z",
-			"cost": 400
+			"cost": 400,
+			"currency": "RUB"
 		}`)},
 		{operation: REVENUE, data: []byte(`
 		{
@@ -215,7 +395,8 @@ func TestService(t *testing.T) {
 			"order_id": 4,
 			"service_id": 1,
 			"closed_at": "2022-11-04T07:12:45Z",
-			"cost": 400
+			"cost": 400,
+			"currency": "RUB"
 		}`)},
 		{operation: REVENUE, data: []byte(`
 		{
@@ -223,7 +404,8 @@ func TestService(t *testing.T) {
 			"order_id": 4,
 			"service_id": 1,
 			"closed_at": "2022-11-04T07:13:32Z",
-			"cost": 400
+			"cost": 400,
+			"currency": "RUB"
 		}`)},
 		{operation: CHECK, id: "1"},
 		{operation: RESERVE, data: []byte(`
@@ -232,6 +414,7 @@ func TestService(t *testing.T) {
 			"order_id": 5,
 			"service_id": 2,
 			"cost": 300,
+			"currency": "RUB",
 			"comment": "now it's time for favor 2"
 		}`)},
 		{operation: CHECK, id: "1"},
@@ -242,24 +425,24 @@ func TestService(t *testing.T) {
 		{Error: nil, Message: OperationSuccessful},
 		{Error: nil, Message: OperationSuccessful},
 		{Error: nil, Message: OperationSuccessful},
-		{Error: nil, Message: OperationSuccessful, Data: Balance{Value: 600}},
+		{Error: nil, Message: OperationSuccessful, Data: Balance{Value: money.New(60000, 2), Currency: "RUB"}},
 		{Error: nil, Message: OperationSuccessful},
 		{Error: nil, Message: OperationSuccessful},
-		{Error: nil, Message: OperationSuccessful, Data: Balance{Value: 1400}},
+		{Error: nil, Message: OperationSuccessful, Data: Balance{Value: money.New(140000, 2), Currency: "RUB"}},
 		{Error: nil, Message: OperationSuccessful},
 		{Error: nil, Message: OperationSuccessful},
 		{Error: nil, Message: OperationSuccessful},
 		{Error: nil, Message: OperationSuccessful},
 		{Error: nil, Message: OperationSuccessful},
-		{Error: nil, Message: OperationSuccessful, Data: Balance{Value: 500}},
+		{Error: nil, Message: OperationSuccessful, Data: Balance{Value: money.New(50000, 2), Currency: "RUB"}},
 		{Error: ErrOrderNotFound, Message: OrderNotFound},
 		{Error: ErrDifferentCosts, Message: ErrDifferentCosts.Error()},
 		{Error: ErrOrderNotFound, Message: OperationOfDifferentUser},
 		{Error: nil, Message: OperationSuccessful},
 		{Error: ErrAlreadyClosedTransaction, Message: AlreadyClosedTransaction},
-		{Error: nil, Message: OperationSuccessful, Data: Balance{Value: 100}},
+		{Error: nil, Message: OperationSuccessful, Data: Balance{Value: money.New(10000, 2), Currency: "RUB"}},
 		{Error: ErrInsufficientFunds, Message: ErrInsufficientFunds.Error()},
-		{Error: nil, Message: OperationSuccessful, Data: Balance{Value: 100}},
+		{Error: nil, Message: OperationSuccessful, Data: Balance{Value: money.New(10000, 2), Currency: "RUB"}},
 	}
 
 	for i, val := range input {
@@ -268,7 +451,7 @@ func TestService(t *testing.T) {
 		case ADD:
 			result = service.AddBalanceLogic(val.data)
 		case CHECK:
-			result = service.GetUserBalanceLogic(val.id)
+			result = service.GetUserBalanceLogic(val.id, "RUB")
 		case RESERVE:
 			result = service.CashReservationLogic(val.data)
 		case REVENUE:
@@ -299,10 +482,10 @@ func TestOperationsDefault(t *testing.T) {
 	}
 
 	expected := []reports.Operation{
-		{Type: "in", Sum: 400, Comment: "..."},
-		{Type: "in", Sum: 1000, Comment: "....."},
-		{Type: "out", Favor: "Favor 1", Sum: 300, Comment: "i want this service too"},
-		{Type: "out", Favor: "Favor 3", Sum: 100, Comment: "i have money for sure"},
+		{Type: "in", Sum: money.New(40000, 2), Currency: "RUB", Comment: "..."},
+		{Type: "in", Sum: money.New(100000, 2), Currency: "RUB", Comment: "....."},
+		{Type: "out", Favor: "Favor 1", Sum: money.New(30000, 2), Currency: "RUB", Comment: "i want this service too"},
+		{Type: "out", Favor: "Favor 3", Sum: money.New(10000, 2), Currency: "RUB", Comment: "i have money for sure"},
 	}
 
 	for i := range expected {
@@ -318,7 +501,7 @@ func TestOperationsDefault(t *testing.T) {
 	expection := Response{Error: nil, Message: OperationSuccessful, Data: data}
 
 	result := service.GetOperations(params.userID, params.page, params.sortby, params.direction)
-	b, err := json.MarshalIndent(result.Data, "", "\t")
+	b, err := json.MarshalIndent(withoutIDs(result.Data), "", "\t")
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -348,10 +531,10 @@ func TestOperationsDateAsc(t *testing.T) {
 	}
 
 	expected := []reports.Operation{
-		{Type: "in", Sum: 400, Comment: "..."},
-		{Type: "in", Sum: 1000, Comment: "....."},
-		{Type: "out", Favor: "Favor 1", Sum: 300, Comment: "i want this service too"},
-		{Type: "out", Favor: "Favor 3", Sum: 100, Comment: "i have money for sure"},
+		{Type: "in", Sum: money.New(40000, 2), Currency: "RUB", Comment: "..."},
+		{Type: "in", Sum: money.New(100000, 2), Currency: "RUB", Comment: "....."},
+		{Type: "out", Favor: "Favor 1", Sum: money.New(30000, 2), Currency: "RUB", Comment: "i want this service too"},
+		{Type: "out", Favor: "Favor 3", Sum: money.New(10000, 2), Currency: "RUB", Comment: "i have money for sure"},
 	}
 
 	for i := range expected {
@@ -367,7 +550,7 @@ func TestOperationsDateAsc(t *testing.T) {
 	expection := Response{Error: nil, Message: OperationSuccessful, Data: data}
 
 	result := service.GetOperations(params.userID, params.page, params.sortby, params.direction)
-	b, err := json.MarshalIndent(result.Data, "", "\t")
+	b, err := json.MarshalIndent(withoutIDs(result.Data), "", "\t")
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -397,10 +580,10 @@ func TestOperationsDateDesc(t *testing.T) {
 	}
 
 	expected := []reports.Operation{
-		{Type: "out", Favor: "Favor 3", Sum: 100, Comment: "i have money for sure"},
-		{Type: "out", Favor: "Favor 1", Sum: 300, Comment: "i want this service too"},
-		{Type: "in", Sum: 1000, Comment: "....."},
-		{Type: "in", Sum: 400, Comment: "..."},
+		{Type: "out", Favor: "Favor 3", Sum: money.New(10000, 2), Currency: "RUB", Comment: "i have money for sure"},
+		{Type: "out", Favor: "Favor 1", Sum: money.New(30000, 2), Currency: "RUB", Comment: "i want this service too"},
+		{Type: "in", Sum: money.New(100000, 2), Currency: "RUB", Comment: "....."},
+		{Type: "in", Sum: money.New(40000, 2), Currency: "RUB", Comment: "..."},
 	}
 
 	for i := range expected {
@@ -416,7 +599,7 @@ func TestOperationsDateDesc(t *testing.T) {
 	expection := Response{Error: nil, Message: OperationSuccessful, Data: data}
 
 	result := service.GetOperations(params.userID, params.page, params.sortby, params.direction)
-	b, err := json.MarshalIndent(result.Data, "", "\t")
+	b, err := json.MarshalIndent(withoutIDs(result.Data), "", "\t")
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -446,10 +629,10 @@ func TestOperationsSumAsc(t *testing.T) {
 	}
 
 	expected := []reports.Operation{
-		{Type: "out", Favor: "Favor 3", Sum: 100, Comment: "i have money for sure"},
-		{Type: "out", Favor: "Favor 1", Sum: 300, Comment: "i want this service too"},
-		{Type: "in", Sum: 400, Comment: "..."},
-		{Type: "in", Sum: 1000, Comment: "....."},
+		{Type: "out", Favor: "Favor 3", Sum: money.New(10000, 2), Currency: "RUB", Comment: "i have money for sure"},
+		{Type: "out", Favor: "Favor 1", Sum: money.New(30000, 2), Currency: "RUB", Comment: "i want this service too"},
+		{Type: "in", Sum: money.New(40000, 2), Currency: "RUB", Comment: "..."},
+		{Type: "in", Sum: money.New(100000, 2), Currency: "RUB", Comment: "....."},
 	}
 
 	for i := range expected {
@@ -465,7 +648,7 @@ func TestOperationsSumAsc(t *testing.T) {
 	expection := Response{Error: nil, Message: OperationSuccessful, Data: data}
 
 	result := service.GetOperations(params.userID, params.page, params.sortby, params.direction)
-	b, err := json.MarshalIndent(result.Data, "", "\t")
+	b, err := json.MarshalIndent(withoutIDs(result.Data), "", "\t")
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -495,10 +678,10 @@ func TestOperationsSumDesc(t *testing.T) {
 	}
 
 	expected := []reports.Operation{
-		{Type: "in", Sum: 1000, Comment: "....."},
-		{Type: "in", Sum: 400, Comment: "..."},
-		{Type: "out", Favor: "Favor 1", Sum: 300, Comment: "i want this service too"},
-		{Type: "out", Favor: "Favor 3", Sum: 100, Comment: "i have money for sure"},
+		{Type: "in", Sum: money.New(100000, 2), Currency: "RUB", Comment: "....."},
+		{Type: "in", Sum: money.New(40000, 2), Currency: "RUB", Comment: "..."},
+		{Type: "out", Favor: "Favor 1", Sum: money.New(30000, 2), Currency: "RUB", Comment: "i want this service too"},
+		{Type: "out", Favor: "Favor 3", Sum: money.New(10000, 2), Currency: "RUB", Comment: "i have money for sure"},
 	}
 
 	for i := range expected {
@@ -514,7 +697,7 @@ func TestOperationsSumDesc(t *testing.T) {
 	expection := Response{Error: nil, Message: OperationSuccessful, Data: data}
 
 	result := service.GetOperations(params.userID, params.page, params.sortby, params.direction)
-	b, err := json.MarshalIndent(result.Data, "", "\t")
+	b, err := json.MarshalIndent(withoutIDs(result.Data), "", "\t")
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -538,6 +721,7 @@ func addRowsForPagination() {
 		{
 			"user_id": 3,
 			"balance": 200,
+			"currency": "RUB",
 			"time": "2022-09-29T06:19:20Z",
 			"comment": "omg"
 		}`)},
@@ -545,6 +729,7 @@ func addRowsForPagination() {
 		{
 			"user_id": 3,
 			"balance": 1700,
+			"currency": "RUB",
 			"time": "2022-10-29T13:55:32Z",
 			"comment": "you are funny"
 		}`)},
@@ -563,6 +748,7 @@ func addOperationsForPagination() {
 			"order_id": 6,
 			"service_id": 2,
 			"cost": 1800,
+			"currency": "RUB",
 			"comment": "expensive pleasure."
 		}`)},
 		{operation: REVENUE, data: []byte(`
@@ -571,7 +757,8 @@ func addOperationsForPagination() {
 			"order_id": 6,
 			"service_id": 2,
 			"closed_at": "2022-10-30T16:42:44Z",
-			"cost": 1800
+			"cost": 1800,
+			"currency": "RUB"
 		}`)},
 	}
 
@@ -600,11 +787,11 @@ func TestPagination1(t *testing.T) {
 	}
 
 	expected := []reports.Operation{
-		{Type: "out", Favor: "Favor 2", Sum: 1800, Comment: "expensive pleasure."},
-		{Type: "in", Sum: 1700, Comment: "you are funny"},
-		{Type: "in", Sum: 1000, Comment: "....."},
-		{Type: "in", Sum: 400, Comment: "..."},
-		{Type: "out", Favor: "Favor 1", Sum: 300, Comment: "i want this service too"},
+		{Type: "out", Favor: "Favor 2", Sum: money.New(180000, 2), Currency: "RUB", Comment: "expensive pleasure."},
+		{Type: "in", Sum: money.New(170000, 2), Currency: "RUB", Comment: "you are funny"},
+		{Type: "in", Sum: money.New(100000, 2), Currency: "RUB", Comment: "....."},
+		{Type: "in", Sum: money.New(40000, 2), Currency: "RUB", Comment: "..."},
+		{Type: "out", Favor: "Favor 1", Sum: money.New(30000, 2), Currency: "RUB", Comment: "i want this service too"},
 	}
 
 	for i := range expected {
@@ -620,7 +807,7 @@ func TestPagination1(t *testing.T) {
 	expection := Response{Error: nil, Message: OperationSuccessful, Data: data}
 
 	result := service.GetOperations(params.userID, params.page, params.sortby, params.direction)
-	b, err := json.MarshalIndent(result.Data, "", "\t")
+	b, err := json.MarshalIndent(withoutIDs(result.Data), "", "\t")
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -647,8 +834,8 @@ func TestPagination2(t *testing.T) {
 	}
 
 	expected := []reports.Operation{
-		{Type: "in", Sum: 200, Comment: "omg"},
-		{Type: "out", Favor: "Favor 3", Sum: 100, Comment: "i have money for sure"},
+		{Type: "in", Sum: money.New(20000, 2), Currency: "RUB", Comment: "omg"},
+		{Type: "out", Favor: "Favor 3", Sum: money.New(10000, 2), Currency: "RUB", Comment: "i have money for sure"},
 	}
 
 	for i := range expected {
@@ -664,7 +851,7 @@ func TestPagination2(t *testing.T) {
 	expection := Response{Error: nil, Message: OperationSuccessful, Data: data}
 
 	result := service.GetOperations(params.userID, params.page, params.sortby, params.direction)
-	b, err := json.MarshalIndent(result.Data, "", "\t")
+	b, err := json.MarshalIndent(withoutIDs(result.Data), "", "\t")
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -688,9 +875,11 @@ func TestSummary(t *testing.T) {
 
 	expection := Response{Error: nil, Message: OperationSuccessful}
 
-	e := `Favor 1;300
-Favor 2;1800
-Favor 3;200
+	e := `service;currency;revenue;refunds;cashback;gross;fee;net;orders;users;average;reserved;previous;delta
+Favor 1;RUB;300.00;0.00;0.00;300.00;0.00;300.00;1;1;300.00;0.00;0.00;300.00
+Favor 2;RUB;1800.00;0.00;0.00;1800.00;0.00;1800.00;1;1;1800.00;300.00;0.00;1800.00
+Favor 3;RUB;200.00;0.00;0.00;200.00;0.00;200.00;2;2;100.00;0.00;0.00;200.00
+Total;RUB;2300.00;0.00;0.00;2300.00;0.00;2300.00;4;2;575.00;300.00;0.00;2300.00
 `
 
 	result := service.GetSummaryLogic(year, month)
@@ -714,3 +903,1712 @@ Favor 3;200
 		t.Errorf("Test operations, actual data: %v, expected: %v", a, e)
 	}
 }
+
+func TestUsersSummary(t *testing.T) {
+
+	year, month := 2022, 10
+
+	expection := Response{Error: nil, Message: OperationSuccessful}
+
+	e := `user_id;currency;spent;top_ups;vouchers;orders
+3;RUB;2200.00;3100.00;0.00;3
+2;RUB;100.00;700.00;0.00;1
+`
+
+	result := service.GetUsersSummaryLogic(year, month, "spent", "DESC")
+
+	csv := fmt.Sprintf("%s//%s", getPathToReportsFolderTest(), result.Data)
+
+	b, err := os.ReadFile(csv)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	a := string(b)
+
+	if result.Error != expection.Error {
+		t.Errorf("Test operations, actual error: %v, expected: %v", result.Error, expection.Error)
+	}
+	if result.Message != expection.Message {
+		t.Errorf("Test operations, actual message: %v, expected: %v", result.Message, expection.Message)
+	}
+	if a != e {
+		t.Errorf("Test operations, actual data: %v, expected: %v", a, e)
+	}
+}
+
+func TestReconciliation(t *testing.T) {
+
+	result := service.ReconcileLogic(false)
+
+	if result.Error != nil {
+		t.Fatalf("Test reconciliation, actual error: %v, expected: %v", result.Error, nil)
+	}
+	report, ok := result.Data.(reconciliation.Report)
+	if !ok {
+		t.Fatalf("Test reconciliation, unexpected data: %v", result.Data)
+	}
+	if report.Checked != 3 {
+		t.Errorf("Test reconciliation, actual checked users: %v, expected: %v", report.Checked, 3)
+	}
+	if len(report.Mismatches) != 0 {
+		t.Errorf("Test reconciliation, actual mismatches: %v, expected: none", report.Mismatches)
+	}
+}
+
+func TestAddBalanceParallel(t *testing.T) {
+
+	const workers, amount = 50, 10
+
+	data := []byte(`
+	{
+		"user_id": 10,
+		"balance": 10,
+		"currency": "RUB",
+		"time": "2022-12-01T10:00:00Z",
+		"comment": "parallel top-up"
+	}`)
+
+	var wg sync.WaitGroup
+	results := make([]*Response, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = service.AddBalanceLogic(data)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, result := range results {
+		if result.Error != nil {
+			t.Errorf("Top-up %v, actual error: %v, expected: %v", i+1, result.Error, nil)
+		}
+	}
+
+	expection := Response{Error: nil, Message: OperationSuccessful, Data: Balance{Value: money.New(workers*amount*100, 2), Currency: "RUB"}}
+
+	result := service.GetUserBalanceLogic("10", "RUB")
+	if result.Error != expection.Error {
+		t.Errorf("Test parallel top-ups, actual error: %v, expected: %v", result.Error, expection.Error)
+	}
+	if result.Data != expection.Data {
+		t.Errorf("Test parallel top-ups, actual data: %v, expected: %v", result.Data, expection.Data)
+	}
+
+	operations := service.GetOperations(10, 0, "", "")
+	if ops, _ := operations.Data.([]reports.Operation); len(ops) != workers {
+		t.Errorf("Test parallel top-ups, actual operations: %v, expected: %v", len(ops), workers)
+	}
+}
+
+func TestReversal(t *testing.T) {
+
+	ops, _ := service.GetOperations(10, 0, "", "").Data.([]reports.Operation)
+	if len(ops) == 0 {
+		t.Fatalf("Test reversal, no operations of user to reverse")
+	}
+	id := ops[0].ID
+
+	input := [][]byte{
+		[]byte(fmt.Sprintf(`{"transaction_id": %d}`, id)),
+		[]byte(fmt.Sprintf(`{"transaction_id": %d, "reason": "mistaken top-up", "time": "2022-12-02T10:00:00Z"}`, id)),
+		[]byte(fmt.Sprintf(`{"transaction_id": %d, "reason": "mistaken top-up again"}`, id)),
+		[]byte(`{"transaction_id": -1, "reason": "no such transaction"}`),
+	}
+
+	expection := []Response{
+		{Error: ErrReasonRequired, Message: ReasonRequired},
+		{Error: nil, Message: OperationSuccessful},
+		{Error: postgres.ErrAlreadyReversed, Message: AlreadyReversedTransaction},
+		{Error: postgres.ErrTransactionNotFound, Message: TransactionNotFound},
+	}
+
+	var reversalID int
+	for i, data := range input {
+		result := service.ReverseLogic(data)
+		if result.Error != expection[i].Error {
+			t.Errorf("Row %v, actual error: %v, expected: %v", i+1, result.Error, expection[i].Error)
+		}
+		if result.Message != expection[i].Message {
+			t.Errorf("Row %v, actual message: %v, expected: %v", i+1, result.Message, expection[i].Message)
+		}
+		if r, ok := result.Data.(Reversal); ok {
+			reversalID = r.ID
+		}
+	}
+
+	result := service.GetUserBalanceLogic("10", "RUB")
+	if expected := (Balance{Value: money.New(49000, 2), Currency: "RUB"}); result.Data != expected {
+		t.Errorf("Test reversal, actual balance: %v, expected: %v", result.Data, expected)
+	}
+
+	ops, _ = service.GetOperations(10, 0, "", "").Data.([]reports.Operation)
+	if ops[0].ReversedBy != reversalID {
+		t.Errorf("Test reversal, actual reversed by: %v, expected: %v", ops[0].ReversedBy, reversalID)
+	}
+	last := ops[len(ops)-1]
+	if last.ID != reversalID || last.ReversalOf != id || last.Type != "out" || last.Reason != "mistaken top-up" {
+		t.Errorf("Test reversal, unexpected reversing operation: %+v", last)
+	}
+}
+
+func TestRefund(t *testing.T) {
+
+	order := `{"user_id": 10, "order_id": 7, "service_id": 1, "cost": 200, "currency": "RUB"%s}`
+	if result := service.CashReservationLogic([]byte(fmt.Sprintf(order, `, "comment": "refundable"`))); result.Error != nil {
+		t.Fatalf("Test refund, can't reserve cash: %v", result.Error)
+	}
+	refund := []byte(`{"user_id": 10, "order_id": 7, "service_id": 1, "amount": 50}`)
+	if result := service.RefundLogic(refund); result.Message != NotRecognizedOrder {
+		t.Errorf("Test refund, actual message: %v, expected: %v", result.Message, NotRecognizedOrder)
+	}
+	if result := service.RevenueLogic([]byte(fmt.Sprintf(order, `, "closed_at": "2022-12-05T10:00:00Z"`))); result.Error != nil {
+		t.Fatalf("Test refund, can't recognize revenue: %v", result.Error)
+	}
+
+	input := [][]byte{
+		refund,
+		[]byte(`{"user_id": 10, "order_id": 7, "service_id": 1, "amount": 200}`),
+		[]byte(`{"user_id": 2, "order_id": 7, "service_id": 1}`),
+		[]byte(`{"user_id": 10, "order_id": 7, "service_id": 1, "comment": "returned goods"}`),
+		[]byte(`{"user_id": 10, "order_id": 7, "service_id": 1}`),
+		[]byte(`{"user_id": 10, "order_id": 8, "service_id": 1}`),
+	}
+
+	expection := []Response{
+		{Error: nil, Message: OperationSuccessful, Data: Balance{Value: money.New(34000, 2), Currency: "RUB"}},
+		{Error: postgres.ErrRefundExceeds, Message: RefundExceedsCost, Data: Balance{Value: money.New(34000, 2), Currency: "RUB"}},
+		{Error: postgres.ErrOperationOfDifferentUser, Message: OperationOfDifferentUser, Data: Balance{Value: money.New(34000, 2), Currency: "RUB"}},
+		{Error: nil, Message: OperationSuccessful, Data: Balance{Value: money.New(49000, 2), Currency: "RUB"}},
+		{Error: postgres.ErrAlreadyRefunded, Message: AlreadyRefundedOrder, Data: Balance{Value: money.New(49000, 2), Currency: "RUB"}},
+		{Error: ErrOrderNotFound, Message: OrderNotFound, Data: Balance{Value: money.New(49000, 2), Currency: "RUB"}},
+	}
+
+	for i, data := range input {
+		result := service.RefundLogic(data)
+		if result.Error != expection[i].Error {
+			t.Errorf("Row %v, actual error: %v, expected: %v", i+1, result.Error, expection[i].Error)
+		}
+		if result.Message != expection[i].Message {
+			t.Errorf("Row %v, actual message: %v, expected: %v", i+1, result.Message, expection[i].Message)
+		}
+		if balance := service.GetUserBalanceLogic("10", "RUB"); balance.Data != expection[i].Data {
+			t.Errorf("Row %v, actual balance: %v, expected: %v", i+1, balance.Data, expection[i].Data)
+		}
+	}
+
+	ops, _ := service.GetOperations(10, 0, "", "").Data.([]reports.Operation)
+	var orderID int
+	for _, op := range ops {
+		if op.Type == "out" && op.Comment == "refundable" {
+			orderID = op.ID
+		}
+	}
+	result := service.ReverseLogic([]byte(fmt.Sprintf(`{"transaction_id": %d, "reason": "refunded order"}`, orderID)))
+	if result.Message != OrderHasRefunds {
+		t.Errorf("Test refund, actual message of reversal: %v, expected: %v", result.Message, OrderHasRefunds)
+	}
+}
+
+func TestWallets(t *testing.T) {
+
+	input := []TestObject{
+		{operation: ADD, data: []byte(`{"user_id": 11, "balance": 100, "currency": "usd", "time": "2022-12-06T10:00:00Z"}`)},
+		{operation: ADD, data: []byte(`{"user_id": 11, "balance": 50, "currency": "RUB", "time": "2022-12-06T10:05:00Z"}`)},
+		{operation: ADD, data: []byte(`{"user_id": 11, "balance": 50, "currency": "XXX", "time": "2022-12-06T10:10:00Z"}`)},
+		{operation: RESERVE, data: []byte(`{"user_id": 11, "order_id": 9, "service_id": 2, "cost": 80, "currency": "EUR"}`)},
+		{operation: RESERVE, data: []byte(`{"user_id": 11, "order_id": 9, "service_id": 2, "cost": 80, "currency": "USD"}`)},
+		{operation: RESERVE, data: []byte(`{"user_id": 11, "order_id": 10, "service_id": 2, "cost": 30, "currency": "USD"}`)},
+		{operation: REVENUE, data: []byte(`{"user_id": 11, "order_id": 9, "service_id": 2, "cost": 80, "currency": "RUB", "closed_at": "2022-12-06T11:00:00Z"}`)},
+		{operation: REVENUE, data: []byte(`{"user_id": 11, "order_id": 9, "service_id": 2, "cost": 80, "currency": "USD", "closed_at": "2022-12-06T11:00:00Z"}`)},
+		{operation: CHECK, id: "11"},
+	}
+
+	expection := []Response{
+		{Error: nil, Message: OperationSuccessful},
+		{Error: nil, Message: OperationSuccessful},
+		{Error: currency.ErrUnknownCurrency, Message: InvalidCurrency},
+		{Error: ErrInsufficientFunds, Message: InsufficientFunds},
+		{Error: nil, Message: OperationSuccessful},
+		{Error: ErrInsufficientFunds, Message: InsufficientFunds},
+		{Error: ErrDifferentCurrency, Message: DifferentCurrency},
+		{Error: nil, Message: OperationSuccessful},
+		{Error: nil, Message: OperationSuccessful, Data: Balance{Value: money.New(2000, 2), Currency: "USD"}},
+	}
+
+	for i, val := range input {
+		var result *Response
+		switch val.operation {
+		case ADD:
+			result = service.AddBalanceLogic(val.data)
+		case CHECK:
+			result = service.GetUserBalanceLogic(val.id, "USD")
+		case RESERVE:
+			result = service.CashReservationLogic(val.data)
+		case REVENUE:
+			result = service.RevenueLogic(val.data)
+		}
+		if result.Error != expection[i].Error {
+			t.Errorf("Row %v, Operation %v, actual error: %v, expected: %v", i+1, val.operation, result.Error, expection[i].Error)
+		}
+		if result.Message != expection[i].Message {
+			t.Errorf("Row %v, Operation %v, actual message: %v, expected: %v", i+1, val.operation, result.Message, expection[i].Message)
+		}
+		if expection[i].Data != nil && result.Data != expection[i].Data {
+			t.Errorf("Row %v, Operation %v, actual data: %v, expected: %v", i+1, val.operation, result.Data, expection[i].Data)
+		}
+	}
+
+	result := service.GetUserBalanceLogic("11", "")
+	expected := []Balance{{Value: money.New(5000, 2), Currency: "RUB"}, {Value: money.New(2000, 2), Currency: "USD"}}
+	if fmt.Sprint(result.Data) != fmt.Sprint(expected) {
+		t.Errorf("Test wallets, actual balances: %v, expected: %v", result.Data, expected)
+	}
+}
+
+func TestExchange(t *testing.T) {
+
+	rates := [][]byte{
+		[]byte(`{"base": "USD", "quote": "RUB", "rate": "60.5", "effective_from": "2022-12-01T00:00:00Z"}`),
+		[]byte(`{"base": "USD", "quote": "RUB", "rate": "62", "effective_from": "2022-12-10T00:00:00Z"}`),
+		[]byte(`{"base": "rub", "quote": "usd", "rate": "0.016", "effective_from": "2022-12-01T00:00:00Z"}`),
+		[]byte(`{"base": "USD", "quote": "RUB", "rate": "61", "effective_from": "2022-12-10T00:00:00Z"}`),
+		[]byte(`{"base": "USD", "quote": "RUB", "rate": "-1"}`),
+		[]byte(`{"base": "USD", "quote": "USD", "rate": "1"}`),
+	}
+	messages := []string{OperationSuccessful, OperationSuccessful, OperationSuccessful, RateExists, InvalidRate, SameCurrencies}
+	for i, data := range rates {
+		if result := service.CreateExchangeRateLogic(data); result.Message != messages[i] {
+			t.Errorf("Rate %v, actual message: %v, expected: %v", i+1, result.Message, messages[i])
+		}
+	}
+	history, _ := service.GetExchangeRatesLogic("USD", "RUB").Data.([]exchange.Rate)
+	if len(history) != 2 || history[0].Rate != "60.5" || history[1].Rate != "62" {
+		t.Errorf("Test exchange, unexpected history of rates: %+v", history)
+	}
+
+	topUps := [][]byte{
+		// rate in effect now is used whatever time of the top-up is
+		[]byte(`{"user_id": 12, "balance": 1000, "currency": "USD", "to_currency": "RUB", "time": "2022-12-05T10:00:00Z"}`),
+		[]byte(`{"user_id": 12, "balance": 1000, "currency": "EUR", "to_currency": "RUB"}`),
+		[]byte(`{"user_id": 12, "balance": "0.01", "currency": "RUB", "to_currency": "USD"}`),
+	}
+	messages = []string{OperationSuccessful, RateNotFound, InvalidAmount}
+	for i, data := range topUps {
+		if result := service.AddBalanceLogic(data); result.Message != messages[i] {
+			t.Errorf("Top-up %v, actual message: %v, expected: %v", i+1, result.Message, messages[i])
+		}
+	}
+
+	transfers := [][]byte{
+		[]byte(`{"from_user_id": 12, "to_user_id": 11, "amount": "62.05", "currency": "RUB", "to_currency": "USD", "time": "2022-12-12T10:00:00Z"}`),
+		[]byte(`{"from_user_id": 12, "to_user_id": 12, "amount": 100, "currency": "RUB"}`),
+		[]byte(`{"from_user_id": 12, "to_user_id": 11, "amount": 100000, "currency": "RUB"}`),
+		[]byte(`{"from_user_id": 12, "to_user_id": 999, "amount": 100, "currency": "RUB"}`),
+		[]byte(`{"from_user_id": 12, "to_user_id": 11, "amount": "1.001", "currency": "RUB"}`),
+	}
+	expection := []Response{
+		{Error: nil, Message: OperationSuccessful},
+		{Error: postgres.ErrSameWallet, Message: SameWallet},
+		{Error: ErrInsufficientFunds, Message: InsufficientFunds},
+		{Error: ErrUserNotFound, Message: UserNotFound},
+		{Error: money.ErrPrecision, Message: AmountPrecision},
+	}
+	var res transfer.Result
+	for i, data := range transfers {
+		result := service.TransferLogic(data)
+		if result.Error != expection[i].Error {
+			t.Errorf("Transfer %v, actual error: %v, expected: %v", i+1, result.Error, expection[i].Error)
+		}
+		if result.Message != expection[i].Message {
+			t.Errorf("Transfer %v, actual message: %v, expected: %v", i+1, result.Message, expection[i].Message)
+		}
+		if r, ok := result.Data.(transfer.Result); ok {
+			res = r
+		}
+	}
+	if expected := (transfer.Result{OutID: res.OutID, InID: res.InID, Credited: money.New(99, 2), Currency: "USD", Rate: "0.016"}); res != expected {
+		t.Errorf("Test exchange, actual transfer: %+v, expected: %+v", res, expected)
+	}
+
+	balances := map[string]Balance{"12": {Value: money.New(6193795, 2), Currency: "RUB"}, "11": {Value: money.New(2099, 2), Currency: "USD"}}
+	for id, expected := range balances {
+		if result := service.GetUserBalanceLogic(id, expected.Currency); result.Data != expected {
+			t.Errorf("Test exchange, user %v, actual balance: %v, expected: %v", id, result.Data, expected)
+		}
+	}
+
+	ops, _ := service.GetOperations(11, 0, "", "").Data.([]reports.Operation)
+	last := ops[len(ops)-1]
+	if last.ID != res.InID || last.Kind != "transfer" || last.LinkedID != res.OutID || last.SourceSum == nil || *last.SourceSum != money.New(6205, 2) || last.SourceCurrency != "RUB" || last.Rate != "0.016" {
+		t.Errorf("Test exchange, unexpected transfer operation: %+v", last)
+	}
+
+	if result := service.ReverseLogic([]byte(fmt.Sprintf(`{"transaction_id": %d, "reason": "mistaken transfer"}`, res.InID))); result.Message != TransferReversal {
+		t.Errorf("Test exchange, actual message of reversal: %v, expected: %v", result.Message, TransferReversal)
+	}
+}
+
+func TestCreditLimit(t *testing.T) {
+
+	if result := service.AddBalanceLogic([]byte(`{"user_id": 14, "balance": 10, "currency": "RUB"}`)); result.Message != OperationSuccessful {
+		t.Fatalf("Test credit limit, actual message of top-up: %v", result.Message)
+	}
+
+	input := []TestObject{
+		{operation: CREDIT, data: []byte(`{"user_id": 13, "currency": "RUB", "credit_limit": "-5"}`)},
+		{operation: CREDIT, data: []byte(`{"user_id": 13, "currency": "RUB", "credit_limit": "500.00"}`)},
+		{operation: RESERVE, data: []byte(`{"user_id": 13, "order_id": 11, "service_id": 1, "cost": 300, "currency": "RUB"}`)},
+		{operation: RESERVE, data: []byte(`{"user_id": 13, "order_id": 12, "service_id": 1, "cost": 250, "currency": "RUB"}`)},
+		{operation: REVENUE, data: []byte(`{"user_id": 13, "order_id": 11, "service_id": 1, "cost": 300, "currency": "RUB", "closed_at": "2022-12-07T11:00:00Z"}`)},
+		{operation: TRANSFER, data: []byte(`{"from_user_id": 13, "to_user_id": 14, "amount": "200.00", "currency": "RUB"}`)},
+		{operation: TRANSFER, data: []byte(`{"from_user_id": 13, "to_user_id": 14, "amount": "0.01", "currency": "RUB"}`)},
+		{operation: CREDIT, data: []byte(`{"user_id": 13, "currency": "RUB", "credit_limit": 100}`)},
+	}
+	expection := []struct {
+		message string
+		balance int64
+		credit  int64
+	}{
+		{InvalidAmount, 0, 0},
+		{OperationSuccessful, 0, 50000},
+		{OperationSuccessful, 0, 20000},
+		{InsufficientFunds, 0, 20000},
+		{OperationSuccessful, -30000, 20000},
+		{OperationSuccessful, -50000, 0},
+		{InsufficientFunds, -50000, 0},
+		{OperationSuccessful, -50000, 0},
+	}
+
+	for i, val := range input {
+		var result *Response
+		switch val.operation {
+		case CREDIT:
+			result = service.SetCreditLimitLogic(val.data)
+		case RESERVE:
+			result = service.CashReservationLogic(val.data)
+		case REVENUE:
+			result = service.RevenueLogic(val.data)
+		case TRANSFER:
+			result = service.TransferLogic(val.data)
+		}
+		if result.Message != expection[i].message {
+			t.Errorf("Row %v, Operation %v, actual message: %v, expected: %v", i+1, val.operation, result.Message, expection[i].message)
+		}
+		if i == 0 {
+			continue
+		}
+		b, _ := service.GetUserBalanceLogic("13", "RUB").Data.(Balance)
+		if b.Value != money.New(expection[i].balance, 2) || b.RemainingCredit == nil || *b.RemainingCredit != money.New(expection[i].credit, 2) {
+			t.Errorf("Row %v, actual balance: %v, remaining credit: %v, expected: %v, %v", i+1, b.Value, b.RemainingCredit, expection[i].balance, expection[i].credit)
+		}
+	}
+}
+
+func TestSpendingLimits(t *testing.T) {
+
+	if result := service.AddBalanceLogic([]byte(`{"user_id": 15, "balance": 1000, "currency": "RUB"}`)); result.Message != OperationSuccessful {
+		t.Fatalf("Test spending limits, actual message of top-up: %v", result.Message)
+	}
+
+	input := []TestObject{
+		{operation: LIMIT, data: []byte(`{"user_id": 15, "period": "week", "currency": "RUB", "amount": 500}`)},
+		{operation: LIMIT, data: []byte(`{"user_id": 999, "period": "day", "currency": "RUB", "amount": 500}`)},
+		{operation: LIMIT, data: []byte(`{"user_id": 15, "period": "day", "currency": "RUB", "amount": 500}`)},
+		{operation: LIMIT, data: []byte(`{"user_id": 15, "service_id": 2, "period": "month", "currency": "RUB", "amount": 300}`)},
+		{operation: RESERVE, data: []byte(`{"user_id": 15, "order_id": 13, "service_id": 1, "cost": 250, "currency": "RUB"}`)},
+		{operation: RESERVE, data: []byte(`{"user_id": 15, "order_id": 14, "service_id": 2, "cost": 200, "currency": "RUB"}`)},
+		{operation: REVENUE, data: []byte(`{"user_id": 15, "order_id": 14, "service_id": 2, "cost": 200, "currency": "RUB", "closed_at": "2022-12-08T11:00:00Z"}`)},
+		{operation: RESERVE, data: []byte(`{"user_id": 15, "order_id": 15, "service_id": 2, "cost": 150, "currency": "RUB"}`)},
+		{operation: RESERVE, data: []byte(`{"user_id": 15, "order_id": 16, "service_id": 1, "cost": 100, "currency": "RUB"}`)},
+		{operation: RESERVE, data: []byte(`{"user_id": 15, "order_id": 16, "service_id": 1, "cost": 50, "currency": "RUB"}`)},
+		{operation: RESERVE, data: []byte(`{"user_id": 15, "order_id": 17, "service_id": 3, "cost": 100, "currency": "USD"}`)},
+	}
+	expection := []Response{
+		{Error: spending.ErrUnknownPeriod, Message: InvalidPeriod},
+		{Error: ErrUserNotFound, Message: UserNotFound},
+		{Error: nil, Message: OperationSuccessful},
+		{Error: nil, Message: OperationSuccessful},
+		{Error: nil, Message: OperationSuccessful},
+		{Error: nil, Message: OperationSuccessful},
+		{Error: nil, Message: OperationSuccessful},
+		{Error: postgres.ErrSpendingLimitExceeded, Message: SpendingLimitExceeded},
+		{Error: postgres.ErrSpendingLimitExceeded, Message: SpendingLimitExceeded},
+		{Error: nil, Message: OperationSuccessful},
+		{Error: ErrInsufficientFunds, Message: InsufficientFunds},
+	}
+
+	for i, val := range input {
+		var result *Response
+		switch val.operation {
+		case LIMIT:
+			result = service.SetSpendingLimitLogic(val.data)
+		case RESERVE:
+			result = service.CashReservationLogic(val.data)
+		case REVENUE:
+			result = service.RevenueLogic(val.data)
+		}
+		if result.Error != expection[i].Error {
+			t.Errorf("Row %v, Operation %v, actual error: %v, expected: %v", i+1, val.operation, result.Error, expection[i].Error)
+		}
+		if result.Message != expection[i].Message {
+			t.Errorf("Row %v, Operation %v, actual message: %v, expected: %v", i+1, val.operation, result.Message, expection[i].Message)
+		}
+	}
+
+	limits, _ := service.GetSpendingLimitsLogic("15").Data.([]spending.Limit)
+	if len(limits) != 2 || limits[0].Period != spending.PeriodDay || limits[0].Used != money.New(50000, 2) ||
+		limits[1].ServiceID == nil || *limits[1].ServiceID != 2 || limits[1].Used != money.New(20000, 2) {
+		t.Errorf("Test spending limits, unexpected limits: %+v", limits)
+	}
+
+	result := service.SetSpendingLimitLogic([]byte(`{"user_id": 15, "period": "day", "currency": "RUB", "amount": "600.00"}`))
+	if l, _ := result.Data.(spending.Limit); len(limits) == 0 || l.ID != limits[0].ID {
+		t.Errorf("Test spending limits, limit is not updated in place: %+v", result.Data)
+	}
+	if len(limits) == 2 {
+		id := strconv.Itoa(limits[1].ID)
+		if result := service.DeleteSpendingLimitLogic(id); result.Message != OperationSuccessful {
+			t.Errorf("Test spending limits, actual message of deletion: %v", result.Message)
+		}
+		if result := service.DeleteSpendingLimitLogic(id); result.Message != LimitNotFound {
+			t.Errorf("Test spending limits, actual message of repeated deletion: %v, expected: %v", result.Message, LimitNotFound)
+		}
+	}
+	if result := service.CashReservationLogic([]byte(`{"user_id": 15, "order_id": 15, "service_id": 2, "cost": 100, "currency": "RUB"}`)); result.Message != OperationSuccessful {
+		t.Errorf("Test spending limits, actual message of reservation: %v, expected: %v", result.Message, OperationSuccessful)
+	}
+}
+
+func TestAccountStates(t *testing.T) {
+
+	input := []TestObject{
+		{operation: ADD, data: []byte(`{"user_id": 16, "balance": 100, "currency": "RUB"}`)},
+		{operation: RESERVE, data: []byte(`{"user_id": 16, "order_id": 18, "service_id": 1, "cost": 30, "currency": "RUB"}`)},
+		{operation: STATE, data: []byte(`{"user_id": 16, "state": "sleeping", "reason": "test"}`)},
+		{operation: STATE, data: []byte(`{"user_id": 16, "state": "frozen"}`)},
+		{operation: STATE, data: []byte(`{"user_id": 16, "state": "frozen", "reason": "suspicious activity"}`)},
+		{operation: RESERVE, data: []byte(`{"user_id": 16, "order_id": 19, "service_id": 1, "cost": 10, "currency": "RUB"}`)},
+		{operation: TRANSFER, data: []byte(`{"from_user_id": 16, "to_user_id": 14, "amount": 10, "currency": "RUB"}`)},
+		{operation: ADD, data: []byte(`{"user_id": 16, "balance": 10, "currency": "RUB"}`)},
+		{operation: REVENUE, data: []byte(`{"user_id": 16, "order_id": 18, "service_id": 1, "cost": 30, "currency": "RUB", "closed_at": "2022-12-09T11:00:00Z"}`)},
+		{operation: STATE, data: []byte(`{"user_id": 16, "state": "closed", "reason": "request of user"}`)},
+		{operation: STATE, data: []byte(`{"user_id": 16, "state": "active", "reason": "checked"}`)},
+		{operation: TRANSFER, data: []byte(`{"from_user_id": 16, "to_user_id": 14, "amount": 80, "currency": "RUB"}`)},
+		{operation: STATE, data: []byte(`{"user_id": 16, "state": "closed", "reason": "request of user"}`)},
+		{operation: ADD, data: []byte(`{"user_id": 16, "balance": 10, "currency": "RUB"}`)},
+		{operation: TRANSFER, data: []byte(`{"from_user_id": 14, "to_user_id": 16, "amount": 1, "currency": "RUB"}`)},
+		{operation: STATE, data: []byte(`{"user_id": 16, "state": "active", "reason": "mistake"}`)},
+	}
+	expection := []Response{
+		{Message: OperationSuccessful, State: user.StateActive},
+		{Message: OperationSuccessful, State: user.StateActive},
+		{Message: InvalidState},
+		{Message: ReasonRequired},
+		{Message: OperationSuccessful, State: user.StateFrozen},
+		{Message: AccountFrozen, State: user.StateFrozen},
+		{Message: AccountFrozen, State: user.StateFrozen},
+		{Message: OperationSuccessful, State: user.StateFrozen},
+		{Message: OperationSuccessful, State: user.StateFrozen},
+		{Message: AccountInUse, State: user.StateFrozen},
+		{Message: OperationSuccessful, State: user.StateActive},
+		{Message: OperationSuccessful, State: user.StateActive},
+		{Message: OperationSuccessful, State: user.StateClosed},
+		{Message: AccountClosed, State: user.StateClosed},
+		{Message: AccountClosed, State: user.StateActive},
+		{Message: AccountClosed, State: user.StateClosed},
+	}
+
+	for i, val := range input {
+		var result *Response
+		switch val.operation {
+		case ADD:
+			result = service.AddBalanceLogic(val.data)
+		case RESERVE:
+			result = service.CashReservationLogic(val.data)
+		case REVENUE:
+			result = service.RevenueLogic(val.data)
+		case TRANSFER:
+			result = service.TransferLogic(val.data)
+		case STATE:
+			result = service.SetAccountStateLogic(val.data)
+		}
+		if result.Message != expection[i].Message {
+			t.Errorf("Row %v, Operation %v, actual message: %v, expected: %v", i+1, val.operation, result.Message, expection[i].Message)
+		}
+		if result.State != expection[i].State {
+			t.Errorf("Row %v, Operation %v, actual state: %v, expected: %v", i+1, val.operation, result.State, expection[i].State)
+		}
+	}
+
+	if result := service.GetUserBalanceLogic("16", "RUB"); result.State != user.StateClosed || result.Data != (Balance{Value: money.New(0, 2), Currency: "RUB"}) {
+		t.Errorf("Test account states, actual balance: %v in state %v", result.Data, result.State)
+	}
+
+	// reversal of the order would credit the closed account
+	operations := service.GetOperations(16, 0, "", "")
+	if operations.State != user.StateClosed {
+		t.Errorf("Test account states, actual state with operations: %v, expected: %v", operations.State, user.StateClosed)
+	}
+	ops, _ := operations.Data.([]reports.Operation)
+	for _, op := range ops {
+		if op.Type == "out" && op.Sum == money.New(3000, 2) {
+			reversal := []byte(fmt.Sprintf(`{"transaction_id": %d, "reason": "order cancelled"}`, op.ID))
+			if result := service.ReverseLogic(reversal); result.Message != AccountClosed || result.State != user.StateClosed {
+				t.Errorf("Test account states, actual message of reversal: %v in state %v, expected: %v", result.Message, result.State, AccountClosed)
+			}
+		}
+	}
+	if result := service.GetUserBalanceLogic("16", "RUB"); result.Data != (Balance{Value: money.New(0, 2), Currency: "RUB"}) {
+		t.Errorf("Test account states, actual balance after reversal: %v", result.Data)
+	}
+}
+
+func TestBonuses(t *testing.T) {
+
+	input := []TestObject{
+		{operation: ADD, data: []byte(`{"user_id": 17, "balance": 100, "currency": "RUB"}`)},
+		{operation: ADD, data: []byte(`{"user_id": 18, "balance": 1, "currency": "RUB"}`)},
+		{operation: BONUS, data: []byte(`{"user_id": 17, "currency": "RUB", "amount": 30, "source": "spring", "expires_at": "2099-01-01T00:00:00Z"}`)},
+		{operation: BONUS, data: []byte(`{"user_id": 17, "currency": "RUB", "amount": 20, "source": "welcome", "expires_at": "2098-01-01T00:00:00Z"}`)},
+		{operation: BONUS, data: []byte(`{"user_id": 17, "currency": "RUB", "amount": 20, "source": "late", "expires_at": "2020-01-01T00:00:00Z"}`)},
+		{operation: BONUS, data: []byte(`{"user_id": 17, "currency": "RUB", "amount": 20, "expires_at": "2099-01-01T00:00:00Z"}`)},
+		{operation: TRANSFER, data: []byte(`{"from_user_id": 17, "to_user_id": 18, "amount": 101, "currency": "RUB"}`)},
+		{operation: RESERVE, data: []byte(`{"user_id": 17, "order_id": 20, "service_id": 1, "cost": 40, "currency": "RUB"}`)},
+		{operation: REVENUE, data: []byte(`{"user_id": 17, "order_id": 20, "service_id": 1, "cost": 40, "currency": "RUB", "closed_at": "2022-12-10T10:00:00Z"}`)},
+		{operation: REFUND, data: []byte(`{"user_id": 17, "order_id": 20, "service_id": 1, "amount": 15}`)},
+		{operation: TRANSFER, data: []byte(`{"from_user_id": 17, "to_user_id": 18, "amount": 75, "currency": "RUB"}`)},
+	}
+	expection := []Response{
+		{Message: OperationSuccessful, Data: Balance{Value: money.New(10000, 2), Currency: "RUB"}},
+		{Message: OperationSuccessful, Data: Balance{Value: money.New(10000, 2), Currency: "RUB"}},
+		{Message: OperationSuccessful, Data: Balance{Value: money.New(13000, 2), Currency: "RUB"}},
+		{Message: OperationSuccessful, Data: Balance{Value: money.New(15000, 2), Currency: "RUB"}},
+		{Message: InvalidExpiry, Data: Balance{Value: money.New(15000, 2), Currency: "RUB"}},
+		{Message: SourceRequired, Data: Balance{Value: money.New(15000, 2), Currency: "RUB"}},
+		{Message: InsufficientFunds, Data: Balance{Value: money.New(15000, 2), Currency: "RUB"}},
+		{Message: OperationSuccessful, Data: Balance{Value: money.New(15000, 2), Currency: "RUB"}},
+		{Message: OperationSuccessful, Data: Balance{Value: money.New(11000, 2), Currency: "RUB"}},
+		{Message: OperationSuccessful, Data: Balance{Value: money.New(12500, 2), Currency: "RUB"}},
+		{Message: OperationSuccessful, Data: Balance{Value: money.New(5000, 2), Currency: "RUB"}},
+	}
+
+	for i, val := range input {
+		var result *Response
+		switch val.operation {
+		case ADD:
+			result = service.AddBalanceLogic(val.data)
+		case BONUS:
+			result = service.GrantBonusLogic(val.data)
+		case TRANSFER:
+			result = service.TransferLogic(val.data)
+		case RESERVE:
+			result = service.CashReservationLogic(val.data)
+		case REVENUE:
+			result = service.RevenueLogic(val.data)
+		case REFUND:
+			result = service.RefundLogic(val.data)
+		}
+		if result.Message != expection[i].Message {
+			t.Errorf("Row %v, Operation %v, actual message: %v, expected: %v", i+1, val.operation, result.Message, expection[i].Message)
+		}
+		if balance := service.GetUserBalanceLogic("17", "RUB"); balance.Data != expection[i].Data {
+			t.Errorf("Row %v, Operation %v, actual balance: %v, expected: %v", i+1, val.operation, balance.Data, expection[i].Data)
+		}
+	}
+
+	// soonest expiring bucket is spent first, refund comes back to the latest expiring one
+	buckets, _ := service.GetBonusesLogic("17").Data.([]bonus.Bucket)
+	if len(buckets) != 2 {
+		t.Fatalf("Test bonuses, actual buckets: %+v", buckets)
+	}
+	if buckets[0].Source != "welcome" || buckets[0].Remaining != money.New(0, 2) || len(buckets[0].Usages) != 1 || buckets[0].Usages[0].Amount != money.New(2000, 2) {
+		t.Errorf("Test bonuses, unexpected bucket: %+v", buckets[0])
+	}
+	if buckets[1].Source != "spring" || buckets[1].Remaining != money.New(2500, 2) || len(buckets[1].Usages) != 1 ||
+		buckets[1].Usages[0].Amount != money.New(2000, 2) || buckets[1].Usages[0].Returned != money.New(1500, 2) {
+		t.Errorf("Test bonuses, unexpected bucket: %+v", buckets[1])
+	}
+
+	expiry, err := service.bonusStorage.Expire(time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Test bonuses, can't expire bonuses: %v", err)
+	}
+	if expiry.Buckets != 1 || expiry.Amounts["RUB"] != money.New(2500, 2) {
+		t.Errorf("Test bonuses, actual expiry: %+v", *expiry)
+	}
+	if balance := service.GetUserBalanceLogic("17", "RUB"); balance.Data != (Balance{Value: money.New(2500, 2), Currency: "RUB"}) {
+		t.Errorf("Test bonuses, actual balance after expiry: %v", balance.Data)
+	}
+	ops, _ := service.GetOperations(17, 0, "", "").Data.([]reports.Operation)
+	if last := ops[len(ops)-1]; last.Type != "out" || last.Kind != postgres.KindBonusExpiry || last.Sum != money.New(2500, 2) {
+		t.Errorf("Test bonuses, unexpected expiry operation: %+v", last)
+	}
+}
+
+func TestCashback(t *testing.T) {
+
+	rules := []struct {
+		data    string
+		message string
+	}{
+		{`{"service_id": 4, "currency": "RUB", "percent": "10", "cap": 15, "valid_from": "2023-01-01T00:00:00Z", "valid_to": "2023-02-01T00:00:00Z"}`, OperationSuccessful},
+		{`{"service_id": 4, "currency": "RUB", "percent": "150", "valid_from": "2023-01-01T00:00:00Z"}`, InvalidPercent},
+		{`{"service_id": 99, "currency": "RUB", "percent": "10", "valid_from": "2023-01-01T00:00:00Z"}`, ServiceNotFound},
+		{`{"service_id": 4, "currency": "RUB", "percent": "10", "valid_from": "2023-01-01T00:00:00Z", "valid_to": "2022-01-01T00:00:00Z"}`, InvalidWindow},
+	}
+	for i, r := range rules {
+		if result := service.CreateCashbackRuleLogic([]byte(r.data)); result.Message != r.message {
+			t.Errorf("Rule %v, actual message: %v, expected: %v", i+1, result.Message, r.message)
+		}
+	}
+
+	input := []TestObject{
+		{operation: ADD, data: []byte(`{"user_id": 19, "balance": 1000, "currency": "RUB"}`)},
+		{operation: RESERVE, data: []byte(`{"user_id": 19, "order_id": 21, "service_id": 4, "cost": 100, "currency": "RUB"}`)},
+		{operation: REVENUE, data: []byte(`{"user_id": 19, "order_id": 21, "service_id": 4, "cost": 100, "currency": "RUB", "closed_at": "2023-01-10T10:00:00Z"}`)},
+		{operation: RESERVE, data: []byte(`{"user_id": 19, "order_id": 22, "service_id": 4, "cost": 300, "currency": "RUB"}`)},
+		{operation: REVENUE, data: []byte(`{"user_id": 19, "order_id": 22, "service_id": 4, "cost": 300, "currency": "RUB", "closed_at": "2023-01-11T10:00:00Z"}`)},
+		{operation: RESERVE, data: []byte(`{"user_id": 19, "order_id": 23, "service_id": 4, "cost": 50, "currency": "RUB"}`)},
+		{operation: REVENUE, data: []byte(`{"user_id": 19, "order_id": 23, "service_id": 4, "cost": 50, "currency": "RUB", "closed_at": "2023-02-05T10:00:00Z"}`)},
+	}
+	expection := []Balance{
+		{Value: money.New(100000, 2), Currency: "RUB"},
+		{Value: money.New(100000, 2), Currency: "RUB"},
+		{Value: money.New(91000, 2), Currency: "RUB"},
+		{Value: money.New(91000, 2), Currency: "RUB"},
+		{Value: money.New(62500, 2), Currency: "RUB"},
+		{Value: money.New(62500, 2), Currency: "RUB"},
+		{Value: money.New(57500, 2), Currency: "RUB"},
+	}
+
+	for i, val := range input {
+		var result *Response
+		switch val.operation {
+		case ADD:
+			result = service.AddBalanceLogic(val.data)
+		case RESERVE:
+			result = service.CashReservationLogic(val.data)
+		case REVENUE:
+			result = service.RevenueLogic(val.data)
+		}
+		if result.Message != OperationSuccessful {
+			t.Errorf("Row %v, Operation %v, actual message: %v, expected: %v", i+1, val.operation, result.Message, OperationSuccessful)
+		}
+		if balance := service.GetUserBalanceLogic("19", "RUB"); balance.Data != expection[i] {
+			t.Errorf("Row %v, Operation %v, actual balance: %v, expected: %v", i+1, val.operation, balance.Data, expection[i])
+		}
+	}
+
+	summary, err := service.transactionStorage.GetMonthSummary(2023, 1)
+	if err != nil {
+		t.Fatalf("Test cashback, can't get summary: %v", err)
+	}
+	for _, s := range summary {
+		if s.Name == "Favor 4" && s.Currency == "RUB" && s.Cashback != money.New(2500, 2) {
+			t.Errorf("Test cashback, actual cashback in summary: %v", s.Cashback)
+		}
+	}
+
+	// cashback links to the order, it is reversed before the order
+	ops, _ := service.GetOperations(19, 0, "", "").Data.([]reports.Operation)
+	var orderID, cashbackID int
+	for _, op := range ops {
+		if op.Type == "out" && op.Sum == money.New(10000, 2) {
+			orderID = op.ID
+		}
+		if op.Kind == postgres.KindCashback && op.Sum == money.New(1000, 2) {
+			cashbackID = op.ID
+			if op.LinkedID != orderID {
+				t.Errorf("Test cashback, cashback %v links to %v, expected: %v", op.ID, op.LinkedID, orderID)
+			}
+		}
+	}
+	reversal := `{"transaction_id": %d, "reason": "mistaken order"}`
+	if result := service.ReverseLogic([]byte(fmt.Sprintf(reversal, orderID))); result.Message != OrderHasCashback {
+		t.Errorf("Test cashback, actual message: %v, expected: %v", result.Message, OrderHasCashback)
+	}
+	if result := service.ReverseLogic([]byte(fmt.Sprintf(reversal, cashbackID))); result.Message != OperationSuccessful {
+		t.Errorf("Test cashback, actual message: %v, expected: %v", result.Message, OperationSuccessful)
+	}
+	if result := service.ReverseLogic([]byte(fmt.Sprintf(reversal, orderID))); result.Message != OperationSuccessful {
+		t.Errorf("Test cashback, actual message: %v, expected: %v", result.Message, OperationSuccessful)
+	}
+	if balance := service.GetUserBalanceLogic("19", "RUB"); balance.Data != (Balance{Value: money.New(66500, 2), Currency: "RUB"}) {
+		t.Errorf("Test cashback, actual balance after reversals: %v", balance.Data)
+	}
+}
+
+func TestFees(t *testing.T) {
+
+	schedules := []struct {
+		data    string
+		message string
+	}{
+		{`{"service_id": 5, "currency": "RUB", "kind": "tiered", "tiers": [{"from": "0", "percent": "10"}, {"from": "500", "percent": "5"}]}`, OperationSuccessful},
+		{`{"service_id": 6, "currency": "RUB", "kind": "fixed", "fixed": "300"}`, OperationSuccessful},
+		{`{"service_id": 5, "currency": "RUB", "kind": "flat", "percent": "5"}`, InvalidFeeKind},
+		{`{"service_id": 5, "currency": "RUB", "kind": "percent", "percent": "101"}`, InvalidFeePercent},
+		{`{"service_id": 5, "currency": "RUB", "kind": "fixed"}`, InvalidFixedFee},
+		{`{"service_id": 5, "currency": "RUB", "kind": "tiered", "tiers": [{"from": "100", "percent": "5"}]}`, InvalidTiers},
+		{`{"service_id": 99, "currency": "RUB", "kind": "percent", "percent": "5"}`, ServiceNotFound},
+	}
+	for i, s := range schedules {
+		if result := service.SetFeeScheduleLogic([]byte(s.data)); result.Message != s.message {
+			t.Errorf("Schedule %v, actual message: %v, expected: %v", i+1, result.Message, s.message)
+		}
+	}
+
+	// fees are taken from revenue of the service, balance of user is charged the cost only
+	input := []TestObject{
+		{operation: ADD, data: []byte(`{"user_id": 20, "balance": 2000, "currency": "RUB"}`)},
+		{operation: RESERVE, data: []byte(`{"user_id": 20, "order_id": 24, "service_id": 5, "cost": 200, "currency": "RUB"}`)},
+		{operation: REVENUE, data: []byte(`{"user_id": 20, "order_id": 24, "service_id": 5, "cost": 200, "currency": "RUB", "closed_at": "2023-03-10T10:00:00Z"}`)},
+		{operation: RESERVE, data: []byte(`{"user_id": 20, "order_id": 25, "service_id": 5, "cost": 1000, "currency": "RUB"}`)},
+		{operation: REVENUE, data: []byte(`{"user_id": 20, "order_id": 25, "service_id": 5, "cost": 1000, "currency": "RUB", "closed_at": "2023-03-11T10:00:00Z"}`)},
+		{operation: RESERVE, data: []byte(`{"user_id": 20, "order_id": 26, "service_id": 6, "cost": 100, "currency": "RUB"}`)},
+		{operation: REVENUE, data: []byte(`{"user_id": 20, "order_id": 26, "service_id": 6, "cost": 100, "currency": "RUB", "closed_at": "2023-03-12T10:00:00Z"}`)},
+	}
+	expection := []Balance{
+		{Value: money.New(200000, 2), Currency: "RUB"},
+		{Value: money.New(200000, 2), Currency: "RUB"},
+		{Value: money.New(180000, 2), Currency: "RUB"},
+		{Value: money.New(180000, 2), Currency: "RUB"},
+		{Value: money.New(80000, 2), Currency: "RUB"},
+		{Value: money.New(80000, 2), Currency: "RUB"},
+		{Value: money.New(70000, 2), Currency: "RUB"},
+	}
+
+	for i, val := range input {
+		var result *Response
+		switch val.operation {
+		case ADD:
+			result = service.AddBalanceLogic(val.data)
+		case RESERVE:
+			result = service.CashReservationLogic(val.data)
+		case REVENUE:
+			result = service.RevenueLogic(val.data)
+		}
+		if result.Message != OperationSuccessful {
+			t.Errorf("Row %v, Operation %v, actual message: %v, expected: %v", i+1, val.operation, result.Message, OperationSuccessful)
+		}
+		if balance := service.GetUserBalanceLogic("20", "RUB"); balance.Data != expection[i] {
+			t.Errorf("Row %v, Operation %v, actual balance: %v, expected: %v", i+1, val.operation, balance.Data, expection[i])
+		}
+	}
+
+	checkSummary := func(name string, gross, fee, net money.Money) {
+		summary, err := service.transactionStorage.GetMonthSummary(2023, 3)
+		if err != nil {
+			t.Fatalf("Test fees, can't get summary: %v", err)
+		}
+		for _, s := range summary {
+			if s.Name == name && s.Currency == "RUB" && (s.Gross != gross || s.Fee != fee || s.Net != net) {
+				t.Errorf("Test fees, %v actual gross/fee/net: %v/%v/%v, expected: %v/%v/%v", name, s.Gross, s.Fee, s.Net, gross, fee, net)
+			}
+		}
+	}
+	// 10% of the first order, 5% of the second one falling into the upper tier, fixed fee is capped by the cost
+	checkSummary("Favor 5", money.New(120000, 2), money.New(7000, 2), money.New(113000, 2))
+	checkSummary("Favor 6", money.New(10000, 2), money.New(10000, 2), money.New(0, 2))
+
+	// fee goes back with revenue of the reversed order
+	ops, _ := service.GetOperations(20, 0, "", "").Data.([]reports.Operation)
+	var orderID int
+	for _, op := range ops {
+		if op.Type == "out" && op.Sum == money.New(20000, 2) {
+			orderID = op.ID
+		}
+	}
+	if result := service.ReverseLogic([]byte(fmt.Sprintf(`{"transaction_id": %d, "reason": "mistaken order"}`, orderID))); result.Message != OperationSuccessful {
+		t.Errorf("Test fees, actual message: %v, expected: %v", result.Message, OperationSuccessful)
+	}
+	checkSummary("Favor 5", money.New(100000, 2), money.New(5000, 2), money.New(95000, 2))
+
+	if result := service.DeleteFeeScheduleLogic("6", "RUB"); result.Message != OperationSuccessful {
+		t.Errorf("Test fees, actual message: %v, expected: %v", result.Message, OperationSuccessful)
+	}
+	if result := service.DeleteFeeScheduleLogic("6", "RUB"); result.Message != ScheduleNotFound {
+		t.Errorf("Test fees, actual message: %v, expected: %v", result.Message, ScheduleNotFound)
+	}
+}
+
+func TestOrders(t *testing.T) {
+
+	if result := service.AddBalanceLogic([]byte(`{"user_id": 21, "balance": 500, "currency": "RUB"}`)); result.Message != OperationSuccessful {
+		t.Fatalf("Test orders, actual message: %v, expected: %v", result.Message, OperationSuccessful)
+	}
+
+	input := []struct {
+		operation Operation
+		data      string
+		message   string
+		balance   money.Money
+		reserved  money.Money
+	}{
+		// total cost of lines exceeds the balance, none of them is reserved
+		{RESERVE, `{"user_id": 21, "order_id": 27, "currency": "RUB", "lines": [{"service_id": 1, "cost": 200}, {"service_id": 2, "cost": 400}]}`,
+			InsufficientFunds, money.New(50000, 2), money.New(0, 2)},
+		{RESERVE, `{"user_id": 21, "order_id": 27, "currency": "RUB", "lines": []}`, EmptyOrder, money.New(50000, 2), money.New(0, 2)},
+		{RESERVE, `{"user_id": 21, "order_id": 27, "currency": "RUB", "lines": [{"service_id": 1, "cost": 200}, {"service_id": 1, "cost": 100}]}`,
+			DuplicateOrderLine, money.New(50000, 2), money.New(0, 2)},
+		{RESERVE, `{"user_id": 21, "order_id": 27, "currency": "RUB", "lines": [{"service_id": 1, "cost": 200}, {"service_id": 2, "cost": 250}]}`,
+			OperationSuccessful, money.New(50000, 2), money.New(45000, 2)},
+		// one line doesn't match its reservation, none of them is recognized
+		{REVENUE, `{"user_id": 21, "order_id": 27, "currency": "RUB", "closed_at": "2023-04-10T10:00:00Z", "lines": [{"service_id": 1, "cost": 200}, {"service_id": 2, "cost": 300}]}`,
+			DifferentCosts, money.New(50000, 2), money.New(45000, 2)},
+		{REVENUE, `{"user_id": 21, "order_id": 27, "currency": "RUB", "closed_at": "2023-04-10T10:00:00Z", "lines": [{"service_id": 1, "cost": 200}, {"service_id": 2, "cost": 250}]}`,
+			OperationSuccessful, money.New(5000, 2), money.New(0, 2)},
+		{REVENUE, `{"user_id": 21, "order_id": 27, "currency": "RUB", "closed_at": "2023-04-10T10:00:00Z", "lines": [{"service_id": 1, "cost": 200}]}`,
+			AlreadyClosedTransaction, money.New(5000, 2), money.New(0, 2)},
+	}
+
+	for i, val := range input {
+		var result *Response
+		switch val.operation {
+		case RESERVE:
+			result = service.ReserveOrderLogic([]byte(val.data))
+		case REVENUE:
+			result = service.RevenueOrderLogic([]byte(val.data))
+		}
+		if result.Message != val.message {
+			t.Errorf("Row %v, Operation %v, actual message: %v, expected: %v", i+1, val.operation, result.Message, val.message)
+		}
+		if balance := service.GetUserBalanceLogic("21", "RUB"); balance.Data != (Balance{Value: val.balance, Currency: "RUB"}) {
+			t.Errorf("Row %v, Operation %v, actual balance: %v, expected: %v", i+1, val.operation, balance.Data, val.balance)
+		}
+		reserved, err := service.transactionStorage.GetAmountOfReservedCash(21, "RUB")
+		if err != nil {
+			t.Fatalf("Row %v, can't get reserved cash: %v", i+1, err)
+		}
+		if reserved != val.reserved {
+			t.Errorf("Row %v, Operation %v, actual reserved: %v, expected: %v", i+1, val.operation, reserved, val.reserved)
+		}
+	}
+}
+
+func TestPayouts(t *testing.T) {
+
+	if result := service.SetFeeScheduleLogic([]byte(`{"service_id": 7, "currency": "RUB", "kind": "percent", "percent": "10"}`)); result.Message != OperationSuccessful {
+		t.Fatalf("Test payouts, actual message: %v, expected: %v", result.Message, OperationSuccessful)
+	}
+
+	input := []struct {
+		operation Operation
+		data      string
+		message   string
+	}{
+		{ADD, `{"user_id": 22, "balance": 1000, "currency": "RUB"}`, OperationSuccessful},
+		{ADD, `{"user_id": 23, "balance": 10, "currency": "RUB"}`, OperationSuccessful},
+		{RESERVE, `{"user_id": 22, "order_id": 28, "service_id": 7, "cost": 300, "currency": "RUB", "payee_id": 99}`, PayeeNotFound},
+		{RESERVE, `{"user_id": 22, "order_id": 28, "service_id": 7, "cost": 300, "currency": "RUB", "payee_id": 22}`, PayeeIsPayer},
+		{RESERVE, `{"user_id": 22, "order_id": 28, "service_id": 7, "cost": 300, "currency": "RUB", "payee_id": 23}`, OperationSuccessful},
+		{REVENUE, `{"user_id": 22, "order_id": 28, "service_id": 7, "cost": 300, "currency": "RUB", "closed_at": "2023-05-10T10:00:00Z"}`, OperationSuccessful},
+		// revenue is paid out, money of refund can't come from it
+		{REFUND, `{"user_id": 22, "order_id": 28, "service_id": 7, "amount": 100}`, OrderHasPayout},
+	}
+	for i, val := range input {
+		var result *Response
+		switch val.operation {
+		case ADD:
+			result = service.AddBalanceLogic([]byte(val.data))
+		case RESERVE:
+			result = service.CashReservationLogic([]byte(val.data))
+		case REVENUE:
+			result = service.RevenueLogic([]byte(val.data))
+		case REFUND:
+			result = service.RefundLogic([]byte(val.data))
+		}
+		if result.Message != val.message {
+			t.Errorf("Row %v, Operation %v, actual message: %v, expected: %v", i+1, val.operation, result.Message, val.message)
+		}
+	}
+
+	// the buyer is charged the cost, the payee gets it net of the platform fee
+	balances := []struct {
+		user    string
+		balance money.Money
+	}{
+		{"22", money.New(70000, 2)},
+		{"23", money.New(28000, 2)},
+	}
+	for _, b := range balances {
+		if balance := service.GetUserBalanceLogic(b.user, "RUB"); balance.Data != (Balance{Value: b.balance, Currency: "RUB"}) {
+			t.Errorf("Test payouts, user %v, actual balance: %v, expected: %v", b.user, balance.Data, b.balance)
+		}
+	}
+
+	// both sides see the movement
+	buyer, _ := service.GetOperations(22, 0, "", "").Data.([]reports.Operation)
+	order := buyer[len(buyer)-1]
+	if order.Type != "out" || order.PayeeID != 23 {
+		t.Errorf("Test payouts, unexpected order operation: %+v", order)
+	}
+	payee, _ := service.GetOperations(23, 0, "", "").Data.([]reports.Operation)
+	payout := payee[len(payee)-1]
+	if payout.Type != "in" || payout.Kind != postgres.KindPayout || payout.Sum != money.New(27000, 2) || payout.LinkedID != order.ID {
+		t.Errorf("Test payouts, unexpected payout operation: %+v", payout)
+	}
+
+	// payout is taken back from the payee before the order is reversed
+	reversal := `{"transaction_id": %d, "reason": "mistaken order"}`
+	if result := service.ReverseLogic([]byte(fmt.Sprintf(reversal, order.ID))); result.Message != OrderHasPayout {
+		t.Errorf("Test payouts, actual message: %v, expected: %v", result.Message, OrderHasPayout)
+	}
+	if result := service.ReverseLogic([]byte(fmt.Sprintf(reversal, payout.ID))); result.Message != OperationSuccessful {
+		t.Errorf("Test payouts, actual message: %v, expected: %v", result.Message, OperationSuccessful)
+	}
+	if result := service.ReverseLogic([]byte(fmt.Sprintf(reversal, order.ID))); result.Message != OperationSuccessful {
+		t.Errorf("Test payouts, actual message: %v, expected: %v", result.Message, OperationSuccessful)
+	}
+	balances[0].balance, balances[1].balance = money.New(100000, 2), money.New(1000, 2)
+	for _, b := range balances {
+		if balance := service.GetUserBalanceLogic(b.user, "RUB"); balance.Data != (Balance{Value: b.balance, Currency: "RUB"}) {
+			t.Errorf("Test payouts, user %v, actual balance after reversals: %v, expected: %v", b.user, balance.Data, b.balance)
+		}
+	}
+
+	// revenue of the order is kept for the payee until it can take money
+	steps := []struct {
+		operation Operation
+		data      string
+		message   string
+	}{
+		{ADD, `{"user_id": 33, "balance": 1, "currency": "RUB"}`, OperationSuccessful},
+		{TRANSFER, `{"from_user_id": 33, "to_user_id": 22, "amount": 1, "currency": "RUB"}`, OperationSuccessful},
+		{RESERVE, `{"user_id": 22, "order_id": 34, "service_id": 7, "cost": 200, "currency": "RUB", "payee_id": 33}`, OperationSuccessful},
+		{STATE, `{"user_id": 33, "state": "closed", "reason": "seller left"}`, AccountInUse},
+		{STATE, `{"user_id": 33, "state": "frozen", "reason": "seller checked"}`, OperationSuccessful},
+		{REVENUE, `{"user_id": 22, "order_id": 34, "service_id": 7, "cost": 200, "currency": "RUB", "closed_at": "2023-05-11T10:00:00Z"}`, AccountFrozen},
+		{STATE, `{"user_id": 33, "state": "active", "reason": "checked"}`, OperationSuccessful},
+		{REVENUE, `{"user_id": 22, "order_id": 34, "service_id": 7, "cost": 200, "currency": "RUB", "closed_at": "2023-05-11T10:00:00Z"}`, OperationSuccessful},
+		{REFUND, `{"user_id": 22, "order_id": 34, "service_id": 7, "amount": 50}`, OrderHasPayout},
+	}
+	for i, val := range steps {
+		var result *Response
+		switch val.operation {
+		case ADD:
+			result = service.AddBalanceLogic([]byte(val.data))
+		case TRANSFER:
+			result = service.TransferLogic([]byte(val.data))
+		case RESERVE:
+			result = service.CashReservationLogic([]byte(val.data))
+		case STATE:
+			result = service.SetAccountStateLogic([]byte(val.data))
+		case REVENUE:
+			result = service.RevenueLogic([]byte(val.data))
+		case REFUND:
+			result = service.RefundLogic([]byte(val.data))
+		}
+		if result.Message != val.message {
+			t.Errorf("Step %v, Operation %v, actual message: %v, expected: %v", i+1, val.operation, result.Message, val.message)
+		}
+	}
+	balances = []struct {
+		user    string
+		balance money.Money
+	}{
+		{"22", money.New(80100, 2)},
+		{"33", money.New(18000, 2)},
+	}
+	for _, b := range balances {
+		if balance := service.GetUserBalanceLogic(b.user, "RUB"); balance.Data != (Balance{Value: b.balance, Currency: "RUB"}) {
+			t.Errorf("Test payouts, user %v, actual balance after frozen payee: %v, expected: %v", b.user, balance.Data, b.balance)
+		}
+	}
+	if ops, _ := service.GetOperations(33, 0, "", "").Data.([]reports.Operation); len(ops) != 3 || ops[2].Kind != postgres.KindPayout {
+		t.Errorf("Test payouts, unexpected operations of payee: %+v", ops)
+	}
+}
+
+func TestPricing(t *testing.T) {
+
+	prices := []struct {
+		data    string
+		message string
+	}{
+		{`{"service_id": 8, "currency": "RUB", "price": "50", "effective_from": "2020-01-01T00:00:00Z"}`, OperationSuccessful},
+		{`{"service_id": 8, "currency": "RUB", "price": "40", "effective_from": "2020-01-01T00:00:00Z"}`, PriceExists},
+		// not in effect yet
+		{`{"service_id": 8, "currency": "RUB", "price": "70", "effective_from": "2999-01-01T00:00:00Z"}`, OperationSuccessful},
+		{`{"service_id": 8, "currency": "RUB", "price": "-5"}`, InvalidAmount},
+		{`{"service_id": 99, "currency": "RUB", "price": "50"}`, ServiceNotFound},
+	}
+	var priceID int
+	for i, p := range prices {
+		result := service.CreatePriceLogic([]byte(p.data))
+		if result.Message != p.message {
+			t.Errorf("Price %v, actual message: %v, expected: %v", i+1, result.Message, p.message)
+		}
+		if i == 0 {
+			priceID = result.Data.(pricing.Price).ID
+		}
+	}
+	if history, _ := service.GetPricesLogic("8", "RUB").Data.([]pricing.Price); len(history) != 2 {
+		t.Errorf("Test pricing, actual history of prices: %v, expected 2 prices", history)
+	}
+
+	if result := service.AddBalanceLogic([]byte(`{"user_id": 24, "balance": 1000, "currency": "RUB"}`)); result.Message != OperationSuccessful {
+		t.Fatalf("Test pricing, actual message: %v, expected: %v", result.Message, OperationSuccessful)
+	}
+	input := []struct {
+		data    string
+		message string
+	}{
+		{`{"user_id": 24, "order_id": 29, "service_id": 8, "cost": 100, "currency": "RUB", "quantity": 3}`, PriceMismatch},
+		{`{"user_id": 24, "order_id": 29, "service_id": 8, "currency": "RUB", "quantity": -1}`, InvalidQuantity},
+		{`{"user_id": 24, "order_id": 29, "service_id": 8, "currency": "USD", "quantity": 3}`, PriceNotFound},
+		{`{"user_id": 24, "order_id": 29, "service_id": 8, "currency": "RUB", "quantity": 3}`, OperationSuccessful},
+	}
+	var result *Response
+	for i, val := range input {
+		if result = service.CashReservationLogic([]byte(val.data)); result.Message != val.message {
+			t.Errorf("Row %v, actual message: %v, expected: %v", i+1, result.Message, val.message)
+		}
+	}
+	// cost is calculated by the price in effect now
+	expected := ReservedLine{ServiceID: 8, Cost: money.New(15000, 2), Currency: "RUB", Quantity: 3, PriceID: priceID}
+	if result.Data != expected {
+		t.Errorf("Test pricing, actual reservation: %+v, expected: %+v", result.Data, expected)
+	}
+
+	revenue := `{"user_id": 24, "order_id": 29, "service_id": 8, "cost": 150, "currency": "RUB", "closed_at": "2023-06-10T10:00:00Z"}`
+	if result := service.RevenueLogic([]byte(revenue)); result.Message != OperationSuccessful {
+		t.Errorf("Test pricing, actual message: %v, expected: %v", result.Message, OperationSuccessful)
+	}
+	ops, _ := service.GetOperations(24, 0, "", "").Data.([]reports.Operation)
+	order := ops[len(ops)-1]
+	if order.Type != "out" || order.Sum != money.New(15000, 2) || order.PriceID != priceID || order.Quantity != 3 {
+		t.Errorf("Test pricing, unexpected order operation: %+v", order)
+	}
+}
+
+func TestCoupons(t *testing.T) {
+
+	coupons := []struct {
+		data    string
+		message string
+	}{
+		{`{"code": "once10", "kind": "percent", "percent": "10", "service_id": 3, "per_user_limit": 1}`, OperationSuccessful},
+		{`{"code": "FIX30", "kind": "fixed", "fixed": "30", "currency": "RUB"}`, OperationSuccessful},
+		{`{"code": "TWO", "kind": "percent", "percent": "50", "usage_limit": 2}`, OperationSuccessful},
+		{`{"code": "ONLY4", "kind": "percent", "percent": "5", "service_id": 4}`, OperationSuccessful},
+		{`{"code": "ONCE10", "kind": "percent", "percent": "20"}`, CouponExists},
+		{`{"code": "NOCUR", "kind": "fixed", "fixed": "30"}`, InvalidFixedDiscount},
+		{`{"code": "BOGUS", "kind": "bogus", "percent": "5"}`, InvalidCouponKind},
+		{`{"code": "OLD", "kind": "percent", "percent": "5", "expires_at": "2020-01-01T00:00:00Z"}`, CouponExpiry},
+		{`{"code": "NOSERVICE", "kind": "percent", "percent": "5", "service_id": 99}`, ServiceNotFound},
+	}
+	for i, c := range coupons {
+		if result := service.CreateCouponLogic([]byte(c.data)); result.Message != c.message {
+			t.Errorf("Coupon %v, actual message: %v, expected: %v", i+1, result.Message, c.message)
+		}
+	}
+
+	if result := service.AddBalanceLogic([]byte(`{"user_id": 25, "balance": 1000, "currency": "RUB"}`)); result.Message != OperationSuccessful {
+		t.Fatalf("Test coupons, actual message: %v, expected: %v", result.Message, OperationSuccessful)
+	}
+	input := []struct {
+		operation Operation
+		data      string
+		message   string
+	}{
+		{RESERVE, `{"user_id": 25, "order_id": 30, "service_id": 3, "cost": 100, "currency": "RUB", "coupon": "once10"}`, OperationSuccessful},
+		{RESERVE, `{"user_id": 25, "order_id": 31, "service_id": 3, "cost": 100, "currency": "RUB", "coupon": "ONCE10"}`, CouponUserLimit},
+		{RESERVE, `{"user_id": 25, "order_id": 31, "service_id": 3, "cost": 100, "currency": "RUB", "coupon": "NOPE"}`, CouponNotFound},
+		{RESERVE, `{"user_id": 25, "order_id": 31, "service_id": 3, "cost": 100, "currency": "RUB", "coupon": "ONLY4"}`, CouponNotApplicable},
+		{REVENUE, `{"user_id": 25, "order_id": 30, "service_id": 3, "cost": 90, "currency": "RUB", "closed_at": "2023-06-15T10:00:00Z"}`, OperationSuccessful},
+	}
+	for i, val := range input {
+		var result *Response
+		switch val.operation {
+		case RESERVE:
+			result = service.CashReservationLogic([]byte(val.data))
+		case REVENUE:
+			result = service.RevenueLogic([]byte(val.data))
+		}
+		if result.Message != val.message {
+			t.Errorf("Row %v, Operation %v, actual message: %v, expected: %v", i+1, val.operation, result.Message, val.message)
+		}
+	}
+	ops, _ := service.GetOperations(25, 0, "", "").Data.([]reports.Operation)
+	if order := ops[len(ops)-1]; order.Sum != money.New(9000, 2) || order.CouponID == 0 || order.Discount == nil || *order.Discount != money.New(1000, 2) {
+		t.Errorf("Test coupons, unexpected order operation: %+v", order)
+	}
+
+	// fixed discount is taken off the lines in turn
+	result := service.ReserveOrderLogic([]byte(`{"user_id": 25, "order_id": 32, "currency": "RUB", "coupon": "FIX30", "lines": [{"service_id": 3, "cost": 20}, {"service_id": 4, "cost": 50}]}`))
+	lines, _ := result.Data.([]ReservedLine)
+	if result.Message != OperationSuccessful || len(lines) != 2 {
+		t.Fatalf("Test coupons, actual message: %v, lines: %+v", result.Message, lines)
+	}
+	expected := []struct{ cost, discount money.Money }{
+		{money.New(0, 2), money.New(2000, 2)},
+		{money.New(4000, 2), money.New(1000, 2)},
+	}
+	for i, e := range expected {
+		if lines[i].Cost != e.cost || lines[i].Discount == nil || *lines[i].Discount != e.discount {
+			t.Errorf("Test coupons, line %v, actual cost/discount: %v/%v, expected: %v/%v", i+1, lines[i].Cost, lines[i].Discount, e.cost, e.discount)
+		}
+	}
+
+	// limited coupon isn't overused by concurrent reservations
+	const workers = 5
+	var wg sync.WaitGroup
+	results := make([]*Response, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			data := fmt.Sprintf(`{"user_id": 25, "order_id": %d, "service_id": 3, "cost": 10, "currency": "RUB", "coupon": "TWO"}`, 33+i)
+			results[i] = service.CashReservationLogic([]byte(data))
+		}(i)
+	}
+	wg.Wait()
+	var redeemed, exhausted int
+	for _, result := range results {
+		switch result.Message {
+		case OperationSuccessful:
+			redeemed++
+		case CouponExhausted:
+			exhausted++
+		}
+	}
+	if redeemed != 2 || exhausted != workers-2 {
+		t.Errorf("Test coupons, actual redeemed/exhausted: %v/%v, expected: %v/%v", redeemed, exhausted, 2, workers-2)
+	}
+	all, _ := service.GetCouponsLogic().Data.([]coupon.Coupon)
+	for _, c := range all {
+		if c.Code == "TWO" && c.Used != 2 {
+			t.Errorf("Test coupons, actual redemptions: %v, expected: %v", c.Used, 2)
+		}
+	}
+
+	// discounted costs are charged and reserved
+	if balance := service.GetUserBalanceLogic("25", "RUB"); balance.Data != (Balance{Value: money.New(91000, 2), Currency: "RUB"}) {
+		t.Errorf("Test coupons, actual balance: %v, expected: %v", balance.Data, money.New(91000, 2))
+	}
+	reserved, err := service.transactionStorage.GetAmountOfReservedCash(25, "RUB")
+	if err != nil {
+		t.Fatalf("Test coupons, can't get reserved cash: %v", err)
+	}
+	if reserved != money.New(5000, 2) {
+		t.Errorf("Test coupons, actual reserved: %v, expected: %v", reserved, money.New(5000, 2))
+	}
+}
+
+func TestVouchers(t *testing.T) {
+
+	batches := []struct {
+		data    string
+		message string
+	}{
+		{`{"count": 0, "value": "500", "currency": "RUB", "expires_at": "2999-01-01T00:00:00Z"}`, InvalidVoucherCount},
+		{`{"count": 3, "value": "0", "currency": "RUB", "expires_at": "2999-01-01T00:00:00Z"}`, InvalidAmount},
+		{`{"count": 3, "value": "500", "currency": "RUB", "expires_at": "2020-01-01T00:00:00Z"}`, VoucherExpiry},
+		{`{"count": 3, "value": "500", "currency": "RUB", "expires_at": "2999-01-01T00:00:00Z"}`, OperationSuccessful},
+	}
+	var result *Response
+	for i, b := range batches {
+		if result = service.CreateVoucherBatchLogic([]byte(b.data)); result.Message != b.message {
+			t.Errorf("Batch %v, actual message: %v, expected: %v", i+1, result.Message, b.message)
+		}
+	}
+	batch, _ := result.Data.(voucher.Batch)
+	if len(batch.Vouchers) != 3 {
+		t.Fatalf("Test vouchers, actual vouchers: %v, expected: %v", len(batch.Vouchers), 3)
+	}
+	codes := []string{batch.Vouchers[0].Code, batch.Vouchers[1].Code}
+
+	redemptions := []struct {
+		data    string
+		message string
+	}{
+		{fmt.Sprintf(`{"user_id": 26, "code": "%s"}`, strings.ToLower(codes[0])), OperationSuccessful},
+		{fmt.Sprintf(`{"user_id": 27, "code": "%s"}`, codes[0]), VoucherRedeemed},
+		{`{"user_id": 27, "code": "NO-SUCH-CODE"}`, VoucherNotFound},
+	}
+	for i, r := range redemptions {
+		if result := service.RedeemVoucherLogic([]byte(r.data)); result.Message != r.message {
+			t.Errorf("Redemption %v, actual message: %v, expected: %v", i+1, result.Message, r.message)
+		}
+	}
+
+	// voucher is redeemed once by concurrent redemptions
+	const workers = 5
+	var wg sync.WaitGroup
+	results := make([]*Response, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = service.RedeemVoucherLogic([]byte(fmt.Sprintf(`{"user_id": 27, "code": "%s"}`, codes[1])))
+		}(i)
+	}
+	wg.Wait()
+	var redeemed int
+	for i, result := range results {
+		switch result.Message {
+		case OperationSuccessful:
+			redeemed++
+		case VoucherRedeemed:
+		default:
+			t.Errorf("Redemption %v, actual message: %v", i+1, result.Message)
+		}
+	}
+	if redeemed != 1 {
+		t.Errorf("Test vouchers, actual redemptions: %v, expected: %v", redeemed, 1)
+	}
+
+	for _, id := range []string{"26", "27"} {
+		if balance := service.GetUserBalanceLogic(id, "RUB"); balance.Data != (Balance{Value: money.New(50000, 2), Currency: "RUB"}) {
+			t.Errorf("Test vouchers, user %v, actual balance: %v, expected: %v", id, balance.Data, money.New(50000, 2))
+		}
+	}
+
+	// top-up refers to the voucher and the voucher to the top-up
+	ops, _ := service.GetOperations(26, 0, "", "").Data.([]reports.Operation)
+	if len(ops) != 1 || ops[0].Kind != postgres.KindVoucher || ops[0].Comment != fmt.Sprintf("voucher %d", batch.Vouchers[0].ID) {
+		t.Fatalf("Test vouchers, unexpected operations: %+v", ops)
+	}
+	vouchers, _ := service.GetVouchersLogic(strconv.Itoa(batch.ID)).Data.([]voucher.Voucher)
+	if len(vouchers) != 3 || vouchers[0].RedeemedBy != 26 || vouchers[0].TransactionID != ops[0].ID || vouchers[2].RedeemedAt != nil {
+		t.Errorf("Test vouchers, unexpected vouchers: %+v", vouchers)
+	}
+
+	now := time.Now().UTC()
+	summary, err := service.transactionStorage.GetUsersMonthSummary(now.Year(), int(now.Month()), "", "")
+	if err != nil {
+		t.Fatalf("Test vouchers, can't get summary of users: %v", err)
+	}
+	for _, s := range summary {
+		if s.UserID == 26 && (s.TopUps != money.New(50000, 2) || s.Vouchers != money.New(50000, 2)) {
+			t.Errorf("Test vouchers, actual top-ups/vouchers: %v/%v, expected: %v/%v", s.TopUps, s.Vouchers, money.New(50000, 2), money.New(50000, 2))
+		}
+	}
+}
+
+func TestTopUps(t *testing.T) {
+
+	// callbacks signed with the empty secret could be forged
+	if _, err := payment.NewProvider(payment.MockName, "", true); err != payment.ErrEmptySecret {
+		t.Errorf("Test top-ups, actual error of provider without secret: %v, expected: %v", err, payment.ErrEmptySecret)
+	}
+	// the mock provider credits balance without payment
+	if _, err := payment.NewProvider(payment.MockName, "secret", false); err != payment.ErrMockNotAllowed {
+		t.Errorf("Test top-ups, actual error of mock provider not allowed: %v, expected: %v", err, payment.ErrMockNotAllowed)
+	}
+	// without the provider nothing can be paid or confirmed
+	disabled := &Service{}
+	if resp := disabled.CreateTopUpLogic([]byte(`{"user_id": 22, "amount": "100", "currency": "RUB"}`)); resp.Message != PaymentsDisabled {
+		t.Errorf("Test top-ups, actual message without provider: %s, expected: %s", resp.Message, PaymentsDisabled)
+	}
+	if resp := disabled.PaymentCallbackLogic([]byte(`{"payment_id": "mock_unknown", "status": "succeeded"}`), ""); resp.Message != PaymentsDisabled {
+		t.Errorf("Test top-ups, actual message of callback without provider: %s, expected: %s", resp.Message, PaymentsDisabled)
+	}
+
+	topUps := []struct {
+		data    string
+		message string
+	}{
+		{`{"user_id": 28, "amount": "0", "currency": "RUB"}`, InvalidAmount},
+		{`{"user_id": 28, "amount": "300", "currency": "XXX"}`, InvalidCurrency},
+		{`{"user_id": 28, "amount": "300", "currency": "RUB"}`, OperationSuccessful},
+		{`{"user_id": 28, "amount": "100", "currency": "RUB"}`, OperationSuccessful},
+	}
+	created := []payment.TopUp{}
+	for i, tu := range topUps {
+		result := service.CreateTopUpLogic([]byte(tu.data))
+		if result.Message != tu.message {
+			t.Errorf("Top-up %v, actual message: %v, expected: %v", i+1, result.Message, tu.message)
+		}
+		if tp, ok := result.Data.(payment.TopUp); ok {
+			created = append(created, tp)
+		}
+	}
+	if len(created) != 2 || created[0].Status != payment.StatusPending || created[0].PaymentID == "" {
+		t.Fatalf("Test top-ups, unexpected top-ups: %+v", created)
+	}
+	if balance := service.GetUserBalanceLogic("28", "RUB"); balance.Message != UserNotFound {
+		t.Errorf("Test top-ups, balance is credited before the payment: %v", balance.Data)
+	}
+
+	// callback of somebody else is rejected
+	body := []byte(fmt.Sprintf(`{"payment_id": "%s", "status": "succeeded"}`, created[0].PaymentID))
+	if result := service.PaymentCallbackLogic(body, "forged"); result.Message != InvalidSignature {
+		t.Errorf("Test top-ups, actual message: %v, expected: %v", result.Message, InvalidSignature)
+	}
+
+	callbacks := []struct {
+		paymentID string
+		status    string
+		message   string
+	}{
+		{created[0].PaymentID, payment.StatusSucceeded, OperationSuccessful},
+		{created[0].PaymentID, payment.StatusSucceeded, OperationSuccessful}, // repeated callback changes nothing
+		{created[0].PaymentID, payment.StatusFailed, TopUpStateConflict},
+		{created[1].PaymentID, payment.StatusFailed, OperationSuccessful},
+		{created[1].PaymentID, payment.StatusPending, InvalidPaymentStatus},
+		{"mock_unknown", payment.StatusSucceeded, TopUpNotFound},
+	}
+	for i, c := range callbacks {
+		data := fmt.Sprintf(`{"payment_id": "%s", "status": "%s"}`, c.paymentID, c.status)
+		if result := service.SimulatePaymentLogic([]byte(data)); result.Message != c.message {
+			t.Errorf("Callback %v, actual message: %v, expected: %v", i+1, result.Message, c.message)
+		}
+	}
+
+	if balance := service.GetUserBalanceLogic("28", "RUB"); balance.Data != (Balance{Value: money.New(30000, 2), Currency: "RUB"}) {
+		t.Errorf("Test top-ups, actual balance: %v, expected: %v", balance.Data, money.New(30000, 2))
+	}
+
+	ops, _ := service.GetOperations(28, 0, "", "").Data.([]reports.Operation)
+	if len(ops) != 1 || ops[0].Kind != postgres.KindPayment || ops[0].Comment != "payment "+created[0].PaymentID {
+		t.Fatalf("Test top-ups, unexpected operations: %+v", ops)
+	}
+
+	statuses := []struct {
+		status string
+		count  int
+	}{
+		{payment.StatusPending, 0},
+		{payment.StatusSucceeded, 1},
+		{payment.StatusFailed, 1},
+	}
+	for _, s := range statuses {
+		result := service.GetTopUpsLogic("28", s.status)
+		list, _ := result.Data.([]payment.TopUp)
+		if len(list) != s.count {
+			t.Errorf("Test top-ups, status %v, actual top-ups: %v, expected: %v", s.status, len(list), s.count)
+		}
+		if s.status == payment.StatusSucceeded && len(list) == 1 && list[0].TransactionID != ops[0].ID {
+			t.Errorf("Test top-ups, actual transaction: %v, expected: %v", list[0].TransactionID, ops[0].ID)
+		}
+	}
+	if result := service.GetTopUpsLogic("28", "unknown"); result.Message != InvalidTopUpStatus {
+		t.Errorf("Test top-ups, actual message: %v, expected: %v", result.Message, InvalidTopUpStatus)
+	}
+
+	// id of payment may be longer than comment of transaction
+	long := payment.TopUp{UserID: 28, Amount: money.New(1000, 2), Currency: "RUB", Provider: payment.MockName,
+		PaymentID: "mock_" + strings.Repeat("0123456789", 9) + "abcde", CreatedAt: time.Now().UTC()}
+	if err := service.topUpStorage.CreateTopUp(&long); err != nil {
+		t.Fatalf("Test top-ups, can't create top-up: %v", err)
+	}
+	if result := service.SimulatePaymentLogic([]byte(fmt.Sprintf(`{"payment_id": "%s", "status": "succeeded"}`, long.PaymentID))); result.Message != OperationSuccessful {
+		t.Errorf("Test top-ups, actual message of long payment id: %v, expected: %v", result.Message, OperationSuccessful)
+	}
+	ops, _ = service.GetOperations(28, 0, "", "").Data.([]reports.Operation)
+	if len(ops) != 2 || ops[1].Comment != long.Comment() || len(ops[1].Comment) != 50 {
+		t.Errorf("Test top-ups, unexpected operations after long payment id: %+v", ops)
+	}
+}
+
+func TestWithdrawals(t *testing.T) {
+
+	if result := service.AddBalanceLogic([]byte(`{"user_id": 29, "balance": 1000, "currency": "RUB"}`)); result.Message != OperationSuccessful {
+		t.Fatalf("Test withdrawals, actual message: %v, expected: %v", result.Message, OperationSuccessful)
+	}
+
+	requests := []struct {
+		data    string
+		message string
+	}{
+		{`{"user_id": 29, "amount": "0", "currency": "RUB", "requested_by": "alice"}`, InvalidAmount},
+		{`{"user_id": 29, "amount": "600", "currency": "RUB"}`, ActorRequired},
+		{`{"user_id": 29, "amount": "600", "currency": "RUB", "requested_by": "  "}`, ActorRequired},
+		{`{"user_id": 29, "amount": "5000", "currency": "RUB", "requested_by": "alice"}`, InsufficientFunds},
+		{`{"user_id": 29, "amount": "600", "currency": "RUB", "requested_by": " Alice"}`, OperationSuccessful},
+		{`{"user_id": 29, "amount": "300", "currency": "RUB", "requested_by": "alice"}`, OperationSuccessful},
+		{`{"user_id": 29, "amount": "200", "currency": "RUB", "requested_by": "alice"}`, InsufficientFunds}, // 900 is held
+	}
+	created := []withdrawal.Withdrawal{}
+	for i, r := range requests {
+		result := service.RequestWithdrawalLogic([]byte(r.data))
+		if result.Message != r.message {
+			t.Errorf("Request %v, actual message: %v, expected: %v", i+1, result.Message, r.message)
+		}
+		if w, ok := result.Data.(withdrawal.Withdrawal); ok {
+			created = append(created, w)
+		}
+	}
+	if len(created) != 2 {
+		t.Fatalf("Test withdrawals, actual withdrawals: %v, expected: %v", len(created), 2)
+	}
+	if reserved, _ := service.transactionStorage.GetAmountOfReservedCash(29, "RUB"); reserved != money.New(90000, 2) {
+		t.Errorf("Test withdrawals, actual reserved cash: %v, expected: %v", reserved, money.New(90000, 2))
+	}
+
+	decisions := []struct {
+		status  string
+		data    string
+		message string
+	}{
+		{withdrawal.StatusApproved, fmt.Sprintf(`{"id": %d, "actor": "alice"}`, created[0].ID), SameActor},
+		{withdrawal.StatusApproved, fmt.Sprintf(`{"id": %d, "actor": "ALICE "}`, created[0].ID), SameActor},
+		{withdrawal.StatusApproved, fmt.Sprintf(`{"id": %d}`, created[0].ID), ActorRequired},
+		{withdrawal.StatusApproved, fmt.Sprintf(`{"id": %d, "actor": "bob"}`, created[0].ID), OperationSuccessful},
+		{withdrawal.StatusRejected, fmt.Sprintf(`{"id": %d, "actor": "carol", "reason": "too late"}`, created[0].ID), WithdrawalDecided},
+		{withdrawal.StatusRejected, fmt.Sprintf(`{"id": %d, "actor": "bob"}`, created[1].ID), ReasonRequired},
+		{withdrawal.StatusRejected, fmt.Sprintf(`{"id": %d, "actor": "bob", "reason": "unknown card"}`, created[1].ID), OperationSuccessful},
+		{withdrawal.StatusApproved, `{"id": 999999, "actor": "bob"}`, WithdrawalNotFound},
+	}
+	for i, d := range decisions {
+		if result := service.DecideWithdrawalLogic([]byte(d.data), d.status); result.Message != d.message {
+			t.Errorf("Decision %v, actual message: %v, expected: %v", i+1, result.Message, d.message)
+		}
+	}
+
+	// approved amount is debited, rejected one is released
+	if balance := service.GetUserBalanceLogic("29", "RUB"); balance.Data != (Balance{Value: money.New(40000, 2), Currency: "RUB"}) {
+		t.Errorf("Test withdrawals, actual balance: %v, expected: %v", balance.Data, money.New(40000, 2))
+	}
+	if reserved, _ := service.transactionStorage.GetAmountOfReservedCash(29, "RUB"); !reserved.IsZero() {
+		t.Errorf("Test withdrawals, actual reserved cash: %v, expected: none", reserved)
+	}
+
+	statuses := []struct {
+		status string
+		actors []string
+	}{
+		{withdrawal.StatusApproved, []string{"alice", "bob"}},
+		{withdrawal.StatusRejected, []string{"alice", "bob"}},
+	}
+	for _, s := range statuses {
+		list, _ := service.GetWithdrawalsLogic("29", s.status).Data.([]withdrawal.Withdrawal)
+		if len(list) != 1 || len(list[0].Events) != len(s.actors) {
+			t.Fatalf("Test withdrawals, status %v, unexpected withdrawals: %+v", s.status, list)
+		}
+		for i, e := range list[0].Events {
+			if e.Actor != s.actors[i] || e.At.IsZero() {
+				t.Errorf("Test withdrawals, status %v, unexpected event: %+v", s.status, e)
+			}
+		}
+	}
+	// money of the approved one is paid out already
+	approved, _ := service.GetWithdrawalsLogic("29", withdrawal.StatusApproved).Data.([]withdrawal.Withdrawal)
+	if result := service.ReverseLogic([]byte(fmt.Sprintf(`{"transaction_id": %d, "reason": "mistaken withdrawal"}`, approved[0].TransactionID))); result.Message != WithdrawalReversal {
+		t.Errorf("Test withdrawals, actual message of reversal: %v, expected: %v", result.Message, WithdrawalReversal)
+	}
+	if result := service.GetWithdrawalsLogic("29", "bogus"); result.Message != InvalidWithdrawalStatus {
+		t.Errorf("Test withdrawals, actual message: %v, expected: %v", result.Message, InvalidWithdrawalStatus)
+	}
+
+	report, _ := service.ReconcileLogic(false).Data.(reconciliation.Report)
+	for _, m := range report.Mismatches {
+		if m.UserID == 29 {
+			t.Errorf("Test withdrawals, unexpected mismatch: %+v", m)
+		}
+	}
+}
+
+func TestAdjustments(t *testing.T) {
+
+	requests := []struct {
+		data    string
+		message string
+		status  string
+	}{
+		{`{"user_id": 30, "direction": "credit", "amount": "100", "currency": "RUB", "reason_code": "goodwill", "requested_by": "alice"}`, OperationSuccessful, adjustment.StatusApplied},
+		{`{"user_id": 30, "direction": "debit", "amount": "500", "currency": "RUB", "reason_code": "correction", "requested_by": "alice"}`, InsufficientFunds, ""},
+		{`{"user_id": 30, "direction": "refund", "amount": "100", "currency": "RUB", "reason_code": "goodwill", "requested_by": "alice"}`, InvalidAdjustmentDirection, ""},
+		{`{"user_id": 30, "direction": "credit", "amount": "100", "currency": "RUB", "reason_code": "bonus", "requested_by": "alice"}`, InvalidReasonCode, ""},
+		{`{"user_id": 30, "direction": "credit", "amount": "100", "currency": "RUB", "reason_code": "goodwill"}`, ActorRequired, ""},
+		{`{"user_id": 30, "direction": "credit", "amount": "0", "currency": "RUB", "reason_code": "goodwill", "requested_by": "alice"}`, InvalidAmount, ""},
+		{`{"user_id": 30, "direction": "credit", "amount": "5000", "currency": "RUB", "reason_code": "migration", "requested_by": "alice"}`, OperationSuccessful, adjustment.StatusPending},
+		{`{"user_id": 30, "direction": "debit", "amount": "2000", "currency": "RUB", "reason_code": "chargeback", "requested_by": "alice"}`, OperationSuccessful, adjustment.StatusPending},
+		{`{"user_id": 30, "direction": "credit", "amount": "3000", "currency": "RUB", "reason_code": "correction", "requested_by": "alice"}`, OperationSuccessful, adjustment.StatusPending},
+	}
+	created := []adjustment.Adjustment{}
+	for i, r := range requests {
+		result := service.RequestAdjustmentLogic([]byte(r.data))
+		if result.Message != r.message {
+			t.Errorf("Request %v, actual message: %v, expected: %v", i+1, result.Message, r.message)
+		}
+		if a, ok := result.Data.(adjustment.Adjustment); ok {
+			if a.Status != r.status {
+				t.Errorf("Request %v, actual status: %v, expected: %v", i+1, a.Status, r.status)
+			}
+			created = append(created, a)
+		}
+	}
+	if len(created) != 4 {
+		t.Fatalf("Test adjustments, actual adjustments: %v, expected: %v", len(created), 4)
+	}
+	// pending adjustments don't change balance
+	if balance := service.GetUserBalanceLogic("30", "RUB"); balance.Data != (Balance{Value: money.New(10000, 2), Currency: "RUB"}) {
+		t.Errorf("Test adjustments, actual balance: %v, expected: %v", balance.Data, money.New(10000, 2))
+	}
+
+	decisions := []struct {
+		status  string
+		data    string
+		message string
+	}{
+		{adjustment.StatusApplied, fmt.Sprintf(`{"id": %d, "actor": "alice"}`, created[1].ID), SameActor},
+		{adjustment.StatusApplied, fmt.Sprintf(`{"id": %d, "actor": " Alice"}`, created[1].ID), SameActor},
+		{adjustment.StatusApplied, fmt.Sprintf(`{"id": %d}`, created[1].ID), ActorRequired},
+		{adjustment.StatusApplied, fmt.Sprintf(`{"id": %d, "actor": "bob"}`, created[1].ID), OperationSuccessful},
+		{adjustment.StatusRejected, fmt.Sprintf(`{"id": %d, "actor": "bob"}`, created[1].ID), AdjustmentDecided},
+		{adjustment.StatusRejected, fmt.Sprintf(`{"id": %d, "actor": "bob"}`, created[2].ID), OperationSuccessful},
+		{adjustment.StatusApplied, fmt.Sprintf(`{"id": %d, "actor": "bob"}`, created[0].ID), AdjustmentDecided},
+		{adjustment.StatusApplied, `{"id": 999999, "actor": "bob"}`, AdjustmentNotFound},
+	}
+	for i, d := range decisions {
+		if result := service.DecideAdjustmentLogic([]byte(d.data), d.status); result.Message != d.message {
+			t.Errorf("Decision %v, actual message: %v, expected: %v", i+1, result.Message, d.message)
+		}
+	}
+
+	// nobody approved the last one in time
+	if n, err := service.adjustmentStorage.Expire(time.Now().UTC().Add(73 * time.Hour)); err != nil || n != 1 {
+		t.Errorf("Test adjustments, actual expired: %v, %v, expected: %v", n, err, 1)
+	}
+	if result := service.DecideAdjustmentLogic([]byte(fmt.Sprintf(`{"id": %d, "actor": "bob"}`, created[3].ID)), adjustment.StatusApplied); result.Message != AdjustmentExpired {
+		t.Errorf("Test adjustments, actual message: %v, expected: %v", result.Message, AdjustmentExpired)
+	}
+	// applied adjustment is undone by the opposite one, approved the same way
+	if result := service.ReverseLogic([]byte(fmt.Sprintf(`{"transaction_id": %d, "reason": "mistaken adjustment"}`, created[0].TransactionID))); result.Message != AdjustmentReversal {
+		t.Errorf("Test adjustments, actual message of reversal: %v, expected: %v", result.Message, AdjustmentReversal)
+	}
+
+	if result := service.RequestAdjustmentLogic([]byte(`{"user_id": 30, "direction": "debit", "amount": "50", "currency": "RUB", "reason_code": "fraud", "requested_by": "alice"}`)); result.Message != OperationSuccessful {
+		t.Errorf("Test adjustments, actual message: %v, expected: %v", result.Message, OperationSuccessful)
+	}
+	if balance := service.GetUserBalanceLogic("30", "RUB"); balance.Data != (Balance{Value: money.New(505000, 2), Currency: "RUB"}) {
+		t.Errorf("Test adjustments, actual balance: %v, expected: %v", balance.Data, money.New(505000, 2))
+	}
+
+	statuses := []struct {
+		status string
+		count  int
+	}{
+		{adjustment.StatusPending, 0},
+		{adjustment.StatusApplied, 3},
+		{adjustment.StatusRejected, 1},
+		{adjustment.StatusExpired, 1},
+		{"", 5},
+	}
+	for _, s := range statuses {
+		list, _ := service.GetAdjustmentsLogic("30", s.status).Data.([]adjustment.Adjustment)
+		if len(list) != s.count {
+			t.Errorf("Test adjustments, status %v, actual adjustments: %v, expected: %v", s.status, len(list), s.count)
+		}
+	}
+	if result := service.GetAdjustmentsLogic("30", "bogus"); result.Message != InvalidAdjustmentStatus {
+		t.Errorf("Test adjustments, actual message: %v, expected: %v", result.Message, InvalidAdjustmentStatus)
+	}
+
+	// thresholds are set by currency, adjustment in currency without threshold always waits for approval
+	currencies := []struct {
+		data   string
+		status string
+	}{
+		{`{"user_id": 30, "direction": "credit", "amount": "1000", "currency": "JPY", "reason_code": "goodwill", "requested_by": "alice"}`, adjustment.StatusApplied},
+		{`{"user_id": 30, "direction": "credit", "amount": "1000", "currency": "USD", "reason_code": "goodwill", "requested_by": "alice"}`, adjustment.StatusPending},
+		{`{"user_id": 30, "direction": "credit", "amount": "1", "currency": "GBP", "reason_code": "goodwill", "requested_by": "alice"}`, adjustment.StatusPending},
+	}
+	for i, c := range currencies {
+		result := service.RequestAdjustmentLogic([]byte(c.data))
+		a, _ := result.Data.(adjustment.Adjustment)
+		if result.Message != OperationSuccessful || a.Status != c.status {
+			t.Errorf("Currency %v, actual message: %v, status: %v, expected status: %v", i+1, result.Message, a.Status, c.status)
+		}
+	}
+	if result := service.ExpireAdjustmentsLogic(); result.Data != (adjustment.Expiry{Adjustments: 0}) {
+		t.Errorf("Test adjustments, actual expiry: %+v, expected: none", result.Data)
+	}
+	if n, err := service.adjustmentStorage.Expire(time.Now().UTC().Add(73 * time.Hour)); err != nil || n != 2 {
+		t.Errorf("Test adjustments, actual expired: %v, %v, expected: %v", n, err, 2)
+	}
+
+	report, _ := service.ReconcileLogic(false).Data.(reconciliation.Report)
+	for _, m := range report.Mismatches {
+		if m.UserID == 30 {
+			t.Errorf("Test adjustments, unexpected mismatch: %+v", m)
+		}
+	}
+}
+
+func TestRevenueWithoutCloseTime(t *testing.T) {
+
+	if result := service.AddBalanceLogic([]byte(`{"user_id": 31, "balance": 200, "currency": "RUB"}`)); result.Message != OperationSuccessful {
+		t.Fatalf("Test revenue without close time, actual message: %v, expected: %v", result.Message, OperationSuccessful)
+	}
+	order := []byte(`{"user_id": 31, "order_id": 33, "service_id": 1, "cost": 100, "currency": "RUB"}`)
+	if result := service.CashReservationLogic(order); result.Message != OperationSuccessful {
+		t.Fatalf("Test revenue without close time, actual message: %v, expected: %v", result.Message, OperationSuccessful)
+	}
+	if result := service.RevenueLogic(order); result.Message != OperationSuccessful {
+		t.Fatalf("Test revenue without close time, actual message: %v, expected: %v", result.Message, OperationSuccessful)
+	}
+	if balance := service.GetUserBalanceLogic("31", "RUB"); balance.Data != (Balance{Value: money.New(10000, 2), Currency: "RUB"}) {
+		t.Errorf("Test revenue without close time, actual balance: %v, expected: %v", balance.Data, money.New(10000, 2))
+	}
+
+	// revenue is recognized now
+	now := time.Now().UTC()
+	summary, err := service.transactionStorage.GetMonthSummary(now.Year(), int(now.Month()))
+	if err != nil {
+		t.Fatalf("Test revenue without close time, can't get summary: %v", err)
+	}
+	found := false
+	for _, s := range summary {
+		if s.Name == "Favor 1" && s.Currency == "RUB" {
+			found = true
+			if s.Gross != money.New(10000, 2) || s.Orders != 1 {
+				t.Errorf("Test revenue without close time, actual gross/orders: %v/%v, expected: %v/%v", s.Gross, s.Orders, money.New(10000, 2), 1)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("Test revenue without close time, no revenue of Favor 1 in summary of %v", now.Format("2006-01"))
+	}
+}
+
+func TestReconciliationRepair(t *testing.T) {
+
+	if result := service.AddBalanceLogic([]byte(`{"user_id": 32, "balance": 100, "currency": "RUB"}`)); result.Message != OperationSuccessful {
+		t.Fatalf("Test reconciliation repair, actual message: %v, expected: %v", result.Message, OperationSuccessful)
+	}
+	// stored balance drifts from the history and the journal
+	if _, err := database.DB.Exec("UPDATE wallets SET balance = balance + 2550 WHERE user_id = 32 AND currency = 'RUB'"); err != nil {
+		t.Fatalf("Test reconciliation repair, can't change balance: %v", err)
+	}
+
+	expected := reconciliation.Mismatch{UserID: 32, Currency: "RUB", Balance: money.New(12550, 2), Computed: money.New(10000, 2),
+		Ledger: money.New(10000, 2), Difference: money.New(2550, 2), Transactions: 1}
+	findMismatch := func(repair bool) (reconciliation.Mismatch, bool) {
+		result := service.ReconcileLogic(repair)
+		if result.Error != nil {
+			t.Fatalf("Test reconciliation repair, actual error: %v, expected: %v", result.Error, nil)
+		}
+		report, _ := result.Data.(reconciliation.Report)
+		for _, m := range report.Mismatches {
+			if m.UserID == 32 {
+				return m, true
+			}
+		}
+		return reconciliation.Mismatch{}, false
+	}
+
+	if m, ok := findMismatch(false); !ok || m != expected {
+		t.Errorf("Test reconciliation repair, actual mismatch: %+v, expected: %+v", m, expected)
+	}
+	expected.Repaired = true
+	if m, ok := findMismatch(true); !ok || m != expected {
+		t.Errorf("Test reconciliation repair, actual repaired mismatch: %+v, expected: %+v", m, expected)
+	}
+	// balance, transactions history and ledger agree afterwards
+	if m, ok := findMismatch(false); ok {
+		t.Errorf("Test reconciliation repair, unexpected mismatch after repair: %+v", m)
+	}
+	if balance := service.GetUserBalanceLogic("32", "RUB"); balance.Data != (Balance{Value: money.New(12550, 2), Currency: "RUB"}) {
+		t.Errorf("Test reconciliation repair, actual balance: %v, expected: %v", balance.Data, money.New(12550, 2))
+	}
+	ops, _ := service.GetOperations(32, 0, "", "").Data.([]reports.Operation)
+	if len(ops) != 2 || ops[1].Kind != "adjustment" || ops[1].Type != "in" || ops[1].Sum != money.New(2550, 2) {
+		t.Errorf("Test reconciliation repair, unexpected operations: %+v", ops)
+	}
+}
@@ -0,0 +1,50 @@
+package spending
+
+import (
+	"time"
+
+	"github.com/antsrp/balance_service/internal/money"
+	"github.com/pkg/errors"
+)
+
+const (
+	PeriodDay   = "day"
+	PeriodMonth = "month"
+
+	UnknownPeriod = "Unknown period of limit"
+)
+
+var ErrUnknownPeriod = errors.New(UnknownPeriod)
+
+// Limit caps the amount user can spend on orders in the currency within the calendar day or month (UTC),
+// on all services or on the single one if ServiceID is set
+type Limit struct {
+	ID        int         `json:"id,omitempty"`
+	UserID    int         `json:"user_id"`
+	ServiceID *int        `json:"service_id,omitempty"`
+	Period    string      `json:"period"`
+	Currency  string      `json:"currency"`
+	Amount    money.Money `json:"amount" swaggertype:"string"`
+	Used      money.Money `json:"used" swaggertype:"string"` // reserved and recognized in the current window
+}
+
+// Window returns the calendar period containing the time, in UTC
+func Window(period string, at time.Time) (time.Time, time.Time, error) {
+	at = at.UTC()
+	switch period {
+	case PeriodDay:
+		begin := time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, time.UTC)
+		return begin, begin.AddDate(0, 0, 1), nil
+	case PeriodMonth:
+		begin := time.Date(at.Year(), at.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return begin, begin.AddDate(0, 1, 0), nil
+	}
+	return time.Time{}, time.Time{}, ErrUnknownPeriod
+}
+
+type Storage interface {
+	SetLimit(*Limit) (int, error)
+	GetLimits(userID int) ([]Limit, error)
+	DeleteLimit(id int) error
+	DeleteAllLimits() error
+}
@@ -0,0 +1,32 @@
+package transfer
+
+import (
+	"time"
+
+	"github.com/antsrp/balance_service/internal/money"
+)
+
+// Transfer is a request to move money from the wallet of one user to the wallet of another one.
+// Amount is converted at the rate in effect at the time of transfer if ToCurrency differs from Currency
+type Transfer struct {
+	FromUserID int         `json:"from_user_id"`
+	ToUserID   int         `json:"to_user_id"`
+	Amount     money.Money `json:"amount"`
+	Currency   string      `json:"currency"`
+	ToCurrency string      `json:"to_currency,omitempty"`
+	Comment    string      `json:"comment"`
+	Time       *time.Time  `json:"time,omitempty"`
+}
+
+// Result describes both transactions of the completed transfer
+type Result struct {
+	OutID    int         `json:"out_id"`
+	InID     int         `json:"in_id"`
+	Credited money.Money `json:"credited" swaggertype:"string"`
+	Currency string      `json:"currency"`
+	Rate     string      `json:"rate,omitempty"`
+}
+
+type Storage interface {
+	Transfer(Transfer) (*Result, error)
+}
@@ -1,18 +1,77 @@
 package user
 
-import "time"
+import (
+	"time"
+
+	"github.com/antsrp/balance_service/internal/money"
+)
 
 type User struct {
-	ID      int        `json:"user_id"`
-	Time    *time.Time `json:"time"`
-	Comment string     `json:"comment,omitempty"`
-	Balance uint64     `json:"balance"`
+	ID         int         `json:"user_id"`
+	Time       *time.Time  `json:"time"`
+	Comment    string      `json:"comment,omitempty"`
+	Balance    money.Money `json:"balance"`
+	Currency   string      `json:"currency"`
+	ToCurrency string      `json:"to_currency,omitempty"` // currency of wallet the top-up is converted to
+}
+
+// Wallet is a balance of user in one currency, it may go negative by the credit limit
+type Wallet struct {
+	Currency    string
+	Balance     money.Money
+	CreditLimit money.Money
+	Reserved    money.Money // cash reserved for orders and not yet recognized
+}
+
+// RemainingCredit returns the part of credit limit not used by the balance and reserved cash
+func (w Wallet) RemainingCredit() (money.Money, error) {
+	own, err := w.Balance.Sub(w.Reserved)
+	if err != nil || !own.IsNegative() {
+		return w.CreditLimit, err
+	}
+	credit, err := w.CreditLimit.Add(own)
+	if err != nil || credit.IsNegative() { // limit was lowered below the credit in use
+		return money.New(0, w.CreditLimit.Exponent), err
+	}
+	return credit, nil
+}
+
+const (
+	StateActive = "active"
+	StateFrozen = "frozen" // money can't leave the account, top-ups are accepted if configured
+	StateClosed = "closed" // no operations, the account must be empty to be closed
+)
+
+// StateChange is a request to change state of the account of user, the reason is required
+type StateChange struct {
+	UserID int        `json:"user_id"`
+	State  string     `json:"state"`
+	Reason string     `json:"reason"`
+	Time   *time.Time `json:"time,omitempty"`
+}
+
+// ValidState checks the state is known
+func ValidState(state string) bool {
+	return state == StateActive || state == StateFrozen || state == StateClosed
+}
+
+// CreditLimit is a request to let the wallet of user go negative by the limit
+type CreditLimit struct {
+	UserID   int         `json:"user_id"`
+	Currency string      `json:"currency"`
+	Limit    money.Money `json:"credit_limit"`
 }
 
 type Storage interface {
-	InsertUser(*User) error
 	FindUser(id int) (*User, error)
-	GetUserBalance(id int) (uint64, error)
-	UpdateUserBalance(*User) error
+	GetUserBalance(id int, currency string) (*Wallet, error)
+	GetUserWallets(id int) ([]Wallet, error)
+	AddBalance(*User) error
+	SetCreditLimit(id int, limit money.Money, currency string) error
 	DeleteAllUsers() error
 }
+
+type StateStorage interface {
+	GetState(id int) (string, error)
+	SetState(StateChange) error
+}
@@ -0,0 +1,85 @@
+package voucher
+
+import (
+	"crypto/rand"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/antsrp/balance_service/internal/money"
+	"github.com/pkg/errors"
+)
+
+const (
+	MaxBatchSize = 1000
+
+	// letters and digits that can't be confused with each other
+	alphabet   = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	groups     = 3
+	groupSize  = 4
+	groupDelim = "-"
+)
+
+const (
+	InvalidCount = "Number of vouchers in batch is out of range"
+)
+
+var ErrInvalidCount = errors.New(InvalidCount)
+
+// Batch is a set of one-time vouchers of the same value generated together
+type Batch struct {
+	ID        int         `json:"id,omitempty"`
+	Count     int         `json:"count"`
+	Value     money.Money `json:"value" swaggertype:"string"`
+	Currency  string      `json:"currency"`
+	ExpiresAt *time.Time  `json:"expires_at"`
+	Vouchers  []Voucher   `json:"vouchers,omitempty"`
+}
+
+// Voucher tops up the balance of user who redeems it by its value, once and before it expires
+type Voucher struct {
+	ID            int         `json:"id"`
+	BatchID       int         `json:"batch_id"`
+	Code          string      `json:"code"`
+	Value         money.Money `json:"value" swaggertype:"string"`
+	Currency      string      `json:"currency"`
+	ExpiresAt     time.Time   `json:"expires_at"`
+	RedeemedBy    int         `json:"redeemed_by,omitempty"`
+	RedeemedAt    *time.Time  `json:"redeemed_at,omitempty"`
+	TransactionID int         `json:"transaction_id,omitempty"` // top-up made by the redemption
+}
+
+// Redemption is a request of user to redeem the voucher
+type Redemption struct {
+	UserID int    `json:"user_id"`
+	Code   string `json:"code"`
+}
+
+type Storage interface {
+	CreateBatch(*Batch) error
+	GetVouchers(batchID int) ([]Voucher, error)
+	Redeem(Redemption) (*Voucher, error)
+	DeleteAllVouchers() error
+}
+
+// GenerateCode returns a random code of groups of letters and digits
+func GenerateCode() (string, error) {
+	var b strings.Builder
+	max := big.NewInt(int64(len(alphabet)))
+	for i := 0; i < groups*groupSize; i++ {
+		if i > 0 && i%groupSize == 0 {
+			b.WriteString(groupDelim)
+		}
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", errors.Wrap(err, "can't generate code of voucher")
+		}
+		b.WriteByte(alphabet[n.Int64()])
+	}
+	return b.String(), nil
+}
+
+// NormalizeCode brings the code from input to the generated form, codes don't depend on case
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
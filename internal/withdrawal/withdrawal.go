@@ -0,0 +1,64 @@
+package withdrawal
+
+import (
+	"time"
+
+	"github.com/antsrp/balance_service/internal/money"
+	"github.com/pkg/errors"
+)
+
+// statuses of withdrawals
+const (
+	StatusPending  = "pending"  // amount is held until the request is decided
+	StatusApproved = "approved" // amount is debited from the wallet
+	StatusRejected = "rejected" // hold is released
+)
+
+const InvalidStatus = "Invalid status of withdrawal"
+
+var ErrInvalidStatus = errors.New(InvalidStatus)
+
+// Withdrawal is a request to take money out of the wallet of user, it is decided by another admin than the one requested it
+type Withdrawal struct {
+	ID            int         `json:"id,omitempty"`
+	UserID        int         `json:"user_id"`
+	Amount        money.Money `json:"amount" swaggertype:"string"`
+	Currency      string      `json:"currency"`
+	Comment       string      `json:"comment,omitempty"`
+	Status        string      `json:"status" enums:"pending,approved,rejected"`
+	RequestedBy   string      `json:"requested_by"`
+	TransactionID int         `json:"transaction_id,omitempty"` // transaction holding the amount, it is completed by approval
+	Events        []Event     `json:"events,omitempty"`
+}
+
+// Event is a change of status of the withdrawal made by the actor
+type Event struct {
+	Status string    `json:"status"`
+	Actor  string    `json:"actor"`
+	Reason string    `json:"reason,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// Decision is an approval or rejection of the pending withdrawal
+type Decision struct {
+	ID     int    `json:"id"`
+	Actor  string `json:"actor"`
+	Reason string `json:"reason"`
+	Status string `json:"-"`
+}
+
+type Storage interface {
+	Request(*Withdrawal) error
+	GetWithdrawals(userID int, status string) ([]Withdrawal, error)
+	Decide(Decision) (*Withdrawal, error)
+	DeleteAllWithdrawals() error
+}
+
+// ValidStatus checks the status is known
+func ValidStatus(status string) bool {
+	switch status {
+	case StatusPending, StatusApproved, StatusRejected:
+		return true
+	}
+	return false
+}